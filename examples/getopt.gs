@@ -0,0 +1,22 @@
+#!/usr/bin/env gisp
+;
+; Greet each name given on the command line:
+;
+;     ./getopt.gs -n 2 -greeting=Hi -shout Ann Bob
+;
+; The same program as getopt.gisp, in s-expression syntax.
+;
+(define (greet line n)
+  (if (> n 0)
+      (begin
+        (display line)
+        (newline)
+        (greet line (- n 1)))))
+
+(receive (opts names) (getopt (rest *argv*) {greeting: "Hello" n: 1 shout: #f})
+  (map
+   (lambda (name)
+     (let ((line (stringAppend (mapGet opts 'greeting) ", " name "!")))
+       (greet (if (mapGet opts 'shout) (stringUpper line) line)
+              (mapGet opts 'n))))
+   (if (nullp names) '("world") names)))
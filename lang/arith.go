@@ -0,0 +1,113 @@
+package lang
+
+import "math"
+
+// Calls of the builtin arithmetic and comparison primitives on two integer
+// variables or constants, such as (+ i 1) or (< i n), dominate numeric
+// loops. The evaluator recognises them when it reaches the call and
+// computes the result in place: the operands are looked up directly, so no
+// frame is pushed and no argument slice is built. A call whose operator is
+// not one of those builtins, whose operands need evaluating, or whose
+// result does not fit an integer takes the general path, which gives the
+// same result.
+
+// intOp computes a binary operation on two integers, reporting false when
+// the general primitive must handle it.
+type intOp func(x, y int64) (Value, bool)
+
+// intOps lists the primitives with a fast path by the names under which
+// SealBuiltins finds them.
+var intOps = map[string]intOp{
+	"+": func(x, y int64) (Value, bool) {
+		sum := x + y
+		return IntValue(sum), (sum > x) == (y > 0)
+	},
+	"-": func(x, y int64) (Value, bool) {
+		diff := x - y
+		return IntValue(diff), (diff < x) == (y > 0)
+	},
+	"*": func(x, y int64) (Value, bool) {
+		if x == 0 || y == 0 {
+			return IntValue(0), true
+		}
+		if (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64) {
+			return Value{}, false
+		}
+		prod := x * y
+		return IntValue(prod), prod/y == x
+	},
+	"<":  func(x, y int64) (Value, bool) { return BoolValue(x < y), true },
+	"<=": func(x, y int64) (Value, bool) { return BoolValue(x <= y), true },
+	">":  func(x, y int64) (Value, bool) { return BoolValue(x > y), true },
+	">=": func(x, y int64) (Value, bool) { return BoolValue(x >= y), true },
+	"=":  func(x, y int64) (Value, bool) { return BoolValue(x == y), true },
+	"==": func(x, y int64) (Value, bool) { return BoolValue(x == y), true },
+}
+
+// sealIntOps records the fast path of each builtin in intOps. It is keyed
+// by primitive rather than by name, so a call reaches it through any
+// binding of the builtin and never through a redefinition.
+func (ev *Evaluator) sealIntOps() {
+	ev.intOps = make(map[*primitive]intOp, len(intOps))
+	for name, op := range intOps {
+		if p, ok := ev.builtins[name].payload.(*primitive); ok {
+			ev.intOps[p] = op
+		}
+	}
+}
+
+// fastArith evaluates the call in pair, whose operator has the value
+// operator, when it qualifies for the fast path, and reports whether it
+// did.
+func (ev *Evaluator) fastArith(state *evalState, operator Value, pair *Pair) bool {
+	if ev.NoFastArith || len(ev.intOps) == 0 {
+		return false
+	}
+	p, ok := operator.payload.(*primitive)
+	if !ok {
+		return false
+	}
+	op, ok := ev.intOps[p]
+	if !ok {
+		return false
+	}
+	first := pair.Rest.Pair()
+	if first == nil {
+		return false
+	}
+	second := first.Rest.Pair()
+	if second == nil || second.Rest.Type != TypeEmpty {
+		return false
+	}
+	x, ok := intOperand(state.env, first)
+	if !ok {
+		return false
+	}
+	y, ok := intOperand(state.env, second)
+	if !ok {
+		return false
+	}
+	val, ok := op(x, y)
+	if !ok {
+		return false
+	}
+	state.value = val
+	state.returning = true
+	return true
+}
+
+// intOperand returns the integer value of the operand at the head of site
+// when it is an integer constant or a variable bound to an integer.
+func intOperand(env *Env, site *Pair) (int64, bool) {
+	v := site.First
+	if v.Type == TypeSymbol {
+		var err error
+		if v, err = env.lookupAt(site, v.Sym()); err != nil {
+			return 0, false
+		}
+	}
+	if v.Type != TypeInt {
+		return 0, false
+	}
+	return v.Int(), true
+}
@@ -0,0 +1,169 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// While a program runs, the evaluator keeps the calls of closures still in
+// progress, so that an error escaping the evaluation can list them. A call
+// in tail position replaces its caller in the list, as it does on the
+// stack, and closures called by primitives, such as the function given to
+// map, are not listed. Neither are procedures whose names start with "__",
+// which is how compilers such as Gisp's name the helpers they generate for
+// loops.
+
+// DefaultBacktraceDepth is the number of calls listed when
+// Evaluator.BacktraceDepth is zero.
+const DefaultBacktraceDepth = 20
+
+// Call is a call of a procedure in progress when an error was raised.
+type Call struct {
+	Name string     // the operator as written, such as f or obj.method
+	Pos  *SourcePos // where the call is, nil when unknown
+}
+
+func (c Call) String() string {
+	if c.Pos == nil {
+		return "in " + c.Name
+	}
+	return "in " + c.Name + ", called at " + c.Pos.String()
+}
+
+// BacktraceError is an error with the calls that were in progress when it
+// was raised, innermost first. Its message lists them below the message of
+// Err, one per line.
+type BacktraceError struct {
+	Err   error
+	Calls []Call
+	More  int // calls left out by Evaluator.BacktraceDepth
+}
+
+func (e *BacktraceError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	for _, c := range e.Calls {
+		b.WriteString("\n  ")
+		b.WriteString(c.String())
+	}
+	if e.More > 0 {
+		fmt.Fprintf(&b, "\n  ... %d more", e.More)
+	}
+	return b.String()
+}
+
+func (e *BacktraceError) Unwrap() error { return e.Err }
+
+// Backtrace returns the calls recorded on err, innermost first.
+func Backtrace(err error) []Call {
+	var traced *BacktraceError
+	if errors.As(err, &traced) {
+		return traced.Calls
+	}
+	return nil
+}
+
+// WithBacktrace returns err with calls, innermost first, added to its
+// backtrace. An error already carrying one comes from an evaluation nested
+// in these calls, so they go after the calls it lists. Jumps and errors
+// raised by the embedder's limits are returned unchanged, as is err when
+// no call is listed or backtraces are turned off.
+func (ev *Evaluator) WithBacktrace(err error, calls []Call) error {
+	limit := ev.BacktraceDepth
+	if limit == 0 {
+		limit = DefaultBacktraceDepth
+	}
+	if limit < 0 {
+		return err
+	}
+	if _, ok := err.(*Jump); ok {
+		return err
+	}
+	if errors.Is(err, ErrFuelExhausted) || errors.Is(err, ErrInterrupted) || errors.Is(err, ErrDepthExceeded) {
+		return err
+	}
+	traced := &BacktraceError{Err: err}
+	nested := errors.As(err, &traced)
+	for _, c := range calls {
+		if strings.HasPrefix(c.Name, "__") {
+			continue
+		}
+		if len(traced.Calls) < limit {
+			traced.Calls = append(traced.Calls, c)
+		} else {
+			traced.More++
+		}
+	}
+	if nested || len(traced.Calls) == 0 {
+		return err
+	}
+	return traced
+}
+
+// OperatorName returns the name a backtrace gives to a call whose operator
+// is the form head: a variable's name, obj.name for a field of a struct,
+// module or object as Gisp compiles it, or "<anonymous>".
+func OperatorName(head Value) string {
+	if head.Type == TypeSymbol {
+		return head.Sym()
+	}
+	if forms, err := ToSlice(head); err == nil && len(forms) == 3 &&
+		forms[0].Type == TypeSymbol && forms[0].Sym() == "getField" {
+		if field, ok := quotedSymbol(forms[2]); ok {
+			return OperatorName(forms[1]) + "." + field
+		}
+	}
+	return "<anonymous>"
+}
+
+// quotedSymbol returns the name of the symbol in the form (quote name).
+func quotedSymbol(v Value) (string, bool) {
+	forms, err := ToSlice(v)
+	if err != nil || len(forms) != 2 || forms[0].Type != TypeSymbol || forms[0].Sym() != "quote" || forms[1].Type != TypeSymbol {
+		return "", false
+	}
+	return forms[1].Sym(), true
+}
+
+// callRecord is a call of a closure in progress, kept by the interpreter
+// until the stack unwinds below the depth at which the closure was entered.
+type callRecord struct {
+	form  *Pair
+	pos   *SourcePos
+	depth int
+}
+
+// enterCall records the call form entering a closure, replacing the calls
+// it returns to directly, which are tail calls.
+func (st *evalState) enterCall(form *Pair) {
+	depth := len(st.cont)
+	n := len(st.calls)
+	for n > 0 && st.calls[n-1].depth >= depth {
+		n--
+	}
+	st.calls = append(st.calls[:n], callRecord{form: form, pos: st.pos, depth: depth})
+}
+
+// leaveCalls forgets the calls that have returned, those entered deeper
+// than the stack now is.
+func (st *evalState) leaveCalls() {
+	n := len(st.calls)
+	for n > 0 && st.calls[n-1].depth > len(st.cont) {
+		n--
+	}
+	st.calls = st.calls[:n]
+}
+
+// backtrace returns the calls in progress, innermost first.
+func (st *evalState) backtrace() []Call {
+	var calls []Call
+	for i := len(st.calls) - 1; i >= 0; i-- {
+		rec := st.calls[i]
+		if rec.depth > len(st.cont) {
+			continue
+		}
+		calls = append(calls, Call{Name: OperatorName(rec.form.First), Pos: rec.pos})
+	}
+	return calls
+}
@@ -0,0 +1,41 @@
+package lang
+
+import "math/big"
+
+// BigIntValue constructs an integer Value from b. An integer that fits in
+// int64 is stored as TypeInt, so that every integer has one representation
+// and TypeBigInt always holds a value beyond the int64 range. The Value takes
+// ownership of b, which must not be modified afterwards.
+func BigIntValue(b *big.Int) Value {
+	if b.IsInt64() {
+		return IntValue(b.Int64())
+	}
+	return Value{Type: TypeBigInt, payload: b}
+}
+
+// BigInt returns the integer held by v as a big.Int: the payload of a
+// TypeBigInt value or a new big.Int for a TypeInt value. It returns nil for
+// other types. The result is shared with v and must not be modified.
+func (v Value) BigInt() *big.Int {
+	switch v.Type {
+	case TypeInt:
+		return big.NewInt(v.Int())
+	case TypeBigInt:
+		if b, ok := v.payload.(*big.Int); ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// IsInteger reports whether v is an integer of either representation.
+func IsInteger(v Value) bool {
+	return v.Type == TypeInt || v.Type == TypeBigInt
+}
+
+// bigToFloat converts b to the nearest float64, which is an infinity when b
+// is beyond the float64 range.
+func bigToFloat(b *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(b).Float64()
+	return f
+}
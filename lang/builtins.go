@@ -0,0 +1,62 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+)
+
+// ShadowPolicy selects what happens when a global definition or assignment
+// replaces a builtin recorded by SealBuiltins.
+type ShadowPolicy int
+
+const (
+	// ShadowAllow replaces builtins silently; it is the default.
+	ShadowAllow ShadowPolicy = iota
+	// ShadowWarn replaces the builtin and prints a warning.
+	ShadowWarn
+	// ShadowError rejects the definition.
+	ShadowError
+)
+
+// SealBuiltins records the current global bindings as the builtins. They
+// stay reachable through Builtin even after user code redefines them, and
+// redefinitions are reported according to the Shadow policy.
+func (ev *Evaluator) SealBuiltins() {
+	names := ev.Global.Names()
+	ev.builtins = make(map[string]Value, len(names))
+	for _, name := range names {
+		ev.builtins[name], _ = ev.Global.Own(name)
+	}
+	ev.sealIntOps()
+}
+
+// Builtin returns the original value of a builtin recorded by SealBuiltins.
+func (ev *Evaluator) Builtin(name string) (Value, bool) {
+	val, ok := ev.builtins[name]
+	return val, ok
+}
+
+// SetWarningOutput redirects warnings; they default to the evaluator's
+// error stream.
+func (ev *Evaluator) SetWarningOutput(w io.Writer) {
+	ev.warnOut = w
+}
+
+// checkShadow applies the Shadow policy before name is rebound in env.
+func (ev *Evaluator) checkShadow(name string, env *Env) error {
+	if ev.Shadow == ShadowAllow || env != ev.Global {
+		return nil
+	}
+	if _, ok := ev.builtins[name]; !ok {
+		return nil
+	}
+	if ev.Shadow == ShadowError {
+		return fmt.Errorf("cannot redefine builtin %s", name)
+	}
+	out := ev.warnOut
+	if out == nil {
+		out = ev.Stderr()
+	}
+	fmt.Fprintf(out, "warning: redefining builtin %s; use builtin(%q) to reach the original\n", name, name)
+	return nil
+}
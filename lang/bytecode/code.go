@@ -0,0 +1,139 @@
+package bytecode
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// opcode selects the operation of an instruction. Each instruction has two
+// integer operands, a and b, whose meaning depends on the opcode.
+type opcode uint8
+
+const (
+	opConst       opcode = iota // push consts[a]
+	opLocal                     // push names[b], bound a frames up
+	opGlobal                    // push names[b], searching from a frames up
+	opSetLocal                  // assign the top value to names[b], bound a frames up
+	opSetGlobal                 // assign the top value to names[b], searching the chain
+	opDefine                    // bind names[b] to the top value in the current frame
+	opPop                       // discard the top value
+	opJump                      // continue at a
+	opJumpIfFalse               // pop a value and continue at a when it is false
+	opClosure                   // push a closure of protos[a] over the current frame
+	opCall                      // call the procedure below the top a values with them; names[b] is its name for backtraces
+	opTailCall                  // opCall in place of the current frame
+	opReturn                    // return the top value to the caller
+	opCallCC                    // call the procedure on top with the current continuation, one-shot when a is 1
+	opTailCallCC                // opCallCC in place of the current frame
+	opCapture                   // bind names[b] to the continuation resuming at a, in a new frame
+	opLet                       // bind the top len(lets[a]) values to lets[a], in a new frame
+	opPopEnv                    // go back to the parent of the current frame
+	opInterpret                 // push the value of consts[a] as the interpreter evaluates it
+	opFail                      // raise errs[a]
+)
+
+var opNames = [...]string{
+	opConst:       "const",
+	opLocal:       "local",
+	opGlobal:      "global",
+	opSetLocal:    "setlocal",
+	opSetGlobal:   "setglobal",
+	opDefine:      "define",
+	opPop:         "pop",
+	opJump:        "jump",
+	opJumpIfFalse: "jumpiffalse",
+	opClosure:     "closure",
+	opCall:        "call",
+	opTailCall:    "tailcall",
+	opReturn:      "return",
+	opCallCC:      "callcc",
+	opTailCallCC:  "tailcallcc",
+	opCapture:     "capture",
+	opLet:         "let",
+	opPopEnv:      "popenv",
+	opInterpret:   "interpret",
+	opFail:        "fail",
+}
+
+func (op opcode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("op%d", op)
+}
+
+// instr is a single instruction.
+type instr struct {
+	op   opcode
+	a, b int32
+}
+
+// proto is the compiled form of a lambda expression, shared by every
+// closure made from it. Its code is compiled when one of them is first
+// called, so macros defined after the lambda was evaluated still expand.
+type proto struct {
+	params []string
+	rest   string
+	body   []lang.Value
+	outer  *scope // the scope the lambda appears in
+	thunk  bool   // runs in the frame it is given rather than a new one
+
+	once     sync.Once // compiles the code on the first call
+	code     []instr
+	where    []*lang.SourcePos // position of the form each instruction is from
+	consts   []lang.Value
+	names    []string
+	lets     [][]string
+	protos   []*proto
+	errs     []error
+	maxStack int
+}
+
+// String disassembles the code of p, one instruction per line.
+func (p *proto) String() string {
+	var b strings.Builder
+	for pc, in := range p.code {
+		fmt.Fprintf(&b, "%4d  %-12s", pc, in.op)
+		switch in.op {
+		case opConst, opInterpret:
+			fmt.Fprintf(&b, " %s", p.consts[in.a].String())
+		case opLocal, opGlobal, opSetLocal:
+			fmt.Fprintf(&b, " %d %s", in.a, p.names[in.b])
+		case opSetGlobal, opDefine:
+			fmt.Fprintf(&b, " %s", p.names[in.b])
+		case opCapture:
+			fmt.Fprintf(&b, " %d %s", in.a, p.names[in.b])
+		case opJump, opJumpIfFalse:
+			fmt.Fprintf(&b, " %d", in.a)
+		case opCallCC, opTailCallCC:
+			if in.a == 1 {
+				b.WriteString(" oneshot")
+			}
+		case opCall, opTailCall:
+			fmt.Fprintf(&b, " %d %s", in.a, p.names[in.b])
+		case opClosure:
+			fmt.Fprintf(&b, " %s", p.protos[in.a].signature())
+		case opLet:
+			fmt.Fprintf(&b, " %s", strings.Join(p.lets[in.a], " "))
+		case opFail:
+			fmt.Fprintf(&b, " %v", p.errs[in.a])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// signature formats the parameter list of p as a lambda form writes it.
+func (p *proto) signature() string {
+	list := "(" + strings.Join(p.params, " ")
+	switch {
+	case p.rest != "" && len(p.params) == 0:
+		return p.rest
+	case p.rest != "":
+		list += " . " + p.rest
+	}
+	return list + ")"
+}
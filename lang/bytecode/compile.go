@@ -0,0 +1,739 @@
+package bytecode
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// The compiler turns the body of a lambda expression into code for one
+// frame. Variables bound by the enclosing lambda and let forms are known
+// at compile time, so a reference to one goes straight to the frame that
+// holds it; other names are searched for from the first frame the
+// compiler knows nothing about. Macro calls are expanded as they are
+// compiled, and catch, unwind-protect and define-macro forms are left to
+// the interpreter.
+//
+// Gisp compiles return, break and continue to
+// (call/cc (lambda (k) body...)), with k called on the result at the end of
+// body. Such a form is compiled in line: at the end of body, where a call
+// of k is the same as returning its argument, the call is replaced by the
+// argument, so a function returning the result of another call makes a
+// tail call. The continuation is captured only when body uses k in any
+// other way.
+
+// scope is the compile-time picture of a frame: the names the compiler
+// knows it binds.
+type scope struct {
+	names  []string
+	parent *scope
+}
+
+func (s *scope) add(name string) {
+	if !slices.Contains(s.names, name) {
+		s.names = append(s.names, name)
+	}
+}
+
+// ctx describes the position of the expression being compiled.
+type ctx struct {
+	tail    bool     // its value is returned from the frame
+	escapes []string // continuations whose in-line call/cc body it ends
+}
+
+// shadow returns c without the escapes named in names, which an inner
+// binding hides.
+func (c ctx) shadow(names []string) ctx {
+	var kept []string
+	for _, k := range c.escapes {
+		if !slices.Contains(names, k) {
+			kept = append(kept, k)
+		}
+	}
+	c.escapes = kept
+	return c
+}
+
+type compiler struct {
+	ev    *lang.Evaluator
+	env   *lang.Env // where macros are looked up
+	p     *proto
+	scope *scope
+	sp    int             // operand stack depth
+	pos   *lang.SourcePos // innermost form with a position being compiled
+}
+
+// compile compiles the code of p. Its closures run in env's children, or
+// in env itself for a thunk.
+func (p *proto) compile(ev *lang.Evaluator, env *lang.Env) {
+	c := &compiler{ev: ev, env: env, p: p, scope: p.outer}
+	if !p.thunk {
+		names := append([]string(nil), p.params...)
+		if p.rest != "" {
+			names = append(names, p.rest)
+		}
+		c.scope = &scope{names: append(names, definedNames(p.body)...), parent: p.outer}
+	}
+	c.body(p.body, ctx{tail: true})
+}
+
+func (c *compiler) emit(op opcode, a, b int) int {
+	c.p.code = append(c.p.code, instr{op: op, a: int32(a), b: int32(b)})
+	c.p.where = append(c.p.where, c.pos)
+	return len(c.p.code) - 1
+}
+
+// patch makes the jump at pc go to the next instruction emitted.
+func (c *compiler) patch(pc int) {
+	c.p.code[pc].a = int32(len(c.p.code))
+}
+
+func (c *compiler) push(n int) {
+	c.sp += n
+	if c.sp > c.p.maxStack {
+		c.p.maxStack = c.sp
+	}
+}
+
+func (c *compiler) name(name string) int {
+	if i := slices.Index(c.p.names, name); i >= 0 {
+		return i
+	}
+	c.p.names = append(c.p.names, name)
+	return len(c.p.names) - 1
+}
+
+func (c *compiler) constant(v lang.Value) {
+	c.p.consts = append(c.p.consts, v)
+	c.emit(opConst, len(c.p.consts)-1, 0)
+	c.push(1)
+}
+
+// ret returns the value on top of the stack when k is a tail position.
+func (c *compiler) ret(k ctx) {
+	if k.tail {
+		c.emit(opReturn, 0, 0)
+		c.sp--
+	}
+}
+
+// lookup returns how many frames up name is bound, if the compiler knows.
+func (c *compiler) lookup(name string) (int, bool) {
+	depth := 0
+	for s := c.scope; s != nil; s = s.parent {
+		if slices.Contains(s.names, name) {
+			return depth, true
+		}
+		depth++
+	}
+	return 0, false
+}
+
+// frames returns the number of frames the compiler knows about.
+func (c *compiler) frames() int {
+	n := 0
+	for s := c.scope; s != nil; s = s.parent {
+		n++
+	}
+	return n
+}
+
+// compile compiles x. A form the interpreter would reject when it reached
+// it compiles to an instruction raising the same error, so that errors in
+// code that never runs go unnoticed as they do there. The instructions
+// are marked with the position of x, when it has one, for error messages.
+func (c *compiler) compile(x lang.Value, k ctx) {
+	if pos, ok := lang.Position(x); ok {
+		defer func(outer *lang.SourcePos) { c.pos = outer }(c.pos)
+		c.pos = &pos
+	}
+	mark, sp, sc := len(c.p.code), c.sp, c.scope
+	if err := c.expr(x, k); err != nil {
+		c.p.code, c.p.where, c.sp, c.scope = c.p.code[:mark], c.p.where[:mark], sp, sc
+		c.p.errs = append(c.p.errs, err)
+		c.emit(opFail, len(c.p.errs)-1, 0)
+		if !k.tail {
+			c.push(1)
+		}
+	}
+}
+
+func (c *compiler) expr(x lang.Value, k ctx) error {
+	switch x.Type {
+	case lang.TypeSymbol:
+		name := x.Sym()
+		if depth, ok := c.lookup(name); ok {
+			c.emit(opLocal, depth, c.name(name))
+		} else {
+			c.emit(opGlobal, c.frames(), c.name(name))
+		}
+		c.push(1)
+	case lang.TypePair:
+		return c.pair(x, k)
+	default:
+		c.constant(x)
+	}
+	c.ret(k)
+	return nil
+}
+
+// body compiles a sequence whose last expression gives its value.
+func (c *compiler) body(exprs []lang.Value, k ctx) {
+	if len(exprs) == 0 {
+		c.constant(lang.EmptyList)
+		c.ret(k)
+		return
+	}
+	for _, x := range exprs[:len(exprs)-1] {
+		c.compile(x, ctx{})
+		c.emit(opPop, 0, 0)
+		c.sp--
+	}
+	c.compile(exprs[len(exprs)-1], k)
+}
+
+func (c *compiler) pair(x lang.Value, k ctx) error {
+	pair := x.Pair()
+	if pair == nil {
+		return fmt.Errorf("expected pair value")
+	}
+	head, rest := pair.First, pair.Rest
+	if head.Type == lang.TypeSymbol {
+		name := head.Sym()
+		switch name {
+		case "quote":
+			return c.quote(rest, k)
+		case "if":
+			return c.ifForm(rest, k)
+		case "begin":
+			exprs, err := lang.ToSlice(rest)
+			if err != nil {
+				return err
+			}
+			c.body(exprs, k)
+			return nil
+		case "lambda":
+			return c.lambda(rest, k)
+		case "define":
+			return c.define(rest, k)
+		case "set!":
+			return c.set(rest, k)
+		case "let":
+			return c.let(rest, k)
+		case "quasiquote":
+			return c.quasiquote(rest, k)
+		case "call/cc", "call/1cc":
+			return c.callCC(name, rest, k)
+		case "cond":
+			return c.cond(rest, k)
+		case "define-macro", "catch", "unwind-protect":
+			c.p.consts = append(c.p.consts, x)
+			c.emit(opInterpret, len(c.p.consts)-1, 0)
+			c.push(1)
+			c.ret(k)
+			return nil
+		}
+		if slices.Contains(k.escapes, name) {
+			if args, err := lang.ToSlice(rest); err == nil && len(args) == 1 {
+				c.compile(args[0], k)
+				return nil
+			}
+		}
+		if _, local := c.lookup(name); !local {
+			if val, err := c.env.Get(name); err == nil && val.Type == lang.TypeMacro {
+				steps, err := c.ev.MacroexpandSteps(x, c.env)
+				if err != nil {
+					return err
+				}
+				c.compile(steps[len(steps)-1], k)
+				return nil
+			}
+		}
+	}
+	args, err := lang.ToSlice(rest)
+	if err != nil {
+		return fmt.Errorf("malformed argument list")
+	}
+	c.compile(head, ctx{})
+	for _, arg := range args {
+		c.compile(arg, ctx{})
+	}
+	callee := c.name(lang.OperatorName(head))
+	if k.tail {
+		c.emit(opTailCall, len(args), callee)
+		c.sp -= len(args) + 1
+	} else {
+		c.emit(opCall, len(args), callee)
+		c.sp -= len(args)
+	}
+	return nil
+}
+
+func (c *compiler) quote(args lang.Value, k ctx) error {
+	exprs, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(exprs) != 1 {
+		return fmt.Errorf("quote expects 1 argument")
+	}
+	c.constant(exprs[0])
+	c.ret(k)
+	return nil
+}
+
+func (c *compiler) ifForm(args lang.Value, k ctx) error {
+	parts, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("if expects 2 or 3 arguments")
+	}
+	alt := lang.EmptyList
+	if len(parts) == 3 {
+		alt = parts[2]
+	}
+	c.compile(parts[0], ctx{})
+	skip := c.emit(opJumpIfFalse, 0, 0)
+	c.sp--
+	c.compile(parts[1], k)
+	if k.tail {
+		c.patch(skip)
+		c.compile(alt, k)
+		return nil
+	}
+	end := c.emit(opJump, 0, 0)
+	c.patch(skip)
+	c.sp--
+	c.compile(alt, k)
+	c.patch(end)
+	return nil
+}
+
+func (c *compiler) cond(args lang.Value, k ctx) error {
+	clauses, err := lang.ToSlice(args)
+	if err != nil {
+		return fmt.Errorf("cond expects a list of clauses: %w", err)
+	}
+	var ends []int
+	for i, clause := range clauses {
+		items, err := lang.ToSlice(clause)
+		if err != nil {
+			return fmt.Errorf("cond clause must be a list: %w", err)
+		}
+		if len(items) != 2 {
+			return fmt.Errorf("cond clause must have predicate and result expression")
+		}
+		if items[0].Type == lang.TypeSymbol && items[0].Sym() == "else" {
+			if i != len(clauses)-1 {
+				return fmt.Errorf("cond else clause must be last")
+			}
+			c.compile(items[1], k)
+			for _, end := range ends {
+				c.patch(end)
+			}
+			return nil
+		}
+		c.compile(items[0], ctx{})
+		next := c.emit(opJumpIfFalse, 0, 0)
+		c.sp--
+		c.compile(items[1], k)
+		if !k.tail {
+			ends = append(ends, c.emit(opJump, 0, 0))
+			c.sp--
+		}
+		c.patch(next)
+	}
+	c.constant(lang.EmptyList)
+	c.ret(k)
+	for _, end := range ends {
+		c.patch(end)
+	}
+	return nil
+}
+
+func (c *compiler) lambda(args lang.Value, k ctx) error {
+	parts, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(parts) < 2 {
+		return fmt.Errorf("lambda expects parameters and body")
+	}
+	params, rest, err := lang.ParseParams(parts[0])
+	if err != nil {
+		return err
+	}
+	c.closure(params, rest, parts[1:])
+	c.ret(k)
+	return nil
+}
+
+func (c *compiler) closure(params []string, rest string, body []lang.Value) {
+	c.p.protos = append(c.p.protos, &proto{params: params, rest: rest, body: body, outer: c.scope})
+	c.emit(opClosure, len(c.p.protos)-1, 0)
+	c.push(1)
+}
+
+func (c *compiler) define(args lang.Value, k ctx) error {
+	parts, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(parts) < 2 {
+		return fmt.Errorf("define expects a name and value")
+	}
+	target, body := parts[0], parts[1:]
+	var name string
+	switch target.Type {
+	case lang.TypeSymbol:
+		if len(body) != 1 {
+			return fmt.Errorf("define expects a single value expression")
+		}
+		name = target.Sym()
+		c.compile(body[0], ctx{})
+	case lang.TypePair:
+		head := target.Pair()
+		if head == nil {
+			return fmt.Errorf("invalid function definition target")
+		}
+		if head.First.Type != lang.TypeSymbol {
+			return fmt.Errorf("function name in define must be a symbol")
+		}
+		params, rest, err := lang.ParseParams(head.Rest)
+		if err != nil {
+			return err
+		}
+		name = head.First.Sym()
+		if c.scope != nil {
+			c.scope.add(name)
+		}
+		c.closure(params, rest, body)
+	default:
+		return fmt.Errorf("invalid define target")
+	}
+	c.emit(opDefine, 0, c.name(name))
+	if c.scope != nil {
+		c.scope.add(name)
+	}
+	c.ret(k)
+	return nil
+}
+
+func (c *compiler) set(args lang.Value, k ctx) error {
+	parts, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(parts) != 2 {
+		return fmt.Errorf("set! expects a name and value")
+	}
+	if parts[0].Type != lang.TypeSymbol {
+		return fmt.Errorf("set! target must be a symbol")
+	}
+	name := parts[0].Sym()
+	c.compile(parts[1], ctx{})
+	if depth, ok := c.lookup(name); ok {
+		c.emit(opSetLocal, depth, c.name(name))
+	} else {
+		c.emit(opSetGlobal, 0, c.name(name))
+	}
+	c.ret(k)
+	return nil
+}
+
+func (c *compiler) let(args lang.Value, k ctx) error {
+	parts, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(parts) < 2 {
+		return fmt.Errorf("let expects bindings and body")
+	}
+	bindings := parts[0]
+	bodyStart := 1
+	var letName string
+	if bindings.Type == lang.TypeSymbol {
+		letName = bindings.Sym()
+		if len(parts) < 3 {
+			return fmt.Errorf("named let expects bindings and body")
+		}
+		bindings = parts[1]
+		bodyStart = 2
+	}
+	body := parts[bodyStart:]
+	var names, values []lang.Value
+	for iter := bindings; iter.Type != lang.TypeEmpty; {
+		iterPair := iter.Pair()
+		if iter.Type != lang.TypePair || iterPair == nil {
+			return fmt.Errorf("invalid binding list")
+		}
+		bind := iterPair.First
+		bPair := bind.Pair()
+		if bind.Type != lang.TypePair || bPair == nil {
+			return fmt.Errorf("binding must be a list")
+		}
+		if bPair.First.Type != lang.TypeSymbol {
+			return fmt.Errorf("binding name must be a symbol")
+		}
+		valueSlice, err := lang.ToSlice(bPair.Rest)
+		if err != nil || len(valueSlice) != 1 {
+			return fmt.Errorf("binding must have exactly one value")
+		}
+		names = append(names, bPair.First)
+		values = append(values, valueSlice[0])
+		iter = iterPair.Rest
+	}
+	if letName != "" {
+		// A named let becomes a let binding the name to its loop
+		// procedure, as the interpreter rewrites it.
+		sym := lang.SymbolValue
+		lambda := lang.List(append([]lang.Value{sym("lambda"), lang.List(names...)}, body...)...)
+		c.compile(lang.List(sym("let"), lang.List(lang.List(sym(letName), lang.EmptyList)),
+			lang.List(sym("set!"), sym(letName), lambda),
+			lang.List(append([]lang.Value{sym(letName)}, values...)...)), k)
+		return nil
+	}
+	var letNames []string
+	for _, name := range names {
+		if slices.Contains(letNames, name.Sym()) {
+			return fmt.Errorf("duplicate parameter %s", name.Sym())
+		}
+		letNames = append(letNames, name.Sym())
+	}
+	for _, value := range values {
+		c.compile(value, ctx{})
+	}
+	c.p.lets = append(c.p.lets, letNames)
+	c.emit(opLet, len(c.p.lets)-1, 0)
+	c.sp -= len(values)
+	outer := c.scope
+	c.scope = &scope{names: append(append([]string(nil), letNames...), definedNames(body)...), parent: outer}
+	c.body(body, k.shadow(letNames))
+	c.scope = outer
+	if !k.tail {
+		c.emit(opPopEnv, 0, 0)
+	}
+	return nil
+}
+
+func (c *compiler) quasiquote(args lang.Value, k ctx) error {
+	exprs, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(exprs) != 1 {
+		return fmt.Errorf("quasiquote expects 1 argument")
+	}
+	expanded, err := lang.ExpandQuasiquote(exprs[0])
+	if err != nil {
+		return err
+	}
+	c.compile(expanded, k)
+	return nil
+}
+
+// callCC compiles a call/cc form, or a call/1cc form, whose continuation
+// is marked one-shot by operand a of the call.
+func (c *compiler) callCC(form string, args lang.Value, k ctx) error {
+	exprs, err := lang.ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(exprs) != 1 {
+		return fmt.Errorf("%s expects single argument", form)
+	}
+	oneShot := 0
+	if form == "call/1cc" {
+		oneShot = 1
+	} else if name, body, ok := escapeLambda(exprs[0]); ok {
+		c.inlineCallCC(name, body, k)
+		return nil
+	}
+	c.compile(exprs[0], ctx{})
+	if k.tail {
+		c.emit(opTailCallCC, oneShot, 0)
+		c.sp--
+	} else {
+		c.emit(opCallCC, oneShot, 0)
+	}
+	return nil
+}
+
+// escapeLambda recognises (lambda (k) body...), the procedure of a call/cc
+// form that is compiled in line.
+func escapeLambda(x lang.Value) (string, []lang.Value, bool) {
+	parts, err := lang.ToSlice(x)
+	if err != nil || len(parts) < 3 || parts[0].Type != lang.TypeSymbol || parts[0].Sym() != "lambda" {
+		return "", nil, false
+	}
+	params, rest, err := lang.ParseParams(parts[1])
+	if err != nil || len(params) != 1 || rest != "" {
+		return "", nil, false
+	}
+	return params[0], parts[2:], true
+}
+
+// inlineCallCC compiles (call/cc (lambda (name) body...)) in line.
+func (c *compiler) inlineCallCC(name string, body []lang.Value, k ctx) {
+	direct, assigned := escapeUse(body, name)
+	inner := k.shadow([]string{name})
+	if !assigned {
+		inner.escapes = append(inner.escapes, name)
+	}
+	defined := definedNames(body)
+	if direct && len(defined) == 0 {
+		c.body(body, inner)
+		return
+	}
+	capture := c.emit(opCapture, 0, c.name(name))
+	outer := c.scope
+	c.scope = &scope{names: append([]string{name}, defined...), parent: outer}
+	c.body(body, inner)
+	c.scope = outer
+	if !k.tail {
+		c.emit(opPopEnv, 0, 0)
+	}
+	c.patch(capture)
+	if k.tail {
+		// A resumed continuation arrives here with its value.
+		c.push(1)
+		c.emit(opReturn, 0, 0)
+		c.sp--
+	}
+}
+
+// escapeUse reports how the body of an in-line call/cc uses the
+// continuation k. direct is set when every reference calls k with one
+// argument at the end of the body, where the compiler replaces the call by
+// the argument, and assigned when the body assigns to k. Forms it does not
+// know, macro calls among them, count as using k in any other way.
+func escapeUse(body []lang.Value, k string) (direct, assigned bool) {
+	u := &use{name: k, direct: true}
+	u.seq(body, true)
+	return u.direct, u.assigned
+}
+
+type use struct {
+	name     string
+	direct   bool
+	assigned bool
+}
+
+func (u *use) seq(exprs []lang.Value, tail bool) {
+	for i, x := range exprs {
+		u.expr(x, tail && i == len(exprs)-1)
+	}
+}
+
+func (u *use) expr(x lang.Value, tail bool) {
+	if x.Type == lang.TypeSymbol && x.Sym() == u.name {
+		u.direct = false
+	}
+	if x.Type != lang.TypePair {
+		return
+	}
+	items, err := lang.ToSlice(x)
+	if err != nil {
+		u.direct = false
+		return
+	}
+	if items[0].Type == lang.TypeSymbol {
+		switch items[0].Sym() {
+		case "quote":
+			return
+		case "if":
+			if len(items) > 1 {
+				u.expr(items[1], false)
+				for _, branch := range items[2:] {
+					u.expr(branch, tail)
+				}
+			}
+			return
+		case "begin":
+			u.seq(items[1:], tail)
+			return
+		case "cond":
+			for _, clause := range items[1:] {
+				parts, err := lang.ToSlice(clause)
+				if err != nil || len(parts) != 2 {
+					u.expr(clause, false)
+					continue
+				}
+				u.expr(parts[0], false)
+				u.expr(parts[1], tail)
+			}
+			return
+		case "let":
+			if len(items) > 2 && items[1].Type != lang.TypeSymbol {
+				shadowed := false
+				for _, bind := range mustSlice(items[1]) {
+					parts := mustSlice(bind)
+					if len(parts) == 2 && parts[0].Type == lang.TypeSymbol && parts[0].Sym() == u.name {
+						shadowed = true
+					}
+					for _, part := range parts[1:] {
+						u.expr(part, false)
+					}
+				}
+				if !shadowed {
+					u.seq(items[2:], tail)
+				}
+				return
+			}
+		case "set!":
+			if len(items) > 1 && items[1].Type == lang.TypeSymbol && items[1].Sym() == u.name {
+				u.assigned = true
+			}
+		case "call/cc":
+			if len(items) == 2 {
+				if name, body, ok := escapeLambda(items[1]); ok {
+					if name != u.name {
+						u.seq(body, tail)
+					}
+					return
+				}
+			}
+		case u.name:
+			if tail && len(items) == 2 {
+				u.expr(items[1], true)
+				return
+			}
+		}
+	}
+	for _, item := range items {
+		u.expr(item, false)
+	}
+}
+
+// mustSlice returns the elements of a proper list, or nil.
+func mustSlice(list lang.Value) []lang.Value {
+	items, _ := lang.ToSlice(list)
+	return items
+}
+
+// definedNames returns the names a body defines in its own frame.
+func definedNames(body []lang.Value) []string {
+	var names []string
+	for _, x := range body {
+		items, err := lang.ToSlice(x)
+		if err != nil || len(items) < 2 || items[0].Type != lang.TypeSymbol {
+			continue
+		}
+		switch items[0].Sym() {
+		case "define":
+			target := items[1]
+			if target.Type == lang.TypePair && target.Pair() != nil {
+				target = target.Pair().First
+			}
+			if target.Type == lang.TypeSymbol {
+				names = append(names, target.Sym())
+			}
+		case "begin":
+			names = append(names, definedNames(items[1:])...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,488 @@
+// Package bytecode compiles Gisp programs to code for a stack machine and
+// runs them, as an alternative to the tree-walking interpreter of package
+// lang. Install it with
+//
+//	ev.Engine = bytecode.New()
+//
+// Programs behave as they do under the interpreter, continuations and the
+// limits set on the evaluator included; only the trace options do not
+// apply to compiled code.
+package bytecode
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Engine compiles and runs programs for an evaluator. It has no state of
+// its own: compiled code is kept with the closures it belongs to.
+type Engine struct{}
+
+// New returns an engine to install as Evaluator.Engine.
+func New() *Engine {
+	return &Engine{}
+}
+
+// Eval compiles expr and runs it in env.
+func (e *Engine) Eval(ev *lang.Evaluator, expr lang.Value, env *lang.Env) (lang.Value, error) {
+	p := &proto{body: []lang.Value{expr}, thunk: true}
+	p.compile(ev, env)
+	m := &machine{ev: ev, active: true}
+	defer func() { m.active = false }()
+	m.f = &frame{proto: p, env: env, stack: make([]lang.Value, 0, p.maxStack), depth: 1}
+	return m.run()
+}
+
+// Apply calls proc with args.
+func (e *Engine) Apply(ev *lang.Evaluator, proc lang.Value, args []lang.Value) (lang.Value, error) {
+	m := &machine{ev: ev, active: true}
+	defer func() { m.active = false }()
+	if err := m.invoke(proc, args, ev.CurrentEnv()); err != nil {
+		if err = m.fail(err); err != nil {
+			return lang.Value{}, err
+		}
+	}
+	return m.run()
+}
+
+// frame is the activation of compiled code or, when then is set, a
+// primitive waiting for the result of a procedure it asked to be applied.
+type frame struct {
+	proto *proto
+	pc    int
+	env   *lang.Env
+	stack []lang.Value
+	then  func(lang.Value) (lang.Value, error)
+	pos   *lang.SourcePos // of the call that made a primitive's frame
+	depth int
+	// call names the call that entered the closure of the frame, for
+	// backtraces; it is empty when a primitive or call/cc called it.
+	call    string
+	callPos *lang.SourcePos
+
+	parent *frame
+	// parentShared is set when a continuation refers to parent too, so
+	// parent must be copied before a value is returned to it.
+	parentShared bool
+}
+
+func (f *frame) clone() *frame {
+	cp := *f
+	cp.stack = append(make([]lang.Value, 0, cap(f.stack)), f.stack...)
+	cp.parentShared = true
+	return &cp
+}
+
+// continuation is the state of a continuation captured by compiled code:
+// a copy of the frame that receives its value, or nil when the value ends
+// the evaluation.
+type continuation struct {
+	m     *machine
+	frame *frame
+}
+
+// machine runs one evaluation. At each moment it either executes the code
+// of f or, with f nil, returns value to the frame to.
+type machine struct {
+	ev     *lang.Evaluator
+	active bool
+
+	f        *frame
+	value    lang.Value
+	to       *frame
+	toShared bool
+	pos      *lang.SourcePos // of the call being made
+	call     string          // name of the call being made
+}
+
+func (m *machine) run() (lang.Value, error) {
+	for {
+		var err error
+		switch {
+		case m.f != nil:
+			f := m.f
+			if err = m.exec(); err != nil {
+				err = lang.AtPosition(err, f.proto.where[f.pc-1])
+				if err = m.fail(err); err != nil {
+					return lang.Value{}, m.ev.WithBacktrace(err, backtrace(f))
+				}
+			}
+		case m.to != nil:
+			g := m.to
+			if err = m.deliver(); err != nil {
+				err = lang.AtPosition(err, g.pos)
+				if err = m.fail(err); err != nil {
+					return lang.Value{}, m.ev.WithBacktrace(err, backtrace(g))
+				}
+			}
+		default:
+			return m.value, nil
+		}
+	}
+}
+
+// backtrace returns the calls in progress in f and the frames it returns
+// to, innermost first.
+func backtrace(f *frame) []lang.Call {
+	var calls []lang.Call
+	for ; f != nil; f = f.parent {
+		if f.call != "" {
+			calls = append(calls, lang.Call{Name: f.call, Pos: f.callPos})
+		}
+	}
+	return calls
+}
+
+// fail resumes the continuation that err jumps to, when it belongs to
+// this evaluation or to one that has finished, and returns err otherwise.
+func (m *machine) fail(err error) error {
+	jump, ok := err.(*lang.Jump)
+	if !ok {
+		return err
+	}
+	k, ok := jump.Cont.State.(*continuation)
+	if !ok || (k.m != m && k.m.active) {
+		return err
+	}
+	m.resume(k, jump.Value)
+	return nil
+}
+
+func (m *machine) resume(k *continuation, v lang.Value) {
+	m.f = nil
+	m.value = v
+	m.to, m.toShared = k.frame, true
+}
+
+// deliver returns value to the frame to.
+func (m *machine) deliver() error {
+	g := m.to
+	if m.toShared {
+		g = g.clone()
+	}
+	m.to = nil
+	if g.then == nil {
+		g.stack = append(g.stack, m.value)
+		m.f = g
+		return nil
+	}
+	m.to, m.toShared = g.parent, g.parentShared
+	m.pos = g.pos
+	val, err := m.ev.CallPrimitive(func(_ *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		return g.then(args[0])
+	}, g.env, []lang.Value{m.value})
+	if err != nil {
+		return err
+	}
+	return m.result(val, g.env)
+}
+
+// result returns val, the result of a primitive called in env, first
+// applying the procedure it asks for when it is a callback.
+func (m *machine) result(val lang.Value, env *lang.Env) error {
+	proc, args, then, ok := lang.SplitCallback(val)
+	if !ok {
+		m.value = val
+		return nil
+	}
+	if then != nil {
+		m.to = &frame{then: then, env: env, pos: m.pos, depth: m.depth(), parent: m.to, parentShared: m.toShared}
+		m.toShared = false
+	}
+	return m.invoke(proc, args, env)
+}
+
+// protoMu guards the Code of closures made by the interpreter, which get
+// their proto when first called, possibly on several goroutines at once.
+var protoMu sync.Mutex
+
+// closureProto returns the proto of c, making one for a closure the
+// interpreter created.
+func closureProto(c *lang.Closure) *proto {
+	protoMu.Lock()
+	defer protoMu.Unlock()
+	p, ok := c.Code.(*proto)
+	if !ok {
+		p = &proto{params: c.Params, rest: c.Rest, body: c.Body}
+		c.Code = p
+	}
+	return p
+}
+
+// depth returns the depth of a frame returning to the frame to.
+func (m *machine) depth() int {
+	if m.to == nil {
+		return 1
+	}
+	return m.to.depth + 1
+}
+
+// invoke calls proc with args, returning its value to the frame to.
+func (m *machine) invoke(proc lang.Value, args []lang.Value, env *lang.Env) error {
+	m.f = nil
+	call := m.call
+	m.call = ""
+	switch proc.Type {
+	case lang.TypePrimitive:
+		fn := proc.Primitive()
+		if fn == nil {
+			return fmt.Errorf("invalid primitive")
+		}
+		val, err := m.ev.CallPrimitive(fn, env, args)
+		if err != nil {
+			return err
+		}
+		return m.result(val, env)
+	case lang.TypeClosure:
+		c := proc.Closure()
+		if c == nil {
+			return fmt.Errorf("invalid closure")
+		}
+		p := closureProto(c)
+		p.once.Do(func() { p.compile(m.ev, c.Env) })
+		frameEnv := lang.NewEnv(c.Env)
+		if err := frameEnv.Bind(p.params, p.rest, args); err != nil {
+			return err
+		}
+		depth := m.depth()
+		if max := m.ev.MaxDepth; max > 0 && depth > max {
+			return fmt.Errorf("%w: more than %d frames", lang.ErrDepthExceeded, max)
+		}
+		m.f = &frame{proto: p, env: frameEnv, stack: make([]lang.Value, 0, p.maxStack), depth: depth, call: call, callPos: m.pos, parent: m.to, parentShared: m.toShared}
+		m.to = nil
+	case lang.TypeContinuation:
+		cont := proc.Continuation()
+		if cont == nil {
+			return fmt.Errorf("invalid continuation")
+		}
+		arg := lang.EmptyList
+		if len(args) > 0 {
+			arg = args[0]
+		}
+		k, ok := cont.State.(*continuation)
+		if !ok {
+			// Captured by the interpreter, which alone can resume it, and
+			// which claims it when it is one-shot.
+			quote := func(v lang.Value) lang.Value { return lang.List(lang.SymbolValue("quote"), v) }
+			val, err := m.ev.Interpret(lang.List(quote(proc), quote(arg)), env)
+			if err != nil {
+				return err
+			}
+			m.value = val
+			return nil
+		}
+		if err := cont.Claim(); err != nil {
+			return err
+		}
+		if k.m != m && k.m.active {
+			return &lang.Jump{Cont: cont, Value: arg}
+		}
+		m.resume(k, arg)
+	default:
+		return fmt.Errorf("attempt to call non-function: %s", proc.String())
+	}
+	return nil
+}
+
+// capture returns a continuation returning to g.
+func (m *machine) capture(g *frame, env *lang.Env) lang.Value {
+	k := &continuation{m: m}
+	if g != nil {
+		k.frame = g.clone()
+		g.parentShared = true
+	}
+	val := lang.ContinuationValue(nil, env, m.ev)
+	val.Continuation().State = k
+	return val
+}
+
+// exec runs the code of m.f until it calls a procedure or returns.
+func (m *machine) exec() error {
+	f := m.f
+	p := f.proto
+	for {
+		if err := m.ev.Tick(); err != nil {
+			return err
+		}
+		in := p.code[f.pc]
+		f.pc++
+		switch in.op {
+		case opConst:
+			f.stack = append(f.stack, p.consts[in.a])
+		case opLocal:
+			v, err := lookupLocal(f.env, int(in.a), p.names[in.b])
+			if err != nil {
+				return err
+			}
+			f.stack = append(f.stack, v)
+		case opGlobal:
+			v, err := lookupGlobal(f.env, int(in.a), p.names[in.b])
+			if err != nil {
+				return err
+			}
+			f.stack = append(f.stack, v)
+		case opSetLocal:
+			if err := setLocal(f.env, int(in.a), p.names[in.b], f.stack[len(f.stack)-1]); err != nil {
+				return err
+			}
+		case opSetGlobal:
+			name := p.names[in.b]
+			target, err := f.env.Locate(name)
+			if err != nil {
+				return err
+			}
+			if err := m.ev.CheckShadow(name, target); err != nil {
+				return err
+			}
+			if err := target.Set(name, f.stack[len(f.stack)-1]); err != nil {
+				return err
+			}
+		case opDefine:
+			name := p.names[in.b]
+			if err := m.ev.CheckShadow(name, f.env); err != nil {
+				return err
+			}
+			f.env.Define(name, f.stack[len(f.stack)-1])
+		case opPop:
+			f.stack = f.stack[:len(f.stack)-1]
+		case opJump:
+			f.pc = int(in.a)
+		case opJumpIfFalse:
+			v := f.stack[len(f.stack)-1]
+			f.stack = f.stack[:len(f.stack)-1]
+			if !lang.IsTruthy(v) {
+				f.pc = int(in.a)
+			}
+		case opClosure:
+			q := p.protos[in.a]
+			c := lang.ClosureValue(q.params, q.rest, q.body, f.env)
+			c.Closure().Code = q
+			f.stack = append(f.stack, c)
+		case opCall, opTailCall:
+			base := len(f.stack) - int(in.a) - 1
+			proc, args := f.stack[base], f.stack[base+1:]
+			if len(args) == 2 && proc.Type == lang.TypePrimitive && args[0].Type == lang.TypeInt && args[1].Type == lang.TypeInt {
+				if op, ok := m.ev.IntOp(proc); ok {
+					if v, ok := op(args[0].Int(), args[1].Int()); ok {
+						f.stack = append(f.stack[:base], v)
+						if in.op == opTailCall {
+							m.ret(f, v)
+							return nil
+						}
+						continue
+					}
+				}
+			}
+			if proc.Type == lang.TypePrimitive {
+				// Primitives may keep their arguments.
+				args = append([]lang.Value(nil), args...)
+			}
+			f.stack = f.stack[:base]
+			m.pos = p.where[f.pc-1]
+			m.call = p.names[in.b]
+			if in.op == opCall {
+				m.to, m.toShared = f, false
+			} else {
+				m.to, m.toShared = f.parent, f.parentShared
+			}
+			return m.invoke(proc, args, f.env)
+		case opReturn:
+			m.ret(f, f.stack[len(f.stack)-1])
+			return nil
+		case opCallCC, opTailCallCC:
+			proc := f.stack[len(f.stack)-1]
+			f.stack = f.stack[:len(f.stack)-1]
+			if in.op == opCallCC {
+				m.to, m.toShared = f, false
+			} else {
+				m.to, m.toShared = f.parent, f.parentShared
+			}
+			k := m.capture(m.to, f.env)
+			k.Continuation().OneShot = in.a == 1
+			m.pos = p.where[f.pc-1]
+			return m.invoke(proc, []lang.Value{k}, f.env)
+		case opCapture:
+			resume := f.pc
+			f.pc = int(in.a)
+			k := m.capture(f, f.env)
+			f.pc = resume
+			env := lang.NewEnv(f.env)
+			if err := env.Bind([]string{p.names[in.b]}, "", []lang.Value{k}); err != nil {
+				return err
+			}
+			f.env = env
+		case opLet:
+			names := p.lets[in.a]
+			base := len(f.stack) - len(names)
+			env := lang.NewEnv(f.env)
+			if err := env.Bind(names, "", f.stack[base:]); err != nil {
+				return err
+			}
+			f.stack = f.stack[:base]
+			f.env = env
+		case opPopEnv:
+			f.env = f.env.Parent()
+		case opInterpret:
+			v, err := m.ev.Interpret(p.consts[in.a], f.env)
+			if err != nil {
+				return err
+			}
+			f.stack = append(f.stack, v)
+		case opFail:
+			return p.errs[in.a]
+		default:
+			return fmt.Errorf("bytecode: unknown instruction %s", in.op)
+		}
+	}
+}
+
+// ret returns v from f to its caller.
+func (m *machine) ret(f *frame, v lang.Value) {
+	m.f = nil
+	m.value = v
+	m.to, m.toShared = f.parent, f.parentShared
+}
+
+// frameAt returns the frame hops levels above env.
+func frameAt(env *lang.Env, hops int) *lang.Env {
+	for ; hops > 0 && env != nil; hops-- {
+		env = env.Parent()
+	}
+	return env
+}
+
+// lookupLocal returns the value of name, bound hops frames above env. The
+// whole chain is searched if the binding is missing, as it is while a
+// define the compiler saw has not run yet.
+func lookupLocal(env *lang.Env, hops int, name string) (lang.Value, error) {
+	if e := frameAt(env, hops); e != nil {
+		if v, ok := e.Own(name); ok {
+			return v, nil
+		}
+	}
+	return env.Get(name)
+}
+
+// lookupGlobal returns the value of name, searching from hops frames above
+// env, past the frames the compiler knows do not bind it. The whole chain
+// is searched if that fails, for names defined at run time in a way the
+// compiler cannot see.
+func lookupGlobal(env *lang.Env, hops int, name string) (lang.Value, error) {
+	if e := frameAt(env, hops); e != nil {
+		if v, err := e.Get(name); err == nil {
+			return v, nil
+		}
+	}
+	return env.Get(name)
+}
+
+func setLocal(env *lang.Env, hops int, name string, v lang.Value) error {
+	if e := frameAt(env, hops); e != nil {
+		if _, ok := e.Own(name); ok {
+			return e.Set(name, v)
+		}
+	}
+	return env.Set(name, v)
+}
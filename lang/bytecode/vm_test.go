@@ -0,0 +1,392 @@
+package bytecode_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/lang/bytecode"
+	"github.com/sergev/gisp/parser"
+	"github.com/sergev/gisp/runtime"
+)
+
+// evaluate runs a Gisp program on the virtual machine when vm is set and
+// on the interpreter otherwise, returning its value and what it printed.
+func evaluate(src string, vm bool) (string, string, error) {
+	ev := runtime.NewEvaluator()
+	if vm {
+		ev.Engine = bytecode.New()
+	}
+	var out strings.Builder
+	ev.SetOutput(&out)
+	val, err := runtime.EvaluateGispString(ev, src)
+	return val.String(), out.String(), err
+}
+
+func TestMatchesInterpreter(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+	}{
+		{"arith", `[1 + 2 * 3, 7 / 2, 2.5 * 2, 9223372036854775807 + 1]`},
+		{"stringIndex", `["héllo"[1], "héllo"[4], charp("abc"[0])]`},
+		{"closures", `
+func counter() {
+	var n = 0
+	return func() { n++; return n }
+}
+var c = counter()
+c(); c()
+[c(), counter()()]`},
+		{"restParams", "`(let ((f (lambda (a . rest) (list a rest)))) (list (f 1) (f 1 2 3)))"},
+		{"recursion", `
+func fib(n) { if n < 2 { return n } return fib(n - 1) + fib(n - 2) }
+fib(15)`},
+		{"whileBreak", `
+var i = 0
+var s = 0
+while true {
+	i++
+	if i % 2 == 0 { continue }
+	if i > 9 { break }
+	s += i
+}
+[i, s]`},
+		{"earlyReturn", `
+func classify(n) {
+	if n < 0 { return "negative" }
+	var m = n
+	while m > 10 {
+		if m == 42 { return "answer" }
+		m -= 1
+	}
+	return "small"
+}
+[classify(-1), classify(50), classify(5)]`},
+		{"tryCatch", `
+func f(x) {
+	try {
+		if x { return "returned" }
+		throw("thrown")
+	} catch (e) {
+		return e
+	} finally {
+		display("finally ")
+	}
+}
+[f(true), f(false)]`},
+		{"catchRuntimeError", `
+var tag = nil
+try {
+	vectorRef(vector(1, 2), "x")
+} catch (e) {
+	tag = errorTag(e)
+}
+tag`},
+		{"reentry", `
+func f() {
+	var saved = false
+	var count = 0
+	var result = callcc(func(k) { saved = k; return 0 })
+	count++
+	if result < 3 { saved(result + 1) }
+	return [result, count]
+}
+f()`},
+		{"generator", `
+func makeGen(xs) {
+	var items = xs
+	return func() {
+		return callcc(func(ret) {
+			if items == [] { return "done" }
+			var x = first(items)
+			items = rest(items)
+			return x
+		})
+	}
+}
+var g = makeGen([1, 2, 3])
+[g(), g(), g(), g()]`},
+		{"oneShot", `
+func walk(xs, yield) {
+	for x in xs { yield(x) }
+	return "done"
+}
+func makeGen(xs) {
+	var resume = false
+	var back = false
+	return func() {
+		return call1cc(func(k) {
+			back = k
+			if resume { resume(false) }
+			var end = walk(xs, func(x) {
+				call1cc(func(r) { resume = r; back(x) })
+			})
+			back(end)
+		})
+	}
+}
+var g = makeGen([1, 2, 3])
+[g(), g(), g(), g(), oneShotp(call1cc(func(k) { return k })), continuationp(callcc(func(k) { return k }))]`},
+		{"oneShotTwice", `
+func f() {
+	var saved = false
+	var result = call1cc(func(k) { saved = k; return 0 })
+	if result < 3 { saved(result + 1) }
+	return result
+}
+f()`},
+		{"tupleAssign", `
+func f(n) {
+	var a, b = 0, 1
+	var v = #[1, 2, 3]
+	while n > 0 {
+		a, b = b, a + b
+		v[0], v[2] = v[2], v[0]
+		n--
+	}
+	var q, r = 0, 0
+	q, r = divmod(a, 4)
+	return [a, b, v, q, r]
+}
+f(7)`},
+		{"match", `
+func calc(e) {
+	return match e {
+	case [` + "`" + `'+, a, b]: calc(a) + calc(b)
+	case [` + "`" + `'neg, a]: -calc(a)
+	case #[_, _]: 0
+	case n if numberp(n): n
+	}
+}
+[calc(` + "`" + `'(+ 1 (neg (+ 2 3)))), calc("x")]`},
+		{"escapeFromMap", `
+callcc(func(exit) {
+	map(func(x) { if x > 2 { exit(x * 10) } return x }, [1, 2, 3, 4])
+})`},
+		{"callbacks", `
+[map(func(x) { return x * x }, [1, 2, 3]),
+ filter(func(x) { return x % 2 == 0 }, [1, 2, 3, 4]),
+ apply(func(a, b) { return a - b }, [10, 3])]`},
+		{"macro", "`(define-macro (unless c . body) (list 'if c '#f (cons 'begin body)))\n" + `
+func f(x) { return ` + "`(unless x \"no\")" + ` }
+[f(false), f(true)]`},
+		{"namedLet", "`(let loop ((i 0) (acc '())) (if (= i 3) acc (loop (+ i 1) (cons i acc))))"},
+		{"quasiquote", "`(let ((x 1) (xs '(2 3))) `(a ,x ,@xs))"},
+		{"quasiquoteNested", "`(let ((x 1) (xs '(2 3))) (list `#(a ,x ,@xs) ``(b ,,x ,,@xs) `(c #(,x) `#(,(d ,x)))))"},
+		{"cond", "`(map (lambda (n) (cond ((< n 0) 'neg) ((= n 0) 'zero) (else 'pos))) '(-1 0 1))"},
+		{"shadowedEscape", "`(call/cc (lambda (k) (let ((k (lambda (x) (* x 2)))) (k 21))))"},
+		{"multipleValues", `
+func f(n) {
+	var q, r = divmod(n, 4)
+	return r, q
+}
+var a, b = f(17)
+[a, b, f(8)]`},
+		{"forIn", `
+var t = []
+for i, x in #[10, 20, 30] {
+	if i == 1 { continue }
+	t = cons(x, t)
+}
+for k, v in makeMap("a", 1) { t = cons([k, v], t) }
+t`},
+		{"environments", "func f(x) { var y = x * 2; return theEnvironment() }\n" +
+			"var env = f(21)\n" +
+			"eval(`'(set! y (+ x y)), env)\n" +
+			"var child = makeChildEnv(env)\n" +
+			"eval(`'(define z 1), child)\n" +
+			"[eval(`'y, env), eval(`'(list x y z), child), eq(env, env)]"},
+		{"channels", `
+var results = makeChannel()
+func square(x) { send(results, x * x) }
+for x in [1, 2, 3] { go(square, x) }
+var total = 0
+for _ in [1, 2, 3] { total += receive(results) }
+var r = select { case v = receive(results): v; default: "none" }
+[total, r]`},
+		{"objects", "var base = makeObject(false, `'area, func(self) { return self.w * self.h })\n" +
+			"var r = makeObject(base, `'w, 2, `'h, 3)\n" +
+			"r.h += 1\n" +
+			"[callMethod(r, `'area), eq(slot(r, `'area), slot(base, `'area))]"},
+		{"variadic", `
+func sum(first, rest...) {
+	var s = first
+	for x in rest { s += x }
+	return s
+}
+var more = [3, 4]
+[sum(1), sum(1, 2, 3), sum(1, more...), func(xs...) { return xs }(5, 6)]`},
+		{"defer", `
+var log = []
+func note(x) { log = cons(x, log) }
+func f(n) {
+	defer note("first")
+	var i = 0
+	while i < n { defer note(i); i++ }
+	if n > 1 { return "early" }
+	throw("small")
+}
+var caught = nil
+try { f(1) } catch (e) { caught = e }
+[f(2), caught, log]`},
+		{"chars", `[utf8Ref("aλ", 1), charToInteger('a'), 'x' == 'x']`},
+		{"unboundVariable", `nosuch + 1`},
+		{"notAFunction", `var x = 1; x(2)`},
+		{"arity", `func f(a, b) { return a }; f(1)`},
+		{"backtrace", `
+func inner(x) { var y = x; return first(y) + 1 }
+func tail(x) { return inner(x) }
+func outer(x) { display(tail(x)) }
+var obj = makeObject(false, ` + "`'run" + `, func(self, x) { return [outer(x)] })
+obj.run(obj, 5)`},
+		{"backtraceDepth", `
+func down(n) { if n == 0 { return first(n) } return 1 + down(n - 1) }
+down(30)`},
+		{"backtraceThroughPrimitive", `
+func bad(x) { return first(x) }
+func each(xs) { return [map(bad, xs)] }
+each([1])`},
+		{"badIf", "`(if)"},
+		{"badSpecialFormNotReached", "`(begin 1 (if #f (quote) 2))"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want, wantOut, wantErr := evaluate(tc.src, false)
+			got, gotOut, gotErr := evaluate(tc.src, true)
+			if (wantErr == nil) != (gotErr == nil) || (wantErr != nil && wantErr.Error() != gotErr.Error()) {
+				t.Fatalf("error %v, interpreter %v", gotErr, wantErr)
+			}
+			if got != want || gotOut != wantOut {
+				t.Fatalf("got %s printing %q, interpreter %s printing %q", got, gotOut, want, wantOut)
+			}
+		})
+	}
+}
+
+func TestExamplesMatchInterpreter(t *testing.T) {
+	files, err := filepath.Glob("../../examples/tutorial_*.gisp")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	files = append(files, "../../examples/continuation.gisp", "../../examples/unify_family_tree.gisp",
+		"../../examples/refal_patterns.gisp", "../../examples/snobol_patterns.gisp")
+	for _, path := range files {
+		var outputs [2]string
+		for i, vm := range []bool{false, true} {
+			ev := runtime.NewEvaluator()
+			if vm {
+				ev.Engine = bytecode.New()
+			}
+			runtime.SetArgv(ev.Global, []string{})
+			var out strings.Builder
+			ev.SetOutput(&out)
+			if _, err := runtime.EvaluateFile(ev, path); err != nil {
+				t.Fatalf("%s (vm %v): %v", path, vm, err)
+			}
+			outputs[i] = out.String()
+		}
+		if outputs[0] != outputs[1] {
+			t.Fatalf("%s printed %q, interpreter %q", path, outputs[1], outputs[0])
+		}
+	}
+}
+
+func TestTailCallsRunInConstantSpace(t *testing.T) {
+	ev := runtime.NewEvaluator()
+	ev.Engine = bytecode.New()
+	ev.MaxDepth = 50
+	val, err := runtime.EvaluateGispString(ev, `
+func count(n, acc) {
+	if n == 0 { return acc }
+	return count(n - 1, acc + 1)
+}
+func loop() {
+	var i = 0
+	while i < 100000 { i++ }
+	return i
+}
+[count(100000, 0), loop()]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := val.String(); got != "(100000 100000)" {
+		t.Fatalf("got %s", got)
+	}
+
+	_, err = runtime.EvaluateGispString(ev, `
+func sum(n) { if n == 0 { return 0 } return n + sum(n - 1) }
+sum(1000)`)
+	if !errors.Is(err, lang.ErrDepthExceeded) {
+		t.Fatalf("expected ErrDepthExceeded, got %v", err)
+	}
+}
+
+func TestFuelLimit(t *testing.T) {
+	ev := runtime.NewEvaluator()
+	ev.Engine = bytecode.New()
+	ev.MaxSteps = 10000
+	_, err := runtime.EvaluateGispString(ev, `while true { }`)
+	if !errors.Is(err, lang.ErrFuelExhausted) {
+		t.Fatalf("expected ErrFuelExhausted, got %v", err)
+	}
+}
+
+// benchVM measures the named script of the runtime benchmark suite on the
+// virtual machine, for comparison with the interpreter benchmarks in lang.
+func benchVM(b *testing.B, name, want string) {
+	b.Helper()
+	var forms []lang.Value
+	for _, script := range runtime.BenchScripts() {
+		if script.Name == name {
+			var err error
+			forms, err = parser.ParseString(script.Source)
+			if err != nil {
+				b.Fatalf("parse %s: %v", name, err)
+			}
+		}
+	}
+	if forms == nil {
+		b.Fatalf("no benchmark script named %s", name)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ev := runtime.NewEvaluator()
+		ev.Engine = bytecode.New()
+		b.StartTimer()
+		val, err := ev.EvalAll(forms, nil)
+		if err != nil {
+			b.Fatalf("%s: %v", name, err)
+		}
+		if got := val.String(); got != want {
+			b.Fatalf("%s => %s, want %s", name, got, want)
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchVM(b, "fib", "6765")
+}
+
+func BenchmarkAckermann(b *testing.B) {
+	benchVM(b, "ackermann", "21")
+}
+
+func BenchmarkNQueens(b *testing.B) {
+	benchVM(b, "nqueens", "4")
+}
+
+func BenchmarkStringBuild(b *testing.B) {
+	benchVM(b, "strings", "2000")
+}
+
+func BenchmarkLookups(b *testing.B) {
+	benchVM(b, "lookups", "59998")
+}
+
+func BenchmarkArith(b *testing.B) {
+	benchVM(b, "arith", "2666466670127")
+}
@@ -0,0 +1,76 @@
+package lang
+
+import "fmt"
+
+// A primitive that needs to call a procedure supplied by the program, such
+// as the predicate given to count, should not use Apply: that runs the
+// procedure in a nested evaluation loop, which grows the Go stack and cuts
+// continuations captured inside the procedure off from the rest of the
+// program. Instead the primitive returns Callback or TailCall, and the
+// evaluator applies the procedure in its own loop.
+
+// callback is the payload of a value returned by Callback or TailCall.
+type callback struct {
+	proc Value
+	args []Value
+	then func(Value) (Value, error)
+}
+
+// Callback returns a value that a primitive can return to have the
+// evaluator apply proc to args and pass the result to then. Whatever then
+// returns becomes the result of the primitive call; it may be another
+// Callback, so a primitive can apply procedures any number of times.
+//
+// A continuation captured during proc may be resumed after then has run,
+// in which case then is called again; state it shares across calls is seen
+// by both.
+func Callback(proc Value, args []Value, then func(Value) (Value, error)) Value {
+	return Value{Type: typeCallback, payload: &callback{proc: proc, args: args, then: then}}
+}
+
+// TailCall returns a value that a primitive can return to have the
+// evaluator apply proc to args in place of the primitive call, so the
+// procedure runs in tail position.
+func TailCall(proc Value, args []Value) Value {
+	return Value{Type: typeCallback, payload: &callback{proc: proc, args: args}}
+}
+
+// resumeCallback applies the procedure requested by a primitive result.
+func (ev *Evaluator) resumeCallback(state *evalState, val Value) error {
+	cb, ok := val.payload.(*callback)
+	if !ok {
+		return fmt.Errorf("invalid callback")
+	}
+	if cb.then != nil {
+		state.push(&callbackFrame{env: state.env, then: cb.then})
+	}
+	return ev.invokeProcedure(state, cb.proc, cb.args)
+}
+
+// callbackFrame hands the result of a procedure requested by Callback back
+// to the primitive that asked for it.
+type callbackFrame struct {
+	framePos
+	env  *Env
+	then func(Value) (Value, error)
+}
+
+func (f *callbackFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	state.env = f.env
+	result, err := ev.withCurrentEnv(f.env, func() (Value, error) {
+		return f.then(val)
+	})
+	if err != nil {
+		return err
+	}
+	if result.Type == typeCallback {
+		return ev.resumeCallback(state, result)
+	}
+	state.value = result
+	state.returning = true
+	return nil
+}
+
+func (f *callbackFrame) clone() frame {
+	return &callbackFrame{framePos: f.framePos, env: f.env, then: f.then}
+}
@@ -0,0 +1,98 @@
+package lang_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/runtime"
+	"github.com/sergev/gisp/sexpr"
+)
+
+// sumWith(f, list) adds up f applied to each element, calling f through
+// lang.Callback.
+func sumWith(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	items, err := lang.ToSlice(args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	var step func(i int, acc int64) lang.Value
+	step = func(i int, acc int64) lang.Value {
+		if i == len(items) {
+			return lang.IntValue(acc)
+		}
+		return lang.Callback(args[0], []lang.Value{items[i]}, func(v lang.Value) (lang.Value, error) {
+			n, err := lang.AsInt(v)
+			if err != nil {
+				return lang.Value{}, err
+			}
+			return step(i+1, acc+n), nil
+		})
+	}
+	return step(0, 0), nil
+}
+
+func evalSource(t *testing.T, ev *lang.Evaluator, src string) lang.Value {
+	t.Helper()
+	forms, err := sexpr.ReadString(src)
+	if err != nil {
+		t.Fatalf("read %q: %v", src, err)
+	}
+	val, err := ev.EvalAll(forms, nil)
+	if err != nil {
+		t.Fatalf("eval %q: %v", src, err)
+	}
+	return val
+}
+
+func TestCallbackResumesContinuation(t *testing.T) {
+	ev := runtime.NewEvaluator()
+	ev.Global.Define("sumWith", lang.PrimitiveValue(sumWith))
+
+	evalSource(t, ev, `
+(define saved #f)
+(define total
+  (sumWith (lambda (x) (call/cc (lambda (k) (if (= x 2) (set! saved k)) x)))
+           '(1 2 3)))`)
+	if got := evalSource(t, ev, "total"); got.Int() != 6 {
+		t.Fatalf("expected total 6, got %s", got.String())
+	}
+	// Re-entering the continuation captured inside the callback finishes
+	// the primitive call again with a different value for the element.
+	evalSource(t, ev, "(saved 10)")
+	if got := evalSource(t, ev, "total"); got.Int() != 14 {
+		t.Fatalf("expected total 14 after resuming, got %s", got.String())
+	}
+
+	// Escaping from the callback abandons the rest of the primitive call.
+	got := evalSource(t, ev, `(call/cc (lambda (k) (sumWith (lambda (x) (if (= x 2) (k 'escaped) x)) '(1 2 3))))`)
+	if got.String() != "escaped" {
+		t.Fatalf("expected escape, got %s", got.String())
+	}
+}
+
+func TestTailCallRunsInEvaluatorLoop(t *testing.T) {
+	ev := runtime.NewEvaluator()
+	ev.MaxSteps = 10_000_000
+	// apply returns lang.TailCall, so a loop through it stays in one run
+	// loop and each iteration is a proper tail call.
+	got := evalSource(t, ev, `
+(define (loop n) (if (= n 0) 'done (apply loop (list (- n 1)))))
+(loop 100000)`)
+	if got.String() != "done" {
+		t.Fatalf("expected done, got %s", got.String())
+	}
+
+}
+
+func TestCallbackErrorsPropagate(t *testing.T) {
+	ev := runtime.NewEvaluator()
+	ev.Global.Define("sumWith", lang.PrimitiveValue(sumWith))
+	forms, err := sexpr.ReadString(`(sumWith (lambda (x) "text") '(1))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ev.EvalAll(forms, nil); err == nil || !strings.Contains(err.Error(), "expected integer, got string") {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors raised while evaluating a program unwind its stack of frames. The
+// catch special form, (catch handler body...), marks the extent of its body
+// with a catchFrame; an error raised inside it discards the frames above and
+// calls handler with the error in place of the body's value. The form
+// (unwind-protect body cleanup...) runs its cleanup expressions whenever the
+// body is left: when it returns, when an error passes through it, and when a
+// continuation escapes from it, as Gisp's return and break do.
+
+// evalCatch evaluates the handler of a catch form; the catchFrame then runs
+// the body.
+func (ev *Evaluator) evalCatch(args Value, state *evalState) error {
+	parts, err := ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("catch expects a handler and a body")
+	}
+	state.push(&catchFrame{body: parts[1:], env: state.env})
+	state.setExpr(parts[0], state.env)
+	return nil
+}
+
+// catchFrame first receives the handler of a catch form and then stays on
+// the stack while the body runs, passing the body's value through.
+type catchFrame struct {
+	framePos
+	handler Value
+	armed   bool
+	body    []Value
+	env     *Env
+}
+
+func (f *catchFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	if f.armed {
+		state.value = val
+		state.returning = true
+		return nil
+	}
+	switch val.Type {
+	case TypePrimitive, TypeClosure, TypeContinuation:
+	default:
+		return fmt.Errorf("catch expects a procedure as handler, got %s", val.Type)
+	}
+	f.handler = val
+	f.armed = true
+	state.push(f)
+	evalSequence(state, f.body, f.env)
+	return nil
+}
+
+func (f *catchFrame) clone() frame {
+	cp := *f
+	return &cp
+}
+
+func (ev *Evaluator) evalUnwindProtect(args Value, state *evalState) error {
+	parts, err := ToSlice(args)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("unwind-protect expects a body")
+	}
+	extent := &protectExtent{cleanup: parts[1:], env: state.env}
+	state.push(&protectFrame{extent: extent})
+	state.setExpr(parts[0], state.env)
+	return nil
+}
+
+// protectExtent is shared by a protectFrame and its clones in captured
+// continuations, so that a jump can tell whether it stays inside the body.
+type protectExtent struct {
+	cleanup []Value
+	env     *Env
+}
+
+// protectFrame runs the cleanup of an unwind-protect form when its body
+// returns, then returns the body's value.
+type protectFrame struct {
+	framePos
+	extent *protectExtent
+}
+
+func (f *protectFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	state.push(&resultFrame{value: val})
+	evalSequence(state, f.extent.cleanup, f.extent.env)
+	return nil
+}
+
+func (f *protectFrame) clone() frame {
+	return &protectFrame{framePos: f.framePos, extent: f.extent}
+}
+
+// resultFrame discards the value of the cleanup code run above it and
+// returns a saved value instead.
+type resultFrame struct {
+	framePos
+	value Value
+}
+
+func (f *resultFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	state.value = f.value
+	state.returning = true
+	return nil
+}
+
+func (f *resultFrame) clone() frame {
+	return &resultFrame{framePos: f.framePos, value: f.value}
+}
+
+// rethrowFrame raises an error again once the cleanup code run above it
+// has finished.
+type rethrowFrame struct {
+	framePos
+	err error
+}
+
+func (f *rethrowFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	return f.err
+}
+
+func (f *rethrowFrame) clone() frame {
+	return &rethrowFrame{framePos: f.framePos, err: f.err}
+}
+
+// raise unwinds the stack after err to the innermost armed catch frame,
+// first running the cleanup of an unwind-protect frame if one is closer.
+// It returns err when nothing handles it. Exhausted fuel, interruption and
+// excessive depth are limits imposed by the embedder, so programs cannot
+// catch them, and a Jump is not an error of the program, so only
+// unwind-protect frames see it.
+func (ev *Evaluator) raise(state *evalState, err error) error {
+	if errors.Is(err, ErrFuelExhausted) || errors.Is(err, ErrInterrupted) || errors.Is(err, ErrDepthExceeded) {
+		return err
+	}
+	var jump *Jump
+	isJump := errors.As(err, &jump)
+	for i := len(state.cont) - 1; i >= 0; i-- {
+		switch f := state.cont[i].(type) {
+		case *protectFrame:
+			state.cont = state.cont[:i]
+			state.push(&rethrowFrame{err: err})
+			evalSequence(state, f.extent.cleanup, f.extent.env)
+			return nil
+		case *catchFrame:
+			if !f.armed || isJump {
+				continue
+			}
+			state.cont = state.cont[:i]
+			state.env = f.env
+			if herr := ev.invokeProcedure(state, f.handler, []Value{CaughtValue(err)}); herr != nil {
+				return ev.raise(state, herr)
+			}
+			return nil
+		}
+	}
+	return err
+}
+
+// leftExtents returns the unwind-protect extents of the frames in from that
+// a jump to the frames in to leaves, innermost first.
+func leftExtents(from, to []frame) []*protectExtent {
+	var left []*protectExtent
+	for i := len(from) - 1; i >= 0; i-- {
+		f, ok := from[i].(*protectFrame)
+		if !ok {
+			continue
+		}
+		kept := false
+		for _, g := range to {
+			if p, ok := g.(*protectFrame); ok && p.extent == f.extent {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			left = append(left, f.extent)
+		}
+	}
+	return left
+}
+
+// unwindTo switches to the stack of an invoked continuation and delivers
+// val to it, after running the cleanup of every unwind-protect form the
+// jump leaves.
+func (ev *Evaluator) unwindTo(state *evalState, cont *Continuation, val Value) {
+	left := leftExtents(state.cont, cont.Frames)
+	if cont.OneShot {
+		// Nothing will resume these frames again, so they need no copy.
+		state.cont, cont.Frames = cont.Frames, nil
+	} else {
+		state.cont = cloneFrames(cont.Frames)
+	}
+	state.env = cont.Env
+	if len(left) == 0 {
+		state.value = val
+		state.returning = true
+		return
+	}
+	state.push(&resultFrame{value: val})
+	for i := len(left) - 1; i > 0; i-- {
+		state.push(&beginFrame{exprs: left[i].cleanup, env: left[i].env})
+	}
+	evalSequence(state, left[0].cleanup, left[0].env)
+}
+
+// evalSequence evaluates exprs in env in order; the value of the last one,
+// or the empty list when there are none, goes to the frame on top.
+func evalSequence(state *evalState, exprs []Value, env *Env) {
+	if len(exprs) == 0 {
+		state.value = EmptyList
+		state.returning = true
+		return
+	}
+	if len(exprs) > 1 {
+		state.push(&beginFrame{exprs: exprs[1:], env: env})
+	}
+	state.setExpr(exprs[0], env)
+}
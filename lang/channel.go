@@ -0,0 +1,30 @@
+package lang
+
+// Channel is a Go channel of values, through which goroutines started by
+// the go primitive communicate.
+type Channel struct {
+	C chan Value
+
+	// Stop, when set, is called by closeChannel in place of closing C. It is
+	// set for channels whose sender closes C itself once told to stop.
+	Stop func()
+}
+
+// NewChannel returns a channel buffering up to size values; a size of zero
+// makes every send wait for a receiver.
+func NewChannel(size int) *Channel {
+	return &Channel{C: make(chan Value, size)}
+}
+
+// ChannelValue wraps a channel.
+func ChannelValue(ch *Channel) Value {
+	return Value{Type: TypeChannel, payload: ch}
+}
+
+// Channel returns the channel payload, if any.
+func (v Value) Channel() *Channel {
+	if ch, ok := v.payload.(*Channel); ok {
+		return ch
+	}
+	return nil
+}
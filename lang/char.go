@@ -0,0 +1,68 @@
+package lang
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CharValue constructs a character Value holding the code point r.
+func CharValue(r rune) Value {
+	return Value{Type: TypeChar, payload: r}
+}
+
+// Char returns the code point of a character Value.
+func (v Value) Char() rune {
+	if r, ok := v.payload.(rune); ok {
+		return r
+	}
+	return 0
+}
+
+// charNames lists the characters written by name, as in #\space.
+var charNames = []struct {
+	name string
+	r    rune
+}{
+	{"nul", 0},
+	{"alarm", 7},
+	{"backspace", 8},
+	{"tab", '\t'},
+	{"newline", '\n'},
+	{"return", '\r'},
+	{"escape", 27},
+	{"space", ' '},
+	{"delete", 127},
+}
+
+// CharName returns the character a name such as "space" or "x41" stands
+// for in #\ syntax.
+func CharName(name string) (rune, bool) {
+	for _, entry := range charNames {
+		if entry.name == name {
+			return entry.r, true
+		}
+	}
+	if hex := strings.TrimPrefix(name, "x"); hex != name && hex != "" {
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err == nil && n <= unicode.MaxRune {
+			return rune(n), true
+		}
+	}
+	return 0, false
+}
+
+// charString writes r the way the reader reads it back: #\a, #\space, or
+// #\x1f for other characters that do not print.
+func charString(r rune) string {
+	for _, entry := range charNames {
+		if entry.r == r {
+			return `#\` + entry.name
+		}
+	}
+	if !unicode.IsPrint(r) {
+		return fmt.Sprintf(`#\x%x`, r)
+	}
+	return `#\` + string(r)
+}
@@ -0,0 +1,126 @@
+package lang
+
+import "fmt"
+
+// String returns the user-facing name of the value type, as used in error
+// messages.
+func (t ValueType) String() string {
+	switch t {
+	case TypeEmpty:
+		return "empty-list"
+	case TypeBool:
+		return "boolean"
+	case TypeInt:
+		return "integer"
+	case TypeReal:
+		return "real"
+	case TypeString:
+		return "string"
+	case TypeChar:
+		return "char"
+	case TypeSymbol:
+		return "symbol"
+	case TypePair:
+		return "pair"
+	case TypeVector:
+		return "vector"
+	case TypePrimitive:
+		return "primitive"
+	case TypeClosure:
+		return "closure"
+	case TypeContinuation:
+		return "continuation"
+	case TypeMacro:
+		return "macro"
+	case TypeEOF:
+		return "eof-object"
+	case TypeRegex:
+		return "regex"
+	case TypeMap:
+		return "map"
+	case TypeBigInt:
+		return "big-integer"
+	case TypeErrorObject:
+		return "error-object"
+	case TypeRecord:
+		return "record"
+	case TypeValues:
+		return "values"
+	case TypeEnvironment:
+		return "environment"
+	case TypeChannel:
+		return "channel"
+	default:
+		return "unknown"
+	}
+}
+
+func expectedError(expected string, v Value) error {
+	return &TypeError{Want: expected, Got: v}
+}
+
+// AsInt returns the integer held by v.
+func AsInt(v Value) (int64, error) {
+	if v.Type != TypeInt {
+		return 0, expectedError("integer", v)
+	}
+	return v.Int(), nil
+}
+
+// AsFloat returns v as a float64, converting integers.
+func AsFloat(v Value) (float64, error) {
+	switch v.Type {
+	case TypeInt:
+		return float64(v.Int()), nil
+	case TypeBigInt:
+		return bigToFloat(v.BigInt()), nil
+	case TypeReal:
+		return v.Real(), nil
+	default:
+		return 0, expectedError("number", v)
+	}
+}
+
+// AsBool returns the boolean held by v. Use IsTruthy for the language's
+// notion of truth.
+func AsBool(v Value) (bool, error) {
+	if v.Type != TypeBool {
+		return false, expectedError("boolean", v)
+	}
+	return v.Bool(), nil
+}
+
+// AsString returns the contents of a string value.
+func AsString(v Value) (string, error) {
+	if v.Type != TypeString {
+		return "", expectedError("string", v)
+	}
+	return v.Str(), nil
+}
+
+// AsSymbol returns the name of a symbol value.
+func AsSymbol(v Value) (string, error) {
+	if v.Type != TypeSymbol {
+		return "", expectedError("symbol", v)
+	}
+	return v.Sym(), nil
+}
+
+// AsSlice returns the elements of a proper list or a vector. The slice of a
+// vector is its backing store, so writes to it are visible to the program.
+func AsSlice(v Value) ([]Value, error) {
+	switch v.Type {
+	case TypeEmpty:
+		return nil, nil
+	case TypeVector:
+		return v.Vector().Elements, nil
+	case TypePair:
+		items, err := ToSlice(v)
+		if err != nil {
+			return nil, fmt.Errorf("expected proper list, got improper list")
+		}
+		return items, nil
+	default:
+		return nil, expectedError("list or vector", v)
+	}
+}
@@ -0,0 +1,123 @@
+package lang
+
+import "fmt"
+
+// An Engine runs programs in place of the tree-walking interpreter, as the
+// bytecode virtual machine in lang/bytecode does. When Evaluator.Engine is
+// set, Eval and Apply hand their work to it, and macro bodies and nested
+// evaluations requested by primitives run on it too. The methods below give
+// an engine what it needs from the evaluator without reaching into its
+// frames.
+
+// Engine evaluates expressions and applies procedures for an Evaluator.
+type Engine interface {
+	Eval(ev *Evaluator, expr Value, env *Env) (Value, error)
+	Apply(ev *Evaluator, proc Value, args []Value) (Value, error)
+}
+
+// Jump carries a continuation captured by an engine out through the
+// evaluations nested inside the one that can resume it, such as a catch
+// form the engine left to the interpreter. Catch forms let it pass, while
+// unwind-protect cleanup runs as it goes by.
+type Jump struct {
+	Cont  *Continuation
+	Value Value
+}
+
+func (j *Jump) Error() string {
+	return "continuation invoked outside its evaluation"
+}
+
+// Interpret evaluates expr in env with the tree-walking interpreter, even
+// when an Engine is set. Engines use it for the forms they do not compile.
+func (ev *Evaluator) Interpret(expr Value, env *Env) (Value, error) {
+	defer ev.enter()()
+	if env == nil {
+		env = ev.Global
+	}
+	prev := ev.currentEnv
+	ev.setCurrentEnv(env)
+	state := &evalState{
+		expr: expr,
+		env:  env,
+	}
+	val, err := ev.run(state)
+	ev.currentEnv = prev
+	return val, err
+}
+
+// Tick accounts for one step of an evaluation, returning ErrInterrupted or
+// an error wrapping ErrFuelExhausted when it must stop.
+func (ev *Evaluator) Tick() error {
+	if ev.interrupt.Load() || ev.MaxSteps > 0 {
+		return ev.tick()
+	}
+	return nil
+}
+
+func (ev *Evaluator) tick() error {
+	if ev.interrupt.Load() {
+		ev.interrupt.Store(false)
+		return ErrInterrupted
+	}
+	if ev.MaxSteps > 0 {
+		ev.steps++
+		if ev.steps > ev.MaxSteps {
+			return fmt.Errorf("%w after %d steps", ErrFuelExhausted, ev.MaxSteps)
+		}
+	}
+	return nil
+}
+
+// CallPrimitive calls fn with args, with env as the current environment
+// that primitives such as defineStruct define into.
+func (ev *Evaluator) CallPrimitive(fn Primitive, env *Env, args []Value) (Value, error) {
+	prev := ev.currentEnv
+	ev.setCurrentEnv(env)
+	val, err := fn(ev, args)
+	ev.currentEnv = prev
+	return val, err
+}
+
+// IntOp returns the integer fast path of proc when it is one of the
+// builtin arithmetic or comparison primitives and NoFastArith is off. The
+// operation reports false when the general primitive must handle its
+// operands.
+func (ev *Evaluator) IntOp(proc Value) (func(x, y int64) (Value, bool), bool) {
+	if ev.NoFastArith || len(ev.intOps) == 0 {
+		return nil, false
+	}
+	p, ok := proc.payload.(*primitive)
+	if !ok {
+		return nil, false
+	}
+	op, ok := ev.intOps[p]
+	return op, ok
+}
+
+// CheckShadow applies the Shadow policy before name is rebound in env.
+func (ev *Evaluator) CheckShadow(name string, env *Env) error {
+	return ev.checkShadow(name, env)
+}
+
+// SplitCallback returns the parts of a value made by Callback or TailCall;
+// then is nil for TailCall. It reports false for any other value.
+func SplitCallback(v Value) (proc Value, args []Value, then func(Value) (Value, error), ok bool) {
+	cb, ok := v.payload.(*callback)
+	if v.Type != typeCallback || !ok {
+		return Value{}, nil, nil, false
+	}
+	return cb.proc, cb.args, cb.then, true
+}
+
+// ParseParams splits a lambda parameter list into the names of the
+// required parameters and the name of the rest parameter, if any.
+func ParseParams(list Value) ([]string, string, error) {
+	return parseParams(list)
+}
+
+// ExpandQuasiquote rewrites the template of a quasiquote form into code
+// that builds it with cons and append.
+func ExpandQuasiquote(template Value) (Value, error) {
+	return expandQuasiQuote(template, 1)
+}
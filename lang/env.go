@@ -1,11 +1,19 @@
 package lang
 
-import "fmt"
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
 
-// Env implements a lexical environment chain.
+// Env implements a lexical environment chain. Its methods may be called
+// from several goroutines, as programs using go do; each frame guards its
+// bindings with its own lock.
 type Env struct {
 	parent *Env
+	mu     sync.RWMutex
 	values map[string]Value
+	shape  atomic.Pointer[Pair] // the lambda form whose call created the frame, if known
 }
 
 // NewEnv creates an environment with optional parent.
@@ -18,30 +26,100 @@ func NewEnv(parent *Env) *Env {
 
 // Define binds name to value in current frame.
 func (e *Env) Define(name string, val Value) {
+	e.mu.Lock()
+	if _, ok := e.values[name]; !ok {
+		// The frame no longer binds just the names of its shape.
+		e.shape.Store(nil)
+		bindingGeneration.Add(1)
+	}
 	e.values[name] = val
+	e.mu.Unlock()
 }
 
 // Set updates an existing binding, searching parents if needed.
 func (e *Env) Set(name string, val Value) error {
-	if _, ok := e.values[name]; ok {
-		e.values[name] = val
-		return nil
-	}
-	if e.parent != nil {
-		return e.parent.Set(name, val)
+	for env := e; env != nil; env = env.parent {
+		env.mu.Lock()
+		_, ok := env.values[name]
+		if ok {
+			env.values[name] = val
+		}
+		env.mu.Unlock()
+		if ok {
+			return nil
+		}
 	}
-	return fmt.Errorf("unbound variable: %s", name)
+	return &UnboundVariableError{Name: name}
 }
 
 // Get retrieves a binding, searching parents if necessary.
 func (e *Env) Get(name string) (Value, error) {
-	if val, ok := e.values[name]; ok {
-		return val, nil
+	for env := e; env != nil; env = env.parent {
+		if val, ok := env.Own(name); ok {
+			return val, nil
+		}
+	}
+	return Value{}, &UnboundVariableError{Name: name}
+}
+
+// Own returns the value bound to name in this frame, ignoring its parents.
+func (e *Env) Own(name string) (Value, bool) {
+	e.mu.RLock()
+	val, ok := e.values[name]
+	e.mu.RUnlock()
+	return val, ok
+}
+
+// Bind binds the arguments of a procedure call to its parameters in e,
+// which must be a new frame, as parsed by ParseParams.
+func (e *Env) Bind(params []string, rest string, args []Value) error {
+	return bindParameters(e, params, rest, args)
+}
+
+// EnvironmentValue wraps env so that programs can hold it, as
+// the-environment returns it.
+func EnvironmentValue(env *Env) Value {
+	return Value{Type: TypeEnvironment, payload: env}
+}
+
+// Environment returns the environment payload, if any.
+func (v Value) Environment() *Env {
+	if env, ok := v.payload.(*Env); ok {
+		return env
+	}
+	return nil
+}
+
+// Names returns the names bound in this frame, not its parents, in sorted
+// order.
+func (e *Env) Names() []string {
+	e.mu.RLock()
+	names := make([]string, 0, len(e.values))
+	for name := range e.values {
+		names = append(names, name)
+	}
+	e.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// CloneUntil returns a copy of the frames from e up to, but not including,
+// root, chained to root itself. The copies start with the bindings the
+// frames hold now; later definitions and assignments made through either
+// chain are not seen by the other. If root is not an ancestor of e, every
+// frame is copied.
+func (e *Env) CloneUntil(root *Env) *Env {
+	if e == nil || e == root {
+		return e
 	}
-	if e.parent != nil {
-		return e.parent.Get(name)
+	clone := NewEnv(e.parent.CloneUntil(root))
+	clone.shape.Store(e.shape.Load())
+	e.mu.RLock()
+	for name, val := range e.values {
+		clone.values[name] = val
 	}
-	return Value{}, fmt.Errorf("unbound variable: %s", name)
+	e.mu.RUnlock()
+	return clone
 }
 
 // Parent returns the parent environment.
@@ -52,19 +130,23 @@ func (e *Env) Parent() *Env {
 // Locate returns the environment frame that defines name.
 func (e *Env) Locate(name string) (*Env, error) {
 	for env := e; env != nil; env = env.parent {
-		if _, ok := env.values[name]; ok {
+		if _, ok := env.Own(name); ok {
 			return env, nil
 		}
 	}
-	return nil, fmt.Errorf("unbound variable: %s", name)
+	return nil, &UnboundVariableError{Name: name}
 }
 
-// Update finds the binding for name and replaces its value using fn.
+// Update finds the binding for name and replaces its value using fn. The
+// frame holding the binding stays locked while fn runs, so that updates
+// made from several goroutines are not lost; fn must not use the frame.
 func (e *Env) Update(name string, fn func(Value) (Value, error)) (Value, error) {
 	frame, err := e.Locate(name)
 	if err != nil {
 		return Value{}, err
 	}
+	frame.mu.Lock()
+	defer frame.mu.Unlock()
 	current := frame.values[name]
 	next, err := fn(current)
 	if err != nil {
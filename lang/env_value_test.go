@@ -1,7 +1,10 @@
 package lang
 
 import (
+	"fmt"
+	"math/big"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -31,6 +34,48 @@ func TestEnvParentLookupAndErrors(t *testing.T) {
 	}
 }
 
+func TestEnvConcurrentAccess(t *testing.T) {
+	global := NewEnv(nil)
+	global.Define("counter", IntValue(0))
+	const workers, rounds = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := NewEnv(global)
+			for i := 0; i < rounds; i++ {
+				name := fmt.Sprintf("w%d_%d", w, i)
+				global.Define(name, IntValue(int64(i)))
+				local.Define("i", IntValue(int64(i)))
+				if _, err := local.Get(name); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := local.Set("i", IntValue(-1)); err != nil {
+					t.Error(err)
+					return
+				}
+				_, err := local.Update("counter", func(v Value) (Value, error) {
+					return IntValue(v.Int() + 1), nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				global.Names()
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := global.Get("counter"); got.Int() != workers*rounds {
+		t.Fatalf("counter => %v, want %d: updates were lost", got, workers*rounds)
+	}
+	if n := len(global.Names()); n != workers*rounds+1 {
+		t.Fatalf("global holds %d names, want %d", n, workers*rounds+1)
+	}
+}
+
 func TestPairToStringAndTypeHelpers(t *testing.T) {
 	pair := PairValue(IntValue(1), IntValue(2))
 	if got := pairToString(pair); got != "(1. 2)" {
@@ -57,3 +102,196 @@ func TestPairToStringAndTypeHelpers(t *testing.T) {
 		t.Fatalf("expected unknown string fallback, got %q", unknown)
 	}
 }
+
+func TestStringPrecision(t *testing.T) {
+	third := RealValue(1.0 / 3)
+	if got := third.String(); got != "0.3333333333333333" {
+		t.Fatalf("expected shortest round-trip form, got %q", got)
+	}
+	nested := List(third, VectorValue([]Value{RealValue(3.14159), IntValue(10)}), RealValue(2.5))
+	if got := nested.StringPrecision(3); got != "(0.333 #(3.14 10) 2.5)" {
+		t.Fatalf("unexpected StringPrecision(3) result %q", got)
+	}
+	if got, want := nested.StringPrecision(0), nested.String(); got != want {
+		t.Fatalf("StringPrecision(0) = %q, want %q", got, want)
+	}
+	if got := FormatReal(1e21, 0); got != "1e+21" {
+		t.Fatalf("unexpected FormatReal result %q", got)
+	}
+}
+
+func TestCharString(t *testing.T) {
+	cases := map[rune]string{
+		'a':    `#\a`,
+		'λ':    `#\λ`,
+		'(':    `#\(`,
+		' ':    `#\space`,
+		'\n':   `#\newline`,
+		0:      `#\nul`,
+		0x1f:   `#\x1f`,
+		0x200b: `#\x200b`,
+	}
+	for r, want := range cases {
+		if got := CharValue(r).String(); got != want {
+			t.Fatalf("CharValue(%U).String() = %q, want %q", r, got, want)
+		}
+		if name := want[2:]; len([]rune(name)) > 1 {
+			if got, ok := CharName(name); !ok || got != r {
+				t.Fatalf("CharName(%q) = %U, %v; want %U", name, got, ok, r)
+			}
+		}
+	}
+	for _, name := range []string{"x", "bell", "x110000", "xyz"} {
+		if _, ok := CharName(name); ok {
+			t.Fatalf("CharName(%q) should fail", name)
+		}
+	}
+}
+
+func TestStringDeeplyNestedStructures(t *testing.T) {
+	deep := EmptyList
+	for i := 0; i < 100000; i++ {
+		deep = List(deep)
+	}
+	out := deep.String()
+	if !strings.HasPrefix(out, strings.Repeat("(", maxPrintDepth)+"(...)") {
+		t.Fatalf("expected nesting to be elided at depth %d, got prefix %q", maxPrintDepth, out[:20])
+	}
+	if !strings.HasSuffix(out, strings.Repeat(")", maxPrintDepth)) || len(out) != 2*maxPrintDepth+5 {
+		t.Fatalf("unexpected length %d for elided output", len(out))
+	}
+
+	vec := VectorValue([]Value{IntValue(1)})
+	for i := 0; i < maxPrintDepth; i++ {
+		vec = VectorValue([]Value{vec})
+	}
+	if out := vec.String(); !strings.Contains(out, "#(...)") {
+		t.Fatalf("expected nested vectors to be elided, got suffix %q", out[len(out)-20:])
+	}
+
+	long := make([]Value, 100000)
+	for i := range long {
+		long[i] = IntValue(int64(i % 10))
+	}
+	if out := List(long...).String(); len(out) != 2*len(long)+1 {
+		t.Fatalf("long flat list should print in full, got length %d", len(out))
+	}
+
+	mixed := PairValue(VectorValue([]Value{List(SymbolValue("a"), StringValue("b"))}), VectorValue(nil))
+	if got := mixed.String(); got != `(#((a "b")). #())` {
+		t.Fatalf("unexpected mixed structure output %q", got)
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	if n, err := AsInt(IntValue(7)); err != nil || n != 7 {
+		t.Fatalf("AsInt => %d, %v", n, err)
+	}
+	if _, err := AsInt(StringValue("7")); err == nil || err.Error() != "expected integer, got string" {
+		t.Fatalf("expected AsInt type error, got %v", err)
+	}
+	if f, err := AsFloat(IntValue(2)); err != nil || f != 2 {
+		t.Fatalf("AsFloat(int) => %v, %v", f, err)
+	}
+	if f, err := AsFloat(RealValue(2.5)); err != nil || f != 2.5 {
+		t.Fatalf("AsFloat(real) => %v, %v", f, err)
+	}
+	if _, err := AsFloat(BoolValue(true)); err == nil || err.Error() != "expected number, got boolean" {
+		t.Fatalf("expected AsFloat type error, got %v", err)
+	}
+	if b, err := AsBool(BoolValue(true)); err != nil || !b {
+		t.Fatalf("AsBool => %v, %v", b, err)
+	}
+	if s, err := AsString(StringValue("hi")); err != nil || s != "hi" {
+		t.Fatalf("AsString => %q, %v", s, err)
+	}
+	if _, err := AsString(SymbolValue("hi")); err == nil || err.Error() != "expected string, got symbol" {
+		t.Fatalf("expected AsString type error, got %v", err)
+	}
+	if s, err := AsSymbol(SymbolValue("x")); err != nil || s != "x" {
+		t.Fatalf("AsSymbol => %q, %v", s, err)
+	}
+
+	items, err := AsSlice(List(IntValue(1), IntValue(2)))
+	if err != nil || len(items) != 2 || items[1].Int() != 2 {
+		t.Fatalf("AsSlice(list) => %v, %v", items, err)
+	}
+	if items, err := AsSlice(EmptyList); err != nil || len(items) != 0 {
+		t.Fatalf("AsSlice(empty) => %v, %v", items, err)
+	}
+	vec := VectorValue([]Value{IntValue(1)})
+	items, err = AsSlice(vec)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("AsSlice(vector) => %v, %v", items, err)
+	}
+	if _, err := AsSlice(PairValue(IntValue(1), IntValue(2))); err == nil {
+		t.Fatalf("expected AsSlice to reject improper list")
+	}
+	if _, err := AsSlice(IntValue(1)); err == nil || err.Error() != "expected list or vector, got integer" {
+		t.Fatalf("expected AsSlice type error, got %v", err)
+	}
+	if name := ValueType(99).String(); name != "unknown" {
+		t.Fatalf("expected unknown type name, got %q", name)
+	}
+}
+
+func TestBigIntValue(t *testing.T) {
+	small := BigIntValue(big.NewInt(-42))
+	if small.Type != TypeInt || small.Int() != -42 {
+		t.Fatalf("expected an int64 to stay TypeInt, got %v (%s)", small, small.Type)
+	}
+	b, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	v := BigIntValue(b)
+	if v.Type != TypeBigInt || v.String() != "-123456789012345678901234567890" {
+		t.Fatalf("expected a big integer, got %v (%s)", v, v.Type)
+	}
+	if !IsInteger(v) || !IsInteger(small) || IsInteger(RealValue(1)) {
+		t.Fatalf("IsInteger disagrees with the integer types")
+	}
+	if f, err := AsFloat(v); err != nil || f != -1.2345678901234568e29 {
+		t.Fatalf("AsFloat(big) => %v, %v", f, err)
+	}
+	if _, err := AsInt(v); err == nil || err.Error() != "expected integer, got big-integer" {
+		t.Fatalf("expected AsInt to reject a big integer, got %v", err)
+	}
+	if IntValue(7).BigInt().Int64() != 7 || StringValue("7").BigInt() != nil {
+		t.Fatalf("unexpected BigInt conversions")
+	}
+
+	m := NewMap()
+	same, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	if err := m.Set(v, StringValue("big")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, ok := m.Get(BigIntValue(same)); !ok || got.Str() != "big" {
+		t.Fatalf("expected equal big integers to share a map key, got %v, %v", got, ok)
+	}
+}
+
+func TestMapKeepsInsertionOrder(t *testing.T) {
+	m := NewMap()
+	for _, k := range []Value{StringValue("b"), IntValue(1), SymbolValue("a"), RealValue(1)} {
+		if err := m.Set(k, BoolValue(true)); err != nil {
+			t.Fatalf("Set(%s) failed: %v", k.String(), err)
+		}
+	}
+	// Replacing a value keeps its position; integers and reals are distinct keys.
+	if err := m.Set(IntValue(1), StringValue("one")); err != nil {
+		t.Fatal(err)
+	}
+	if got := MapValue(m).String(); got != `{"b": #t, 1: "one", a: #t, 1: #t}` {
+		t.Fatalf("unexpected map %s", got)
+	}
+	if !m.Delete(SymbolValue("a")) || m.Delete(SymbolValue("a")) {
+		t.Fatalf("expected a to be deleted exactly once")
+	}
+	if val, ok := m.Get(RealValue(1)); !ok || !val.Bool() {
+		t.Fatalf("expected entry after the deleted one to stay reachable")
+	}
+	if got := List(m.Keys()...).String(); got != `("b" 1 1)` {
+		t.Fatalf("unexpected keys %s", got)
+	}
+	if err := m.Set(List(IntValue(1)), EmptyList); err == nil || err.Error() != "pair cannot be used as a map key" {
+		t.Fatalf("expected unhashable key error, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The error types below are returned by the evaluator and by the primitives
+// in package runtime, so embedders can tell failures apart with errors.As
+// instead of matching message text. Each also names its category with a
+// symbol, reported by ErrorTag, so a handler can rethrow the categories it
+// does not expect.
+
+// Error category tags reported by ErrorTag.
+const (
+	TagUnboundVariable = "unbound-variable"
+	TagArityError      = "arity-error"
+	TagTypeError       = "type-error"
+	TagUserError       = "user-error"
+)
+
+// ErrorTag returns the category symbol of err, searching wrapped errors, or
+// the empty string when err carries no category.
+func ErrorTag(err error) string {
+	var tagged interface{ Tag() string }
+	if errors.As(err, &tagged) {
+		return tagged.Tag()
+	}
+	return ""
+}
+
+// UnboundVariableError reports a reference to or assignment of a name that
+// has no binding.
+type UnboundVariableError struct {
+	Name string
+}
+
+func (e *UnboundVariableError) Error() string {
+	return fmt.Sprintf("unbound variable: %s", e.Name)
+}
+
+// Tag returns TagUnboundVariable.
+func (e *UnboundVariableError) Tag() string { return TagUnboundVariable }
+
+// ArityError reports a procedure called with the wrong number of arguments.
+// Proc is empty for anonymous closures. Want is the fewest arguments
+// accepted; AtLeast marks procedures that take any number beyond it, and a
+// Max greater than Want gives the most arguments accepted otherwise.
+type ArityError struct {
+	Proc    string
+	Want    int
+	Max     int
+	AtLeast bool
+	Got     int
+}
+
+func (e *ArityError) Error() string {
+	if e.Proc == "" {
+		if e.AtLeast {
+			return fmt.Sprintf("expected at least %d arguments, got %d", e.Want, e.Got)
+		}
+		return fmt.Sprintf("expected exactly %d arguments, got %d", e.Want, e.Got)
+	}
+	switch {
+	case e.AtLeast:
+		return fmt.Sprintf("%s expects at least %s, got %d", e.Proc, pluralArgs(e.Want), e.Got)
+	case e.Max == e.Want+1:
+		return fmt.Sprintf("%s expects %d or %d arguments, got %d", e.Proc, e.Want, e.Max, e.Got)
+	case e.Max > e.Want:
+		return fmt.Sprintf("%s expects %d to %d arguments, got %d", e.Proc, e.Want, e.Max, e.Got)
+	case e.Want == 0:
+		return fmt.Sprintf("%s expects no arguments", e.Proc)
+	default:
+		return fmt.Sprintf("%s expects %s, got %d", e.Proc, pluralArgs(e.Want), e.Got)
+	}
+}
+
+// Tag returns TagArityError.
+func (e *ArityError) Tag() string { return TagArityError }
+
+func pluralArgs(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// TypeError reports an argument of the wrong type. Want describes what was
+// expected, such as "integer" or "list or vector"; Proc is empty when the
+// check is not tied to a named procedure.
+type TypeError struct {
+	Proc string
+	Want string
+	Got  Value
+}
+
+func (e *TypeError) Error() string {
+	if e.Proc == "" {
+		return fmt.Sprintf("expected %s, got %s", e.Want, e.Got.Type)
+	}
+	return fmt.Sprintf("%s expects %s, got %s", e.Proc, e.Want, e.Got.Type)
+}
+
+// Tag returns TagTypeError.
+func (e *TypeError) Tag() string { return TagTypeError }
+
+// UserError is raised by the error primitive. Message joins the arguments
+// as printed by error, and Args keeps the original values.
+type UserError struct {
+	Message string
+	Args    []Value
+}
+
+func (e *UserError) Error() string { return e.Message }
+
+// Tag returns TagUserError.
+func (e *UserError) Tag() string { return TagUserError }
+
+// ThrownError carries a value raised by the throw primitive. A catch
+// handler receives the value itself.
+type ThrownError struct {
+	Value Value
+}
+
+func (e *ThrownError) Error() string {
+	if e.Value.Type == TypeString {
+		return "uncaught throw: " + e.Value.Str()
+	}
+	return "uncaught throw: " + e.Value.String()
+}
+
+// ErrorObject is the value a catch handler receives for an error raised by
+// the evaluator or a primitive. Throwing it raises Err again unchanged.
+type ErrorObject struct {
+	Err error
+}
+
+// ErrorObjectValue wraps err as an error object.
+func ErrorObjectValue(err error) Value {
+	return Value{Type: TypeErrorObject, payload: &ErrorObject{Err: err}}
+}
+
+// ErrorObject returns the error object payload, if any.
+func (v Value) ErrorObject() *ErrorObject {
+	if e, ok := v.payload.(*ErrorObject); ok {
+		return e
+	}
+	return nil
+}
+
+// CaughtValue returns what a catch handler receives for err: the value
+// passed to throw, or an error object for any other error.
+func CaughtValue(err error) Value {
+	var thrown *ThrownError
+	if errors.As(err, &thrown) {
+		return thrown.Value
+	}
+	return ErrorObjectValue(err)
+}
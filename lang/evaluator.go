@@ -1,11 +1,89 @@
 package lang
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrFuelExhausted is returned when an evaluation exceeds Evaluator.MaxSteps.
+var ErrFuelExhausted = errors.New("fuel exhausted")
+
+// ErrDepthExceeded is returned when an evaluation has more pending frames
+// than Evaluator.MaxDepth allows.
+var ErrDepthExceeded = errors.New("stack depth exceeded")
+
+// ErrInterrupted is returned when an evaluation is stopped by Interrupt.
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrAllocLimit is wrapped by errors from primitives asked to build a string
+// or vector longer than Evaluator.MaxAlloc allows.
+var ErrAllocLimit = errors.New("allocation limit exceeded")
+
+// DefaultMaxAlloc is the length limit used when Evaluator.MaxAlloc is zero.
+const DefaultMaxAlloc = 1 << 26
 
 // Evaluator executes Scheme-like programs.
 type Evaluator struct {
-	Global     *Env
+	Global *Env
+	// Sandbox disables primitives that reach outside the interpreter, such
+	// as filesystem access. Embedders running untrusted code should set it.
+	Sandbox bool
+	// Policy selects individual resources primitives may reach; when set
+	// it takes precedence over Sandbox. See SecurityPolicy.
+	Policy *Policy
+	// MaxSteps limits the number of reduction steps a single top-level Eval,
+	// EvalAll or Apply call may take; zero means unlimited. Nested calls made
+	// by primitives share the budget of the outermost call.
+	MaxSteps int64
+	// MaxDepth limits the number of frames waiting for a value, the
+	// evaluator's equivalent of stack depth; zero means unlimited. Calls in
+	// tail position, including Gisp's return of a call, do not add frames.
+	MaxDepth int
+	// MaxAlloc limits the length of a single string or vector built by
+	// primitives such as makeVector. Zero selects DefaultMaxAlloc and a
+	// negative value removes the limit.
+	MaxAlloc int64
+	// BacktraceDepth limits the number of calls listed in the backtrace of
+	// an error escaping an evaluation. Zero selects DefaultBacktraceDepth
+	// and a negative value turns backtraces off.
+	BacktraceDepth int
+	// NoFastArith turns off the fast path for integer arithmetic on
+	// variables and constants, so that every such call applies its
+	// primitive. It exists for measuring the fast path.
+	NoFastArith bool
+	// TraceContinuations logs every continuation captured by call/cc and
+	// every jump to one, with the continuation's number and the depth of
+	// the stack, to the trace output. Gisp's return, break and continue
+	// are built on call/cc and show up too.
+	TraceContinuations bool
+	// Engine, when set, runs Eval and Apply in place of the tree-walking
+	// interpreter; see lang/bytecode.
+	Engine Engine
+	// Shadow controls how redefining a builtin recorded by SealBuiltins
+	// at the top level is reported.
+	Shadow     ShadowPolicy
+	steps      int64
+	depth      int
 	currentEnv *Env
+	traced     map[*Closure]string
+	contSeq    int
+	in         io.Reader
+	inValues   *valueInput
+	out        io.Writer
+	errOut     io.Writer
+	traceOut   io.Writer
+	warnOut    io.Writer
+	builtins   map[string]Value
+	intOps     map[*primitive]intOp
+	loading    []loadingFile
+	modules    map[string]*Env
+	interrupt  atomic.Bool
 }
 
 // NewEvaluator constructs an evaluator rooted at a new global environment.
@@ -14,20 +92,172 @@ func NewEvaluator() *Evaluator {
 	return &Evaluator{Global: global, currentEnv: global}
 }
 
+// Fork returns an evaluator for running part of a program on another
+// goroutine, as go does. It shares the global environment, the limits, the
+// policy, the engine and the input and output streams of ev, while the
+// state of an evaluation in progress, such as the step count, is its own.
+// Traced procedures and loaded modules are copied, so later changes made
+// through either evaluator do not affect the other.
+func (ev *Evaluator) Fork() *Evaluator {
+	fork := &Evaluator{
+		Global:             ev.Global,
+		Sandbox:            ev.Sandbox,
+		Policy:             ev.Policy,
+		MaxSteps:           ev.MaxSteps,
+		MaxDepth:           ev.MaxDepth,
+		MaxAlloc:           ev.MaxAlloc,
+		BacktraceDepth:     ev.BacktraceDepth,
+		NoFastArith:        ev.NoFastArith,
+		TraceContinuations: ev.TraceContinuations,
+		Engine:             ev.Engine,
+		Shadow:             ev.Shadow,
+		currentEnv:         ev.Global,
+		in:                 ev.in,
+		inValues:           ev.sharedValues(),
+		out:                ev.out,
+		errOut:             ev.errOut,
+		traceOut:           ev.traceOut,
+		warnOut:            ev.warnOut,
+		builtins:           ev.builtins,
+		intOps:             ev.intOps,
+		loading:            slices.Clone(ev.loading),
+	}
+	if ev.traced != nil {
+		fork.traced = maps.Clone(ev.traced)
+	}
+	if ev.modules != nil {
+		fork.modules = maps.Clone(ev.modules)
+	}
+	return fork
+}
+
+// CheckAlloc returns an error wrapping ErrAllocLimit when n elements exceed
+// the evaluator's allocation limit.
+func (ev *Evaluator) CheckAlloc(n int64) error {
+	limit := ev.MaxAlloc
+	if limit == 0 {
+		limit = DefaultMaxAlloc
+	}
+	if limit > 0 && n > limit {
+		return fmt.Errorf("%w: length %d exceeds limit %d", ErrAllocLimit, n, limit)
+	}
+	return nil
+}
+
+// SetOutput redirects what primitives such as display print; it defaults
+// to standard output.
+func (ev *Evaluator) SetOutput(w io.Writer) {
+	ev.out = w
+}
+
+// Output returns the writer primitives print to.
+func (ev *Evaluator) Output() io.Writer {
+	if ev.out == nil {
+		return os.Stdout
+	}
+	return ev.out
+}
+
+// SetStdout is SetOutput under the name that pairs with SetStdin and
+// SetStderr.
+func (ev *Evaluator) SetStdout(w io.Writer) {
+	ev.SetOutput(w)
+}
+
+// SetStderr redirects the evaluator's error stream, which also receives
+// warnings unless SetWarningOutput says otherwise; it defaults to standard
+// error.
+func (ev *Evaluator) SetStderr(w io.Writer) {
+	ev.errOut = w
+}
+
+// Stderr returns the evaluator's error stream.
+func (ev *Evaluator) Stderr() io.Writer {
+	if ev.errOut == nil {
+		return os.Stderr
+	}
+	return ev.errOut
+}
+
+// SetStdin replaces what primitives such as read consume; it defaults to
+// standard input. Values already buffered from the previous stream are
+// dropped.
+func (ev *Evaluator) SetStdin(r io.Reader) {
+	ev.in = r
+	ev.inValues = nil
+}
+
+// SetReadInput makes read take its values from r rather than parsing them
+// from Stdin, until the next SetReadInput or SetStdin; nil goes back to
+// Stdin. Evaluators forked from ev afterwards read from r too.
+func (ev *Evaluator) SetReadInput(r ValueReader) {
+	ev.inValues = nil
+	if r != nil {
+		ev.inValues = &valueInput{r: r}
+	}
+}
+
+// Stdin returns the reader primitives consume input from.
+func (ev *Evaluator) Stdin() io.Reader {
+	if ev.in == nil {
+		return os.Stdin
+	}
+	return ev.in
+}
+
+// ValueReader parses successive values from an input stream; Read returns
+// io.EOF once the stream is exhausted.
+type ValueReader interface {
+	Read() (Value, error)
+}
+
+// StdinValues returns the value reader read consumes: the one given to
+// SetReadInput, or one over Stdin built with open the first time and after
+// each SetStdin, so that values buffered by one read are not lost to the
+// next. An evaluator and those forked from it share the reader, and it
+// may be used from their goroutines at once.
+func (ev *Evaluator) StdinValues(open func(io.Reader) ValueReader) ValueReader {
+	in := ev.sharedValues()
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.r == nil {
+		in.r = open(ev.Stdin())
+	}
+	return in
+}
+
+// sharedValues returns the value input of ev, creating an unopened one so
+// that forks can share it before the first read.
+func (ev *Evaluator) sharedValues() *valueInput {
+	if ev.inValues == nil {
+		ev.inValues = &valueInput{}
+	}
+	return ev.inValues
+}
+
+// valueInput is the value reader behind read, serializing the reads of an
+// evaluator and its forks so that each value goes to exactly one of them.
+type valueInput struct {
+	mu sync.Mutex
+	r  ValueReader
+}
+
+func (in *valueInput) Read() (Value, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.r.Read()
+}
+
 // Eval evaluates a single expression within the provided environment.
 func (ev *Evaluator) Eval(expr Value, env *Env) (Value, error) {
+	if ev.Engine == nil {
+		return ev.Interpret(expr, env)
+	}
+	defer ev.enter()()
 	if env == nil {
 		env = ev.Global
 	}
-	prev := ev.currentEnv
-	ev.setCurrentEnv(env)
-	state := &evalState{
-		expr: expr,
-		env:  env,
-	}
-	val, err := ev.run(state)
-	ev.currentEnv = prev
-	return val, err
+	return ev.Engine.Eval(ev, expr, env)
 }
 
 // CurrentEnv returns the environment associated with the ongoing evaluation.
@@ -54,8 +284,14 @@ func (ev *Evaluator) withCurrentEnv(env *Env, fn func() (Value, error)) (Value,
 	return val, err
 }
 
-// Apply invokes a procedure with arguments.
+// Apply invokes a procedure with arguments. It runs a separate evaluation
+// loop, so primitives that call back into the program should return
+// Callback or TailCall instead.
 func (ev *Evaluator) Apply(proc Value, args []Value) (Value, error) {
+	defer ev.enter()()
+	if ev.Engine != nil {
+		return ev.Engine.Apply(ev, proc, args)
+	}
 	state := &evalState{}
 	if err := ev.invokeProcedure(state, proc, args); err != nil {
 		return Value{}, err
@@ -63,26 +299,57 @@ func (ev *Evaluator) Apply(proc Value, args []Value) (Value, error) {
 	return ev.run(state)
 }
 
+// enter marks the start of an evaluation, resetting the step count when it
+// is the outermost one, and returns the function that marks its end.
+func (ev *Evaluator) enter() func() {
+	if ev.depth == 0 {
+		ev.steps = 0
+		ev.interrupt.Store(false)
+	}
+	ev.depth++
+	return func() { ev.depth-- }
+}
+
+// Interrupt asks the running evaluation to stop with ErrInterrupted at its
+// next step. It may be called from another goroutine, such as a signal
+// handler; bindings made before the interruption are kept.
+func (ev *Evaluator) Interrupt() {
+	ev.interrupt.Store(true)
+}
+
 func (ev *Evaluator) run(state *evalState) (Value, error) {
 	for {
+		if err := ev.Tick(); err != nil {
+			return Value{}, err
+		}
+		if ev.MaxDepth > 0 && len(state.cont) > ev.MaxDepth {
+			return Value{}, fmt.Errorf("%w: more than %d frames", ErrDepthExceeded, ev.MaxDepth)
+		}
 		if state.returning {
 			if len(state.cont) == 0 {
 				return state.value, nil
 			}
 			frame := state.pop()
 			if err := frame.apply(ev, state.value, state); err != nil {
-				return Value{}, err
+				pos := state.pos
+				if err := ev.raise(state, err); err != nil {
+					return Value{}, ev.WithBacktrace(AtPosition(err, pos), state.backtrace())
+				}
 			}
 			continue
 		}
 		if err := ev.evaluateCurrent(state); err != nil {
-			return Value{}, err
+			pos := state.pos
+			if err := ev.raise(state, err); err != nil {
+				return Value{}, ev.WithBacktrace(AtPosition(err, pos), state.backtrace())
+			}
 		}
 	}
 }
 
 // EvalAll evaluates a sequence of expressions.
 func (ev *Evaluator) EvalAll(exprs []Value, env *Env) (Value, error) {
+	defer ev.enter()()
 	result := EmptyList
 	for _, expr := range exprs {
 		val, err := ev.Eval(expr, env)
@@ -100,9 +367,14 @@ type evalState struct {
 	cont      []frame
 	value     Value
 	returning bool
+	site      *Pair      // call site of expr when it is a symbol in a call
+	pos       *SourcePos // innermost form with a position being evaluated
+	calling   *Pair      // call form whose operator is being invoked
+	calls     []callRecord
 }
 
 func (st *evalState) push(f frame) {
+	f.setPosition(st.pos)
 	st.cont = append(st.cont, f)
 }
 
@@ -113,6 +385,10 @@ func (st *evalState) pop() frame {
 	}
 	f := st.cont[l-1]
 	st.cont = st.cont[:l-1]
+	st.pos = f.position()
+	if n := len(st.calls); n > 0 && st.calls[n-1].depth >= l {
+		st.leaveCalls()
+	}
 	return f
 }
 
@@ -122,17 +398,38 @@ func (st *evalState) setExpr(expr Value, env *Env) {
 		st.env = env
 	}
 	st.returning = false
+	st.site = nil
 }
 
 type frame interface {
 	apply(ev *Evaluator, val Value, state *evalState) error
 	clone() frame
+	position() *SourcePos
+	setPosition(pos *SourcePos)
+}
+
+// framePos is embedded in every frame. It holds the position of the form
+// being evaluated when the frame was pushed, which is current again once
+// the frame is popped, so an error is reported at the innermost form
+// enclosing it in the source.
+type framePos struct {
+	pos *SourcePos
 }
 
+func (f *framePos) position() *SourcePos { return f.pos }
+
+func (f *framePos) setPosition(pos *SourcePos) { f.pos = pos }
+
 func (ev *Evaluator) evaluateCurrent(state *evalState) error {
 	switch state.expr.Type {
 	case TypeSymbol:
-		val, err := state.env.Get(state.expr.Sym())
+		var val Value
+		var err error
+		if state.site != nil {
+			val, err = state.env.lookupAt(state.site, state.expr.Sym())
+		} else {
+			val, err = state.env.Get(state.expr.Sym())
+		}
 		if err != nil {
 			return err
 		}
@@ -154,6 +451,9 @@ func (ev *Evaluator) evaluatePair(state *evalState) error {
 		return fmt.Errorf("expected pair value")
 	}
 	head := pair.First
+	if pair.pos != nil {
+		state.pos = pair.pos
+	}
 
 	if head.Type == TypeSymbol {
 		switch head.Sym() {
@@ -175,30 +475,41 @@ func (ev *Evaluator) evaluatePair(state *evalState) error {
 			return ev.evalLet(pair.Rest, state)
 		case "quasiquote":
 			return ev.evalQuasiQuote(pair.Rest, state)
-		case "call/cc":
-			return ev.evalCallCC(pair.Rest, state)
+		case "call/cc", "call/1cc":
+			return ev.evalCallCC(head.Sym(), pair.Rest, state)
 		case "cond":
 			return ev.evalCond(pair.Rest, state)
+		case "catch":
+			return ev.evalCatch(pair.Rest, state)
+		case "unwind-protect":
+			return ev.evalUnwindProtect(pair.Rest, state)
 		}
 	}
 
 	if head.Type == TypeSymbol {
-		if macroVal, err := state.env.Get(head.Sym()); err == nil && macroVal.Type == TypeMacro {
-			expanded, err := ev.expandMacro(macroVal.Macro(), pair.Rest, state.env)
-			if err != nil {
-				return err
+		if headVal, err := state.env.lookupAt(pair, head.Sym()); err == nil {
+			if headVal.Type == TypeMacro {
+				expanded, err := ev.expandMacro(headVal.Macro(), pair.Rest, state.env)
+				if err != nil {
+					return err
+				}
+				state.setExpr(expanded, state.env)
+				return nil
+			}
+			if ev.fastArith(state, headVal, pair) {
+				return nil
 			}
-			state.setExpr(expanded, state.env)
-			return nil
 		}
 	}
 
 	frame := &callFrame{
 		env:       state.env,
+		form:      pair,
 		remaining: pair.Rest,
 	}
 	state.push(frame)
 	state.setExpr(pair.First, state.env)
+	state.site = pair
 	return nil
 }
 
@@ -216,6 +527,7 @@ func (ev *Evaluator) evalQuote(args Value, state *evalState) error {
 }
 
 type ifFrame struct {
+	framePos
 	consequent Value
 	alternate  Value
 	env        *Env
@@ -234,6 +546,7 @@ func (f *ifFrame) apply(ev *Evaluator, val Value, state *evalState) error {
 
 func (f *ifFrame) clone() frame {
 	return &ifFrame{
+		framePos:   f.framePos,
 		consequent: f.consequent,
 		alternate:  f.alternate,
 		env:        f.env,
@@ -249,6 +562,7 @@ func (ev *Evaluator) evalCond(args Value, state *evalState) error {
 }
 
 type condFrame struct {
+	framePos
 	remaining []Value
 	body      Value
 	env       *Env
@@ -268,6 +582,7 @@ func (f *condFrame) clone() frame {
 		remainingCopy = append([]Value(nil), f.remaining...)
 	}
 	return &condFrame{
+		framePos:  f.framePos,
 		remaining: remainingCopy,
 		body:      f.body,
 		env:       f.env,
@@ -329,6 +644,7 @@ func (ev *Evaluator) evalIf(args Value, state *evalState) error {
 }
 
 type beginFrame struct {
+	framePos
 	exprs []Value
 	env   *Env
 }
@@ -352,8 +668,9 @@ func (f *beginFrame) clone() frame {
 	cp := make([]Value, len(f.exprs))
 	copy(cp, f.exprs)
 	return &beginFrame{
-		exprs: cp,
-		env:   f.env,
+		framePos: f.framePos,
+		exprs:    cp,
+		env:      f.env,
 	}
 }
 
@@ -391,6 +708,7 @@ func (ev *Evaluator) evalLambda(args Value, state *evalState) error {
 	}
 	body := parts[1:]
 	closure := ClosureValue(params, rest, body, state.env)
+	closure.Closure().shape = args.Pair()
 	state.value = closure
 	state.returning = true
 	return nil
@@ -430,6 +748,9 @@ func (ev *Evaluator) evalDefine(args Value, state *evalState) error {
 		if err != nil {
 			return err
 		}
+		if err := ev.checkShadow(nameVal.Sym(), state.env); err != nil {
+			return err
+		}
 		lambda := ClosureValue(params, rest, body, state.env)
 		state.env.Define(nameVal.Sym(), lambda)
 		state.value = lambda
@@ -441,11 +762,15 @@ func (ev *Evaluator) evalDefine(args Value, state *evalState) error {
 }
 
 type defineFrame struct {
+	framePos
 	name string
 	env  *Env
 }
 
 func (f *defineFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	if err := ev.checkShadow(f.name, f.env); err != nil {
+		return err
+	}
 	f.env.Define(f.name, val)
 	state.value = val
 	state.returning = true
@@ -453,7 +778,7 @@ func (f *defineFrame) apply(ev *Evaluator, val Value, state *evalState) error {
 }
 
 func (f *defineFrame) clone() frame {
-	return &defineFrame{name: f.name, env: f.env}
+	return &defineFrame{framePos: f.framePos, name: f.name, env: f.env}
 }
 
 func (ev *Evaluator) evalDefineMacro(args Value, state *evalState) error {
@@ -478,6 +803,9 @@ func (ev *Evaluator) evalDefineMacro(args Value, state *evalState) error {
 	if err != nil {
 		return err
 	}
+	if err := ev.checkShadow(nameVal.Sym(), state.env); err != nil {
+		return err
+	}
 	macro := MacroValue(params, rest, body, state.env)
 	state.env.Define(nameVal.Sym(), macro)
 	state.value = macro
@@ -503,11 +831,17 @@ func (ev *Evaluator) evalSet(args Value, state *evalState) error {
 }
 
 type setFrame struct {
+	framePos
 	name string
 	env  *Env
 }
 
 func (f *setFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	if frame, err := f.env.Locate(f.name); err == nil {
+		if err := ev.checkShadow(f.name, frame); err != nil {
+			return err
+		}
+	}
 	if err := f.env.Set(f.name, val); err != nil {
 		return err
 	}
@@ -517,7 +851,7 @@ func (f *setFrame) apply(ev *Evaluator, val Value, state *evalState) error {
 }
 
 func (f *setFrame) clone() frame {
-	return &setFrame{name: f.name, env: f.env}
+	return &setFrame{framePos: f.framePos, name: f.name, env: f.env}
 }
 
 func (ev *Evaluator) evalLet(args Value, state *evalState) error {
@@ -573,15 +907,10 @@ func (ev *Evaluator) evalLet(args Value, state *evalState) error {
 		values = append(values, valueSlice[0])
 		iter = iterPair.Rest
 	}
-	paramNames := make([]Value, len(names))
-	copy(paramNames, names)
-	lambdaParams := EmptyList
-	for i := len(paramNames) - 1; i >= 0; i-- {
-		lambdaParams = PairValue(paramNames[i], lambdaParams)
-	}
-	lambdaList := append([]Value{SymbolValue("lambda"), lambdaParams}, body...)
-	lambdaExpr := List(lambdaList...)
 	if letName != "" {
+		lambdaParams := List(names...)
+		lambdaList := append([]Value{SymbolValue("lambda"), lambdaParams}, body...)
+		lambdaExpr := List(lambdaList...)
 		binding := List(SymbolValue(letName), EmptyList)
 		bindingList := List(binding)
 		setExpr := List(SymbolValue("set!"), SymbolValue(letName), lambdaExpr)
@@ -591,12 +920,58 @@ func (ev *Evaluator) evalLet(args Value, state *evalState) error {
 		state.setExpr(List(letParts...), state.env)
 		return nil
 	}
-	callList := []Value{lambdaExpr}
-	callList = append(callList, values...)
-	state.setExpr(List(callList...), state.env)
+	frame := &letFrame{exprs: values, body: body, env: state.env, shape: args.Pair()}
+	for _, name := range names {
+		if slices.Contains(frame.names, name.Sym()) {
+			return fmt.Errorf("duplicate parameter %s", name.Sym())
+		}
+		frame.names = append(frame.names, name.Sym())
+	}
+	return frame.next(state)
+}
+
+// letFrame evaluates the initial values of a let in order and then runs
+// its body in a new frame binding them. The let form is the shape of that
+// frame, as the lambda form is for a procedure call.
+type letFrame struct {
+	framePos
+	names  []string
+	exprs  []Value
+	values []Value
+	body   []Value
+	env    *Env
+	shape  *Pair
+}
+
+func (f *letFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	f.values = append(f.values, val)
+	return f.next(state)
+}
+
+func (f *letFrame) next(state *evalState) error {
+	if len(f.values) < len(f.exprs) {
+		state.push(f)
+		state.setExpr(f.exprs[len(f.values)], f.env)
+		return nil
+	}
+	env := NewEnv(f.env)
+	env.shape.Store(f.shape)
+	for i, name := range f.names {
+		env.values[name] = f.values[i]
+	}
+	if len(f.body) > 1 {
+		state.push(&beginFrame{exprs: f.body[1:], env: env})
+	}
+	state.setExpr(f.body[0], env)
 	return nil
 }
 
+func (f *letFrame) clone() frame {
+	cp := *f
+	cp.values = append([]Value(nil), f.values...)
+	return &cp
+}
+
 func (ev *Evaluator) evalQuasiQuote(args Value, state *evalState) error {
 	exprs, err := ToSlice(args)
 	if err != nil {
@@ -613,17 +988,18 @@ func (ev *Evaluator) evalQuasiQuote(args Value, state *evalState) error {
 	return nil
 }
 
-func (ev *Evaluator) evalCallCC(args Value, state *evalState) error {
+func (ev *Evaluator) evalCallCC(name string, args Value, state *evalState) error {
 	exprs, err := ToSlice(args)
 	if err != nil {
 		return err
 	}
 	if len(exprs) != 1 {
-		return fmt.Errorf("call/cc expects single argument")
+		return fmt.Errorf("%s expects single argument", name)
 	}
 	frame := &callCCFrame{
-		env:   state.env,
-		stack: cloneFrames(state.cont),
+		oneShot: name == "call/1cc",
+		env:     state.env,
+		stack:   cloneFrames(state.cont),
 	}
 	state.push(frame)
 	state.setExpr(exprs[0], state.env)
@@ -631,19 +1007,29 @@ func (ev *Evaluator) evalCallCC(args Value, state *evalState) error {
 }
 
 type callCCFrame struct {
-	env   *Env
-	stack []frame
+	framePos
+	env     *Env
+	stack   []frame
+	oneShot bool
 }
 
 func (f *callCCFrame) apply(ev *Evaluator, val Value, state *evalState) error {
 	contVal := ContinuationValue(cloneFrames(f.stack), f.env, ev)
+	ev.contSeq++
+	contVal.Continuation().ID = ev.contSeq
+	contVal.Continuation().OneShot = f.oneShot
+	if ev.TraceContinuations {
+		ev.traceLine(0, fmt.Sprintf("call/cc: capture #%d at depth %d", ev.contSeq, len(f.stack)))
+	}
 	return ev.invokeProcedure(state, val, []Value{contVal})
 }
 
 func (f *callCCFrame) clone() frame {
 	return &callCCFrame{
-		env:   f.env,
-		stack: cloneFrames(f.stack),
+		framePos: f.framePos,
+		env:      f.env,
+		stack:    cloneFrames(f.stack),
+		oneShot:  f.oneShot,
 	}
 }
 
@@ -667,7 +1053,43 @@ func (ev *Evaluator) expandMacro(m *Macro, args Value, env *Env) (Value, error)
 	return result, nil
 }
 
+// maxExpandSteps bounds MacroexpandSteps, so a macro that keeps expanding
+// into another macro call is reported instead of looping forever.
+const maxExpandSteps = 1000
+
+// MacroexpandSteps returns expr followed by each successive expansion of
+// the macro call at its head, looked up in env (the global environment when
+// nil). It stops at the first form that is not a macro call; subforms are
+// left unexpanded.
+func (ev *Evaluator) MacroexpandSteps(expr Value, env *Env) ([]Value, error) {
+	if env == nil {
+		env = ev.Global
+	}
+	steps := []Value{expr}
+	for {
+		pair := expr.Pair()
+		if expr.Type != TypePair || pair == nil || pair.First.Type != TypeSymbol {
+			return steps, nil
+		}
+		macroVal, err := env.Get(pair.First.Sym())
+		if err != nil || macroVal.Type != TypeMacro {
+			return steps, nil
+		}
+		if len(steps) > maxExpandSteps {
+			return nil, fmt.Errorf("macro expansion of %s did not finish after %d steps", pair.First.Sym(), maxExpandSteps)
+		}
+		expanded, err := ev.expandMacro(macroVal.Macro(), pair.Rest, env)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, expanded)
+		expr = expanded
+	}
+}
+
 func (ev *Evaluator) invokeProcedure(state *evalState, operator Value, args []Value) error {
+	form := state.calling
+	state.calling = nil
 	switch operator.Type {
 	case TypePrimitive:
 		fn := operator.Primitive()
@@ -680,6 +1102,9 @@ func (ev *Evaluator) invokeProcedure(state *evalState, operator Value, args []Va
 		if err != nil {
 			return err
 		}
+		if val.Type == typeCallback {
+			return ev.resumeCallback(state, val)
+		}
 		state.value = val
 		state.returning = true
 	case TypeClosure:
@@ -688,9 +1113,17 @@ func (ev *Evaluator) invokeProcedure(state *evalState, operator Value, args []Va
 			return fmt.Errorf("invalid closure")
 		}
 		newEnv := NewEnv(closure.Env)
+		newEnv.shape.Store(closure.shape)
 		if err := bindParameters(newEnv, closure.Params, closure.Rest, args); err != nil {
 			return err
 		}
+		if name, ok := ev.traced[closure]; ok {
+			ev.traceEnter(state, name, args)
+		}
+		if form != nil {
+			state.enterCall(form)
+		}
+		state.pos = nil
 		body := closure.Body
 		if len(body) == 0 {
 			state.value = EmptyList
@@ -708,14 +1141,25 @@ func (ev *Evaluator) invokeProcedure(state *evalState, operator Value, args []Va
 		if cont == nil || cont.Eval == nil {
 			return fmt.Errorf("invalid continuation")
 		}
+		if err := cont.Claim(); err != nil {
+			return err
+		}
 		var arg Value = EmptyList
 		if len(args) > 0 {
 			arg = args[0]
 		}
-		state.cont = cloneFrames(cont.Frames)
-		state.env = cont.Env
-		state.value = arg
-		state.returning = true
+		if cont.State != nil {
+			return &Jump{Cont: cont, Value: arg}
+		}
+		if ev.TraceContinuations {
+			frames := "frames"
+			if len(state.cont) == 1 {
+				frames = "frame"
+			}
+			ev.traceLine(0, fmt.Sprintf("call/cc: invoke #%d with %s, discarding %d %s and resuming at depth %d",
+				cont.ID, arg.String(), len(state.cont), frames, len(cont.Frames)))
+		}
+		ev.unwindTo(state, cont, arg)
 	default:
 		return fmt.Errorf("attempt to call non-function: %s", operator.String())
 	}
@@ -723,7 +1167,9 @@ func (ev *Evaluator) invokeProcedure(state *evalState, operator Value, args []Va
 }
 
 type callFrame struct {
+	framePos
 	env          *Env
+	form         *Pair
 	operator     Value
 	remaining    Value
 	args         []Value
@@ -739,9 +1185,26 @@ func (f *callFrame) apply(ev *Evaluator, val Value, state *evalState) error {
 	}
 
 	if f.remaining.Type == TypeEmpty {
+		// The last argument may have been a call that left state.env in
+		// its callee; a primitive must see the caller's environment.
+		state.env = f.env
+		state.calling = f.form
 		return ev.invokeProcedure(state, f.operator, f.args)
 	}
 
+	if !ev.TraceContinuations && f.escapesWithLastArg(state) {
+		// The value of the only argument goes straight to the continuation,
+		// so evaluate it on the continuation's stack rather than on top of
+		// this one. Gisp compiles return to such a call, which keeps a
+		// function returning the result of another call in constant space.
+		// Traced jumps skip this so that the log can show the value.
+		remPair := f.remaining.Pair()
+		state.cont = cloneFrames(f.operator.Continuation().Frames)
+		state.setExpr(remPair.First, f.env)
+		state.site = remPair
+		return nil
+	}
+
 	if f.remaining.Type != TypePair {
 		return fmt.Errorf("malformed argument list")
 	}
@@ -753,14 +1216,30 @@ func (f *callFrame) apply(ev *Evaluator, val Value, state *evalState) error {
 	f.remaining = remPair.Rest
 	state.push(f)
 	state.setExpr(next, f.env)
+	state.site = remPair
 	return nil
 }
 
+// escapesWithLastArg reports whether the operator is a continuation applied
+// to a single argument that has not been evaluated yet, and the jump leaves
+// no unwind-protect form whose cleanup must wait for the argument.
+func (f *callFrame) escapesWithLastArg(state *evalState) bool {
+	if f.operator.Type != TypeContinuation || len(f.args) != 0 || f.remaining.Type != TypePair {
+		return false
+	}
+	cont := f.operator.Continuation()
+	remPair := f.remaining.Pair()
+	return cont != nil && cont.Eval != nil && cont.State == nil && !cont.OneShot && remPair != nil && remPair.Rest.Type == TypeEmpty &&
+		len(leftExtents(state.cont, cont.Frames)) == 0
+}
+
 func (f *callFrame) clone() frame {
 	argsCopy := make([]Value, len(f.args))
 	copy(argsCopy, f.args)
 	return &callFrame{
+		framePos:     f.framePos,
 		env:          f.env,
+		form:         f.form,
 		operator:     f.operator,
 		remaining:    f.remaining,
 		args:         argsCopy,
@@ -777,6 +1256,9 @@ func parseParams(val Value) ([]string, string, error) {
 				return nil, "", fmt.Errorf("multiple rest parameters")
 			}
 			rest = val.Sym()
+			if slices.Contains(params, rest) {
+				return nil, "", fmt.Errorf("duplicate parameter %s", rest)
+			}
 			break
 		}
 		if val.Type != TypePair {
@@ -790,6 +1272,9 @@ func parseParams(val Value) ([]string, string, error) {
 		if name.Type != TypeSymbol {
 			return nil, "", fmt.Errorf("parameter must be a symbol")
 		}
+		if slices.Contains(params, name.Sym()) {
+			return nil, "", fmt.Errorf("duplicate parameter %s", name.Sym())
+		}
 		params = append(params, name.Sym())
 		val = p.Rest
 	}
@@ -798,15 +1283,18 @@ func parseParams(val Value) ([]string, string, error) {
 
 func bindParameters(env *Env, params []string, rest string, args []Value) error {
 	if len(args) < len(params) {
-		return fmt.Errorf("expected at least %d arguments, got %d", len(params), len(args))
+		return &ArityError{Want: len(params), AtLeast: rest != "", Got: len(args)}
 	}
+	// env is a new frame that no lookup has passed through yet, so its
+	// bindings are stored directly rather than through Define, which would
+	// needlessly invalidate the inline caches.
 	for i, name := range params {
-		env.Define(name, args[i])
+		env.values[name] = args[i]
 	}
 	if rest != "" {
-		env.Define(rest, listFromArgs(args[len(params):]))
+		env.values[rest] = listFromArgs(args[len(params):])
 	} else if len(args) != len(params) {
-		return fmt.Errorf("expected exactly %d arguments, got %d", len(params), len(args))
+		return &ArityError{Want: len(params), Got: len(args)}
 	}
 	return nil
 }
@@ -818,6 +1306,12 @@ func listFromArgs(args []Value) Value {
 	return List(args...)
 }
 
+// expandQuasiQuote rewrites the template of a quasiquote at the given
+// nesting depth into code that builds it with cons and append. Unquoted
+// expressions at depth 1 are evaluated; deeper ones are kept as data with
+// their own templates expanded one level shallower. A vector holding an
+// unquote is built from its elements as a list, converted by listToVector;
+// one without is kept as it is.
 func expandQuasiQuote(expr Value, depth int) (Value, error) {
 	switch expr.Type {
 	case TypePair:
@@ -825,66 +1319,62 @@ func expandQuasiQuote(expr Value, depth int) (Value, error) {
 		if p == nil {
 			return Value{}, fmt.Errorf("expected pair")
 		}
-		head := p.First
-		tail := p.Rest
-		if tagged, ok, err := taggedForm(head, "unquote"); err != nil {
-			return Value{}, err
-		} else if ok {
-			if depth == 1 {
-				return tagged, nil
-			}
-			sub, err := expandQuasiQuote(tagged, depth-1)
+		// The tagged forms are checked on expr itself as well as on list
+		// elements, so that an unquote after a dot, as in `(a . ,rest),
+		// supplies the tail of the list.
+		for _, tag := range []string{"unquote", "unquote-splicing", "quasiquote"} {
+			tagged, ok, err := taggedForm(expr, tag)
 			if err != nil {
 				return Value{}, err
 			}
-			tailExpanded, err := expandQuasiQuote(tail, depth)
-			if err != nil {
-				return Value{}, err
+			if !ok {
+				continue
 			}
-			return List(SymbolValue("cons"), List(SymbolValue("quote"), SymbolValue("unquote")), List(SymbolValue("cons"), sub, tailExpanded)), nil
-		}
-		if tagged, ok, err := taggedForm(head, "unquote-splicing"); err != nil {
-			return Value{}, err
-		} else if ok {
-			if depth == 1 {
-				tailExpanded, err := expandQuasiQuote(tail, depth)
-				if err != nil {
-					return Value{}, err
-				}
-				return List(SymbolValue("append"), tagged, tailExpanded), nil
+			if depth == 1 && tag == "unquote" {
+				return tagged, nil
 			}
-			sub, err := expandQuasiQuote(tagged, depth-1)
-			if err != nil {
-				return Value{}, err
+			if depth == 1 && tag == "unquote-splicing" {
+				return Value{}, fmt.Errorf("unquote-splicing is only valid inside a list")
+			}
+			inner := depth - 1
+			if tag == "quasiquote" {
+				inner = depth + 1
 			}
-			tailExpanded, err := expandQuasiQuote(tail, depth)
+			// The argument is expanded as a list, so that a splice in
+			// it, as in ``(a ,,@xs), supplies the arguments of the
+			// unquote kept as data.
+			args, err := expandQuasiQuote(p.Rest, inner)
 			if err != nil {
 				return Value{}, err
 			}
-			return List(SymbolValue("cons"), List(SymbolValue("quote"), SymbolValue("unquote-splicing")), List(SymbolValue("cons"), sub, tailExpanded)), nil
+			return List(SymbolValue("cons"), List(SymbolValue("quote"), SymbolValue(tag)), args), nil
 		}
-		if tagged, ok, err := taggedForm(head, "quasiquote"); err != nil {
+		tailExpanded, err := expandQuasiQuote(p.Rest, depth)
+		if err != nil {
 			return Value{}, err
-		} else if ok {
-			sub, err := expandQuasiQuote(tagged, depth+1)
-			if err != nil {
-				return Value{}, err
-			}
-			tailExpanded, err := expandQuasiQuote(tail, depth)
-			if err != nil {
+		}
+		if depth == 1 {
+			if tagged, ok, err := taggedForm(p.First, "unquote-splicing"); err != nil {
 				return Value{}, err
+			} else if ok {
+				return List(SymbolValue("append"), tagged, tailExpanded), nil
 			}
-			return List(SymbolValue("cons"), List(SymbolValue("quote"), SymbolValue("quasiquote")), List(SymbolValue("cons"), sub, tailExpanded)), nil
 		}
-		headExpanded, err := expandQuasiQuote(head, depth)
+		headExpanded, err := expandQuasiQuote(p.First, depth)
 		if err != nil {
 			return Value{}, err
 		}
-		tailExpanded, err := expandQuasiQuote(tail, depth)
+		return List(SymbolValue("cons"), headExpanded, tailExpanded), nil
+	case TypeVector:
+		vec := expr.Vector()
+		if vec == nil || !containsUnquote(expr) {
+			return expr, nil
+		}
+		elems, err := expandQuasiQuote(List(vec.Elements...), depth)
 		if err != nil {
 			return Value{}, err
 		}
-		return List(SymbolValue("cons"), headExpanded, tailExpanded), nil
+		return List(SymbolValue("listToVector"), elems), nil
 	case TypeSymbol:
 		return List(SymbolValue("quote"), expr), nil
 	case TypeEmpty:
@@ -894,6 +1384,32 @@ func expandQuasiQuote(expr Value, depth int) (Value, error) {
 	}
 }
 
+// containsUnquote reports whether a quasiquote template holds an unquote
+// or unquote-splicing form at any depth.
+func containsUnquote(v Value) bool {
+	switch v.Type {
+	case TypePair:
+		for cur := v; cur.Type == TypePair && cur.Pair() != nil; cur = cur.Pair().Rest {
+			p := cur.Pair()
+			if isSymbolNamed(p.First, "unquote") || isSymbolNamed(p.First, "unquote-splicing") || containsUnquote(p.First) {
+				return true
+			}
+			if p.Rest.Type != TypePair && containsUnquote(p.Rest) {
+				return true
+			}
+		}
+	case TypeVector:
+		if vec := v.Vector(); vec != nil {
+			for _, elem := range vec.Elements {
+				if containsUnquote(elem) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func isSymbolNamed(v Value, name string) bool {
 	return v.Type == TypeSymbol && v.Sym() == name
 }
@@ -0,0 +1,81 @@
+package lang_test
+
+import (
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/parser"
+	"github.com/sergev/gisp/runtime"
+)
+
+// benchScript compiles the named script of the runtime benchmark suite once
+// and then measures evaluating it in a fresh evaluator per iteration.
+func benchScript(b *testing.B, name, want string) {
+	b.Helper()
+	benchScriptWith(b, name, want, nil)
+}
+
+// benchScriptWith is benchScript with setup applied to each evaluator.
+func benchScriptWith(b *testing.B, name, want string, setup func(*lang.Evaluator)) {
+	b.Helper()
+	var forms []lang.Value
+	for _, script := range runtime.BenchScripts() {
+		if script.Name == name {
+			var err error
+			forms, err = parser.ParseString(script.Source)
+			if err != nil {
+				b.Fatalf("parse %s: %v", name, err)
+			}
+		}
+	}
+	if forms == nil {
+		b.Fatalf("no benchmark script named %s", name)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ev := runtime.NewEvaluator()
+		if setup != nil {
+			setup(ev)
+		}
+		b.StartTimer()
+		val, err := ev.EvalAll(forms, nil)
+		if err != nil {
+			b.Fatalf("%s: %v", name, err)
+		}
+		if got := val.String(); got != want {
+			b.Fatalf("%s => %s, want %s", name, got, want)
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchScript(b, "fib", "6765")
+}
+
+func BenchmarkAckermann(b *testing.B) {
+	benchScript(b, "ackermann", "21")
+}
+
+func BenchmarkNQueens(b *testing.B) {
+	benchScript(b, "nqueens", "4")
+}
+
+func BenchmarkStringBuild(b *testing.B) {
+	benchScript(b, "strings", "2000")
+}
+
+func BenchmarkLookups(b *testing.B) {
+	benchScript(b, "lookups", "59998")
+}
+
+func BenchmarkArith(b *testing.B) {
+	benchScript(b, "arith", "2666466670127")
+}
+
+// BenchmarkArithGeneric runs the same script with every arithmetic call
+// going through its primitive, for comparison with BenchmarkArith.
+func BenchmarkArithGeneric(b *testing.B) {
+	benchScriptWith(b, "arith", "2666466670127", func(ev *lang.Evaluator) { ev.NoFastArith = true })
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func newTestEvaluator() *Evaluator {
@@ -130,8 +131,9 @@ func TestEvaluatorEvalSymbol(t *testing.T) {
 func TestEvaluatorEvalSymbolUnbound(t *testing.T) {
 	ev := newTestEvaluator()
 	_, err := ev.Eval(SymbolValue("missing"), nil)
-	if err == nil {
-		t.Fatal("expected error for unbound symbol")
+	var unbound *UnboundVariableError
+	if !errors.As(err, &unbound) || unbound.Name != "missing" {
+		t.Fatalf("expected UnboundVariableError for missing, got %v", err)
 	}
 }
 
@@ -143,6 +145,136 @@ func TestEvaluatorEvalAll(t *testing.T) {
 	}
 }
 
+func TestEvaluatorMaxSteps(t *testing.T) {
+	ev := newTestEvaluator()
+	loop := List(SymbolValue("define"), List(SymbolValue("spin"), SymbolValue("n")),
+		List(SymbolValue("spin"), List(SymbolValue("+"), SymbolValue("n"), IntValue(1))))
+	mustEval(t, ev, loop)
+
+	ev.MaxSteps = 1000
+	_, err := ev.Eval(List(SymbolValue("spin"), IntValue(0)), nil)
+	if !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("expected ErrFuelExhausted, got %v", err)
+	}
+
+	// The budget is reset for every top-level call.
+	for i := 0; i < 3; i++ {
+		val, err := ev.Eval(List(SymbolValue("+"), IntValue(1), IntValue(2)), nil)
+		if err != nil || val.Int() != 3 {
+			t.Fatalf("expected small evaluation to fit the budget, got %v (%v)", val, err)
+		}
+	}
+
+	// Nested evaluations started by primitives share the outer budget.
+	ev.Global.Define("nested", PrimitiveValue(func(ev *Evaluator, args []Value) (Value, error) {
+		return ev.Apply(args[0], []Value{IntValue(0)})
+	}))
+	_, err = ev.Eval(List(SymbolValue("nested"), SymbolValue("spin")), nil)
+	if !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("expected nested evaluation to exhaust fuel, got %v", err)
+	}
+	_, err = ev.EvalAll([]Value{IntValue(1), List(SymbolValue("spin"), IntValue(0))}, nil)
+	if !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("expected EvalAll to exhaust fuel, got %v", err)
+	}
+
+	ev.MaxSteps = 0
+	val := mustEval(t, ev, List(SymbolValue("+"), IntValue(2), IntValue(2)))
+	if val.Int() != 4 {
+		t.Fatalf("expected 4 with unlimited fuel, got %v", val)
+	}
+}
+
+func TestEvaluatorTailCallsRunInConstantDepth(t *testing.T) {
+	ev := newTestEvaluator()
+	ev.Global.Define("zero?", PrimitiveValue(func(_ *Evaluator, args []Value) (Value, error) {
+		return BoolValue(args[0].Int() == 0), nil
+	}))
+	countdown := List(SymbolValue("define"), List(SymbolValue("countdown"), SymbolValue("n")),
+		List(SymbolValue("if"), List(SymbolValue("zero?"), SymbolValue("n")),
+			SymbolValue("done"),
+			List(SymbolValue("countdown"), List(SymbolValue("+"), SymbolValue("n"), IntValue(-1)))))
+	isEven := List(SymbolValue("define"), List(SymbolValue("even?"), SymbolValue("n")),
+		List(SymbolValue("if"), List(SymbolValue("zero?"), SymbolValue("n")),
+			BoolValue(true),
+			List(SymbolValue("odd?"), List(SymbolValue("+"), SymbolValue("n"), IntValue(-1)))))
+	isOdd := List(SymbolValue("define"), List(SymbolValue("odd?"), SymbolValue("n")),
+		List(SymbolValue("if"), List(SymbolValue("zero?"), SymbolValue("n")),
+			BoolValue(false),
+			List(SymbolValue("even?"), List(SymbolValue("+"), SymbolValue("n"), IntValue(-1)))))
+	// Returning through an escape continuation, as Gisp's return does.
+	escape := List(SymbolValue("define"), List(SymbolValue("escape"), SymbolValue("n")),
+		List(SymbolValue("call/cc"), List(SymbolValue("lambda"), List(SymbolValue("return")),
+			List(SymbolValue("if"), List(SymbolValue("zero?"), SymbolValue("n")),
+				List(SymbolValue("return"), IntValue(0))),
+			List(SymbolValue("return"),
+				List(SymbolValue("escape"), List(SymbolValue("+"), SymbolValue("n"), IntValue(-1)))))))
+	mustEvalAll(t, ev, List(SymbolValue("define"), SymbolValue("done"), IntValue(7)), countdown, isEven, isOdd, escape)
+
+	ev.MaxDepth = 50
+	for _, tc := range []struct {
+		call Value
+		want string
+	}{
+		{List(SymbolValue("countdown"), IntValue(100000)), "7"},
+		{List(SymbolValue("even?"), IntValue(100001)), "#f"},
+		{List(SymbolValue("escape"), IntValue(100000)), "0"},
+	} {
+		val, err := ev.Eval(tc.call, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.call, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.call, tc.want, got)
+		}
+	}
+
+	// A call that is not in tail position still grows the stack.
+	sum := List(SymbolValue("define"), List(SymbolValue("sum"), SymbolValue("n")),
+		List(SymbolValue("if"), List(SymbolValue("zero?"), SymbolValue("n")),
+			IntValue(0),
+			List(SymbolValue("+"), SymbolValue("n"),
+				List(SymbolValue("sum"), List(SymbolValue("+"), SymbolValue("n"), IntValue(-1))))))
+	mustEval(t, ev, sum)
+	if _, err := ev.Eval(List(SymbolValue("sum"), IntValue(1000)), nil); !errors.Is(err, ErrDepthExceeded) {
+		t.Fatalf("expected ErrDepthExceeded, got %v", err)
+	}
+}
+
+func TestEvaluatorInterrupt(t *testing.T) {
+	ev := newTestEvaluator()
+	mustEval(t, ev, List(SymbolValue("define"), SymbolValue("counter"), IntValue(0)))
+	loop := List(SymbolValue("define"), List(SymbolValue("spin")),
+		List(SymbolValue("set!"), SymbolValue("counter"), List(SymbolValue("+"), SymbolValue("counter"), IntValue(1))),
+		List(SymbolValue("spin")))
+	mustEval(t, ev, loop)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ev.Eval(List(SymbolValue("spin")), nil)
+		done <- err
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrInterrupted) {
+				t.Fatalf("expected ErrInterrupted, got %v", err)
+			}
+			// The environment survives the interruption.
+			val := mustEval(t, ev, SymbolValue("counter"))
+			if val.Int() == 0 {
+				t.Fatalf("expected counter to have advanced before the interrupt")
+			}
+			return
+		case <-deadline:
+			t.Fatalf("evaluation was not interrupted")
+		case <-time.After(10 * time.Millisecond):
+			ev.Interrupt()
+		}
+	}
+}
+
 func TestEvaluatorApplyPrimitive(t *testing.T) {
 	ev := newTestEvaluator()
 	proc := SymbolValue("+")
@@ -437,8 +569,14 @@ func TestEvaluatorQuasiQuote(t *testing.T) {
 
 	expr := List(SymbolValue("quasiquote"), List(List(SymbolValue("unquote"), SymbolValue("a"))))
 	val := mustEval(t, ev, expr)
-	if val.Type != TypeInt || val.Int() != 4 {
-		t.Fatalf("expected 4, got %v", val)
+	if val.String() != "(4)" {
+		t.Fatalf("expected (4), got %v", val)
+	}
+
+	// `(x . ,a) puts the unquoted value in the tail of the list.
+	dotted := List(SymbolValue("quasiquote"), PairValue(SymbolValue("x"), List(SymbolValue("unquote"), SymbolValue("a"))))
+	if val := mustEval(t, ev, dotted); val.String() != "(x. 4)" {
+		t.Fatalf("expected (x. 4), got %v", val)
 	}
 
 	listExpr := List(
@@ -526,6 +664,29 @@ func TestParseParams(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for invalid parameter list")
 	}
+
+	for _, list := range []Value{
+		List(SymbolValue("x"), SymbolValue("y"), SymbolValue("x")),
+		PairValue(SymbolValue("x"), SymbolValue("x")),
+	} {
+		if _, _, err := parseParams(list); err == nil || err.Error() != "duplicate parameter x" {
+			t.Fatalf("parseParams(%s) => %v, want duplicate parameter error", list.String(), err)
+		}
+	}
+}
+
+func TestDuplicateParametersRejected(t *testing.T) {
+	ev := newTestEvaluator()
+	forms := []Value{
+		List(SymbolValue("lambda"), List(SymbolValue("x"), SymbolValue("x")), SymbolValue("x")),
+		List(SymbolValue("define"), List(SymbolValue("f"), SymbolValue("a"), SymbolValue("a")), SymbolValue("a")),
+		List(SymbolValue("define-macro"), List(SymbolValue("m"), SymbolValue("a"), SymbolValue("a")), SymbolValue("a")),
+	}
+	for _, form := range forms {
+		if _, err := ev.Eval(form, nil); err == nil || !strings.Contains(err.Error(), "duplicate parameter") {
+			t.Fatalf("Eval(%s) => %v, want duplicate parameter error", form.String(), err)
+		}
+	}
 }
 
 func TestBindParameters(t *testing.T) {
@@ -552,8 +713,14 @@ func TestBindParameters(t *testing.T) {
 	}
 
 	err = bindParameters(NewEnv(nil), []string{"x", "y"}, "", []Value{IntValue(1)})
-	if err == nil {
-		t.Fatal("expected error for too few args")
+	var arity *ArityError
+	if !errors.As(err, &arity) || arity.Want != 2 || arity.Got != 1 || arity.AtLeast {
+		t.Fatalf("expected ArityError for too few args, got %v", err)
+	}
+
+	err = bindParameters(NewEnv(nil), []string{"x", "y"}, "rest", nil)
+	if err == nil || err.Error() != "expected at least 2 arguments, got 0" {
+		t.Fatalf("unexpected error for too few args with rest: %v", err)
 	}
 
 	err = bindParameters(NewEnv(nil), []string{"x"}, "", []Value{IntValue(1), IntValue(2)})
@@ -576,8 +743,28 @@ func TestExpandQuasiQuote(t *testing.T) {
 	if err != nil {
 		t.Fatalf("expandQuasiQuote error: %v", err)
 	}
-	if expanded.Type != TypeSymbol || expanded.Sym() != "a" {
-		t.Fatalf("unexpected expansion: %v", expanded)
+	expectedList := List(SymbolValue("cons"), SymbolValue("a"), List(SymbolValue("quote"), EmptyList))
+	if !valuesEqual(expanded, expectedList) {
+		t.Fatalf("expected %v, got %v", expectedList, expanded)
+	}
+
+	vec := VectorValue([]Value{IntValue(1), List(SymbolValue("unquote"), SymbolValue("a"))})
+	expandedVec, err := expandQuasiQuote(vec, 1)
+	if err != nil {
+		t.Fatalf("expandQuasiQuote vector error: %v", err)
+	}
+	expectedVec := List(SymbolValue("listToVector"), List(SymbolValue("cons"), IntValue(1),
+		List(SymbolValue("cons"), SymbolValue("a"), List(SymbolValue("quote"), EmptyList))))
+	if !valuesEqual(expandedVec, expectedVec) {
+		t.Fatalf("expected %v, got %v", expectedVec, expandedVec)
+	}
+	constant := VectorValue([]Value{IntValue(1), SymbolValue("a")})
+	if got, err := expandQuasiQuote(constant, 1); err != nil || got.Vector() != constant.Vector() {
+		t.Fatalf("expected a vector without unquotes to be kept, got %v, %v", got, err)
+	}
+
+	if _, err := expandQuasiQuote(List(SymbolValue("unquote-splicing"), SymbolValue("a")), 1); err == nil {
+		t.Fatal("expected error for unquote-splicing outside a list")
 	}
 
 	_, err = expandQuasiQuote(List(List(SymbolValue("unquote"))), 1)
@@ -586,6 +773,85 @@ func TestExpandQuasiQuote(t *testing.T) {
 	}
 }
 
+func TestEvaluatorCatch(t *testing.T) {
+	ev := newTestEvaluator()
+	ev.Global.Define("throw", PrimitiveValue(func(_ *Evaluator, args []Value) (Value, error) {
+		return Value{}, &ThrownError{Value: args[0]}
+	}))
+	sym := SymbolValue
+	handler := List(sym("lambda"), List(sym("e")), List(sym("cons"), sym("caught"), sym("e")))
+	mustEvalAll(t, ev, List(sym("define"), sym("caught"), List(sym("quote"), sym("caught"))))
+
+	for _, tc := range []struct {
+		expr Value
+		want string
+	}{
+		{List(sym("catch"), handler, List(sym("+"), IntValue(1), IntValue(2))), "3"},
+		{List(sym("catch"), handler, List(sym("+"), IntValue(1), List(sym("throw"), IntValue(5)))), "(caught. 5)"},
+		{List(sym("catch"), handler, List(sym("undefined-thing"))), `(caught. #<error "unbound variable: undefined-thing">)`},
+		// An error in a handler goes to the next catch out.
+		{List(sym("catch"), handler,
+			List(sym("catch"), List(sym("lambda"), List(sym("e")), List(sym("throw"), IntValue(6))),
+				List(sym("throw"), IntValue(5)))), "(caught. 6)"},
+	} {
+		if got := mustEval(t, ev, tc.expr).String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.expr, tc.want, got)
+		}
+	}
+
+	if _, err := ev.Eval(List(sym("catch"), IntValue(1), IntValue(2)), nil); err == nil {
+		t.Fatal("expected an error for a handler that is not a procedure")
+	}
+	var thrown *ThrownError
+	if _, err := ev.Eval(List(sym("throw"), IntValue(1)), nil); !errors.As(err, &thrown) {
+		t.Fatalf("expected an uncaught ThrownError, got %v", err)
+	}
+
+	// Running out of fuel cannot be caught.
+	loop := List(sym("define"), List(sym("loop")), List(sym("loop")))
+	mustEvalAll(t, ev, loop)
+	ev.MaxSteps = 1000
+	defer func() { ev.MaxSteps = 0 }()
+	if _, err := ev.Eval(List(sym("catch"), handler, List(sym("loop"))), nil); !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("expected ErrFuelExhausted, got %v", err)
+	}
+}
+
+func TestEvaluatorUnwindProtect(t *testing.T) {
+	ev := newTestEvaluator()
+	ev.Global.Define("throw", PrimitiveValue(func(_ *Evaluator, args []Value) (Value, error) {
+		return Value{}, &ThrownError{Value: args[0]}
+	}))
+	sym := SymbolValue
+	quote := func(v Value) Value { return List(sym("quote"), v) }
+	mustEvalAll(t, ev, List(sym("define"), sym("log"), EmptyList))
+	record := func(tag string) Value {
+		return List(sym("set!"), sym("log"), List(sym("cons"), quote(sym(tag)), sym("log")))
+	}
+	handler := List(sym("lambda"), List(sym("e")), sym("e"))
+
+	for _, tc := range []struct {
+		expr Value
+		want string
+	}{
+		// The body's value survives the cleanup.
+		{List(sym("unwind-protect"), IntValue(1), record("normal")), "1"},
+		// The cleanup runs before the handler of an enclosing catch.
+		{List(sym("catch"), handler,
+			List(sym("unwind-protect"), List(sym("throw"), IntValue(2)), record("thrown"))), "2"},
+		// So it does when a continuation escapes, as Gisp's return does.
+		{List(sym("call/cc"), List(sym("lambda"), List(sym("k")),
+			List(sym("unwind-protect"), List(sym("k"), IntValue(3)), record("escaped")))), "3"},
+	} {
+		if got := mustEval(t, ev, tc.expr).String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.expr, tc.want, got)
+		}
+	}
+	if got := mustEval(t, ev, sym("log")).String(); got != "(escaped thrown normal)" {
+		t.Fatalf("expected every cleanup to run once, got %s", got)
+	}
+}
+
 func TestTaggedForm(t *testing.T) {
 	value := List(SymbolValue("unquote"), IntValue(1))
 	arg, ok, err := taggedForm(value, "unquote")
@@ -624,6 +890,7 @@ func TestListToSliceRaw(t *testing.T) {
 }
 
 type mockFrame struct {
+	framePos
 	id      int
 	cloned  bool
 	applied bool
@@ -705,3 +972,160 @@ func valuesEqual(a, b Value) bool {
 		return false
 	}
 }
+
+func TestEvaluatorFastArith(t *testing.T) {
+	ev := newTestEvaluator()
+	plus, _ := ev.Global.Get("+")
+	calls := 0
+	ev.Global.Define("+", PrimitiveValue(func(ev *Evaluator, args []Value) (Value, error) {
+		calls++
+		return plus.Primitive()(ev, args)
+	}))
+	ev.SealBuiltins()
+	sym := SymbolValue
+	mustEvalAll(t, ev, List(sym("define"), sym("x"), IntValue(40)))
+
+	for _, tc := range []struct {
+		expr  Value
+		want  string
+		calls int
+	}{
+		{List(sym("+"), sym("x"), IntValue(2)), "42", 0},
+		// Only the inner call has operands that need no evaluation.
+		{List(sym("+"), sym("x"), List(sym("+"), IntValue(1), IntValue(1))), "42", 1},
+		// An overflowing sum is left to the primitive.
+		{List(sym("+"), sym("x"), IntValue(math.MaxInt64)), "-9223372036854775769", 1},
+		{List(sym("+"), sym("x"), StringValue("a")), "", 1},
+		// Local bindings hide the builtin.
+		{List(sym("let"), List(List(sym("+"), List(sym("lambda"), List(sym("a"), sym("b")), sym("a")))),
+			List(sym("+"), sym("x"), IntValue(2))), "40", 0},
+	} {
+		calls = 0
+		val, err := ev.Eval(tc.expr, nil)
+		if tc.want == "" {
+			if err == nil {
+				t.Fatalf("%s: expected an error, got %s", tc.expr, val)
+			}
+		} else if err != nil || val.String() != tc.want {
+			t.Fatalf("%s: expected %s, got %s (err=%v)", tc.expr, tc.want, val, err)
+		}
+		if calls != tc.calls {
+			t.Fatalf("%s: expected %d primitive calls, got %d", tc.expr, tc.calls, calls)
+		}
+	}
+
+	ev.NoFastArith = true
+	calls = 0
+	if val := mustEval(t, ev, List(sym("+"), sym("x"), IntValue(2))); val.Int() != 42 || calls != 1 {
+		t.Fatalf("expected the primitive to compute 42, got %s after %d calls", val, calls)
+	}
+	ev.NoFastArith = false
+
+	// A redefinition is honoured: + now multiplies.
+	mustEvalAll(t, ev, List(sym("define"), sym("+"), sym("*")))
+	if val := mustEval(t, ev, List(sym("+"), sym("x"), IntValue(2))); val.Int() != 80 {
+		t.Fatalf("expected the redefined + to multiply, got %s", val)
+	}
+}
+
+func TestShadowPolicy(t *testing.T) {
+	ev := newTestEvaluator()
+	ev.SealBuiltins()
+	original, ok := ev.Builtin("+")
+	if !ok {
+		t.Fatalf("expected + to be recorded as a builtin")
+	}
+	redefine := List(SymbolValue("define"), SymbolValue("+"), IntValue(1))
+
+	ev.Shadow = ShadowError
+	if _, err := ev.Eval(redefine, nil); err == nil || !strings.Contains(err.Error(), "cannot redefine builtin +") {
+		t.Fatalf("expected redefinition error, got %v", err)
+	}
+	// Local bindings may shadow builtins freely.
+	local := List(SymbolValue("let"), List(List(SymbolValue("+"), IntValue(2))), SymbolValue("+"))
+	if val := mustEval(t, ev, local); val.Int() != 2 {
+		t.Fatalf("expected local binding, got %s", val.String())
+	}
+
+	var warnings strings.Builder
+	ev.SetWarningOutput(&warnings)
+	ev.Shadow = ShadowWarn
+	mustEval(t, ev, redefine)
+	if !strings.Contains(warnings.String(), "warning: redefining builtin +") {
+		t.Fatalf("expected a warning, got %q", warnings.String())
+	}
+	if val := mustEval(t, ev, SymbolValue("+")); val.Type != TypeInt {
+		t.Fatalf("expected + to be redefined, got %s", val.String())
+	}
+	if val, _ := ev.Builtin("+"); val.Primitive() == nil || original.Primitive() == nil {
+		t.Fatalf("expected the original primitive to stay reachable")
+	}
+}
+
+func TestEvaluatorBacktrace(t *testing.T) {
+	ev := newTestEvaluator()
+	sym := SymbolValue
+	mustEvalAll(t, ev,
+		List(sym("define"), List(sym("inner"), sym("x")), List(sym("+"), sym("x"), List(sym("quote"), sym("a")))),
+		List(sym("define"), List(sym("middle"), sym("x")), List(sym("list"), List(sym("inner"), sym("x")))),
+		// outer calls middle in tail position, so middle replaces it.
+		List(sym("define"), List(sym("outer"), sym("x")), List(sym("middle"), sym("x"))),
+		List(sym("define"), List(sym("__helper"), sym("x")), List(sym("list"), List(sym("inner"), sym("x")))),
+	)
+
+	for _, tc := range []struct {
+		depth int
+		expr  Value
+		want  string
+	}{
+		{0, List(sym("outer"), IntValue(1)), "+: expected integers\n  in inner\n  in middle"},
+		{1, List(sym("outer"), IntValue(1)), "+: expected integers\n  in inner\n  ... 1 more"},
+		{-1, List(sym("outer"), IntValue(1)), "+: expected integers"},
+		{0, List(sym("list"), List(sym("__helper"), IntValue(1))), "+: expected integers\n  in inner"},
+		{0, List(sym("+"), IntValue(1), sym("nosuch")), "unbound variable: nosuch"},
+	} {
+		ev.BacktraceDepth = tc.depth
+		_, err := ev.Eval(tc.expr, nil)
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("%s with depth %d: error %v, want %q", tc.expr, tc.depth, err, tc.want)
+		}
+	}
+
+	ev.BacktraceDepth = 0
+	_, err := ev.Eval(List(sym("outer"), IntValue(1)), nil)
+	calls := Backtrace(err)
+	if len(calls) != 2 || calls[0].Name != "inner" || calls[1].Name != "middle" || calls[0].Pos != nil {
+		t.Fatalf("Backtrace = %v", calls)
+	}
+	var traced *BacktraceError
+	if !errors.As(err, &traced) || traced.Err.Error() != "+: expected integers" {
+		t.Fatalf("expected a BacktraceError wrapping the error, got %v", err)
+	}
+
+	// A caught error has no backtrace.
+	handler := List(sym("lambda"), List(sym("e")), sym("e"))
+	caught := mustEval(t, ev, List(sym("catch"), handler, List(sym("outer"), IntValue(1))))
+	if got := caught.String(); got != `#<error "+: expected integers">` {
+		t.Fatalf("caught %s", got)
+	}
+}
+
+func TestOperatorName(t *testing.T) {
+	sym := SymbolValue
+	field := func(target Value, name string) Value {
+		return List(sym("getField"), target, List(sym("quote"), sym(name)))
+	}
+	for _, tc := range []struct {
+		head Value
+		want string
+	}{
+		{sym("f"), "f"},
+		{field(sym("obj"), "run"), "obj.run"},
+		{field(field(sym("a"), "b"), "c"), "a.b.c"},
+		{List(sym("lambda"), EmptyList, IntValue(1)), "<anonymous>"},
+	} {
+		if got := OperatorName(tc.head); got != tc.want {
+			t.Fatalf("OperatorName(%s) = %q, want %q", tc.head, got, tc.want)
+		}
+	}
+}
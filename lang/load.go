@@ -0,0 +1,77 @@
+package lang
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ImportCycleError reports a file that is loaded again while it is still
+// being loaded. Chain lists the files from the first load of the repeated
+// file to its second one.
+type ImportCycleError struct {
+	Chain []string
+}
+
+func (e *ImportCycleError) Error() string {
+	return "import cycle: " + strings.Join(e.Chain, " → ")
+}
+
+// loadingFile is an entry of the stack of files being loaded; key is the
+// absolute path used to recognise the file and name is the path as given.
+type loadingFile struct {
+	key  string
+	name string
+}
+
+// EnterFile records that the file at path is being loaded. It returns an
+// ImportCycleError if the file is already being loaded, which would
+// otherwise recurse forever. Each successful call must be paired with
+// LeaveFile once the file has been evaluated.
+func (ev *Evaluator) EnterFile(path string) error {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = filepath.Clean(path)
+	}
+	for i, f := range ev.loading {
+		if f.key == key {
+			chain := make([]string, 0, len(ev.loading)-i+1)
+			for _, g := range ev.loading[i:] {
+				chain = append(chain, g.name)
+			}
+			return &ImportCycleError{Chain: append(chain, path)}
+		}
+	}
+	ev.loading = append(ev.loading, loadingFile{key: key, name: path})
+	return nil
+}
+
+// LeaveFile ends the innermost load recorded by EnterFile.
+func (ev *Evaluator) LeaveFile() {
+	if n := len(ev.loading); n > 0 {
+		ev.loading = ev.loading[:n-1]
+	}
+}
+
+// CurrentFile returns the path, as given to EnterFile, of the innermost file
+// being loaded, or "" when no file is.
+func (ev *Evaluator) CurrentFile() string {
+	if n := len(ev.loading); n > 0 {
+		return ev.loading[n-1].name
+	}
+	return ""
+}
+
+// Module returns the environment recorded by SetModule for key.
+func (ev *Evaluator) Module(key string) (*Env, bool) {
+	env, ok := ev.modules[key]
+	return env, ok
+}
+
+// SetModule records env as the environment of the module identified by
+// key, normally its absolute path, so that it is evaluated only once.
+func (ev *Evaluator) SetModule(key string, env *Env) {
+	if ev.modules == nil {
+		ev.modules = make(map[string]*Env)
+	}
+	ev.modules[key] = env
+}
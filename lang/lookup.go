@@ -0,0 +1,80 @@
+package lang
+
+import "sync/atomic"
+
+// Variable references in procedure calls are resolved through inline
+// caches. The cache of a call site remembers how many frames up the
+// environment chain its symbol was found, together with the shape of every
+// frame it passed over. A frame's shape is the lambda form whose call
+// created it, so frames with the same shape bind the same names; a later
+// lookup from a chain whose frames have the same shapes can then go
+// straight to the frame that held the name, checking only that frame's
+// bindings. Adding a name to an existing frame with Define bumps
+// bindingGeneration, which invalidates every cache, since the new binding
+// may hide one found further up. It also clears the frame's shape, so that
+// no cache made later takes the frame for one of its shape that lacks the
+// name.
+
+// bindingGeneration counts names added to existing frames.
+var bindingGeneration atomic.Uint64
+
+// lookupSite is the inline cache of a call site. Entries are never
+// modified once stored, so evaluators running on several goroutines can
+// share compiled code.
+type lookupSite struct {
+	name   string
+	gen    uint64
+	shapes []*Pair // shapes of the frames passed over, innermost first
+}
+
+// lookupAt resolves name, which appears as the first element of site, in
+// env.
+func (e *Env) lookupAt(site *Pair, name string) (Value, error) {
+	if c := site.cache.Load(); c != nil && c.name == name && c.gen == bindingGeneration.Load() {
+		env := e
+		for _, shape := range c.shapes {
+			if env == nil || env.shape.Load() != shape {
+				env = nil
+				break
+			}
+			env = env.parent
+		}
+		if env != nil {
+			if val, ok := env.Own(name); ok {
+				return val, nil
+			}
+		}
+	}
+	gen := bindingGeneration.Load()
+	hops, cacheable := 0, true
+	for env := e; env != nil; env = env.parent {
+		val, ok := env.Own(name)
+		if !ok {
+			cacheable = cacheable && env.shape.Load() != nil
+			hops++
+			continue
+		}
+		if cacheable {
+			site.cache.Store(newLookupSite(site, name, gen, e, hops))
+		}
+		return val, nil
+	}
+	return Value{}, &UnboundVariableError{Name: name}
+}
+
+// seenOnce marks a site that has been looked up once. Code built by macro
+// expansion is often evaluated only once, so a site gets a real cache entry
+// only when it is reached a second time.
+var seenOnce = &lookupSite{}
+
+func newLookupSite(site *Pair, name string, gen uint64, env *Env, hops int) *lookupSite {
+	if site.cache.Load() == nil {
+		return seenOnce
+	}
+	shapes := make([]*Pair, hops)
+	for i := range shapes {
+		shapes[i] = env.shape.Load()
+		env = env.parent
+	}
+	return &lookupSite{name: name, gen: gen, shapes: shapes}
+}
@@ -0,0 +1,133 @@
+package lang
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestInlineCacheSeesNewBindings(t *testing.T) {
+	ev := newTestEvaluator()
+	ev.Global.Define("x", IntValue(1))
+	// g reads x through the same call site whether or not it has just
+	// defined its own x, so the site's cache must notice the new binding.
+	// (define g (lambda (flag) (if flag (define x 2) ()) (+ x 0)))
+	mustEval(t, ev, List(SymbolValue("define"), SymbolValue("g"), List(
+		SymbolValue("lambda"), List(SymbolValue("flag")),
+		List(SymbolValue("if"), SymbolValue("flag"), List(SymbolValue("define"), SymbolValue("x"), IntValue(2)), EmptyList),
+		List(SymbolValue("+"), SymbolValue("x"), IntValue(0)),
+	)))
+	for i, tc := range []struct {
+		flag bool
+		want int64
+	}{{false, 1}, {false, 1}, {true, 2}, {false, 1}} {
+		call := List(SymbolValue("g"), BoolValue(tc.flag))
+		got, err := ev.Eval(call, nil)
+		if err != nil || got.Int() != tc.want {
+			t.Fatalf("call %d: g(%v) => %v, %v; want %d", i, tc.flag, got, err, tc.want)
+		}
+	}
+}
+
+func TestInlineCacheFollowsFrameShapes(t *testing.T) {
+	ev := newTestEvaluator()
+	ev.Global.Define("y", IntValue(10))
+	// The same call form runs inside closures made from two different
+	// lambda forms; only one of them binds y.
+	body := List(SymbolValue("+"), SymbolValue("y"), IntValue(0))
+	shadowing := List(SymbolValue("lambda"), List(SymbolValue("y")), body)
+	plain := List(SymbolValue("lambda"), List(SymbolValue("z")), body)
+	for i, tc := range []struct {
+		lambda Value
+		want   int64
+	}{{plain, 10}, {shadowing, 5}, {plain, 10}, {shadowing, 5}} {
+		got, err := ev.Eval(List(tc.lambda, IntValue(5)), nil)
+		if err != nil || got.Int() != tc.want {
+			t.Fatalf("call %d => %v, %v; want %d", i, got, err, tc.want)
+		}
+	}
+}
+
+func TestInlineCacheSkipsFramesGivenNewNames(t *testing.T) {
+	ev := newTestEvaluator()
+	ev.Global.Define("x", SymbolValue("global"))
+	// Both closures come from the same lambda form, but only the frame of
+	// a defines its own x, after the frame was made. A cache filled by b
+	// must not pass over that frame when a runs again.
+	// (define f (lambda (c) (if c (define x 'local) #f) (lambda () x)))
+	mustEval(t, ev, List(SymbolValue("define"), SymbolValue("f"), List(
+		SymbolValue("lambda"), List(SymbolValue("c")),
+		List(SymbolValue("if"), SymbolValue("c"),
+			List(SymbolValue("define"), SymbolValue("x"), List(SymbolValue("quote"), SymbolValue("local"))),
+			BoolValue(false)),
+		List(SymbolValue("lambda"), EmptyList, List(SymbolValue("list"), SymbolValue("x"))),
+	)))
+	mustEval(t, ev, List(SymbolValue("define"), SymbolValue("a"), List(SymbolValue("f"), BoolValue(true))))
+	mustEval(t, ev, List(SymbolValue("define"), SymbolValue("b"), List(SymbolValue("f"), BoolValue(false))))
+	for i, tc := range []struct {
+		closure string
+		want    string
+	}{{"a", "(local)"}, {"b", "(global)"}, {"b", "(global)"}, {"a", "(local)"}} {
+		got, err := ev.Eval(List(SymbolValue(tc.closure)), nil)
+		if err != nil || got.String() != tc.want {
+			t.Fatalf("call %d: (%s) => %v, %v; want %s", i, tc.closure, got, err, tc.want)
+		}
+	}
+}
+
+// BenchmarkEnvLookup compares resolving a global from eight frames down by
+// walking the chain with resolving it through an inline cache.
+func BenchmarkEnvLookup(b *testing.B) {
+	global := NewEnv(nil)
+	global.Define("target", IntValue(1))
+	env := global
+	for i := 0; i < 8; i++ {
+		env = NewEnv(env)
+		env.shape.Store(&Pair{})
+		env.values[fmt.Sprintf("local%d", i)] = IntValue(int64(i))
+	}
+	b.Run("walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := env.Get("target"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		site := &Pair{First: SymbolValue("target")}
+		for i := 0; i < b.N; i++ {
+			if _, err := env.lookupAt(site, "target"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkEnvDefine measures binding a name in a frame that already has
+// it, as a loop assigning a global does.
+func BenchmarkEnvDefine(b *testing.B) {
+	env := NewEnv(nil)
+	for i := 0; i < b.N; i++ {
+		env.Define("x", IntValue(int64(i)))
+	}
+}
+
+// BenchmarkEnvLookupParallel resolves the same global from eight frames
+// down on every processor at once, as goroutines sharing the global
+// environment do. Reads take shared locks, so they do not wait for each
+// other.
+func BenchmarkEnvLookupParallel(b *testing.B) {
+	global := NewEnv(nil)
+	global.Define("target", IntValue(1))
+	b.RunParallel(func(pb *testing.PB) {
+		env := global
+		for i := 0; i < 8; i++ {
+			env = NewEnv(env)
+			env.Define(fmt.Sprintf("local%d", i), IntValue(int64(i)))
+		}
+		for pb.Next() {
+			if _, err := env.Get("target"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
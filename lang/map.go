@@ -0,0 +1,113 @@
+package lang
+
+import "fmt"
+
+// Map is a mutable hash table keyed by booleans, numbers, strings and
+// symbols. It remembers the order in which keys were first inserted, and
+// every operation that lists its contents uses that order, so programs that
+// print or iterate over a map behave the same on every run.
+type Map struct {
+	keys   []Value
+	values []Value
+	index  map[mapKey]int
+}
+
+// mapKey identifies a key value; integers and reals are distinct keys.
+type mapKey struct {
+	typ ValueType
+	val interface{}
+}
+
+// NewMap returns an empty map.
+func NewMap() *Map {
+	return &Map{index: make(map[mapKey]int)}
+}
+
+// MapValue wraps a map.
+func MapValue(m *Map) Value {
+	return Value{Type: TypeMap, payload: m}
+}
+
+// Map returns the underlying map payload, if any.
+func (v Value) Map() *Map {
+	if m, ok := v.payload.(*Map); ok {
+		return m
+	}
+	return nil
+}
+
+func keyOf(k Value) (mapKey, error) {
+	switch k.Type {
+	case TypeBool, TypeInt, TypeReal, TypeString, TypeChar, TypeSymbol:
+		return mapKey{typ: k.Type, val: k.payload}, nil
+	case TypeBigInt:
+		return mapKey{typ: k.Type, val: k.BigInt().String()}, nil
+	default:
+		return mapKey{}, fmt.Errorf("%s cannot be used as a map key", k.Type)
+	}
+}
+
+// Len returns the number of entries.
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+// Get returns the value stored under k.
+func (m *Map) Get(k Value) (Value, bool) {
+	key, err := keyOf(k)
+	if err != nil {
+		return Value{}, false
+	}
+	i, ok := m.index[key]
+	if !ok {
+		return Value{}, false
+	}
+	return m.values[i], true
+}
+
+// Set stores v under k. A new key goes after the existing ones; replacing
+// the value of a key keeps its position.
+func (m *Map) Set(k, v Value) error {
+	key, err := keyOf(k)
+	if err != nil {
+		return err
+	}
+	if i, ok := m.index[key]; ok {
+		m.values[i] = v
+		return nil
+	}
+	m.index[key] = len(m.keys)
+	m.keys = append(m.keys, k)
+	m.values = append(m.values, v)
+	return nil
+}
+
+// Delete removes k and reports whether it was present.
+func (m *Map) Delete(k Value) bool {
+	key, err := keyOf(k)
+	if err != nil {
+		return false
+	}
+	i, ok := m.index[key]
+	if !ok {
+		return false
+	}
+	delete(m.index, key)
+	m.keys = append(m.keys[:i], m.keys[i+1:]...)
+	m.values = append(m.values[:i], m.values[i+1:]...)
+	for j := i; j < len(m.keys); j++ {
+		next, _ := keyOf(m.keys[j])
+		m.index[next] = j
+	}
+	return true
+}
+
+// Keys returns the keys in insertion order.
+func (m *Map) Keys() []Value {
+	return append([]Value(nil), m.keys...)
+}
+
+// Values returns the values in the insertion order of their keys.
+func (m *Map) Values() []Value {
+	return append([]Value(nil), m.values...)
+}
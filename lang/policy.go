@@ -0,0 +1,31 @@
+package lang
+
+// Policy lists the resources that primitives may reach outside the
+// interpreter. Primitives that touch one of them consult the evaluator's
+// policy and fail with an error when access is denied.
+type Policy struct {
+	AllowFS   bool // read and write files and directories
+	AllowNet  bool // open network connections
+	AllowExec bool // run other programs
+	AllowExit bool // terminate the process
+}
+
+// AllowAll permits every resource; it is the policy of an evaluator that
+// sets neither Policy nor Sandbox.
+var AllowAll = Policy{AllowFS: true, AllowNet: true, AllowExec: true, AllowExit: true}
+
+// DenyAll permits nothing; it is the policy of a sandboxed evaluator.
+var DenyAll = Policy{}
+
+// SecurityPolicy returns the policy in effect: Policy when set, otherwise
+// DenyAll for a sandboxed evaluator and AllowAll for any other.
+func (ev *Evaluator) SecurityPolicy() Policy {
+	switch {
+	case ev.Policy != nil:
+		return *ev.Policy
+	case ev.Sandbox:
+		return DenyAll
+	default:
+		return AllowAll
+	}
+}
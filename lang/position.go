@@ -0,0 +1,83 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Compilers from source text, such as the Gisp parser, record where each
+// form they build came from, so that an error raised while evaluating it
+// can name the place. Positions live on the pairs of compiled forms and are
+// not part of their value: printing, eq and equal ignore them.
+
+// SourcePos is a place in source text.
+type SourcePos struct {
+	File   string // file name, empty when the source was not a file
+	Line   int    // one-based line number
+	Column int    // one-based column number
+}
+
+// String formats p as file:line:col, or as "line L:C" without a file name,
+// the way the Gisp parser reports syntax errors.
+func (p SourcePos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// SetPosition records pos as the source of the form v and returns v. It
+// does nothing when v is not a pair or already has a position, so a form
+// keeps the most specific place recorded for it.
+func SetPosition(v Value, pos SourcePos) Value {
+	if p := v.Pair(); v.Type == TypePair && p != nil && p.pos == nil {
+		p.pos = &pos
+	}
+	return v
+}
+
+// Position returns the source position recorded for the form v.
+func Position(v Value) (SourcePos, bool) {
+	if p := v.Pair(); v.Type == TypePair && p != nil && p.pos != nil {
+		return *p.pos, true
+	}
+	return SourcePos{}, false
+}
+
+// positionOf returns the position of the form v, or nil.
+func positionOf(v Value) *SourcePos {
+	if p := v.Pair(); v.Type == TypePair && p != nil {
+		return p.pos
+	}
+	return nil
+}
+
+// PositionError is an error raised while evaluating the form at Pos. When
+// forms are nested it names the innermost one with a recorded position.
+type PositionError struct {
+	Pos SourcePos
+	Err error
+}
+
+func (e *PositionError) Error() string {
+	return e.Pos.String() + ": " + e.Err.Error()
+}
+
+func (e *PositionError) Unwrap() error { return e.Err }
+
+// AtPosition returns err located at pos, or err itself when pos is nil,
+// when err already carries a position from a nested evaluation, or when
+// it is a Jump, which is not an error of the program.
+func AtPosition(err error, pos *SourcePos) error {
+	if pos == nil {
+		return err
+	}
+	var located *PositionError
+	if errors.As(err, &located) {
+		return err
+	}
+	if _, ok := err.(*Jump); ok {
+		return err
+	}
+	return &PositionError{Pos: *pos, Err: err}
+}
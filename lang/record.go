@@ -0,0 +1,67 @@
+package lang
+
+import "fmt"
+
+// RecordType describes a struct type: its name and the names of its
+// fields, in the order the constructor takes them.
+type RecordType struct {
+	Name   string
+	Fields []string
+	index  map[string]int
+}
+
+// NewRecordType returns a struct type with the given fields, which must be
+// distinct.
+func NewRecordType(name string, fields []string) (*RecordType, error) {
+	t := &RecordType{Name: name, Fields: fields, index: make(map[string]int, len(fields))}
+	for i, field := range fields {
+		if _, dup := t.index[field]; dup {
+			return nil, fmt.Errorf("struct %s declares field %s twice", name, field)
+		}
+		t.index[field] = i
+	}
+	return t, nil
+}
+
+// FieldIndex returns the position of field among the fields of t.
+func (t *RecordType) FieldIndex(field string) (int, bool) {
+	i, ok := t.index[field]
+	return i, ok
+}
+
+// Record is an instance of a struct type. Its fields are mutable.
+type Record struct {
+	Type   *RecordType
+	Values []Value
+}
+
+// RecordValue wraps a record.
+func RecordValue(r *Record) Value {
+	return Value{Type: TypeRecord, payload: r}
+}
+
+// Record returns the underlying record payload, if any.
+func (v Value) Record() *Record {
+	if r, ok := v.payload.(*Record); ok {
+		return r
+	}
+	return nil
+}
+
+// Get returns the value of field.
+func (r *Record) Get(field string) (Value, bool) {
+	i, ok := r.Type.FieldIndex(field)
+	if !ok {
+		return Value{}, false
+	}
+	return r.Values[i], true
+}
+
+// Set stores v in field and reports whether the record has that field.
+func (r *Record) Set(field string, v Value) bool {
+	i, ok := r.Type.FieldIndex(field)
+	if ok {
+		r.Values[i] = v
+	}
+	return ok
+}
@@ -0,0 +1,87 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Trace enables call tracing for a closure. Every call to it prints the
+// arguments on entry and the result on return, indented by the number of
+// traced calls in progress. The name is used in the printed call.
+func (ev *Evaluator) Trace(proc Value, name string) error {
+	closure := proc.Closure()
+	if proc.Type != TypeClosure || closure == nil {
+		return fmt.Errorf("trace expects a closure, got %s", proc.String())
+	}
+	if ev.traced == nil {
+		ev.traced = make(map[*Closure]string)
+	}
+	ev.traced[closure] = name
+	return nil
+}
+
+// Untrace disables tracing for a closure and reports whether it was traced.
+func (ev *Evaluator) Untrace(proc Value) bool {
+	closure := proc.Closure()
+	if proc.Type != TypeClosure || closure == nil {
+		return false
+	}
+	if _, ok := ev.traced[closure]; !ok {
+		return false
+	}
+	delete(ev.traced, closure)
+	return true
+}
+
+// SetTraceOutput redirects trace logging; it defaults to the evaluator's
+// output.
+func (ev *Evaluator) SetTraceOutput(w io.Writer) {
+	ev.traceOut = w
+}
+
+func (ev *Evaluator) traceEnter(state *evalState, name string, args []Value) {
+	depth := 0
+	for i := len(state.cont) - 1; i >= 0; i-- {
+		if f, ok := state.cont[i].(*traceFrame); ok {
+			depth = f.depth + 1
+			break
+		}
+	}
+	var call strings.Builder
+	call.WriteByte('(')
+	call.WriteString(name)
+	for _, arg := range args {
+		call.WriteByte(' ')
+		call.WriteString(arg.String())
+	}
+	call.WriteByte(')')
+	ev.traceLine(depth, call.String())
+	state.push(&traceFrame{depth: depth})
+}
+
+func (ev *Evaluator) traceLine(depth int, text string) {
+	out := ev.traceOut
+	if out == nil {
+		out = ev.Output()
+	}
+	fmt.Fprintf(out, "%s%s\n", strings.Repeat("  ", depth), text)
+}
+
+// traceFrame logs the result of a traced call when it returns. Its depth is
+// kept in the frame so continuations restore the indentation they captured.
+type traceFrame struct {
+	framePos
+	depth int
+}
+
+func (f *traceFrame) apply(ev *Evaluator, val Value, state *evalState) error {
+	ev.traceLine(f.depth, "=> "+val.String())
+	state.value = val
+	state.returning = true
+	return nil
+}
+
+func (f *traceFrame) clone() frame {
+	return &traceFrame{framePos: f.framePos, depth: f.depth}
+}
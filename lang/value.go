@@ -3,7 +3,10 @@ package lang
 import (
 	"fmt"
 	"math"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 // ValueType enumerates the different runtime value categories.
@@ -23,6 +26,19 @@ const (
 	TypeContinuation
 	TypeMacro
 	TypeEOF
+	TypeRegex
+	TypeMap
+	TypeBigInt
+	TypeErrorObject
+	TypeRecord
+	TypeValues
+	TypeChar
+	TypeEnvironment
+	TypeChannel
+
+	// typeCallback marks a primitive result built by Callback or TailCall;
+	// the evaluator consumes it, so programs never see such a value.
+	typeCallback
 )
 
 // Value represents any runtime object in the interpreter.
@@ -35,6 +51,12 @@ type Value struct {
 type Pair struct {
 	First Value
 	Rest  Value
+	// cache holds the inline cache for a symbol in First when the pair
+	// is part of a procedure call; see lookupAt.
+	cache atomic.Pointer[lookupSite]
+	// pos is where in the source the form starting with this pair came
+	// from, when a compiler recorded it; see SetPosition.
+	pos *SourcePos
 }
 
 // Vector represents a mutable indexed collection.
@@ -45,12 +67,22 @@ type Vector struct {
 // Primitive represents a built-in Go function exposed to the interpreter.
 type Primitive func(*Evaluator, []Value) (Value, error)
 
+// primitive is the payload of a primitive Value. Copies of the value share
+// it, which gives primitives an identity that Go functions lack.
+type primitive struct {
+	fn Primitive
+}
+
 // Closure represents a user-defined function with lexical scope.
 type Closure struct {
 	Params []string
 	Rest   string
 	Body   []Value
 	Env    *Env
+	// Code caches what an Engine compiled Body to; the interpreter
+	// ignores it.
+	Code  interface{}
+	shape *Pair // the lambda form it was made from, if known
 }
 
 // Macro represents a macro transformer.
@@ -66,6 +98,23 @@ type Continuation struct {
 	Frames []frame
 	Env    *Env
 	Eval   *Evaluator
+	ID     int // numbers the continuations an evaluator captures, from 1
+	// State holds what an Engine captured in place of Frames. The
+	// interpreter cannot resume it and raises a Jump instead.
+	State interface{}
+	// OneShot marks a continuation captured by call/1cc, which may be
+	// resumed only once and so is resumed without copying its frames.
+	OneShot bool
+	resumed atomic.Bool
+}
+
+// Claim records that c is being resumed. It fails when c is a one-shot
+// continuation that has been resumed already.
+func (c *Continuation) Claim() error {
+	if c.OneShot && c.resumed.Swap(true) {
+		return fmt.Errorf("one-shot continuation resumed twice")
+	}
+	return nil
 }
 
 // EmptyList is the singleton empty list value.
@@ -160,7 +209,7 @@ func ToSlice(list Value) ([]Value, error) {
 func PrimitiveValue(fn Primitive) Value {
 	return Value{
 		Type:    TypePrimitive,
-		payload: fn,
+		payload: &primitive{fn: fn},
 	}
 }
 
@@ -192,6 +241,11 @@ func ContinuationValue(frames []frame, env *Env, ev *Evaluator) Value {
 	}
 }
 
+// RegexValue wraps a compiled regular expression.
+func RegexValue(re *regexp.Regexp) Value {
+	return Value{Type: TypeRegex, payload: re}
+}
+
 func (v Value) Bool() bool {
 	if b, ok := v.payload.(bool); ok {
 		return b
@@ -243,8 +297,8 @@ func (v Value) Vector() *Vector {
 }
 
 func (v Value) Primitive() Primitive {
-	if p, ok := v.payload.(Primitive); ok {
-		return p
+	if p, ok := v.payload.(*primitive); ok {
+		return p.fn
 	}
 	return nil
 }
@@ -270,7 +324,44 @@ func (v Value) Macro() *Macro {
 	return nil
 }
 
+// Regex returns the compiled regular expression payload, if any.
+func (v Value) Regex() *regexp.Regexp {
+	if re, ok := v.payload.(*regexp.Regexp); ok {
+		return re
+	}
+	return nil
+}
+
 func (v Value) String() string {
+	return v.StringPrecision(0)
+}
+
+// StringPrecision is String with reals, including those inside lists,
+// vectors, maps and records, rounded to digits significant digits. With
+// digits zero or less a real is printed in the shortest form that reads
+// back as the same number.
+func (v Value) StringPrecision(digits int) string {
+	switch v.Type {
+	case TypePair, TypeVector, TypeMap, TypeRecord:
+		var builder strings.Builder
+		writeValue(&builder, v, digits)
+		return builder.String()
+	default:
+		return atomString(v, digits)
+	}
+}
+
+// FormatReal formats f as a real is printed: with digits significant
+// digits, or in the shortest form that reads back as f when digits is zero
+// or less.
+func FormatReal(f float64, digits int) string {
+	if digits <= 0 {
+		digits = -1
+	}
+	return strconv.FormatFloat(f, 'g', digits, 64)
+}
+
+func atomString(v Value, digits int) string {
 	switch v.Type {
 	case TypeEmpty:
 		return "()"
@@ -281,16 +372,16 @@ func (v Value) String() string {
 		return "#f"
 	case TypeInt:
 		return fmt.Sprintf("%d", v.Int())
+	case TypeBigInt:
+		return v.BigInt().String()
 	case TypeReal:
-		return fmt.Sprintf("%g", v.Real())
+		return FormatReal(v.Real(), digits)
 	case TypeString:
 		return fmt.Sprintf("%q", v.Str())
+	case TypeChar:
+		return charString(v.Char())
 	case TypeSymbol:
 		return v.Sym()
-	case TypePair:
-		return pairToString(v)
-	case TypeVector:
-		return vectorToString(v)
 	case TypePrimitive:
 		return "<primitive>"
 	case TypeClosure:
@@ -299,51 +390,189 @@ func (v Value) String() string {
 		return "<continuation>"
 	case TypeMacro:
 		return "<macro>"
+	case TypeEnvironment:
+		return "#<environment>"
+	case TypeChannel:
+		return "#<channel>"
 	case TypeEOF:
 		return "#<eof>"
+	case TypeErrorObject:
+		if e := v.ErrorObject(); e != nil && e.Err != nil {
+			return fmt.Sprintf("#<error %q>", e.Err.Error())
+		}
+		return "#<error>"
+	case TypeRegex:
+		if re := v.Regex(); re != nil {
+			return fmt.Sprintf("#<regex %q>", re.String())
+		}
+		return "#<regex>"
+	case TypeValues:
+		vals := v.Values()
+		parts := make([]string, len(vals))
+		for i, val := range vals {
+			parts[i] = val.StringPrecision(digits)
+		}
+		return strings.Join(parts, " ")
 	default:
 		return "<unknown>"
 	}
 }
 
-func pairToString(v Value) string {
-	out := "("
-	cur := v
-	first := true
-	for {
-		p := cur.Pair()
-		if cur.Type != TypePair || p == nil {
-			out += fmt.Sprintf(". %s)", cur.String())
-			break
-		}
-		if !first {
-			out += " "
-		}
-		out += p.First.String()
-		rest := p.Rest
-		if rest.Type == TypeEmpty {
-			out += ")"
-			break
+// maxPrintDepth bounds how deeply nested lists, vectors and maps are printed.
+// Structure below this depth is elided as "...".
+const maxPrintDepth = 1000
+
+type printKind int
+
+const (
+	printValue      printKind = iota // print value at depth
+	printText                        // emit text verbatim
+	printPairNext                    // print the head of pair value, then its tail
+	printPairTail                    // continue a list after an element
+	printVectorNext                  // print element index of vector value
+	printMapNext                     // print entry index of map value
+	printRecordNext                  // print field index of record value
+)
+
+type printTask struct {
+	kind  printKind
+	value Value
+	text  string
+	index int
+	depth int
+}
+
+// writeValue prints v using an explicit stack so that deeply nested data
+// cannot exhaust the Go call stack. Reals are printed with digits
+// significant digits, as StringPrecision describes.
+func writeValue(builder *strings.Builder, v Value, digits int) {
+	stack := []printTask{{kind: printValue, value: v}}
+	for len(stack) > 0 {
+		task := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch task.kind {
+		case printText:
+			builder.WriteString(task.text)
+		case printValue:
+			switch task.value.Type {
+			case TypePair:
+				if task.value.Pair() == nil {
+					builder.WriteString("<unknown>")
+					continue
+				}
+				if task.depth >= maxPrintDepth {
+					builder.WriteString("(...)")
+					continue
+				}
+				builder.WriteByte('(')
+				stack = append(stack, printTask{kind: printPairNext, value: task.value, depth: task.depth})
+			case TypeVector:
+				if task.value.Vector() == nil {
+					builder.WriteString("#<vector invalid>")
+					continue
+				}
+				if task.depth >= maxPrintDepth {
+					builder.WriteString("#(...)")
+					continue
+				}
+				builder.WriteString("#(")
+				stack = append(stack, printTask{kind: printVectorNext, value: task.value, depth: task.depth})
+			case TypeMap:
+				if task.value.Map() == nil {
+					builder.WriteString("#<map invalid>")
+					continue
+				}
+				if task.depth >= maxPrintDepth {
+					builder.WriteString("{...}")
+					continue
+				}
+				builder.WriteByte('{')
+				stack = append(stack, printTask{kind: printMapNext, value: task.value, depth: task.depth})
+			case TypeRecord:
+				r := task.value.Record()
+				if r == nil {
+					builder.WriteString("#<record invalid>")
+					continue
+				}
+				if task.depth >= maxPrintDepth {
+					builder.WriteString("#<" + r.Type.Name + " ...>")
+					continue
+				}
+				builder.WriteString("#<" + r.Type.Name)
+				stack = append(stack, printTask{kind: printRecordNext, value: task.value, depth: task.depth})
+			default:
+				builder.WriteString(atomString(task.value, digits))
+			}
+		case printPairNext:
+			p := task.value.Pair()
+			stack = append(stack,
+				printTask{kind: printPairTail, value: p.Rest, depth: task.depth},
+				printTask{kind: printValue, value: p.First, depth: task.depth + 1},
+			)
+		case printPairTail:
+			switch rest := task.value; {
+			case rest.Type == TypeEmpty:
+				builder.WriteByte(')')
+			case rest.Type == TypePair && rest.Pair() != nil:
+				builder.WriteByte(' ')
+				stack = append(stack, printTask{kind: printPairNext, value: rest, depth: task.depth})
+			default:
+				builder.WriteString(". ")
+				stack = append(stack,
+					printTask{kind: printText, text: ")"},
+					printTask{kind: printValue, value: rest, depth: task.depth + 1},
+				)
+			}
+		case printVectorNext:
+			elems := task.value.Vector().Elements
+			if task.index >= len(elems) {
+				builder.WriteByte(')')
+				continue
+			}
+			if task.index > 0 {
+				builder.WriteByte(' ')
+			}
+			stack = append(stack,
+				printTask{kind: printVectorNext, value: task.value, index: task.index + 1, depth: task.depth},
+				printTask{kind: printValue, value: elems[task.index], depth: task.depth + 1},
+			)
+		case printMapNext:
+			m := task.value.Map()
+			if task.index >= m.Len() {
+				builder.WriteByte('}')
+				continue
+			}
+			if task.index > 0 {
+				builder.WriteString(", ")
+			}
+			// Entries use the {key: value} literal syntax of the reader.
+			stack = append(stack,
+				printTask{kind: printMapNext, value: task.value, index: task.index + 1, depth: task.depth},
+				printTask{kind: printValue, value: m.values[task.index], depth: task.depth + 1},
+				printTask{kind: printText, text: ": "},
+				printTask{kind: printValue, value: m.keys[task.index], depth: task.depth + 1},
+			)
+		case printRecordNext:
+			r := task.value.Record()
+			if task.index >= len(r.Values) {
+				builder.WriteByte('>')
+				continue
+			}
+			sep := " "
+			if task.index > 0 {
+				sep = ", "
+			}
+			stack = append(stack,
+				printTask{kind: printRecordNext, value: task.value, index: task.index + 1, depth: task.depth},
+				printTask{kind: printValue, value: r.Values[task.index], depth: task.depth + 1},
+				printTask{kind: printText, text: sep + r.Type.Fields[task.index] + ": "},
+			)
 		}
-		cur = rest
-		first = false
 	}
-	return out
 }
 
-func vectorToString(v Value) string {
-	vec := v.Vector()
-	if vec == nil {
-		return "#<vector invalid>"
-	}
+func pairToString(v Value) string {
 	var builder strings.Builder
-	builder.WriteString("#(")
-	for i, elem := range vec.Elements {
-		if i > 0 {
-			builder.WriteByte(' ')
-		}
-		builder.WriteString(elem.String())
-	}
-	builder.WriteByte(')')
+	writeValue(&builder, v, 0)
 	return builder.String()
 }
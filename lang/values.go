@@ -0,0 +1,25 @@
+package lang
+
+// MultipleValues returns vals as the result of a procedure that returns
+// several values at once, as values(q, r) does. callWithValues passes them
+// to its consumer as separate arguments without building a list; anywhere
+// else the result is a single object printing as the values separated by
+// spaces. A single value is returned as itself, so returning one value is
+// the same as returning it normally.
+func MultipleValues(vals ...Value) Value {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return Value{Type: TypeValues, payload: vals}
+}
+
+// Values returns the values held by a MultipleValues result, or v alone
+// for any other value.
+func (v Value) Values() []Value {
+	if v.Type == TypeValues {
+		if vals, ok := v.payload.([]Value); ok {
+			return vals
+		}
+	}
+	return []Value{v}
+}
@@ -1,185 +1,441 @@
 package main
 
 import (
-	"bufio"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/peterh/liner"
 	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/lang/bytecode"
 	"github.com/sergev/gisp/parser"
+	"github.com/sergev/gisp/repl"
 	"github.com/sergev/gisp/runtime"
+	"github.com/sergev/gisp/sexpr"
 )
 
+// usage describes the command-line grammar.
+const usage = `usage:
+  gisp [options]                   start the REPL
+  gisp [options] script [arg ...]  run a script; *argv* is (script arg ...)
+  gisp [options] - [arg ...]       run s-expressions from standard input; *argv* is ("-" arg ...)
+  gisp expand file                 print the forms a source file compiles to
+  gisp vet file ...                report suspicious code, such as unreachable statements
+  gisp tokens [-asi] file          list the tokens of a Gisp source; -asi explains inserted semicolons
+  gisp grammar                     print the syntax of Gisp in EBNF
+  gisp bench [-n runs] [-vm] [file ...]  time scripts, or the built-in suite
+options:
+  -sandbox      deny filesystem, network, exec and exit
+  -allow list   comma-separated resources to permit: fs, net, exec, exit or all
+`
+
 func main() {
 	ev := runtime.NewEvaluator()
+	ev.Shadow = shadowPolicy()
 	args := os.Args[1:]
-	if len(args) > 0 {
-		runtime.SetArgv(ev.Global, args)
-		script := args[0]
-		var err error
-		if script == "-" {
-			_, err = runtime.EvaluateReader(ev, os.Stdin)
-		} else {
-			_, err = runtime.EvaluateFile(ev, script)
+	if len(args) > 0 && args[0] == "bench" {
+		if err := runBench(os.Stdout, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "gisp: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "expand" {
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
 		}
+		if err := expandFile(os.Stdout, args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "gisp: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "tokens" {
+		if err := runTokens(os.Stdout, args[1:], os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "gisp: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "grammar" {
+		if len(args) != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Print(parser.Grammar)
+		return
+	}
+	if len(args) > 0 && args[0] == "vet" {
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		count, err := vetFiles(os.Stdout, args[1:], os.Stdin)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "gisp: %v\n", err)
 			os.Exit(1)
 		}
+		if count > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	policy, args, err := parseOptions(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(usage)
 		return
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gisp: %v\n%s", err, usage)
+		os.Exit(2)
+	}
+	ev.Policy = policy
+	if len(args) == 0 {
+		runtime.SetArgv(ev.Global, []string{})
+		if err := runREPL(ev); err != nil {
+			fmt.Fprintf(os.Stderr, "gisp: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// The script name and everything after it, options included, become
+	// *argv*; the script decides what its own arguments mean.
+	runtime.SetArgv(ev.Global, args)
+	if _, err := runScript(ev, args[0], os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "gisp: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	runtime.SetArgv(ev.Global, []string{})
-	runREPL(ev)
+// runScript evaluates the script named on the command line. A name of "-"
+// reads s-expressions from stdin, as gisp always has; a Gisp program is run
+// from a .gisp file.
+func runScript(ev *lang.Evaluator, script string, stdin io.Reader) (lang.Value, error) {
+	if script != "-" {
+		return runtime.EvaluateFile(ev, script)
+	}
+	forms, err := readForms(script, stdin)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return ev.EvalAll(forms, nil)
 }
 
-func runREPL(ev *lang.Evaluator) {
-	if !isInteractive() {
-		runBufferedREPL(ev, bufio.NewReader(os.Stdin))
-		return
+// parseOptions handles the options before the script name and returns the
+// security policy they select along with the remaining arguments. -sandbox
+// denies every resource, and -allow permits a comma-separated list of fs,
+// net, exec and exit (or all); $GISP_ALLOW supplies that list when the
+// option is absent. A nil policy leaves the evaluator unrestricted.
+func parseOptions(args []string) (*lang.Policy, []string, error) {
+	flags := flag.NewFlagSet("gisp", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	sandbox := flags.Bool("sandbox", false, "deny filesystem, network, exec and exit")
+	allowEnv, restricted := os.LookupEnv("GISP_ALLOW")
+	allow := flags.String("allow", allowEnv, "comma-separated resources to permit: fs, net, exec, exit or all")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		restricted = true
+	})
+	if !restricted {
+		return nil, flags.Args(), nil
+	}
+	policy := lang.DenyAll
+	if *sandbox {
+		return &policy, flags.Args(), nil
 	}
-	runInteractiveREPL(ev)
+	for _, name := range strings.Split(*allow, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "fs":
+			policy.AllowFS = true
+		case "net":
+			policy.AllowNet = true
+		case "exec":
+			policy.AllowExec = true
+		case "exit":
+			policy.AllowExit = true
+		case "all":
+			policy = lang.AllowAll
+		default:
+			return nil, nil, fmt.Errorf("unknown resource %q in -allow", name)
+		}
+	}
+	return &policy, flags.Args(), nil
 }
 
-func parseGisp(src string) ([]lang.Value, error) {
-	return parser.ParseString(src)
+// expandFile prints the forms a source file compiles to, one pretty-printed
+// form per entry.
+func expandFile(w io.Writer, path string) error {
+	forms, err := loadForms(path)
+	if err != nil {
+		return err
+	}
+	printExpanded(w, forms)
+	return nil
 }
 
-func isIncomplete(err error) bool {
-	return parser.IsIncomplete(err)
+// loadForms reads a source file without evaluating it. .gisp files go
+// through the parser; anything else, including - for stdin, is read as
+// S-expressions, just as running it would. A leading #! line is ignored,
+// and Gisp files get the call to main that running them would add.
+func loadForms(path string) ([]lang.Value, error) {
+	return readForms(path, os.Stdin)
 }
 
-func runBufferedREPL(ev *lang.Evaluator, reader *bufio.Reader) {
-	var buffer strings.Builder
+// readForms is loadForms with the reader that stands for "-".
+func readForms(path string, stdin io.Reader) ([]lang.Value, error) {
+	src, err := readSource(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".gisp" {
+		return parser.ParseProgram(src)
+	}
+	return sexpr.ReadString(src)
+}
 
-	for {
-		line, err := reader.ReadString('\n')
+// readSource returns the text of a source file, or of stdin for "-", with a
+// leading #! line blanked out.
+func readSource(path string, stdin io.Reader) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	src := string(data)
+	if strings.HasPrefix(src, "#!") {
+		// Keep the newline so that line numbers still match the file.
+		if idx := strings.IndexByte(src, '\n'); idx >= 0 {
+			src = src[idx:]
+		} else {
+			src = ""
+		}
+	}
+	return src, nil
+}
+
+// vetFiles implements "gisp vet file ...". It prints the diagnostics found
+// in each Gisp source as path:line:column: message and returns how many
+// there were.
+func vetFiles(w io.Writer, paths []string, stdin io.Reader) (int, error) {
+	count := 0
+	for _, path := range paths {
+		src, err := readSource(path, stdin)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if buffer.Len() == 0 {
-					return
-				}
-			} else {
-				fmt.Fprintf(os.Stderr, "read error: %v\n", err)
-				return
-			}
+			return count, err
 		}
-		buffer.WriteString(line)
-		src := buffer.String()
-		forms, parseErr := parseGisp(src)
-		if parseErr != nil {
-			if isIncomplete(parseErr) && !errors.Is(err, io.EOF) {
-				continue
-			}
-			fmt.Fprintf(os.Stderr, "parse error: %v\n", parseErr)
-			buffer.Reset()
-			if errors.Is(err, io.EOF) {
-				return
-			}
-			continue
-		}
-		buffer.Reset()
-		for _, expr := range forms {
-			val, evalErr := ev.Eval(expr, nil)
-			if evalErr != nil {
-				fmt.Fprintf(os.Stderr, "error: %v\n", evalErr)
-				break
-			}
-			fmt.Println(val.String())
+		diags, err := parser.Check(src)
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", path, err)
 		}
-		if errors.Is(err, io.EOF) {
-			return
+		for _, d := range diags {
+			fmt.Fprintf(w, "%s:%d:%d: %s\n", path, d.Pos.Line, d.Pos.Column, d.Message)
 		}
+		count += len(diags)
 	}
+	return count, nil
 }
 
-func runInteractiveREPL(ev *lang.Evaluator) {
-	state := liner.NewLiner()
-	defer state.Close()
-	state.SetCtrlCAborts(true)
-
-	historyPath := replHistoryPath()
-	if historyPath != "" {
-		if f, err := os.Open(historyPath); err == nil {
-			state.ReadHistory(f)
-			f.Close()
-		}
-		defer func() {
-			if f, err := os.Create(historyPath); err == nil {
-				state.WriteHistory(f)
-				f.Close()
-			}
-		}()
+func printExpanded(w io.Writer, forms []lang.Value) {
+	for _, form := range forms {
+		fmt.Fprintln(w, sexpr.Format(form, sexpr.DefaultWidth))
 	}
+}
 
-	var buffer strings.Builder
-
-	for {
-		prompt := "gisp> "
-		if buffer.Len() > 0 {
-			prompt = ".... "
-		}
-		input, err := state.Prompt(prompt)
-		if err != nil {
-			switch {
-			case errors.Is(err, liner.ErrPromptAborted):
-				fmt.Println()
-				buffer.Reset()
-				continue
-			case errors.Is(err, io.EOF):
-				fmt.Println()
-				return
-			default:
-				fmt.Fprintf(os.Stderr, "read error: %v\n", err)
-				return
+// runTokens implements "gisp tokens [-asi] file". It prints one token per
+// line with its position. Semicolons inserted at line breaks are listed
+// like written ones unless -asi is given, which marks them and says why
+// each was inserted.
+func runTokens(w io.Writer, args []string, stdin io.Reader) error {
+	flags := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	asi := flags.Bool("asi", false, "annotate automatically inserted semicolons")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("tokens: expected one file, got %d", flags.NArg())
+	}
+	src, err := readSource(flags.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	tokens, err := parser.Tokenize(src)
+	if err != nil {
+		return err
+	}
+	for i, tok := range tokens {
+		fmt.Fprintf(w, "%d:%d\t%s", tok.Pos.Line, tok.Pos.Column, tok.Text())
+		if *asi && tok.Inserted {
+			var next parser.Token // EOF
+			if i+1 < len(tokens) {
+				next = tokens[i+1]
 			}
+			prev := tokens[max(i-1, 0)]
+			fmt.Fprintf(w, "\t// inserted: %s", parser.InsertionReason(prev, next))
 		}
-		buffer.WriteString(input)
-		buffer.WriteString("\n")
+		fmt.Fprintln(w)
+	}
+	return nil
+}
 
-		src := buffer.String()
-		forms, parseErr := parseGisp(src)
-		if parseErr != nil {
-			if isIncomplete(parseErr) {
-				continue
+// runBench implements "gisp bench [-n runs] [-vm] [file ...]". Each script is
+// compiled once and then evaluated runs times in a fresh evaluator; the
+// built-in suite runs when no files are given.
+func runBench(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	runs := flags.Int("n", 5, "number of timed runs per script")
+	noFastArith := flags.Bool("nofastarith", false, "apply arithmetic primitives without the integer fast path")
+	vm := flags.Bool("vm", false, "run the scripts on the bytecode virtual machine")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *runs <= 0 {
+		return fmt.Errorf("bench: -n must be positive, got %d", *runs)
+	}
+	type benchProgram struct {
+		name  string
+		forms []lang.Value
+	}
+	var programs []benchProgram
+	if flags.NArg() == 0 {
+		for _, script := range runtime.BenchScripts() {
+			forms, err := parser.ParseString(script.Source)
+			if err != nil {
+				return fmt.Errorf("bench %s: %w", script.Name, err)
 			}
-			fmt.Fprintf(os.Stderr, "parse error: %v\n", parseErr)
-			buffer.Reset()
-			continue
+			programs = append(programs, benchProgram{script.Name, forms})
 		}
-
-		buffer.Reset()
-		if trimmed := strings.TrimSpace(src); trimmed != "" {
-			state.AppendHistory(trimmed)
+	}
+	for _, path := range flags.Args() {
+		forms, err := loadForms(path)
+		if err != nil {
+			return err
 		}
-		for _, expr := range forms {
-			val, evalErr := ev.Eval(expr, nil)
-			if evalErr != nil {
-				fmt.Fprintf(os.Stderr, "error: %v\n", evalErr)
-				break
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		programs = append(programs, benchProgram{name, forms})
+	}
+	for _, prog := range programs {
+		var total, best time.Duration
+		var result lang.Value
+		for i := 0; i < *runs; i++ {
+			ev := runtime.NewEvaluator()
+			ev.NoFastArith = *noFastArith
+			if *vm {
+				ev.Engine = bytecode.New()
+			}
+			start := time.Now()
+			val, err := ev.EvalAll(prog.forms, nil)
+			elapsed := time.Since(start)
+			if err != nil {
+				return fmt.Errorf("bench %s: %w", prog.name, err)
+			}
+			result = val
+			total += elapsed
+			if i == 0 || elapsed < best {
+				best = elapsed
 			}
-			fmt.Println(val.String())
 		}
+		fmt.Fprintf(w, "%-12s %12v/run  best %12v  result %s\n", prog.name, total/time.Duration(*runs), best, result.String())
 	}
+	return nil
 }
 
-func replHistoryPath() string {
-	home, err := os.UserHomeDir()
-	if err != nil || home == "" {
-		return ""
+// runREPL starts the REPL on the standard streams, with line editing and
+// history unless the environment turns them off.
+func runREPL(ev *lang.Evaluator) error {
+	return repl.Run(ev, repl.Options{
+		HistoryPath: replHistoryPath(),
+		LineEditing: replKeymap() != keymapNone,
+		SoftTimeout: replSoftTimeout(),
+	})
+}
+
+// defaultSoftTimeout is how long an expression may run before the REPL
+// reminds the user that it can be interrupted.
+const defaultSoftTimeout = 5 * time.Second
+
+// replSoftTimeout reads the notice threshold in seconds from
+// $GISP_REPL_TIMEOUT; 0 turns the notice off.
+func replSoftTimeout() time.Duration {
+	value := strings.TrimSpace(os.Getenv("GISP_REPL_TIMEOUT"))
+	if value == "" {
+		return defaultSoftTimeout
+	}
+	secs, err := strconv.ParseFloat(value, 64)
+	if err != nil || secs < 0 {
+		fmt.Fprintf(os.Stderr, "gisp: invalid GISP_REPL_TIMEOUT %q; using %v\n", value, defaultSoftTimeout)
+		return defaultSoftTimeout
 	}
-	return filepath.Join(home, ".gisp_history")
+	return time.Duration(secs * float64(time.Second))
 }
 
-func isInteractive() bool {
-	info, err := os.Stdin.Stat()
-	if err != nil {
-		return false
+// shadowPolicy reads how redefined builtins are reported from $GISP_SHADOW:
+// allow (the default), warn or error.
+func shadowPolicy() lang.ShadowPolicy {
+	value := strings.TrimSpace(os.Getenv("GISP_SHADOW"))
+	switch value {
+	case "", "allow":
+		return lang.ShadowAllow
+	case "warn":
+		return lang.ShadowWarn
+	case "error":
+		return lang.ShadowError
+	}
+	fmt.Fprintf(os.Stderr, "gisp: invalid GISP_SHADOW %q; using allow\n", value)
+	return lang.ShadowAllow
+}
+
+const (
+	keymapEmacs = "emacs"
+	keymapNone  = "none"
+)
+
+// replKeymap reports the line editing mode selected via $GISP_KEYMAP.
+// "none" disables line editing so an external wrapper such as rlwrap can
+// supply its own (for example vi) bindings.
+func replKeymap() string {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("GISP_KEYMAP")))
+	switch mode {
+	case "", keymapEmacs:
+		return keymapEmacs
+	case keymapNone:
+		return keymapNone
+	default:
+		fmt.Fprintf(os.Stderr, "gisp: unsupported keymap %q; using %s (set GISP_KEYMAP=%s to use an external line editor)\n", mode, keymapEmacs, keymapNone)
+		return keymapEmacs
+	}
+}
+
+// replHistoryPath returns the history file location. $GISP_HISTORY overrides
+// the default gisp/history under the user's configuration directory;
+// setting it to an empty string disables history. An existing
+// ~/.gisp_history, the location used by earlier versions, is kept.
+func replHistoryPath() string {
+	if path, ok := os.LookupEnv("GISP_HISTORY"); ok {
+		return path
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		legacy := filepath.Join(home, ".gisp_history")
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil || dir == "" {
+		return ""
 	}
-	return (info.Mode() & os.ModeCharDevice) != 0
+	return filepath.Join(dir, "gisp", "history")
 }
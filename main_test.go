@@ -1,33 +1,190 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/sergev/gisp/lang"
 	"github.com/sergev/gisp/runtime"
 )
 
-func TestParseGispGoSyntax(t *testing.T) {
-	forms, err := parseGisp(`
-var x = 40;
-x + 2;
-`)
-	if err != nil {
-		t.Fatalf("parseGisp returned error: %v", err)
+func TestReplHistoryPathOverride(t *testing.T) {
+	custom := filepath.Join(t.TempDir(), "history")
+	t.Setenv("GISP_HISTORY", custom)
+	if got := replHistoryPath(); got != custom {
+		t.Fatalf("replHistoryPath => %q, want %q", got, custom)
 	}
-	if len(forms) == 0 {
-		t.Fatalf("expected compiled forms, got none")
+	t.Setenv("GISP_HISTORY", "")
+	if got := replHistoryPath(); got != "" {
+		t.Fatalf("expected empty GISP_HISTORY to disable history, got %q", got)
 	}
+}
 
-	ev := runtime.NewEvaluator()
-	val, err := ev.EvalAll(forms, nil)
-	if err != nil {
-		t.Fatalf("EvalAll returned error: %v", err)
+func TestReplHistoryPathDefault(t *testing.T) {
+	home, config := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("GISP_HISTORY", "")
+	os.Unsetenv("GISP_HISTORY")
+	if got, want := replHistoryPath(), filepath.Join(config, "gisp", "history"); got != want {
+		t.Fatalf("replHistoryPath => %q, want %q", got, want)
+	}
+	legacy := filepath.Join(home, ".gisp_history")
+	if err := os.WriteFile(legacy, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := replHistoryPath(); got != legacy {
+		t.Fatalf("replHistoryPath => %q, want existing %q", got, legacy)
+	}
+}
+
+func TestReplKeymap(t *testing.T) {
+	for env, want := range map[string]string{"": keymapEmacs, "Emacs": keymapEmacs, "none": keymapNone} {
+		t.Setenv("GISP_KEYMAP", env)
+		if got := replKeymap(); got != want {
+			t.Fatalf("GISP_KEYMAP=%q => %q, want %q", env, got, want)
+		}
+	}
+}
+
+func TestExpandFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prog.gisp")
+	if err := os.WriteFile(path, []byte("var x = 1 + 2;\n"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	var out strings.Builder
+	if err := expandFile(&out, path); err != nil {
+		t.Fatalf("expandFile returned error: %v", err)
+	}
+	if got, want := out.String(), "(define x (+ 1 2))\n"; got != want {
+		t.Fatalf("expandFile => %q, want %q", got, want)
+	}
+}
+
+func TestReadFormsFromStdinAsSExpressions(t *testing.T) {
+	// expand - and bench - read stdin the way gisp - runs it.
+	forms, err := readForms("-", strings.NewReader("#!/usr/bin/env gisp\n(display (+ 1 2))\n"))
+	if err != nil || len(forms) != 1 || forms[0].String() != "(display (+ 1 2))" {
+		t.Fatalf("readForms(-) => %v, %v", forms, err)
+	}
+}
+
+func TestVetFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.gisp")
+	src := "#!/usr/bin/env gisp\nfunc f() {\n    return 1\n    display(2)\n}\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	var out strings.Builder
+	count, err := vetFiles(&out, []string{path, "-"}, strings.NewReader("var x = 1\n"))
+	if err != nil || count != 1 {
+		t.Fatalf("vetFiles => %d, %v", count, err)
+	}
+	if got, want := out.String(), path+":4:5: unreachable code\n"; got != want {
+		t.Fatalf("vetFiles printed %q, want %q", got, want)
+	}
+}
+
+func TestRunTokens(t *testing.T) {
+	var out strings.Builder
+	if err := runTokens(&out, []string{"-asi", "-"}, strings.NewReader("return\nx")); err != nil {
+		t.Fatalf("runTokens returned error: %v", err)
+	}
+	want := "1:1\treturn\n1:1\t;\t// inserted: newline after 'return'\n2:1\tx\n2:1\t;\t// inserted: end of input after 'x'\n"
+	if got := out.String(); got != want {
+		t.Fatalf("runTokens -asi => %q, want %q", got, want)
 	}
-	if got, want := val.String(), "42"; got != want {
-		t.Fatalf("EvalAll => %s, want %s", got, want)
+	out.Reset()
+	if err := runTokens(&out, []string{"-"}, strings.NewReader("x")); err != nil || out.String() != "1:1\tx\n1:1\t;\n" {
+		t.Fatalf("runTokens => %q, %v", out.String(), err)
+	}
+	if err := runTokens(&out, nil, nil); err == nil {
+		t.Fatal("expected an error without a file")
+	}
+}
+
+func TestReplSoftTimeout(t *testing.T) {
+	for env, want := range map[string]time.Duration{
+		"":    defaultSoftTimeout,
+		"0":   0,
+		"1.5": 1500 * time.Millisecond,
+		"-1":  defaultSoftTimeout,
+	} {
+		t.Setenv("GISP_REPL_TIMEOUT", env)
+		if got := replSoftTimeout(); got != want {
+			t.Fatalf("GISP_REPL_TIMEOUT=%q => %v, want %v", env, got, want)
+		}
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sum.gisp")
+	if err := os.WriteFile(path, []byte("#!/usr/bin/env gisp\nvar total = 40\ntotal + 2\n"), 0o644); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	var out strings.Builder
+	if err := runBench(&out, []string{"-n", "2", path}); err != nil {
+		t.Fatalf("runBench returned error: %v", err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "sum ") || !strings.HasSuffix(got, "result 42\n") {
+		t.Fatalf("unexpected bench output %q", got)
+	}
+	out.Reset()
+	if err := runBench(&out, []string{"-n", "1", "-vm", path}); err != nil {
+		t.Fatalf("runBench -vm returned error: %v", err)
+	}
+	if got := out.String(); !strings.HasSuffix(got, "result 42\n") {
+		t.Fatalf("unexpected bench -vm output %q", got)
+	}
+	if err := runBench(&out, []string{"-n", "0", path}); err == nil {
+		t.Fatalf("expected error for non-positive run count")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	t.Setenv("GISP_ALLOW", "")
+	os.Unsetenv("GISP_ALLOW")
+	policy, rest, err := parseOptions([]string{"script.gisp", "-sandbox"})
+	if err != nil || policy != nil || !reflect.DeepEqual(rest, []string{"script.gisp", "-sandbox"}) {
+		t.Fatalf("parseOptions without options => %v, %v, %v", policy, rest, err)
+	}
+	policy, rest, err = parseOptions([]string{"-sandbox", "-", "x"})
+	if err != nil || policy == nil || *policy != lang.DenyAll || !reflect.DeepEqual(rest, []string{"-", "x"}) {
+		t.Fatalf("parseOptions -sandbox => %v, %v, %v", policy, rest, err)
+	}
+	policy, _, err = parseOptions([]string{"-allow", "fs, exit", "script.gisp"})
+	if err != nil || policy == nil || *policy != (lang.Policy{AllowFS: true, AllowExit: true}) {
+		t.Fatalf("parseOptions -allow => %v, %v", policy, err)
+	}
+	if _, _, err := parseOptions([]string{"-allow=disk"}); err == nil || !strings.Contains(err.Error(), `unknown resource "disk"`) {
+		t.Fatalf("expected unknown resource error, got %v", err)
 	}
 
-	if _, err := parseGisp("if true {"); err == nil || !isIncomplete(err) {
-		t.Fatalf("expected incomplete error for open block, got %v", err)
+	t.Setenv("GISP_ALLOW", "net")
+	policy, _, err = parseOptions(nil)
+	if err != nil || policy == nil || *policy != (lang.Policy{AllowNet: true}) {
+		t.Fatalf("parseOptions with GISP_ALLOW => %v, %v", policy, err)
+	}
+}
+
+func TestRunScriptFromStdin(t *testing.T) {
+	ev := runtime.NewEvaluator()
+	var out strings.Builder
+	ev.SetOutput(&out)
+	_, args, err := parseOptions([]string{"-", "one", "-sandbox"})
+	if err != nil || !reflect.DeepEqual(args, []string{"-", "one", "-sandbox"}) {
+		t.Fatalf("parseOptions => %v, %v", args, err)
+	}
+	runtime.SetArgv(ev.Global, args)
+	src := "#!/usr/bin/env gisp\n(display (rest *argv*))\n"
+	if _, err := runScript(ev, "-", strings.NewReader(src)); err != nil {
+		t.Fatalf("runScript returned error: %v", err)
+	}
+	if got, want := out.String(), `("one" "-sandbox")`; got != want {
+		t.Fatalf("script printed %q, want %q", got, want)
 	}
 }
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/sergev/gisp/lang"
@@ -15,6 +16,34 @@ func ParseString(src string) ([]lang.Value, error) {
 	return CompileProgram(prog)
 }
 
+// ParseProgram parses src as a complete script. It behaves like
+// ParseString, except that a script declaring func main without calling it
+// at the top level gets a call appended after its other forms. Any later
+// top-level form mentioning main, as var rc = main() does, counts as a call.
+// main is passed *argv* when it declares parameters.
+func ParseProgram(src string) ([]lang.Value, error) {
+	forms, err := ParseString(src)
+	if err != nil {
+		return nil, err
+	}
+	return appendMainCall(forms), nil
+}
+
+// ParseProgramFile is ParseProgram for src read from the file name, which
+// the positions recorded in the compiled forms refer to.
+func ParseProgramFile(name, src string) ([]lang.Value, error) {
+	prog, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	prog.File = name
+	forms, err := CompileProgram(prog)
+	if err != nil {
+		return nil, err
+	}
+	return appendMainCall(forms), nil
+}
+
 // ParseReader consumes Gisp source from an io.Reader and returns compiled Scheme forms.
 func ParseReader(r io.Reader) ([]lang.Value, error) {
 	data, err := io.ReadAll(r)
@@ -23,3 +52,107 @@ func ParseReader(r io.Reader) ([]lang.Value, error) {
 	}
 	return ParseString(string(data))
 }
+
+// EndsWithSemicolon reports whether the last token of src is a semicolon
+// written by the user, as opposed to one inserted at a line break. The REPL
+// uses it to suppress echoing results.
+func EndsWithSemicolon(src string) bool {
+	lx := newLexer(src)
+	explicit := false
+	for {
+		tok, err := lx.nextToken()
+		if err != nil || tok.Type == tokenEOF {
+			return explicit
+		}
+		explicit = tok.Type == tokenSemicolon && !tok.Inserted
+	}
+}
+
+// Tokenize splits src into tokens, including the semicolons inserted
+// automatically at line breaks, which are marked Inserted. The final EOF
+// token is not included.
+func Tokenize(src string) ([]Token, error) {
+	lx := newLexer(src)
+	var tokens []Token
+	for {
+		tok, err := lx.nextToken()
+		if err != nil {
+			return tokens, wrapError(err)
+		}
+		if tok.Type == tokenEOF {
+			return tokens, nil
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// InsertionReason explains why a semicolon was inserted between prev and
+// next, such as "newline after 'return'". next is the token that follows
+// the inserted semicolon, of type EOF at the end of the input.
+func InsertionReason(prev, next Token) string {
+	switch {
+	case next.Type == tokenEOF:
+		return fmt.Sprintf("end of input after '%s'", prev.Text())
+	case next.Type == tokenRBrace && next.Pos.Line == prev.Pos.Line:
+		return fmt.Sprintf("'}' after '%s'", prev.Text())
+	default:
+		return fmt.Sprintf("newline after '%s'", prev.Text())
+	}
+}
+
+func appendMainCall(forms []lang.Value) []lang.Value {
+	var params lang.Value
+	declared, called := false, false
+	for _, form := range forms {
+		items, err := lang.ToSlice(form)
+		if err == nil && len(items) == 3 && isSymbol(items[0], "define") && isSymbol(items[1], "main") {
+			lambda, err := lang.ToSlice(items[2])
+			if err == nil && len(lambda) >= 2 && isSymbol(lambda[0], "lambda") {
+				params = lambda[1]
+				declared, called = true, false
+				continue
+			}
+		}
+		if err == nil && len(items) > 0 && isSymbol(items[0], "main") {
+			return forms
+		}
+		// A form such as var rc = main() or display(main()) calls main
+		// itself, so the script does not get a second call.
+		if declared && refersTo(form, "main") {
+			called = true
+		}
+	}
+	if !declared || called {
+		return forms
+	}
+	call := lang.List(lang.SymbolValue("main"))
+	if params.Type != lang.TypeEmpty {
+		call = lang.List(lang.SymbolValue("main"), lang.SymbolValue("*argv*"))
+	}
+	return append(forms, call)
+}
+
+// refersTo reports whether the symbol name occurs in form outside quoted
+// data.
+func refersTo(form lang.Value, name string) bool {
+	switch form.Type {
+	case lang.TypeSymbol:
+		return form.Sym() == name
+	case lang.TypePair:
+		if isSymbol(form.Pair().First, "quote") {
+			return false
+		}
+		for form.Type == lang.TypePair {
+			if refersTo(form.Pair().First, name) {
+				return true
+			}
+			form = form.Pair().Rest
+		}
+		return refersTo(form, name)
+	}
+	return false
+}
+
+func isSymbol(v lang.Value, name string) bool {
+	return v.Type == lang.TypeSymbol && v.Sym() == name
+}
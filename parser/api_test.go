@@ -132,3 +132,173 @@ func TestParseStringVectorLiteral(t *testing.T) {
 		}
 	}
 }
+
+func TestEndsWithSemicolon(t *testing.T) {
+	cases := map[string]bool{
+		"x":                       false,
+		"x;":                      true,
+		"x;\n":                    true,
+		"x; // quiet":             true,
+		"x\n":                     false,
+		"x; y":                    false,
+		"func f() { return 1; }":  false,
+		"func f() { return 1; };": true,
+		"":                        false,
+	}
+	for src, want := range cases {
+		if got := EndsWithSemicolon(src); got != want {
+			t.Fatalf("EndsWithSemicolon(%q) = %v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestTokenizeMarksInsertedSemicolons(t *testing.T) {
+	tokens, err := Tokenize("f(x)\nreturn;\nvar s = \"a\"")
+	if err != nil {
+		t.Fatalf("Tokenize: %v", err)
+	}
+	var got []string
+	for i, tok := range tokens {
+		text := tok.Text()
+		if tok.Inserted {
+			var next Token
+			if i+1 < len(tokens) {
+				next = tokens[i+1]
+			}
+			text = "<" + InsertionReason(tokens[i-1], next) + ">"
+		}
+		got = append(got, text)
+	}
+	want := []string{"f", "(", "x", ")", "<newline after ')'>", "return", ";", "var", "s", "=", `"a"`, `<end of input after '"a"'>`}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("Tokenize => %q, want %q", got, want)
+	}
+}
+
+func TestInsertedSemicolonNote(t *testing.T) {
+	_, err := ParseString("func f(x) {\n  if x\n  {\n    return 1\n  }\n}\n")
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Note != "newline after 'x' inserted a ';' here" {
+		t.Fatalf("expected a note about the inserted semicolon, got %v", err)
+	}
+	if got, want := err.Error(), "line 2:6: expected {, found ;\nnote: newline after 'x' inserted a ';' here"; got != want {
+		t.Fatalf("error message %q, want %q", got, want)
+	}
+	_, err = ParseString("func f(x) { if x; { return 1 } }")
+	if !errors.As(err, &perr) || perr.Note != "" {
+		t.Fatalf("a written semicolon should not get a note, got %v", err)
+	}
+	// Errors about other tokens get no note, even when an inserted
+	// semicolon follows them.
+	for _, src := range []string{
+		"func f() {\n  break\n}\n",
+		"func f(g) {\n  while true {\n    g(func() { continue\n    })\n  }\n}\n",
+		"return\n",
+	} {
+		_, err = ParseString(src)
+		if !errors.As(err, &perr) || perr.Note != "" {
+			t.Fatalf("%q: expected an error without a note, got %v", src, err)
+		}
+	}
+}
+
+func TestAssignmentInCondition(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"var x = 0\nif x = 1 { x }", "line 2:6: assignment in if condition; did you mean '=='?"},
+		{"func f(x) { while x = 1 { x++ } }", "line 1:21: assignment in while condition; did you mean '=='?"},
+		{"var y = if 1 = 2 { 1 } else { 2 }", "line 1:14: assignment in if condition; did you mean '=='?"},
+	} {
+		if _, err := ParseString(tc.src); err == nil || err.Error() != tc.want {
+			t.Fatalf("ParseString(%q) error %v, want %q", tc.src, err, tc.want)
+		}
+	}
+	if _, err := ParseString("var x = 0\nif x == 1 { x }"); err != nil {
+		t.Fatalf("comparison in condition: %v", err)
+	}
+}
+
+func TestParseProgramAppendsMainCall(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"func main() { display(1) }", "(main)"},
+		{"func main(args) { display(args) }", "(main *argv*)"},
+		{"func main() { display(1) }\nmain()", "(main)"},
+		{"func helper() { 1 }", "(define helper (lambda () (call/cc (lambda (__gisp_return_1) (begin 1 ())))))"},
+	}
+	for _, tc := range cases {
+		forms, err := ParseProgram(tc.src)
+		if err != nil {
+			t.Fatalf("ParseProgram(%q) returned error: %v", tc.src, err)
+		}
+		if got := forms[len(forms)-1].String(); got != tc.want {
+			t.Fatalf("ParseProgram(%q) last form = %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	// A script that already calls main is left alone.
+	for _, src := range []string{
+		"func main() { 1 }\nmain()",
+		"func main() { 1 }\nvar rc = main()",
+		"func main() { 1 }\ndisplay(main())",
+	} {
+		forms, err := ParseProgram(src)
+		if err != nil || len(forms) != 2 {
+			t.Fatalf("ParseProgram(%q): expected main not to be called twice, got %v, %v", src, forms, err)
+		}
+	}
+	// A string naming main does not call it.
+	forms, err := ParseProgram("func main() { 1 }\nvar name = \"main\"")
+	if err != nil || len(forms) != 3 || forms[2].String() != "(main)" {
+		t.Fatalf("expected main to be called after a string naming it, got %v, %v", forms, err)
+	}
+}
+
+func TestParseProgramFileRecordsPositions(t *testing.T) {
+	src := "func f(x) {\n    if x > 0 {\n        return g(x)\n    }\n}\n"
+	forms, err := ParseProgramFile("prog.gisp", src)
+	if err != nil {
+		t.Fatalf("ParseProgramFile returned error: %v", err)
+	}
+	if pos, ok := lang.Position(forms[0]); !ok || pos != (lang.SourcePos{File: "prog.gisp", Line: 1, Column: 1}) {
+		t.Fatalf("define at %v, %v; want prog.gisp:1:1", pos, ok)
+	}
+	// (define f (lambda (x) (if (> x 0) (return (g x)) ()))), with the
+	// lambda's body wrapped in a call/cc for return.
+	var find func(v lang.Value, head string) lang.Value
+	find = func(v lang.Value, head string) lang.Value {
+		items, err := lang.ToSlice(v)
+		if err != nil {
+			return lang.Value{}
+		}
+		if len(items) > 0 && items[0].Type == lang.TypeSymbol && items[0].Sym() == head {
+			return v
+		}
+		for _, item := range items {
+			if found := find(item, head); found.Type == lang.TypePair {
+				return found
+			}
+		}
+		return lang.Value{}
+	}
+	for head, want := range map[string]lang.SourcePos{
+		"if": {File: "prog.gisp", Line: 2, Column: 5},
+		"g":  {File: "prog.gisp", Line: 3, Column: 17},
+	} {
+		form := find(forms[0], head)
+		if pos, ok := lang.Position(form); !ok || pos != want {
+			t.Fatalf("%s form %s at %v, %v; want %v", head, form, pos, ok, want)
+		}
+	}
+
+	forms, err = ParseString("1 + 2")
+	if err != nil {
+		t.Fatalf("ParseString returned error: %v", err)
+	}
+	if pos, ok := lang.Position(forms[0]); !ok || pos.String() != "line 1:3" {
+		t.Fatalf("sum at %v, %v; want line 1:3", pos, ok)
+	}
+}
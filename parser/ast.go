@@ -17,6 +17,9 @@ type Node interface {
 // Program is the root of a parsed Gisp file.
 type Program struct {
 	Decls []Decl
+	// File names the source file, when known, in the positions that
+	// CompileProgram records for runtime errors.
+	File string
 }
 
 // Decl represents a top-level declaration.
@@ -64,6 +67,15 @@ type StringExpr struct {
 func (e *StringExpr) Pos() Position { return e.Posn }
 func (*StringExpr) exprNode()       {}
 
+// CharExpr is a single-quoted character literal.
+type CharExpr struct {
+	Value rune
+	Posn  Position
+}
+
+func (e *CharExpr) Pos() Position { return e.Posn }
+func (*CharExpr) exprNode()       {}
+
 // BoolExpr is a boolean literal.
 type BoolExpr struct {
 	Value bool
@@ -102,6 +114,7 @@ func (*VectorExpr) exprNode()       {}
 // LambdaExpr is an anonymous function.
 type LambdaExpr struct {
 	Params []string
+	Rest   string // parameter collecting the remaining arguments, or ""
 	Body   *BlockStmt
 	Posn   Position
 }
@@ -109,10 +122,13 @@ type LambdaExpr struct {
 func (e *LambdaExpr) Pos() Position { return e.Posn }
 func (*LambdaExpr) exprNode()       {}
 
-// CallExpr invokes an expression with arguments.
+// CallExpr invokes an expression with arguments. When Spread is set the
+// last argument, written args..., is a list whose elements are passed as
+// the remaining arguments.
 type CallExpr struct {
 	Callee Expr
 	Args   []Expr
+	Spread bool
 	Posn   Position
 }
 
@@ -129,17 +145,35 @@ type IndexExpr struct {
 func (e *IndexExpr) Pos() Position { return e.Posn }
 func (*IndexExpr) exprNode()       {}
 
-// SwitchClause represents a single case within a switch expression.
+// FieldExpr selects a field of a struct, module or object, as in p.x.
+type FieldExpr struct {
+	Target Expr
+	Field  string
+	Posn   Position
+}
+
+func (e *FieldExpr) Pos() Position { return e.Posn }
+func (*FieldExpr) exprNode()       {}
+
+// SwitchClause represents a single case within a switch expression. In a
+// switch with a subject Values lists the values compared with it;
+// otherwise Cond is the condition. With Fallthrough set the body of the
+// next clause is evaluated after Body, and gives the value.
 type SwitchClause struct {
-	Cond Expr
-	Body Expr
-	Posn Position
+	Cond        Expr
+	Values      []Expr
+	Body        Expr
+	Fallthrough bool
+	Posn        Position
 }
 
 func (c *SwitchClause) Pos() Position { return c.Posn }
 
-// SwitchExpr selects the first matching case body based on truthy conditions.
+// SwitchExpr selects the first matching case body based on truthy
+// conditions, or, when it has a Subject, on the first case with a value
+// equal to it.
 type SwitchExpr struct {
+	Subject Expr // may be nil
 	Clauses []*SwitchClause
 	Default Expr // may be nil
 	Posn    Position
@@ -148,6 +182,107 @@ type SwitchExpr struct {
 func (e *SwitchExpr) Pos() Position { return e.Posn }
 func (*SwitchExpr) exprNode()       {}
 
+// SelectClause is a case of a select expression: a receive from Channel,
+// whose value is bound to Name when one is given, or a send of Value.
+type SelectClause struct {
+	Name    string // may be empty
+	Channel Expr
+	Value   Expr // nil for a receive
+	Body    Expr
+	Posn    Position
+}
+
+func (c *SelectClause) Pos() Position { return c.Posn }
+
+// SelectExpr performs one of the channel operations of its cases that can
+// proceed, waiting for one unless there is a default.
+type SelectExpr struct {
+	Clauses []*SelectClause
+	Default Expr // may be nil
+	Posn    Position
+}
+
+func (e *SelectExpr) Pos() Position { return e.Posn }
+func (*SelectExpr) exprNode()       {}
+
+// MatchClause is a case of a match expression: a pattern, an optional
+// guard evaluated with the pattern's variables bound, and the body.
+type MatchClause struct {
+	Pattern Pattern
+	Guard   Expr // may be nil
+	Body    Expr
+	Posn    Position
+}
+
+func (c *MatchClause) Pos() Position { return c.Posn }
+
+// MatchExpr evaluates the body of the first case whose pattern matches the
+// value of Subject and whose guard, if any, holds, or yields nil when none
+// does.
+type MatchExpr struct {
+	Subject Expr
+	Clauses []*MatchClause
+	Posn    Position
+}
+
+func (e *MatchExpr) Pos() Position { return e.Posn }
+func (*MatchExpr) exprNode()       {}
+
+// Pattern is the shape a match case compares its subject against.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern, written _, matches any value without binding it.
+type WildcardPattern struct {
+	Posn Position
+}
+
+func (p *WildcardPattern) Pos() Position { return p.Posn }
+func (*WildcardPattern) patternNode()    {}
+
+// VarPattern matches any value and binds it to Name.
+type VarPattern struct {
+	Name string
+	Posn Position
+}
+
+func (p *VarPattern) Pos() Position { return p.Posn }
+func (*VarPattern) patternNode()    {}
+
+// LiteralPattern matches a value equal to that of a literal: a number,
+// string, character, boolean, nil or backtick literal.
+type LiteralPattern struct {
+	Value Expr
+	Posn  Position
+}
+
+func (p *LiteralPattern) Pos() Position { return p.Posn }
+func (*LiteralPattern) patternNode()    {}
+
+// ListPattern matches a list whose elements match Elements in turn. Without
+// a Rest name the list must have exactly as many elements; with one, the
+// remaining tail is bound to it, as in `[x, xs...]`.
+type ListPattern struct {
+	Elements []Pattern
+	Rest     string // may be empty
+	Posn     Position
+}
+
+func (p *ListPattern) Pos() Position { return p.Posn }
+func (*ListPattern) patternNode()    {}
+
+// VectorPattern matches a vector with exactly as many elements as Elements,
+// each matching the pattern in its position.
+type VectorPattern struct {
+	Elements []Pattern
+	Posn     Position
+}
+
+func (p *VectorPattern) Pos() Position { return p.Posn }
+func (*VectorPattern) patternNode()    {}
+
 // IfExpr conditionally evaluates expression branches.
 type IfExpr struct {
 	Cond Expr
@@ -159,6 +294,17 @@ type IfExpr struct {
 func (e *IfExpr) Pos() Position { return e.Posn }
 func (*IfExpr) exprNode()       {}
 
+// WhileExpr is a while loop in expression position. It yields the value
+// passed to break, or nil when the condition becomes false.
+type WhileExpr struct {
+	Cond Expr
+	Body *BlockStmt
+	Posn Position
+}
+
+func (e *WhileExpr) Pos() Position { return e.Posn }
+func (*WhileExpr) exprNode()       {}
+
 // UnaryExpr represents prefix operator application.
 type UnaryExpr struct {
 	Op   TokenType
@@ -179,6 +325,16 @@ type BinaryExpr struct {
 func (e *BinaryExpr) Pos() Position { return e.Posn }
 func (*BinaryExpr) exprNode()       {}
 
+// InfixExpr applies a user-declared infix operator, compiling to a call.
+type InfixExpr struct {
+	Name        string
+	Left, Right Expr
+	Posn        Position
+}
+
+func (e *InfixExpr) Pos() Position { return e.Posn }
+func (*InfixExpr) exprNode()       {}
+
 // SExprLiteral embeds a raw Scheme expression parsed via the existing reader.
 type SExprLiteral struct {
 	Value lang.Value
@@ -192,6 +348,7 @@ func (*SExprLiteral) exprNode()       {}
 type FuncDecl struct {
 	Name   string
 	Params []string
+	Rest   string // parameter collecting the remaining arguments, or ""
 	Body   *BlockStmt
 	Posn   Position
 }
@@ -199,6 +356,27 @@ type FuncDecl struct {
 func (d *FuncDecl) Pos() Position { return d.Posn }
 func (*FuncDecl) declNode()       {}
 
+// ImportDecl loads a module and binds Name to it, so that its definitions
+// are reached as fields, as in `import "lib/math"` followed by `math.sqrt(2)`.
+type ImportDecl struct {
+	Name string
+	Path string
+	Posn Position
+}
+
+func (d *ImportDecl) Pos() Position { return d.Posn }
+func (*ImportDecl) declNode()       {}
+
+// StructDecl declares a struct type, as in `struct point { x, y }`.
+type StructDecl struct {
+	Name   string
+	Fields []string
+	Posn   Position
+}
+
+func (d *StructDecl) Pos() Position { return d.Posn }
+func (*StructDecl) declNode()       {}
+
 // VarDecl declares a mutable binding, optionally initialised.
 type VarDecl struct {
 	Name  string
@@ -211,6 +389,33 @@ func (d *VarDecl) Pos() Position { return d.Posn }
 func (*VarDecl) declNode()       {}
 func (*VarDecl) stmtNode()       {}
 
+// InfixDecl declares identifiers as infix operators at a precedence level,
+// as in `infix union, dot 5`.
+type InfixDecl struct {
+	Names      []string
+	Precedence int
+	Posn       Position
+}
+
+func (d *InfixDecl) Pos() Position { return d.Posn }
+func (*InfixDecl) declNode()       {}
+
+// DestructureDecl binds the elements of a list to several names at once,
+// as in `var [a, b, rest...] = expr`, or with Values set the multiple
+// values of a result, as in `var q, r = divmod(a, b)`.
+type DestructureDecl struct {
+	Names  []string
+	Rest   string // may be empty
+	Init   Expr
+	Posn   Position
+	Const  bool
+	Values bool
+}
+
+func (d *DestructureDecl) Pos() Position { return d.Posn }
+func (*DestructureDecl) declNode()       {}
+func (*DestructureDecl) stmtNode()       {}
+
 // BlockStmt is a braced block.
 type BlockStmt struct {
 	Stmts []Stmt
@@ -251,6 +456,20 @@ func (s *AssignStmt) Pos() Position { return s.Posn }
 func (*AssignStmt) stmtNode()       {}
 func (*AssignStmt) declNode()       {}
 
+// TupleAssignStmt assigns several targets at once, as in `a, b = b, a`
+// with one expression for each target, or `q, r = divmod(x, y)` with the
+// multiple values of a single expression. Every expression is evaluated
+// before any target is assigned.
+type TupleAssignStmt struct {
+	Targets []Expr
+	Exprs   []Expr
+	Posn    Position
+}
+
+func (s *TupleAssignStmt) Pos() Position { return s.Posn }
+func (*TupleAssignStmt) stmtNode()       {}
+func (*TupleAssignStmt) declNode()       {}
+
 // IncDecStmt performs a post-increment or post-decrement on an identifier.
 type IncDecStmt struct {
 	Name string
@@ -282,9 +501,40 @@ type WhileStmt struct {
 func (s *WhileStmt) Pos() Position { return s.Posn }
 func (*WhileStmt) stmtNode()       {}
 
-// BreakStmt exits the nearest enclosing loop.
+// ForStmt runs Body once for each item of a list, vector, string or map,
+// as in `for x in xs { ... }`. With one name it is bound to each element,
+// character or map key; with two, to the index or key and the element or
+// value.
+type ForStmt struct {
+	Names []string
+	Iter  Expr
+	Body  *BlockStmt
+	Posn  Position
+}
+
+func (s *ForStmt) Pos() Position { return s.Posn }
+func (*ForStmt) stmtNode()       {}
+func (*ForStmt) declNode()       {}
+
+// TryStmt runs Body, handing an error raised in it to the Catch block with
+// the error bound to CatchName, and runs Finally however Body is left.
+type TryStmt struct {
+	Body      *BlockStmt
+	CatchName string
+	Catch     *BlockStmt // may be nil
+	Finally   *BlockStmt // may be nil
+	Posn      Position
+}
+
+func (s *TryStmt) Pos() Position { return s.Posn }
+func (*TryStmt) stmtNode()       {}
+func (*TryStmt) declNode()       {}
+
+// BreakStmt exits the nearest enclosing loop, optionally with the value the
+// loop yields when used as an expression.
 type BreakStmt struct {
-	Posn Position
+	Result Expr // may be nil
+	Posn   Position
 }
 
 func (s *BreakStmt) Pos() Position { return s.Posn }
@@ -298,6 +548,16 @@ type ContinueStmt struct {
 func (s *ContinueStmt) Pos() Position { return s.Posn }
 func (*ContinueStmt) stmtNode()       {}
 
+// DeferStmt evaluates the callee and arguments of Call and runs the call
+// when the enclosing function returns, after the calls deferred later.
+type DeferStmt struct {
+	Call *CallExpr
+	Posn Position
+}
+
+func (s *DeferStmt) Pos() Position { return s.Posn }
+func (*DeferStmt) stmtNode()       {}
+
 // ReturnStmt exits the current function, optionally with a value.
 type ReturnStmt struct {
 	Result Expr // may be nil
@@ -8,6 +8,17 @@ import (
 
 type builder struct {
 	gensymCounter int
+	file          string // source file named in recorded positions
+}
+
+// at records the position of node on form, unless form already has a
+// more specific one, and returns form.
+func (b *builder) at(node Node, form lang.Value) lang.Value {
+	pos := node.Pos()
+	if pos.Line == 0 {
+		return form
+	}
+	return lang.SetPosition(form, lang.SourcePos{File: b.file, Line: pos.Line, Column: pos.Column})
 }
 
 func (b *builder) gensym(prefix string) string {
@@ -19,6 +30,40 @@ func (b *builder) symbol(name string) lang.Value {
 	return lang.SymbolValue(name)
 }
 
+// HelperBuiltins lists the builtins that the forms compiled for
+// destructuring, pattern matching, for loops, defer, spread calls and
+// shared literals call.
+// They call them under the names BuiltinAlias gives, which the runtime
+// binds to the same primitives, so that a parameter or global named first
+// or vectorRef does not change what those constructs do.
+var HelperBuiltins = []string{
+	"first", "rest", "cons", "length", "not", "error", "callWithValues",
+	"pairp", "nullp", "vectorp", "vectorLength", "vectorRef", "equal",
+	"rangeItems", "rangeEntries",
+	"eq", "apply", "listp", "ref", "=", "<",
+}
+
+// BuiltinAlias returns the name under which compiled code calls the helper
+// builtin name.
+func BuiltinAlias(name string) string {
+	return "__gisp_" + name
+}
+
+// builtin returns the symbol naming the helper builtin name, which must be
+// listed in HelperBuiltins.
+func (b *builder) builtin(name string) lang.Value {
+	return b.symbol(BuiltinAlias(name))
+}
+
+// param returns the symbol for a parameter name, replacing the discard
+// identifier with a fresh symbol so that `_` never becomes a binding.
+func (b *builder) param(name string) lang.Value {
+	if name == discardIdent {
+		return b.symbol(b.gensym("discard"))
+	}
+	return b.symbol(name)
+}
+
 func (b *builder) list(values ...lang.Value) lang.Value {
 	return lang.List(values...)
 }
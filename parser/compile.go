@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -13,7 +15,7 @@ func CompileProgram(prog *Program) ([]lang.Value, error) {
 	if prog == nil {
 		return nil, nil
 	}
-	b := &builder{}
+	b := &builder{file: prog.File}
 	var results []lang.Value
 	ctx := compileContext{}
 	for _, decl := range prog.Decls {
@@ -21,15 +23,24 @@ func CompileProgram(prog *Program) ([]lang.Value, error) {
 		if err != nil {
 			return nil, err
 		}
-		results = append(results, forms...)
+		for _, form := range forms {
+			results = append(results, b.at(decl, form))
+		}
 	}
 	return results, nil
 }
 
+// discardIdent is the blank identifier: it may appear as a parameter or an
+// assignment target but never creates a binding or yields a value.
+const discardIdent = "_"
+
+var errDiscardValue = fmt.Errorf("cannot use %s as value", discardIdent)
+
 type compileContext struct {
 	returnSym   string
 	breakSym    string
 	continueSym string
+	defers      *deferList
 }
 
 func (c compileContext) withReturn(sym string) compileContext {
@@ -37,6 +48,21 @@ func (c compileContext) withReturn(sym string) compileContext {
 	return c
 }
 
+// deferList is the variable holding the calls deferred by the function
+// being compiled, most recent first; used records whether it needs one.
+type deferList struct {
+	sym  string
+	used bool
+}
+
+// withFunc returns the context of a function body, whose return escapes
+// through the continuation bound to retSym and which has its own defers.
+func (c compileContext) withFunc(retSym string, defers *deferList) compileContext {
+	c = c.withReturn(retSym)
+	c.defers = defers
+	return c
+}
+
 func (c compileContext) withLoop(breakSym, continueSym string) compileContext {
 	c.breakSym = breakSym
 	c.continueSym = continueSym
@@ -86,6 +112,30 @@ func compileDecl(b *builder, decl Decl, ctx compileContext) ([]lang.Value, error
 			return nil, err
 		}
 		return []lang.Value{form}, nil
+	case *DestructureDecl:
+		form, err := compileTopLevelDestructure(b, d, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []lang.Value{form}, nil
+	case *InfixDecl:
+		return nil, nil
+	case *StructDecl:
+		fields := make([]lang.Value, len(d.Fields))
+		for i, field := range d.Fields {
+			fields[i] = b.symbol(field)
+		}
+		return []lang.Value{b.list(
+			b.symbol("defineStruct"),
+			b.quoteSymbol(d.Name),
+			b.list(b.symbol("quote"), b.list(fields...)),
+		)}, nil
+	case *ImportDecl:
+		return []lang.Value{b.list(
+			b.symbol("import"),
+			lang.StringValue(d.Path),
+			b.quoteSymbol(d.Name),
+		)}, nil
 	case *ExprDecl:
 		expr, err := compileExpr(b, d.Expr, ctx)
 		if err != nil {
@@ -98,6 +148,24 @@ func compileDecl(b *builder, decl Decl, ctx compileContext) ([]lang.Value, error
 			return nil, err
 		}
 		return []lang.Value{form}, nil
+	case *TupleAssignStmt:
+		form, err := compileTupleAssign(b, d, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []lang.Value{b.at(d, form)}, nil
+	case *TryStmt:
+		form, err := compileTry(b, d, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []lang.Value{form}, nil
+	case *ForStmt:
+		form, err := compileFor(b, d, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []lang.Value{form}, nil
 	default:
 		return nil, fmt.Errorf("unsupported top-level declaration %T", decl)
 	}
@@ -114,6 +182,9 @@ func compileTopLevelBinding(b *builder, decl *VarDecl, ctx compileContext) (lang
 	} else {
 		value = lang.EmptyList
 	}
+	if decl.Name == discardIdent {
+		return value, nil
+	}
 	return b.list(
 		b.symbol("define"),
 		b.symbol(decl.Name),
@@ -121,29 +192,117 @@ func compileTopLevelBinding(b *builder, decl *VarDecl, ctx compileContext) (lang
 	), nil
 }
 
+func compileTopLevelDestructure(b *builder, decl *DestructureDecl, ctx compileContext) (lang.Value, error) {
+	init, err := compileExpr(b, decl.Init, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if decl.Values {
+		// Define the names first, then assign them from the parameters
+		// of the consumer that receives the values.
+		var forms, sets []lang.Value
+		params := make([]string, len(decl.Names))
+		for i, name := range decl.Names {
+			params[i] = b.gensym("value")
+			if name == discardIdent {
+				continue
+			}
+			forms = append(forms, b.list(b.symbol("define"), b.symbol(name), lang.EmptyList))
+			sets = append(sets, b.list(b.symbol("set!"), b.symbol(name), b.symbol(params[i])))
+		}
+		consumer := b.lambda(params, b.begin(append(sets, lang.EmptyList)))
+		forms = append(forms, receiveValues(b, init, consumer))
+		return b.begin(forms), nil
+	}
+	tmpSym := b.gensym("destructure")
+	bindings := destructureBindings(b, decl, tmpSym)
+	forms := make([]lang.Value, 0, 2*len(bindings)+1)
+	for _, bind := range bindings {
+		forms = append(forms, b.list(b.symbol("define"), b.symbol(bind.name), lang.EmptyList))
+	}
+	body := []lang.Value{destructureCheck(b, decl, tmpSym)}
+	for _, bind := range bindings {
+		body = append(body, b.list(b.symbol("set!"), b.symbol(bind.name), bind.value))
+	}
+	body = append(body, b.symbol(tmpSym))
+	forms = append(forms, b.let([]binding{{name: tmpSym, value: init}}, b.begin(body)))
+	return b.begin(forms), nil
+}
+
+func compileDestructureWithRest(b *builder, decl *DestructureDecl, rest lang.Value, ctx compileContext) (lang.Value, error) {
+	init, err := compileExpr(b, decl.Init, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if decl.Values {
+		paramList := lang.EmptyList
+		for i := len(decl.Names) - 1; i >= 0; i-- {
+			paramList = lang.PairValue(b.param(decl.Names[i]), paramList)
+		}
+		consumer := b.list(b.symbol("lambda"), paramList, rest)
+		return receiveValues(b, init, consumer), nil
+	}
+	tmpSym := b.gensym("destructure")
+	inner := b.let(destructureBindings(b, decl, tmpSym), rest)
+	body := b.begin([]lang.Value{destructureCheck(b, decl, tmpSym), inner})
+	return b.let([]binding{{name: tmpSym, value: init}}, body), nil
+}
+
+// receiveValues calls consumer with the multiple values of init.
+func receiveValues(b *builder, init, consumer lang.Value) lang.Value {
+	return b.list(b.builtin("callWithValues"), b.lambda(nil, init), consumer)
+}
+
+// destructureBindings returns first/rest accessor chains for each name in the pattern.
+func destructureBindings(b *builder, decl *DestructureDecl, tmpSym string) []binding {
+	bindings := make([]binding, 0, len(decl.Names)+1)
+	cursor := b.symbol(tmpSym)
+	for _, name := range decl.Names {
+		if name != discardIdent {
+			bindings = append(bindings, binding{name: name, value: b.list(b.builtin("first"), cursor)})
+		}
+		cursor = b.list(b.builtin("rest"), cursor)
+	}
+	if decl.Rest != "" && decl.Rest != discardIdent {
+		bindings = append(bindings, binding{name: decl.Rest, value: cursor})
+	}
+	return bindings
+}
+
+// destructureCheck raises an error unless the list held in tmpSym matches the pattern arity.
+func destructureCheck(b *builder, decl *DestructureDecl, tmpSym string) lang.Value {
+	want := lang.IntValue(int64(len(decl.Names)))
+	length := b.list(b.builtin("length"), b.symbol(tmpSym))
+	mismatch := b.list(b.builtin("not"), b.list(b.builtin("="), length, want))
+	message := fmt.Sprintf("destructuring expects %d elements, got", len(decl.Names))
+	if decl.Rest != "" {
+		mismatch = b.list(b.builtin("<"), length, want)
+		message = fmt.Sprintf("destructuring expects at least %d elements, got", len(decl.Names))
+	}
+	return b.list(
+		b.symbol("if"),
+		mismatch,
+		b.list(b.builtin("error"), lang.StringValue(message), length),
+		lang.EmptyList,
+	)
+}
+
 func compileFuncDecl(b *builder, decl *FuncDecl, ctx compileContext) (lang.Value, error) {
-	retSym := b.gensym("return")
-	bodyCtx := ctx.withReturn(retSym)
-	body, err := compileBlock(b, decl.Body, bodyCtx)
+	body, err := compileFuncBody(b, decl.Body, ctx)
 	if err != nil {
 		return lang.Value{}, err
 	}
 	paramList := lang.EmptyList
+	if decl.Rest != "" {
+		paramList = b.param(decl.Rest)
+	}
 	for i := len(decl.Params) - 1; i >= 0; i-- {
-		paramList = lang.PairValue(b.symbol(decl.Params[i]), paramList)
+		paramList = lang.PairValue(b.param(decl.Params[i]), paramList)
 	}
-	callCC := b.list(
-		b.symbol("call/cc"),
-		b.list(
-			b.symbol("lambda"),
-			lang.List(b.symbol(retSym)),
-			body,
-		),
-	)
 	lambda := b.list(
 		b.symbol("lambda"),
 		paramList,
-		callCC,
+		body,
 	)
 	return b.list(
 		b.symbol("define"),
@@ -183,14 +342,28 @@ func compileStmtWithRest(b *builder, stmt Stmt, rest lang.Value, ctx compileCont
 			}
 			initVal = val
 		}
-		return b.let([]binding{{name: s.Name, value: initVal}}, rest), nil
+		if s.Name == discardIdent {
+			return b.begin([]lang.Value{initVal, rest}), nil
+		}
+		return b.at(s, b.let([]binding{{name: s.Name, value: initVal}}, rest)), nil
+	case *DestructureDecl:
+		return compileDestructureWithRest(b, s, rest, ctx)
 	case *AssignStmt:
 		effect, err := compileAssignEffect(b, s, ctx)
 		if err != nil {
 			return lang.Value{}, err
 		}
-		return b.begin([]lang.Value{effect, rest}), nil
+		return b.begin([]lang.Value{b.at(s, effect), rest}), nil
+	case *TupleAssignStmt:
+		effect, err := compileTupleAssign(b, s, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return b.begin([]lang.Value{b.at(s, effect), rest}), nil
 	case *IncDecStmt:
+		if s.Name == discardIdent {
+			return lang.Value{}, newErrorAt(s.Posn, errDiscardValue)
+		}
 		var primName string
 		switch s.Op {
 		case tokenPlusPlus:
@@ -204,7 +377,7 @@ func compileStmtWithRest(b *builder, stmt Stmt, rest lang.Value, ctx compileCont
 			b.symbol(primName),
 			b.quoteSymbol(s.Name),
 		)
-		return b.begin([]lang.Value{call, rest}), nil
+		return b.begin([]lang.Value{b.at(s, call), rest}), nil
 	case *ExprStmt:
 		expr, err := compileExpr(b, s.Expr, ctx)
 		if err != nil {
@@ -241,68 +414,90 @@ func compileStmtWithRest(b *builder, stmt Stmt, rest lang.Value, ctx compileCont
 			thenExpr,
 			elseExpr,
 		)
-		return b.begin([]lang.Value{ifExpr, rest}), nil
+		return b.begin([]lang.Value{b.at(s, ifExpr), rest}), nil
 	case *WhileStmt:
-		cond, err := compileExpr(b, s.Cond, ctx)
+		loop, err := compileWhile(b, s.Cond, s.Body, ctx)
 		if err != nil {
 			return lang.Value{}, err
 		}
-		breakSym := b.gensym("break")
-		loopSym := b.gensym("loop")
-		loopCtx := ctx.withLoop(breakSym, loopSym)
-		body, err := compileBlock(b, s.Body, loopCtx)
+		return b.begin([]lang.Value{b.at(s, loop), rest}), nil
+	case *ForStmt:
+		loop, err := compileFor(b, s, ctx)
 		if err != nil {
 			return lang.Value{}, err
 		}
-		loopBody := b.list(
-			b.symbol("if"),
-			cond,
-			b.begin([]lang.Value{
-				body,
-				b.list(b.symbol(loopSym)),
-			}),
-			lang.EmptyList,
-		)
-		loopLambda := b.list(
-			b.symbol("lambda"),
-			lang.EmptyList,
-			loopBody,
-		)
-		loopSet := b.list(
-			b.symbol("set!"),
-			b.symbol(loopSym),
-			loopLambda,
-		)
-		loopCall := b.list(b.symbol(loopSym))
-		loopLetBody := b.begin([]lang.Value{loopSet, loopCall})
-		loopLet := b.let([]binding{{name: loopSym, value: lang.EmptyList}}, loopLetBody)
-		callCC := b.list(
-			b.symbol("call/cc"),
-			b.list(
-				b.symbol("lambda"),
-				lang.List(b.symbol(breakSym)),
-				loopLet,
-			),
-		)
-		return b.begin([]lang.Value{callCC, rest}), nil
+		return b.begin([]lang.Value{b.at(s, loop), rest}), nil
+	case *TryStmt:
+		form, err := compileTry(b, s, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return b.begin([]lang.Value{b.at(s, form), rest}), nil
 	case *BreakStmt:
 		if ctx.breakSym == "" {
 			return lang.Value{}, fmt.Errorf("break not allowed in this context")
 		}
-		return b.list(
+		value := lang.EmptyList
+		if s.Result != nil {
+			val, err := compileExpr(b, s.Result, ctx)
+			if err != nil {
+				return lang.Value{}, err
+			}
+			value = val
+		}
+		return b.at(s, b.list(
 			b.symbol(ctx.breakSym),
-			lang.EmptyList,
-		), nil
+			value,
+		)), nil
 	case *ContinueStmt:
 		if ctx.continueSym == "" {
 			return lang.Value{}, fmt.Errorf("continue not allowed in this context")
 		}
-		return b.list(
+		return b.at(s, b.list(
 			b.symbol(ctx.continueSym),
-		), nil
+		)), nil
+	case *DeferStmt:
+		if ctx.defers == nil {
+			return lang.Value{}, fmt.Errorf("defer not allowed outside functions")
+		}
+		ctx.defers.used = true
+		call, err := compileExprNode(b, s.Call, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		parts, err := lang.ToSlice(call)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		// The arguments, and a callee other than a name, are evaluated
+		// now and the call made later by a thunk. A named callee is left
+		// in place so that it may be a macro, such as receive.
+		var bindings []lang.Value
+		for i, part := range parts {
+			if i == 0 && part.Type == lang.TypeSymbol {
+				continue
+			}
+			tmp := b.symbol(b.gensym("arg"))
+			bindings = append(bindings, lang.List(tmp, part))
+			parts[i] = tmp
+		}
+		thunk := b.list(b.symbol("lambda"), lang.EmptyList, b.at(s.Call, lang.List(parts...)))
+		if len(bindings) > 0 {
+			thunk = b.list(b.symbol("let"), lang.List(bindings...), thunk)
+		}
+		push := b.list(
+			b.symbol("set!"),
+			b.symbol(ctx.defers.sym),
+			b.list(
+				b.builtin("cons"),
+				thunk,
+				b.symbol(ctx.defers.sym),
+			),
+		)
+		return b.begin([]lang.Value{b.at(s, push), rest}), nil
 	case *ReturnStmt:
 		if ctx.returnSym == "" {
-			return lang.Value{}, fmt.Errorf("return not allowed in this context")
+			return lang.Value{}, newErrorAt(s.Posn, fmt.Errorf("return not allowed in this context"))
 		}
 		var value lang.Value
 		if s.Result != nil {
@@ -314,23 +509,47 @@ func compileStmtWithRest(b *builder, stmt Stmt, rest lang.Value, ctx compileCont
 		} else {
 			value = lang.EmptyList
 		}
-		return b.list(
+		return b.at(s, b.list(
 			b.symbol(ctx.returnSym),
 			value,
-		), nil
+		)), nil
 	default:
 		return lang.Value{}, fmt.Errorf("unsupported statement %T", stmt)
 	}
 }
 
+// compileExpr compiles expr and records its position on the result.
 func compileExpr(b *builder, expr Expr, ctx compileContext) (lang.Value, error) {
+	val, err := compileExprNode(b, expr, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return b.at(expr, val), nil
+}
+
+func compileExprNode(b *builder, expr Expr, ctx compileContext) (lang.Value, error) {
 	switch e := expr.(type) {
 	case *IdentifierExpr:
+		if e.Name == discardIdent {
+			return lang.Value{}, newErrorAt(e.Posn, errDiscardValue)
+		}
 		return b.symbol(e.Name), nil
+	case *FieldExpr:
+		target, err := compileExpr(b, e.Target, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return b.list(b.symbol("getField"), target, b.quoteSymbol(e.Field)), nil
 	case *NumberExpr:
-		return parseNumber(e.Value)
+		val, err := parseNumber(e.Value)
+		if err != nil {
+			return lang.Value{}, newErrorAt(e.Posn, err)
+		}
+		return val, nil
 	case *StringExpr:
 		return lang.StringValue(e.Value), nil
+	case *CharExpr:
+		return lang.CharValue(e.Value), nil
 	case *BoolExpr:
 		return lang.BoolValue(e.Value), nil
 	case *NilExpr:
@@ -361,20 +580,38 @@ func compileExpr(b *builder, expr Expr, ctx compileContext) (lang.Value, error)
 		return compileLambdaExpr(b, e, ctx)
 	case *SwitchExpr:
 		return compileSwitchExpr(b, e, ctx)
+	case *SelectExpr:
+		return compileSelectExpr(b, e, ctx)
+	case *MatchExpr:
+		return compileMatchExpr(b, e, ctx)
 	case *IfExpr:
 		return compileIfExpr(b, e, ctx)
+	case *WhileExpr:
+		return compileWhile(b, e.Cond, e.Body, ctx)
 	case *CallExpr:
 		callee, err := compileExpr(b, e.Callee, ctx)
 		if err != nil {
 			return lang.Value{}, err
 		}
-		args := make([]lang.Value, 0, len(e.Args)+1)
+		args := make([]lang.Value, 0, len(e.Args)+2)
+		if e.Spread {
+			// f(x, xs...) is (apply f x xs).
+			args = append(args, b.builtin("apply"))
+		}
 		args = append(args, callee)
 		for _, arg := range e.Args {
 			val, err := compileExpr(b, arg, ctx)
 			if err != nil {
 				return lang.Value{}, err
 			}
+			if datum, ok := sharedLiteralArg(e.Callee, arg); ok && !e.Spread {
+				// The name may be a parameter, local or redefined global
+				// that keeps or changes its argument; only the builtin
+				// itself gets the shared data.
+				name := e.Callee.(*IdentifierExpr).Name
+				isBuiltin := b.list(b.builtin("eq"), callee, b.builtin(name))
+				val = b.list(b.symbol("if"), isBuiltin, b.list(b.symbol("quote"), datum), val)
+			}
 			args = append(args, val)
 		}
 		return lang.List(args...), nil
@@ -388,7 +625,7 @@ func compileExpr(b *builder, expr Expr, ctx compileContext) (lang.Value, error)
 			return lang.Value{}, err
 		}
 		return lang.List(
-			b.symbol("vectorRef"),
+			b.symbol("ref"),
 			target,
 			index,
 		), nil
@@ -396,6 +633,16 @@ func compileExpr(b *builder, expr Expr, ctx compileContext) (lang.Value, error)
 		return compileUnaryExpr(b, e, ctx)
 	case *BinaryExpr:
 		return compileBinaryExpr(b, e, ctx)
+	case *InfixExpr:
+		left, err := compileExpr(b, e.Left, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		right, err := compileExpr(b, e.Right, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return lang.List(b.symbol(e.Name), left, right), nil
 	case *SExprLiteral:
 		return e.Value, nil
 	default:
@@ -403,6 +650,126 @@ func compileExpr(b *builder, expr Expr, ctx compileContext) (lang.Value, error)
 	}
 }
 
+// literalSafeCalls lists builtins that neither modify nor keep their
+// arguments. A constant list or vector literal passed straight to one of them
+// cannot be reached by user code afterwards, so when the callee turns out to
+// be that builtin at run time, the literal is quoted data shared by every
+// evaluation instead of being rebuilt each time. Builtins mapped to true may
+// return an element of the literal and therefore only share literals whose
+// elements are all atoms. Each is also in HelperBuiltins, for the check.
+var literalSafeCalls = map[string]bool{
+	"apply":        true,
+	"equal":        false,
+	"first":        true,
+	"length":       false,
+	"listp":        false,
+	"ref":          true,
+	"vectorLength": false,
+	"vectorRef":    true,
+}
+
+// sharedLiteralArg reports whether arg, an argument of a call to callee, can
+// be compiled to shared constant data, and returns that data.
+func sharedLiteralArg(callee, arg Expr) (lang.Value, bool) {
+	ident, ok := callee.(*IdentifierExpr)
+	if !ok {
+		return lang.Value{}, false
+	}
+	atomsOnly, ok := literalSafeCalls[ident.Name]
+	if !ok {
+		return lang.Value{}, false
+	}
+	switch arg.(type) {
+	case *ListExpr, *VectorExpr:
+	default:
+		return lang.Value{}, false
+	}
+	depth := -1
+	if atomsOnly {
+		depth = 1
+	}
+	return constantDatum(arg, depth)
+}
+
+// constantDatum converts a literal built only from numbers, strings,
+// booleans, nil and nested list or vector literals into the value it
+// evaluates to. A non-negative depth limits how deeply literals may nest.
+func constantDatum(expr Expr, depth int) (lang.Value, bool) {
+	var elements []Expr
+	switch e := expr.(type) {
+	case *NumberExpr:
+		val, err := parseNumber(e.Value)
+		return val, err == nil
+	case *StringExpr:
+		return lang.StringValue(e.Value), true
+	case *CharExpr:
+		return lang.CharValue(e.Value), true
+	case *BoolExpr:
+		return lang.BoolValue(e.Value), true
+	case *NilExpr:
+		return lang.EmptyList, true
+	case *ListExpr:
+		elements = e.Elements
+	case *VectorExpr:
+		elements = e.Elements
+	default:
+		return lang.Value{}, false
+	}
+	if depth == 0 {
+		return lang.Value{}, false
+	}
+	values := make([]lang.Value, len(elements))
+	for i, el := range elements {
+		val, ok := constantDatum(el, depth-1)
+		if !ok {
+			return lang.Value{}, false
+		}
+		values[i] = val
+	}
+	if _, ok := expr.(*VectorExpr); ok {
+		return lang.VectorValue(values), true
+	}
+	return lang.List(values...), true
+}
+
+// compileTupleAssign binds the values of s to temporaries, from one
+// expression each or from the multiple values of one, and then assigns the
+// targets from them in order.
+func compileTupleAssign(b *builder, s *TupleAssignStmt, ctx compileContext) (lang.Value, error) {
+	temps := make([]string, len(s.Targets))
+	sets := make([]lang.Value, 0, len(s.Targets)+1)
+	for i, target := range s.Targets {
+		temps[i] = b.gensym("value")
+		set, err := compileAssignEffect(b, &AssignStmt{
+			Target: target,
+			Expr:   &IdentifierExpr{Name: temps[i], Posn: target.Pos()},
+			Op:     tokenAssign,
+			Posn:   target.Pos(),
+		}, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		sets = append(sets, set)
+	}
+	body := b.begin(append(sets, lang.EmptyList))
+	if len(s.Exprs) == 1 {
+		init, err := compileExpr(b, s.Exprs[0], ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return receiveValues(b, init, b.lambda(temps, body)), nil
+	}
+	bindings := make([]binding, len(s.Exprs))
+	for i, expr := range s.Exprs {
+		value, err := compileExpr(b, expr, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		bindings[i] = binding{name: temps[i], value: value}
+	}
+	return b.let(bindings, body), nil
+}
+
 func compileAssignEffect(b *builder, s *AssignStmt, ctx compileContext) (lang.Value, error) {
 	value, err := compileExpr(b, s.Expr, ctx)
 	if err != nil {
@@ -411,6 +778,12 @@ func compileAssignEffect(b *builder, s *AssignStmt, ctx compileContext) (lang.Va
 	switch target := s.Target.(type) {
 	case *IdentifierExpr:
 		name := target.Name
+		if name == discardIdent {
+			if s.Op == tokenAssign || s.Op == 0 {
+				return value, nil
+			}
+			return lang.Value{}, newErrorAt(s.Posn, errDiscardValue)
+		}
 		if s.Op == tokenAssign || s.Op == 0 {
 			return b.list(
 				b.symbol("set!"),
@@ -426,6 +799,41 @@ func compileAssignEffect(b *builder, s *AssignStmt, ctx compileContext) (lang.Va
 			), nil
 		}
 		return lang.Value{}, fmt.Errorf("unsupported assignment operator %s", s.Op)
+	case *FieldExpr:
+		obj, err := compileExpr(b, target.Target, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if s.Op == tokenAssign || s.Op == 0 {
+			return b.list(
+				b.symbol("setField"),
+				obj,
+				b.quoteSymbol(target.Field),
+				value,
+			), nil
+		}
+		primName, ok := compoundAssignPrimitive(s.Op)
+		if !ok {
+			return lang.Value{}, fmt.Errorf("unsupported assignment operator %s", s.Op)
+		}
+		var bindings []binding
+		if _, ok := target.Target.(*IdentifierExpr); !ok {
+			// ps[i] in ps[i].x += v is evaluated only once.
+			tmp := b.gensym("obj")
+			bindings = append(bindings, binding{name: tmp, value: obj})
+			obj = b.symbol(tmp)
+		}
+		current := b.list(b.symbol("getField"), obj, b.quoteSymbol(target.Field))
+		update := b.list(
+			b.symbol("setField"),
+			obj,
+			b.quoteSymbol(target.Field),
+			b.list(b.symbol(strings.TrimSuffix(primName, "=")), current, value),
+		)
+		if bindings == nil {
+			return update, nil
+		}
+		return b.let(bindings, update), nil
 	case *IndexExpr:
 		if s.Op != tokenAssign && s.Op != 0 {
 			return lang.Value{}, fmt.Errorf("compound assignments not supported for indexed targets")
@@ -450,15 +858,36 @@ func compileAssignEffect(b *builder, s *AssignStmt, ctx compileContext) (lang.Va
 }
 
 func compileLambdaExpr(b *builder, expr *LambdaExpr, ctx compileContext) (lang.Value, error) {
-	retSym := b.gensym("return")
-	bodyCtx := ctx.withReturn(retSym)
-	body, err := compileBlock(b, expr.Body, bodyCtx)
+	body, err := compileFuncBody(b, expr.Body, ctx)
 	if err != nil {
 		return lang.Value{}, err
 	}
 	paramList := lang.EmptyList
+	if expr.Rest != "" {
+		paramList = b.param(expr.Rest)
+	}
 	for i := len(expr.Params) - 1; i >= 0; i-- {
-		paramList = lang.PairValue(b.symbol(expr.Params[i]), paramList)
+		paramList = lang.PairValue(b.param(expr.Params[i]), paramList)
+	}
+	return b.list(
+		b.symbol("lambda"),
+		paramList,
+		body,
+	), nil
+}
+
+// compileFuncBody compiles the body of a function into a call/cc form
+// binding its return continuation. When the body defers calls, that form
+// runs in an unwind-protect whose cleanup calls the thunks the defer
+// statements pushed, most recent first, however the function is left; each
+// is protected in turn, so one raising an error does not keep the others
+// from running.
+func compileFuncBody(b *builder, block *BlockStmt, ctx compileContext) (lang.Value, error) {
+	retSym := b.gensym("return")
+	defers := &deferList{sym: b.gensym("defers")}
+	body, err := compileBlock(b, block, ctx.withFunc(retSym, defers))
+	if err != nil {
+		return lang.Value{}, err
 	}
 	callCC := b.list(
 		b.symbol("call/cc"),
@@ -468,37 +897,422 @@ func compileLambdaExpr(b *builder, expr *LambdaExpr, ctx compileContext) (lang.V
 			body,
 		),
 	)
+	if !defers.used {
+		return callCC, nil
+	}
+	loop := b.gensym("deferred")
+	pending := b.symbol(b.gensym("pending"))
+	cleanup := b.list(
+		b.symbol("let"),
+		b.symbol(loop),
+		lang.List(lang.List(pending, b.symbol(defers.sym))),
+		b.list(
+			b.symbol("if"),
+			b.list(b.builtin("nullp"), pending),
+			lang.EmptyList,
+			b.list(
+				b.symbol("unwind-protect"),
+				b.list(b.list(b.builtin("first"), pending)),
+				b.list(b.symbol(loop), b.list(b.builtin("rest"), pending)),
+			),
+		),
+	)
 	return b.list(
+		b.symbol("let"),
+		lang.List(lang.List(b.symbol(defers.sym), b.list(b.symbol("quote"), lang.EmptyList))),
+		b.list(
+			b.symbol("unwind-protect"),
+			callCC,
+			cleanup,
+		),
+	), nil
+}
+
+// mentionsSymbol reports whether the symbol name occurs anywhere in form.
+func mentionsSymbol(form lang.Value, name string) bool {
+	for form.Type == lang.TypePair {
+		pair := form.Pair()
+		if mentionsSymbol(pair.First, name) {
+			return true
+		}
+		form = pair.Rest
+	}
+	return form.Type == lang.TypeSymbol && form.Sym() == name
+}
+
+// compileWhile builds a loop that escapes through a continuation bound to
+// the break symbol. Its value is the one passed to break, or the empty list
+// once the condition fails.
+func compileWhile(b *builder, condExpr Expr, block *BlockStmt, ctx compileContext) (lang.Value, error) {
+	cond, err := compileExpr(b, condExpr, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return compileLoop(b, cond, ctx, func(loopCtx compileContext) (lang.Value, error) {
+		return compileBlock(b, block, loopCtx)
+	})
+}
+
+// compileFor walks a vector of the items, taken once before the first
+// iteration by rangeItems, or by rangeEntries along with their indices or
+// keys. Each iteration binds the loop variables afresh, so closures made in
+// the body keep their own, and advances the index before the body runs, so
+// that continue moves on to the next item.
+func compileFor(b *builder, stmt *ForStmt, ctx compileContext) (lang.Value, error) {
+	iter, err := compileExpr(b, stmt.Iter, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	keysSym := b.gensym("keys")
+	itemsSym := b.gensym("items")
+	indexSym := b.gensym("index")
+	index := b.symbol(indexSym)
+	cond := b.list(b.symbol("<"), index, b.list(b.builtin("vectorLength"), b.symbol(itemsSym)))
+	loop, err := compileLoop(b, cond, ctx, func(loopCtx compileContext) (lang.Value, error) {
+		body, err := compileBlock(b, stmt.Body, loopCtx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		vectors := []string{itemsSym}
+		if len(stmt.Names) == 2 {
+			vectors = []string{keysSym, itemsSym}
+		}
+		var bindings []binding
+		for i, name := range stmt.Names {
+			if name != discardIdent {
+				bindings = append(bindings, binding{name: name, value: b.list(b.builtin("vectorRef"), b.symbol(vectors[i]), index)})
+			}
+		}
+		next := b.list(b.symbol("set!"), index, b.list(b.symbol("+"), index, lang.IntValue(1)))
+		return b.let(bindings, b.begin([]lang.Value{next, body})), nil
+	})
+	if err != nil {
+		return lang.Value{}, err
+	}
+	form := b.let([]binding{{name: indexSym, value: lang.IntValue(0)}}, loop)
+	if len(stmt.Names) == 2 {
+		consumer := b.list(b.symbol("lambda"), lang.List(b.symbol(keysSym), b.symbol(itemsSym)), form)
+		return receiveValues(b, b.list(b.builtin("rangeEntries"), iter), consumer), nil
+	}
+	return b.let([]binding{{name: itemsSym, value: b.list(b.builtin("rangeItems"), iter)}}, form), nil
+}
+
+// compileLoop repeats the body made by compileBody while cond holds. The
+// loop escapes through a continuation bound to the break symbol.
+func compileLoop(b *builder, cond lang.Value, ctx compileContext, compileBody func(compileContext) (lang.Value, error)) (lang.Value, error) {
+	breakSym := b.gensym("break")
+	loopSym := b.gensym("loop")
+	continueSym := b.gensym("continue")
+	loopCtx := ctx.withLoop(breakSym, continueSym)
+	body, err := compileBody(loopCtx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if mentionsSymbol(body, continueSym) {
+		// continue escapes from this iteration alone, so that the call
+		// starting the next one stays in tail position.
+		body = b.list(
+			b.symbol("call/cc"),
+			b.list(
+				b.symbol("lambda"),
+				lang.List(b.symbol(continueSym)),
+				body,
+			),
+		)
+	}
+	loopBody := b.list(
+		b.symbol("if"),
+		cond,
+		b.begin([]lang.Value{
+			body,
+			b.list(b.symbol(loopSym)),
+		}),
+		lang.EmptyList,
+	)
+	loopLambda := b.list(
 		b.symbol("lambda"),
-		paramList,
-		callCC,
+		lang.EmptyList,
+		loopBody,
+	)
+	loopSet := b.list(
+		b.symbol("set!"),
+		b.symbol(loopSym),
+		loopLambda,
+	)
+	loopCall := b.list(b.symbol(loopSym))
+	loopLetBody := b.begin([]lang.Value{loopSet, loopCall})
+	loopLet := b.let([]binding{{name: loopSym, value: lang.EmptyList}}, loopLetBody)
+	return b.list(
+		b.symbol("call/cc"),
+		b.list(
+			b.symbol("lambda"),
+			lang.List(b.symbol(breakSym)),
+			loopLet,
+		),
 	), nil
 }
 
-func compileSwitchExpr(b *builder, expr *SwitchExpr, ctx compileContext) (lang.Value, error) {
-	clauseVals := make([]lang.Value, 0, len(expr.Clauses)+1)
-	for _, clause := range expr.Clauses {
-		condVal, err := compileExpr(b, clause.Cond, ctx)
+// compileTry wraps the body in a catch form whose handler runs the catch
+// block, and that in an unwind-protect form running the finally block.
+func compileTry(b *builder, stmt *TryStmt, ctx compileContext) (lang.Value, error) {
+	form, err := compileBlock(b, stmt.Body, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if stmt.Catch != nil {
+		handler, err := compileBlock(b, stmt.Catch, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		form = b.list(
+			b.symbol("catch"),
+			b.list(
+				b.symbol("lambda"),
+				lang.List(b.param(stmt.CatchName)),
+				handler,
+			),
+			form,
+		)
+	}
+	if stmt.Finally != nil {
+		cleanup, err := compileBlock(b, stmt.Finally, ctx)
 		if err != nil {
 			return lang.Value{}, err
 		}
+		form = b.list(
+			b.symbol("unwind-protect"),
+			form,
+			cleanup,
+		)
+	}
+	return form, nil
+}
+
+// compileSwitchExpr compiles a switch to cond. With a subject, the subject
+// is bound to a temporary and each case tests it with == against its
+// values in turn. A case that falls through has the bodies of the clauses
+// it reaches appended to its own.
+func compileSwitchExpr(b *builder, expr *SwitchExpr, ctx compileContext) (lang.Value, error) {
+	var subjectSym string
+	if expr.Subject != nil {
+		subjectSym = b.gensym("subject")
+	}
+	tests := make([]lang.Value, len(expr.Clauses))
+	bodies := make([]lang.Value, len(expr.Clauses), len(expr.Clauses)+1)
+	for i, clause := range expr.Clauses {
+		if expr.Subject == nil {
+			condVal, err := compileExpr(b, clause.Cond, ctx)
+			if err != nil {
+				return lang.Value{}, err
+			}
+			tests[i] = condVal
+		} else {
+			alts := []lang.Value{b.symbol("or")}
+			for _, value := range clause.Values {
+				val, err := compileExpr(b, value, ctx)
+				if err != nil {
+					return lang.Value{}, err
+				}
+				alts = append(alts, b.at(value, b.list(b.symbol("=="), b.symbol(subjectSym), val)))
+			}
+			tests[i] = lang.List(alts...)
+			if len(alts) == 2 {
+				tests[i] = alts[1]
+			}
+		}
 		bodyVal, err := compileExpr(b, clause.Body, ctx)
 		if err != nil {
 			return lang.Value{}, err
 		}
-		clauseVals = append(clauseVals, lang.List(condVal, bodyVal))
+		bodies[i] = bodyVal
 	}
+	var defaultVal lang.Value
 	if expr.Default != nil {
 		bodyVal, err := compileExpr(b, expr.Default, ctx)
 		if err != nil {
 			return lang.Value{}, err
 		}
-		clauseVals = append(clauseVals, lang.List(b.symbol("else"), bodyVal))
+		defaultVal = bodyVal
+		bodies = append(bodies, bodyVal)
+	}
+	clauseVals := make([]lang.Value, 0, len(expr.Clauses)+1)
+	for i := range expr.Clauses {
+		end := i
+		for end < len(expr.Clauses) && expr.Clauses[end].Fallthrough && end+1 < len(bodies) {
+			end++
+		}
+		clauseVals = append(clauseVals, lang.List(tests[i], b.begin(bodies[i:end+1])))
+	}
+	if expr.Default != nil {
+		clauseVals = append(clauseVals, lang.List(b.symbol("else"), defaultVal))
 	}
 	all := make([]lang.Value, 0, len(clauseVals)+1)
 	all = append(all, b.symbol("cond"))
 	all = append(all, clauseVals...)
-	return lang.List(all...), nil
+	form := lang.List(all...)
+	if expr.Subject == nil {
+		return form, nil
+	}
+	subject, err := compileExpr(b, expr.Subject, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return b.let([]binding{{name: subjectSym, value: subject}}, form), nil
+}
+
+// compileSelectExpr hands the channel operations to channelSelect, which
+// returns the index of the one performed and the value it received, and
+// dispatches on the index to the body of its case.
+func compileSelectExpr(b *builder, expr *SelectExpr, ctx compileContext) (lang.Value, error) {
+	indexSym := b.gensym("case")
+	valueSym := b.gensym("received")
+	ops := []lang.Value{b.symbol("vector")}
+	clauseVals := []lang.Value{b.symbol("cond")}
+	for i, clause := range expr.Clauses {
+		op := []lang.Value{b.symbol("vector")}
+		for _, e := range []Expr{clause.Channel, clause.Value} {
+			if e == nil {
+				continue
+			}
+			val, err := compileExpr(b, e, ctx)
+			if err != nil {
+				return lang.Value{}, err
+			}
+			op = append(op, val)
+		}
+		ops = append(ops, lang.List(op...))
+		body, err := compileExpr(b, clause.Body, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if clause.Name != "" && clause.Name != discardIdent {
+			body = b.let([]binding{{name: clause.Name, value: b.symbol(valueSym)}}, body)
+		}
+		match := b.list(b.symbol("="), b.symbol(indexSym), lang.IntValue(int64(i)))
+		clauseVals = append(clauseVals, lang.List(match, body))
+	}
+	if expr.Default != nil {
+		body, err := compileExpr(b, expr.Default, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		clauseVals = append(clauseVals, lang.List(b.symbol("else"), body))
+	}
+	wait := lang.BoolValue(expr.Default == nil)
+	consumer := b.list(b.symbol("lambda"), lang.List(b.symbol(indexSym), b.symbol(valueSym)), lang.List(clauseVals...))
+	return receiveValues(b, b.list(b.symbol("channelSelect"), lang.List(ops...), wait), consumer), nil
+}
+
+// compileMatchExpr binds the subject to a temporary and tries the cases in
+// turn. Each case after the first is wrapped in a procedure of no arguments
+// that the case before it calls when its pattern or guard fails, so that
+// the tests of a pattern nest without repeating the cases that follow.
+func compileMatchExpr(b *builder, expr *MatchExpr, ctx compileContext) (lang.Value, error) {
+	subject, err := compileExpr(b, expr.Subject, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	subjectSym := b.gensym("subject")
+	form := lang.EmptyList
+	for i := len(expr.Clauses) - 1; i >= 0; i-- {
+		clause := expr.Clauses[i]
+		var bindings []binding
+		fail := lang.EmptyList
+		if i < len(expr.Clauses)-1 {
+			failSym := b.gensym("nomatch")
+			bindings = append(bindings, binding{name: failSym, value: b.lambda(nil, form)})
+			fail = b.list(b.symbol(failSym))
+		}
+		body, err := compileExpr(b, clause.Body, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if clause.Guard != nil {
+			guard, err := compileExpr(b, clause.Guard, ctx)
+			if err != nil {
+				return lang.Value{}, err
+			}
+			body = b.list(b.symbol("if"), guard, body, fail)
+		}
+		test, err := compilePattern(b, clause.Pattern, b.symbol(subjectSym), body, fail, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		form = b.at(clause, test)
+		if len(bindings) > 0 {
+			form = b.let(bindings, form)
+		}
+	}
+	return b.let([]binding{{name: subjectSym, value: subject}}, form), nil
+}
+
+// compilePattern returns a form that evaluates success, with the variables
+// of pattern bound, when the value of target matches pattern, and fail
+// otherwise. target is a symbol, so it may be evaluated more than once.
+func compilePattern(b *builder, pattern Pattern, target, success, fail lang.Value, ctx compileContext) (lang.Value, error) {
+	switch pat := pattern.(type) {
+	case *WildcardPattern:
+		return success, nil
+	case *VarPattern:
+		return b.let([]binding{{name: pat.Name, value: target}}, success), nil
+	case *LiteralPattern:
+		value, err := compileExpr(b, pat.Value, ctx)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		test := b.list(b.builtin("equal"), target, value)
+		return b.list(b.symbol("if"), test, success, fail), nil
+	case *ListPattern:
+		return compileListPattern(b, pat.Elements, pat.Rest, target, success, fail, ctx)
+	case *VectorPattern:
+		// Bind the elements from the last so that each pattern is tested
+		// inside the bindings of the ones before it.
+		form := success
+		for i := len(pat.Elements) - 1; i >= 0; i-- {
+			elemSym := b.gensym("element")
+			inner, err := compilePattern(b, pat.Elements[i], b.symbol(elemSym), form, fail, ctx)
+			if err != nil {
+				return lang.Value{}, err
+			}
+			ref := b.list(b.builtin("vectorRef"), target, lang.IntValue(int64(i)))
+			form = b.let([]binding{{name: elemSym, value: ref}}, inner)
+		}
+		length := b.list(b.builtin("vectorLength"), target)
+		sized := b.list(b.symbol("="), length, lang.IntValue(int64(len(pat.Elements))))
+		form = b.list(b.symbol("if"), sized, form, fail)
+		return b.list(b.symbol("if"), b.list(b.builtin("vectorp"), target), form, fail), nil
+	default:
+		return lang.Value{}, fmt.Errorf("unsupported pattern %T", pattern)
+	}
+}
+
+// compileListPattern matches the list in target one pair at a time: the
+// first element against the first pattern, and the tail against the rest.
+func compileListPattern(b *builder, elems []Pattern, rest string, target, success, fail lang.Value, ctx compileContext) (lang.Value, error) {
+	if len(elems) == 0 {
+		if rest == "" {
+			return b.list(b.symbol("if"), b.list(b.builtin("nullp"), target), success, fail), nil
+		}
+		if rest == discardIdent {
+			return success, nil
+		}
+		return b.let([]binding{{name: rest, value: target}}, success), nil
+	}
+	headSym := b.gensym("head")
+	tailSym := b.gensym("tail")
+	tailTest, err := compileListPattern(b, elems[1:], rest, b.symbol(tailSym), success, fail, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	headTest, err := compilePattern(b, elems[0], b.symbol(headSym), tailTest, fail, ctx)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	bound := b.let([]binding{
+		{name: headSym, value: b.list(b.builtin("first"), target)},
+		{name: tailSym, value: b.list(b.builtin("rest"), target)},
+	}, headTest)
+	return b.list(b.symbol("if"), b.list(b.builtin("pairp"), target), bound, fail), nil
 }
 
 func compileIfExpr(b *builder, expr *IfExpr, ctx compileContext) (lang.Value, error) {
@@ -574,11 +1388,11 @@ func compileBinaryExpr(b *builder, expr *BinaryExpr, ctx compileContext) (lang.V
 	case tokenPercent:
 		return lang.List(b.symbol("%"), left, right), nil
 	case tokenEqualEqual:
-		return lang.List(b.symbol("="), left, right), nil
+		return lang.List(b.symbol("=="), left, right), nil
 	case tokenBangEqual:
 		return lang.List(
 			b.symbol("not"),
-			lang.List(b.symbol("="), left, right),
+			lang.List(b.symbol("=="), left, right),
 		), nil
 	case tokenLess:
 		return lang.List(b.symbol("<"), left, right), nil
@@ -609,17 +1423,63 @@ func compileBinaryExpr(b *builder, expr *BinaryExpr, ctx compileContext) (lang.V
 	}
 }
 
+// IntOverflow chooses what becomes of an integer literal too large for
+// int64.
+type IntOverflow int
+
+const (
+	// OverflowBigInt makes the literal a big integer, as arithmetic does
+	// with a result that overflows.
+	OverflowBigInt IntOverflow = iota
+	// OverflowFloat makes the literal the nearest float, and Diagnose warns
+	// that it lost precision.
+	OverflowFloat
+	// OverflowError rejects the literal with an error that names it and
+	// its position.
+	OverflowError
+)
+
+// IntegerOverflow is what the compiler does with integer literals that do
+// not fit in int64. Set it before parsing; it is not safe to change while
+// source is being compiled.
+var IntegerOverflow = OverflowBigInt
+
 func parseNumber(src string) (lang.Value, error) {
 	if strings.ContainsAny(src, ".eE") {
 		f, err := strconv.ParseFloat(src, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return lang.Value{}, fmt.Errorf("float literal %s is out of range", src)
+		}
 		if err != nil {
 			return lang.Value{}, fmt.Errorf("invalid float literal %q: %w", src, err)
 		}
 		return lang.RealValue(f), nil
 	}
 	i, err := strconv.ParseInt(src, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		switch IntegerOverflow {
+		case OverflowFloat:
+			f, _ := strconv.ParseFloat(src, 64)
+			return lang.RealValue(f), nil
+		case OverflowError:
+			return lang.Value{}, fmt.Errorf("integer literal %s overflows int64", src)
+		}
+		if b, ok := new(big.Int).SetString(src, 10); ok {
+			return lang.BigIntValue(b), nil
+		}
+	}
 	if err != nil {
 		return lang.Value{}, fmt.Errorf("invalid integer literal %q: %w", src, err)
 	}
 	return lang.IntValue(i), nil
 }
+
+// overflowsInt64 reports whether src is an integer literal too large for
+// int64.
+func overflowsInt64(src string) bool {
+	if strings.ContainsAny(src, ".eE") {
+		return false
+	}
+	_, err := strconv.ParseInt(src, 10, 64)
+	return errors.Is(err, strconv.ErrRange)
+}
@@ -260,6 +260,61 @@ func TestCompileStmtsVarDecl(t *testing.T) {
 	}
 }
 
+func TestCompileStmtsDestructureDecl(t *testing.T) {
+	b := &builder{}
+	stmt := &DestructureDecl{Names: []string{"a", "b"}, Rest: "more", Init: &IdentifierExpr{Name: "xs"}}
+	result, err := compileStmtWithRest(b, stmt, lang.StringValue("done"), compileContext{})
+	if err != nil {
+		t.Fatalf("compileStmtWithRest: %v", err)
+	}
+	let := requireListHead(t, result, "let")
+	for _, name := range []string{"a", "b", "more"} {
+		if !containsSymbolWithPrefix(let, name) {
+			t.Fatalf("expected binding for %s, got %#v", name, let)
+		}
+	}
+}
+
+func TestCompileTopLevelDestructure(t *testing.T) {
+	forms := compileSource(t, "var [a, b] = [1, 2];")
+	if len(forms) != 1 {
+		t.Fatalf("expected single form, got %d", len(forms))
+	}
+	top := requireListHead(t, forms[0], "begin")
+	if !containsSymbolWithPrefix(top, "a") || !containsSymbolWithPrefix(top, "b") {
+		t.Fatalf("expected definitions for a and b, got %#v", top)
+	}
+}
+
+func TestCompileDiscardIdentifier(t *testing.T) {
+	forms := compileSource(t, "var _ = f()\n_ = g()\nfunc h(_, x, _) { return x }\n")
+	if len(forms) != 3 {
+		t.Fatalf("expected 3 forms, got %d", len(forms))
+	}
+	requireListHead(t, forms[0], "f")
+	requireListHead(t, forms[1], "g")
+	lambda := requireListHead(t, forms[2], "define")[2].([]interface{})
+	params := lambda[1].([]interface{})
+	if len(params) != 3 || params[1] != datumSymbol("x") {
+		t.Fatalf("unexpected parameter list %#v", params)
+	}
+	if params[0] == params[2] || !containsSymbolWithPrefix(params[0], "__gisp_discard_") || !containsSymbolWithPrefix(params[2], "__gisp_discard_") {
+		t.Fatalf("expected distinct generated discard parameters, got %#v", params)
+	}
+
+	for src, want := range map[string]string{
+		"var x = _":        "line 1:9: cannot use _ as value",
+		"_ += 1":           "line 1:1: cannot use _ as value",
+		"func f() { _++ }": "line 1:12: cannot use _ as value",
+		"f(_)":             "line 1:3: cannot use _ as value",
+	} {
+		prog := parseProgramFromSource(t, src)
+		if _, err := CompileProgram(prog); err == nil || err.Error() != want {
+			t.Fatalf("%q: expected error %q, got %v", src, want, err)
+		}
+	}
+}
+
 func TestCompileStmtAssign(t *testing.T) {
 	b := &builder{}
 	stmt := &AssignStmt{
@@ -797,6 +852,37 @@ func TestCompileExprCall(t *testing.T) {
 	}
 }
 
+func TestCompileSharedLiteralArguments(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"length([1, 2, 3])", "(length (if (__gisp_eq length __gisp_length) (quote (1 2 3)) (list 1 2 3)))"},
+		{`equal(x, [["a"], #[true, nil]])`, `(equal x (if (__gisp_eq equal __gisp_equal) (quote (("a") #(#t ()))) (list (list "a") (vector #t ()))))`},
+		{"vectorRef(#[1, 2], i)", "(vectorRef (if (__gisp_eq vectorRef __gisp_vectorRef) (quote #(1 2)) (vector 1 2)) i)"},
+		// first may return an element, so only flat literals are shared.
+		{"first([[1], [2]])", "(first (list (list 1) (list 2)))"},
+		// Non-constant elements and unknown callees keep building fresh data.
+		{"length([x, 2])", "(length (list x 2))"},
+		{"cons(1, [2])", "(cons 1 (list 2))"},
+		{"f([1])", "(f (list 1))"},
+	}
+	for _, tc := range cases {
+		forms := compileSource(t, tc.src)
+		if len(forms) != 1 {
+			t.Fatalf("%s: expected 1 form, got %d", tc.src, len(forms))
+		}
+		if got := forms[0].String(); got != tc.want {
+			t.Fatalf("%s compiled to %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	forms := compileSource(t, "func f() { return length([1, 2]) }")
+	if !strings.Contains(forms[0].String(), "(quote (1 2))") {
+		t.Fatalf("expected literal inside function body to be shared, got %s", forms[0].String())
+	}
+}
+
 func TestCompileExprIndex(t *testing.T) {
 	b := &builder{}
 	expr := &IndexExpr{
@@ -807,9 +893,9 @@ func TestCompileExprIndex(t *testing.T) {
 	if err != nil {
 		t.Fatalf("compileExpr index: %v", err)
 	}
-	call := requireListHead(t, val, "vectorRef")
+	call := requireListHead(t, val, "ref")
 	if len(call) != 3 {
-		t.Fatalf("expected vectorRef form with 3 elements, got %d", len(call))
+		t.Fatalf("expected ref form with 3 elements, got %d", len(call))
 	}
 	if sym, ok := call[1].(datumSymbol); !ok || string(sym) != "flags" {
 		t.Fatalf("expected flags symbol as target, got %#v", call[1])
@@ -877,7 +963,7 @@ func TestCompileExprBinary(t *testing.T) {
 		{"mul", tokenStar, "*"},
 		{"div", tokenSlash, "/"},
 		{"mod", tokenPercent, "%"},
-		{"eq", tokenEqualEqual, "="},
+		{"eq", tokenEqualEqual, "=="},
 		{"lt", tokenLess, "<"},
 		{"le", tokenLessEqual, "<="},
 		{"gt", tokenGreater, ">"},
@@ -945,7 +1031,7 @@ func TestCompileExprLogicalAndWithEquality(t *testing.T) {
 	if !ok {
 		t.Fatalf("expected equality list, got %#v", andList[2])
 	}
-	if head := eqForm[0].(datumSymbol); string(head) != "=" {
+	if head := eqForm[0].(datumSymbol); string(head) != "==" {
 		t.Fatalf("expected equality head, got %q", head)
 	}
 	if len(eqForm) != 3 {
@@ -970,7 +1056,7 @@ func TestCompileExprBinaryNotEqual(t *testing.T) {
 	}
 	not := requireListHead(t, val, "not")
 	inner := not[1].([]interface{})
-	if string(inner[0].(datumSymbol)) != "=" {
+	if string(inner[0].(datumSymbol)) != "==" {
 		t.Fatalf("expected equals inside not, got %#v", inner[0])
 	}
 }
@@ -1199,6 +1285,31 @@ func TestParseNumberInvalid(t *testing.T) {
 	}
 }
 
+func TestParseNumberOverflow(t *testing.T) {
+	defer func(mode IntOverflow) { IntegerOverflow = mode }(IntegerOverflow)
+	const big = "99999999999999999999"
+
+	IntegerOverflow = OverflowBigInt
+	if val, err := parseNumber(big); err != nil || val.Type != lang.TypeBigInt || val.String() != big {
+		t.Fatalf("expected big integer %s, got %v, %v", big, val, err)
+	}
+	IntegerOverflow = OverflowFloat
+	if val, err := parseNumber(big); err != nil || val.Type != lang.TypeReal || val.Real() != 1e20 {
+		t.Fatalf("expected float 1e20, got %v, %v", val, err)
+	}
+	IntegerOverflow = OverflowError
+	_, err := ParseString("var x = 1\nvar y = " + big)
+	if err == nil || err.Error() != "line 2:9: integer literal "+big+" overflows int64" {
+		t.Fatalf("expected positioned overflow error, got %v", err)
+	}
+	if _, err := ParseString("9223372036854775807"); err != nil {
+		t.Fatalf("largest int64 rejected: %v", err)
+	}
+	if _, err := ParseString("[1e400]"); err == nil || err.Error() != "line 1:2: float literal 1e400 is out of range" {
+		t.Fatalf("expected positioned range error, got %v", err)
+	}
+}
+
 type unsupportedDecl struct{}
 
 func (unsupportedDecl) Pos() Position { return Position{} }
@@ -0,0 +1,228 @@
+package parser
+
+import "fmt"
+
+// Diagnostic is a warning about code that compiles but probably does not do
+// what was intended.
+type Diagnostic struct {
+	Pos     Position
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d:%d: %s", d.Pos.Line, d.Pos.Column, d.Message)
+}
+
+// Check parses src and returns the diagnostics for it, in source order.
+func Check(src string) ([]Diagnostic, error) {
+	prog, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return Diagnose(prog), nil
+}
+
+// Diagnose returns the diagnostics for a parsed program:
+//   - statements that follow an unconditional return, break or continue in
+//     the same block, which the compiler drops without notice;
+//   - integer literals too large for int64 when IntegerOverflow is
+//     OverflowFloat, which lose precision as floats.
+func Diagnose(prog *Program) []Diagnostic {
+	c := &checker{}
+	for _, decl := range prog.Decls {
+		c.decl(decl)
+	}
+	return c.diags
+}
+
+type checker struct {
+	diags []Diagnostic
+}
+
+func (c *checker) report(pos Position, format string, args ...interface{}) {
+	c.diags = append(c.diags, Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) decl(decl Decl) {
+	switch d := decl.(type) {
+	case *FuncDecl:
+		c.block(d.Body)
+	case *VarDecl:
+		c.expr(d.Init)
+	case *DestructureDecl:
+		c.expr(d.Init)
+	case *ExprDecl:
+		c.expr(d.Expr)
+	case *AssignStmt, *TupleAssignStmt:
+		c.stmt(d.(Stmt))
+	case *TryStmt:
+		c.stmt(d)
+	case *ForStmt:
+		c.stmt(d)
+	}
+}
+
+// block checks a block and reports whether control never reaches its end.
+// Only the first unreachable statement of a block is reported.
+func (c *checker) block(block *BlockStmt) bool {
+	if block == nil {
+		return false
+	}
+	terminated, reported := false, false
+	for _, stmt := range block.Stmts {
+		if terminated && !reported {
+			c.report(stmtStart(stmt), "unreachable code")
+			reported = true
+		}
+		// Dead statements are still checked so that problems inside them
+		// are found too.
+		if c.stmt(stmt) {
+			terminated = true
+		}
+	}
+	return terminated
+}
+
+// stmt checks a statement and reports whether it always transfers control
+// elsewhere instead of falling through to the next one.
+func (c *checker) stmt(stmt Stmt) bool {
+	switch s := stmt.(type) {
+	case *ReturnStmt:
+		c.expr(s.Result)
+		return true
+	case *BreakStmt:
+		c.expr(s.Result)
+		return true
+	case *ContinueStmt:
+		return true
+	case *BlockStmt:
+		return c.block(s)
+	case *IfStmt:
+		c.expr(s.Cond)
+		thenExits := c.block(s.Then)
+		elseExits := c.block(s.Else)
+		return thenExits && elseExits && s.Else != nil
+	case *WhileStmt:
+		c.expr(s.Cond)
+		c.block(s.Body)
+	case *ForStmt:
+		c.expr(s.Iter)
+		c.block(s.Body)
+	case *TryStmt:
+		// An error in the body goes to the catch block, if there is one.
+		bodyExits := c.block(s.Body)
+		catchExits := c.block(s.Catch)
+		finallyExits := c.block(s.Finally)
+		return bodyExits && (s.Catch == nil || catchExits) || finallyExits
+	case *VarDecl:
+		c.expr(s.Init)
+	case *DestructureDecl:
+		c.expr(s.Init)
+	case *AssignStmt:
+		c.expr(s.Target)
+		c.expr(s.Expr)
+	case *TupleAssignStmt:
+		for _, target := range s.Targets {
+			c.expr(target)
+		}
+		for _, expr := range s.Exprs {
+			c.expr(expr)
+		}
+	case *ExprStmt:
+		c.expr(s.Expr)
+	case *DeferStmt:
+		c.expr(s.Call)
+	}
+	return false
+}
+
+// expr looks for function literals, whose bodies are checked like those of
+// declared functions, and for number literals.
+func (c *checker) expr(expr Expr) {
+	switch e := expr.(type) {
+	case *NumberExpr:
+		if IntegerOverflow == OverflowFloat && overflowsInt64(e.Value) {
+			val, _ := parseNumber(e.Value)
+			c.report(e.Posn, "integer literal %s overflows int64 and becomes the float %s", e.Value, val)
+		}
+	case *LambdaExpr:
+		c.block(e.Body)
+	case *ListExpr:
+		c.exprs(e.Elements)
+	case *VectorExpr:
+		c.exprs(e.Elements)
+	case *CallExpr:
+		c.expr(e.Callee)
+		c.exprs(e.Args)
+	case *IndexExpr:
+		c.expr(e.Target)
+		c.expr(e.Index)
+	case *SwitchExpr:
+		c.expr(e.Subject)
+		for _, clause := range e.Clauses {
+			c.expr(clause.Cond)
+			c.exprs(clause.Values)
+			c.expr(clause.Body)
+		}
+		c.expr(e.Default)
+	case *SelectExpr:
+		for _, clause := range e.Clauses {
+			c.expr(clause.Channel)
+			c.expr(clause.Value)
+			c.expr(clause.Body)
+		}
+		c.expr(e.Default)
+	case *MatchExpr:
+		c.expr(e.Subject)
+		for _, clause := range e.Clauses {
+			c.expr(clause.Guard)
+			c.expr(clause.Body)
+		}
+	case *IfExpr:
+		c.expr(e.Cond)
+		c.expr(e.Then)
+		c.expr(e.Else)
+	case *WhileExpr:
+		c.expr(e.Cond)
+		c.block(e.Body)
+	case *UnaryExpr:
+		c.expr(e.Expr)
+	case *BinaryExpr:
+		c.expr(e.Left)
+		c.expr(e.Right)
+	case *InfixExpr:
+		c.expr(e.Left)
+		c.expr(e.Right)
+	}
+}
+
+func (c *checker) exprs(exprs []Expr) {
+	for _, expr := range exprs {
+		c.expr(expr)
+	}
+}
+
+// stmtStart returns where a statement begins in the source. The position of
+// a call or operator expression is that of its operator, which for an
+// expression statement is not the start of the line.
+func stmtStart(stmt Stmt) Position {
+	s, ok := stmt.(*ExprStmt)
+	if !ok {
+		return stmt.Pos()
+	}
+	expr := s.Expr
+	for {
+		switch e := expr.(type) {
+		case *CallExpr:
+			expr = e.Callee
+		case *IndexExpr:
+			expr = e.Target
+		case *BinaryExpr:
+			expr = e.Left
+		case *InfixExpr:
+			expr = e.Left
+		default:
+			return expr.Pos()
+		}
+	}
+}
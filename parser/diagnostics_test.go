@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckReportsUnreachableCode(t *testing.T) {
+	src := `func f(x) {
+    if x {
+        return 1
+        display("never")
+        display("again")
+    } else {
+        return 2
+    }
+    x = 3
+}
+
+var g = func() {
+    while true {
+        break
+        continue
+    }
+    return 0
+}
+
+func h(x) {
+    if x { return 1 }
+    return 2
+}
+
+func k(x) {
+    try {
+        return f(x)
+    } catch (e) {
+        return 0
+    }
+    display("never")
+}
+
+for x in [1] {
+    continue
+    display(x)
+}
+`
+	diags, err := Check(src)
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"line 4:9: unreachable code",
+		"line 9:5: unreachable code",
+		"line 15:9: unreachable code",
+		"line 31:5: unreachable code",
+		"line 36:5: unreachable code",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Check => %q, want %q", got, want)
+	}
+
+	if _, err := Check("func ("); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+}
+
+func TestCheckReportsIntegersRoundedToFloat(t *testing.T) {
+	defer func(mode IntOverflow) { IntegerOverflow = mode }(IntegerOverflow)
+	src := "var x = [1, 99999999999999999999]\n"
+	for mode, want := range map[IntOverflow][]string{
+		OverflowBigInt: nil,
+		OverflowFloat:  {"line 1:13: integer literal 99999999999999999999 overflows int64 and becomes the float 1e+20"},
+	} {
+		IntegerOverflow = mode
+		diags, err := Check(src)
+		if err != nil {
+			t.Fatalf("Check returned error: %v", err)
+		}
+		var got []string
+		for _, d := range diags {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("mode %d: Check => %q, want %q", mode, got, want)
+		}
+	}
+}
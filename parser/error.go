@@ -10,20 +10,27 @@ type Error struct {
 	Err        error
 	Pos        Position
 	Incomplete bool
+	// Note explains a likely cause, such as an automatically inserted
+	// semicolon, on a line of its own after the message.
+	Note string
 }
 
 func (e *Error) Error() string {
 	if e == nil || e.Err == nil {
 		return ""
 	}
+	msg := e.Err.Error()
 	if e.Pos.Line > 0 {
 		col := e.Pos.Column
 		if col <= 0 {
 			col = 1
 		}
-		return fmt.Sprintf("line %d:%d: %s", e.Pos.Line, col, e.Err.Error())
+		msg = fmt.Sprintf("line %d:%d: %s", e.Pos.Line, col, msg)
 	}
-	return e.Err.Error()
+	if e.Note != "" {
+		msg += "\nnote: " + e.Note
+	}
+	return msg
 }
 
 func (e *Error) Unwrap() error {
@@ -0,0 +1,152 @@
+package parser
+
+// GrammarVersion numbers the revisions of Grammar. It goes up whenever the
+// syntax the parser accepts changes, so tools built against one revision
+// can tell when the language has moved on.
+const GrammarVersion = 10
+
+// Grammar describes the syntax the parser accepts, in ISO-style EBNF:
+// terminals are quoted, `?...?` explains what cannot be spelled out, and
+// the lexical elements come last. "gisp grammar" prints it, and the tests
+// check it against the lexer's tokens and the parser's operator levels, so
+// it stays a precise reference rather than an approximation.
+//
+// Semicolons are written where the parser expects them even though the
+// lexer inserts most of them at line breaks, as in Go.
+const Grammar = `(* Gisp grammar, version 10 *)
+
+Program        = { TopLevelDecl | ";" } ;
+
+TopLevelDecl   = FuncDecl | VarDecl | ConstDecl | InfixDecl | StructDecl
+               | ImportDecl | TryStmt | ForStmt | AssignStmt | IncDecStmt | ExprStmt ;
+(* At the top level only a FieldRef may be incremented or decremented. *)
+
+FuncDecl       = "func" Identifier "(" [ ParamList ] ")" Block ;
+ParamList      = Identifier { "," Identifier } [ "..." ] ;
+(* A final "..." makes the last parameter collect the remaining arguments. *)
+
+VarDecl        = "var" ( Identifier [ "[" Expression "]" | "=" Expression ]
+                       | DestructurePattern "=" Expression
+                       | ValuesPattern "=" ExpressionList ) ";" ;
+ConstDecl      = "const" ( ( Identifier | DestructurePattern ) "=" Expression
+                         | ValuesPattern "=" ExpressionList ) ";" ;
+DestructurePattern = "[" Identifier { "," Identifier } [ "..." ] "]" ;
+ValuesPattern  = Identifier "," Identifier { "," Identifier } ;
+ExpressionList = Expression { "," Expression } ;
+(* A ValuesPattern takes the multiple values of a single Expression, or one
+   value from each Expression, of which there must be as many as names. *)
+
+InfixDecl      = "infix" Identifier { "," Identifier } Number ";" ;
+(* The Number is the precedence, 1 to 6; see InfixOp1 to InfixOp6. *)
+StructDecl     = "struct" Identifier
+                 "{" [ Identifier { ( "," | ";" ) Identifier } [ "," | ";" ] ] "}" ";" ;
+(* "infix" and "struct" are not reserved; they start a declaration only at
+   the top level and when followed by an Identifier. *)
+ImportDecl     = "import" [ Identifier ] String ";" ;
+
+Block          = "{" { Statement | ";" } "}" ;
+
+Statement      = VarDecl | ConstDecl | AssignStmt | IncDecStmt | IfStmt
+               | WhileStmt | ForStmt | BreakStmt | ContinueStmt | ReturnStmt
+               | DeferStmt | TryStmt | Block | ExprStmt ;
+
+AssignStmt     = AssignTarget AssignOp Expression ";"
+               | AssignTarget "," AssignTarget { "," AssignTarget } "=" ExpressionList ";" ;
+AssignTarget   = ( Identifier | FieldRef ) { "[" Expression "]" | "." Identifier } ;
+(* Only "=" may assign to an indexed target. Several targets are assigned
+   like a ValuesPattern, after every Expression has been evaluated. *)
+IncDecStmt     = ( Identifier | FieldRef ) ( "++" | "--" ) ";" ;
+ExprStmt       = Expression ";" ;
+
+IfStmt         = "if" Expression Block [ "else" Block ] ;
+WhileStmt      = "while" Expression Block ;
+ForStmt        = "for" Identifier [ "," Identifier ] "in" Expression Block ;
+(* "in" is not reserved; it is recognized only after the loop variables. *)
+BreakStmt      = "break" [ Expression ] ";" ;
+ContinueStmt   = "continue" ";" ;
+ReturnStmt     = "return" [ Expression { "," Expression } ] ";" ;
+DeferStmt      = "defer" Expression ";" ;
+(* The Expression must be a call; DeferStmt is allowed only in functions. *)
+TryStmt        = "try" Block ( "catch" "(" Identifier ")" Block [ "finally" Block ]
+                             | "finally" Block ) ;
+
+Expression     = PipeExpr ;
+PipeExpr       = OrExpr { "|>" OrExpr } ;
+OrExpr         = AndExpr { ( OrOp | InfixOp1 ) AndExpr } ;
+AndExpr        = EqualityExpr { ( AndOp | InfixOp2 ) EqualityExpr } ;
+EqualityExpr   = RelationalExpr { ( EqualityOp | InfixOp3 ) RelationalExpr } ;
+RelationalExpr = AddExpr { ( RelOp | InfixOp4 ) AddExpr } ;
+AddExpr        = MulExpr { ( AddOp | InfixOp5 ) MulExpr } ;
+MulExpr        = PrefixExpr { ( MulOp | InfixOp6 ) PrefixExpr } ;
+PrefixExpr     = { PrefixOp } PostfixExpr ;
+PostfixExpr    = PrimaryExpr { "(" [ ArgList ] ")" | "[" Expression "]" | "." Identifier } ;
+ArgList        = Expression { "," Expression } [ "..." ] ;
+(* A final "..." passes the elements of the last argument, a list. *)
+
+PrimaryExpr    = Identifier | FieldRef | Number | String | Char
+               | "true" | "false" | "nil"
+               | ListLiteral | VectorLiteral | LambdaExpr
+               | IfExpr | SwitchExpr | SelectExpr | MatchExpr | WhileExpr | SExprLiteral
+               | "(" Expression ")" ;
+
+IfExpr         = "if" Expression ExprBlock [ "else" ( ExprBlock | IfExpr ) ] ;
+ExprBlock      = "{" Expression [ ";" ] "}" ;
+WhileExpr      = "while" Expression Block ;
+SwitchExpr     = "switch" [ Expression ] "{" { CaseClause } [ DefaultClause ] "}" ;
+CaseClause     = "case" ExpressionList ":" Expression [ ";" ] [ "fallthrough" [ ";" ] ] ;
+(* With a subject Expression a case is chosen when one of its values is ==
+   to the subject, and without one when one of its Expressions is true.
+   "fallthrough" is not reserved; it goes on to the body of the next clause
+   and may not end the last case. *)
+DefaultClause  = "default" ":" Expression [ ";" ] ;
+SelectExpr     = "select" "{" { SelectClause } [ DefaultClause ] "}" ;
+SelectClause   = "case" ( [ Identifier "=" ] "receive" "(" Expression ")"
+                        | "send" "(" Expression "," Expression ")" ) ":" Expression [ ";" ] ;
+(* "receive" and "send" are not reserved; here they name channel operations. *)
+MatchExpr      = "match" Expression "{" MatchClause { MatchClause } "}" ;
+MatchClause    = "case" Pattern [ "if" Expression ] ":" Expression [ ";" ] ;
+Pattern        = Identifier | [ "-" ] Number | String | Char | "true" | "false" | "nil"
+               | SExprLiteral | ListPattern | VectorPattern ;
+ListPattern    = "[" [ Pattern { "," Pattern } [ "," ] ] "]"
+               | "[" { Pattern "," } Identifier "..." "]" ;
+VectorPattern  = "#[" [ Pattern { "," Pattern } [ "," ] ] "]" ;
+(* "match" is not reserved; it starts a MatchExpr only when followed by an
+   Expression and a "{" holding a "case". An Identifier in a Pattern binds
+   the value it matches, except "_", which matches anything, and may appear
+   only once in the Pattern of a case. *)
+LambdaExpr     = "func" "(" [ ParamList ] ")" Block ;
+ListLiteral    = "[" [ ArgList [ "," ] ] "]" ;
+VectorLiteral  = "#[" [ ArgList [ "," ] ] "]" ;
+SExprLiteral   = "` + "`" + `" SExpression ;
+
+OrOp           = "||" ;
+AndOp          = "&&" ;
+EqualityOp     = "==" | "!=" ;
+RelOp          = "<" | "<=" | ">" | ">=" ;
+AddOp          = "+" | "-" | "|" | "^" ;
+MulOp          = "*" | "/" | "%" | "<<" | ">>" | "&" | "&^" ;
+PrefixOp       = "-" | "!" | "^" ;
+AssignOp       = "=" | "+=" | "-=" | "*=" | "/=" | "%="
+               | "<<=" | ">>=" | "&=" | "|=" | "^=" | "&^=" ;
+
+InfixOp1       = ? an Identifier declared by an InfixDecl with precedence 1 ? ;
+InfixOp2       = ? an Identifier declared by an InfixDecl with precedence 2 ? ;
+InfixOp3       = ? an Identifier declared by an InfixDecl with precedence 3 ? ;
+InfixOp4       = ? an Identifier declared by an InfixDecl with precedence 4 ? ;
+InfixOp5       = ? an Identifier declared by an InfixDecl with precedence 5 ? ;
+InfixOp6       = ? an Identifier declared by an InfixDecl with precedence 6 ? ;
+
+(* Lexical elements. Spaces, newlines, // line comments and /* block
+   comments */ separate tokens. *)
+
+Identifier     = ( letter | "_" ) { letter | digit | "_" } ;
+FieldRef       = Identifier "." Identifier { "." Identifier } ;
+Number         = digit { digit } [ "." { digit } ] [ ( "e" | "E" ) [ "+" | "-" ] digit { digit } ] ;
+String         = '"' { Character | Escape } '"' ;
+Char           = "'" ( ? any character except "'", '\' and newline ? | Escape ) "'" ;
+Character      = ? any character except '"', '\' and newline ? ;
+Escape         = "\" ? any character; \n is a newline, \t a tab, and others stand for themselves ? ;
+SExpression    = ? one datum in the s-expression syntax, read by the sexpr package ? ;
+letter         = ? a Unicode letter ? ;
+digit          = ? a Unicode decimal digit ? ;
+`
@@ -0,0 +1,269 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// grammarDigests records the SHA-256 of Grammar at each GrammarVersion.
+// Editing Grammar fails TestGrammarVersion until the version is raised and
+// the new digest added here.
+var grammarDigests = map[int]string{
+	1:  "152af29371c3614cdc95b4d208a7bffbcc44072b9e651d907cb4d5e46f47902d",
+	2:  "2ac91cdbd866de9fb1cddce45f5812edc01966014c7b2bccab0bd1383a88b009",
+	3:  "800d6f7222453ab77ed9a8239f058ca5b6813917a45c63bc7d9c84e01549c3f0",
+	4:  "9a5922eb44bca550d474c72a0d57acf650840244b81b7e37ae032dd304c44465",
+	5:  "4fbcab733b31a2280db53ba57d8052dda7f16cbad3d1322bfeacb5dad564e233",
+	6:  "e85fe0964c7bc1cc50181d2d8fb84c280a18136cf9baeff71b2eaff326ef1be9",
+	7:  "7481995351601993a9e606a2a744a72b205fc7d7f1abaeba5e5074687bec8d55",
+	8:  "e2215174c31ab686da88f0fdf7b8744b2a10121680ec04e83c87fefb4b96e8d9",
+	9:  "f23b4c3c24c6b9a3fbd66bc574671c6eee770ebdd8455ae669322a00d25308e6",
+	10: "5bf6d19c57befc113dc818b0d51058421e729a51805b92d1f2e6777d6d4ca01e",
+}
+
+// production is one rule of Grammar: the names it refers to and the
+// terminals it contains.
+type production struct {
+	refs      []string
+	terminals []string
+	lexical   bool
+}
+
+// parseGrammar reads the productions of an EBNF text written like Grammar.
+// Productions after the "Lexical elements" comment are marked lexical.
+func parseGrammar(t *testing.T, text string) (map[string]*production, []string) {
+	t.Helper()
+	prods := make(map[string]*production)
+	var order []string
+	var cur *production
+	lexical := false
+	expectEquals := false
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\n' || c == '\t':
+			i++
+		case strings.HasPrefix(text[i:], "(*"):
+			end := strings.Index(text[i:], "*)")
+			if end < 0 {
+				t.Fatalf("unterminated comment at offset %d", i)
+			}
+			if strings.Contains(text[i:i+end], "Lexical elements") {
+				lexical = true
+			}
+			i += end + 2
+		case c == '"' || c == '\'' || c == '?':
+			end := strings.IndexByte(text[i+1:], c)
+			if end < 0 {
+				t.Fatalf("unterminated %c at offset %d", c, i)
+			}
+			if cur == nil {
+				t.Fatalf("%s outside a production", text[i:i+end+2])
+			}
+			if c != '?' {
+				cur.terminals = append(cur.terminals, text[i+1:i+1+end])
+			}
+			i += end + 2
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(text) && (text[i] == '_' || text[i] >= 'a' && text[i] <= 'z' ||
+				text[i] >= 'A' && text[i] <= 'Z' || text[i] >= '0' && text[i] <= '9') {
+				i++
+			}
+			name := text[start:i]
+			if cur == nil {
+				if _, dup := prods[name]; dup {
+					t.Fatalf("production %s defined twice", name)
+				}
+				cur = &production{lexical: lexical}
+				prods[name] = cur
+				order = append(order, name)
+				expectEquals = true
+				continue
+			}
+			cur.refs = append(cur.refs, name)
+		case c == '=' && expectEquals:
+			expectEquals = false
+			i++
+		case c == ';':
+			if cur == nil || expectEquals {
+				t.Fatalf("stray ; at offset %d", i)
+			}
+			cur = nil
+			i++
+		case strings.IndexByte("|()[]{}", c) >= 0 && cur != nil && !expectEquals:
+			i++
+		default:
+			t.Fatalf("unexpected %q at offset %d", c, i)
+		}
+	}
+	if cur != nil {
+		t.Fatalf("last production is not terminated")
+	}
+	return prods, order
+}
+
+func TestGrammarIsWellFormed(t *testing.T) {
+	prods, order := parseGrammar(t, Grammar)
+	if order[0] != "Program" {
+		t.Fatalf("first production is %s, want Program", order[0])
+	}
+	reached := map[string]bool{"Program": true}
+	queue := []string{"Program"}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, ref := range prods[name].refs {
+			if _, ok := prods[ref]; !ok {
+				t.Fatalf("%s refers to undefined %s", name, ref)
+			}
+			if !reached[ref] {
+				reached[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+	}
+	for _, name := range order {
+		if !reached[name] {
+			t.Fatalf("production %s is not reachable from Program", name)
+		}
+	}
+}
+
+// lexesAs reports whether the lexer reads term as exactly one token of the
+// given type.
+func lexesAs(term string) (TokenType, bool) {
+	lx := newLexer(term)
+	tok, err := lx.nextToken()
+	if err != nil {
+		return tokenIllegal, false
+	}
+	next, err := lx.nextToken()
+	if next.Inserted {
+		next, err = lx.nextToken()
+	}
+	if err != nil || next.Type != tokenEOF {
+		return tokenIllegal, false
+	}
+	return tok.Type, true
+}
+
+func TestGrammarTerminalsAreTokens(t *testing.T) {
+	prods, _ := parseGrammar(t, Grammar)
+	used := make(map[string]bool)
+	for name, prod := range prods {
+		if prod.lexical {
+			continue
+		}
+		for _, term := range prod.terminals {
+			used[term] = true
+			tt, ok := lexesAs(term)
+			switch {
+			case term == "`":
+				tt, ok = lexesAs("`x")
+				if tt != tokenSExpr {
+					ok = false
+				}
+			case term == ".":
+				// A dot is a token only before the name it selects.
+				tok, err := newLexer(".x").nextToken()
+				tt, ok = tok.Type, err == nil && tok.Type == tokenDot
+			case term == "infix" || term == "struct" || term == "in" || term == "receive" || term == "send" || term == "match" || term == "fallthrough":
+				ok = ok && tt == tokenIdentifier
+			default:
+				ok = ok && tt.String() == term
+			}
+			if !ok {
+				t.Fatalf("%s: terminal %q is not a single token", name, term)
+			}
+		}
+	}
+	for tt := tokenFunc; tt <= tokenRBracket; tt++ {
+		if !used[tt.String()] {
+			t.Fatalf("token %s does not appear in the grammar", tt)
+		}
+	}
+}
+
+// newTestParser returns a parser positioned at the first token of src.
+func newTestParser(t *testing.T, src string) *parser {
+	t.Helper()
+	p := &parser{lx: newLexer(src)}
+	if err := p.advance(); err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+	return p
+}
+
+// TestGrammarOperatorLevels checks each operator production against the
+// parser: an operator belongs to a binary level when the parse function for
+// that level accepts it and the next tighter one does not.
+func TestGrammarOperatorLevels(t *testing.T) {
+	prods, _ := parseGrammar(t, Grammar)
+	has := func(prod, term string) bool {
+		for _, s := range prods[prod].terminals {
+			if s == term {
+				return true
+			}
+		}
+		return false
+	}
+	levels := []struct {
+		prod  string
+		parse func(*parser) (Expr, error)
+	}{
+		{"MulOp", (*parser).parseFactor},
+		{"AddOp", (*parser).parseTerm},
+		{"RelOp", (*parser).parseComparison},
+		{"EqualityOp", (*parser).parseEquality},
+		{"AndOp", (*parser).parseLogicalAnd},
+		{"OrOp", (*parser).parseLogicalOr},
+	}
+	for tt := tokenAssign; tt <= tokenPipeline; tt++ {
+		op := tt.String()
+		if got, want := has("AssignOp", op), isAssignmentToken(tt); got != want {
+			t.Fatalf("%s in AssignOp is %v, parser says %v", op, got, want)
+		}
+		tighter := false
+		for _, level := range levels {
+			p := newTestParser(t, "a "+op+" b")
+			expr, err := level.parse(p)
+			bin, ok := expr.(*BinaryExpr)
+			accepted := err == nil && ok && bin.Op == tt && (p.curr.Type == tokenSemicolon || p.curr.Type == tokenEOF)
+			if got, want := has(level.prod, op), accepted && !tighter; got != want {
+				t.Fatalf("%s in %s is %v, parser says %v", op, level.prod, got, want)
+			}
+			tighter = tighter || accepted
+		}
+		p := newTestParser(t, op+" a")
+		expr, err := p.parseUnary()
+		unary, ok := expr.(*UnaryExpr)
+		if got, want := has("PrefixOp", op), err == nil && ok && unary.Op == tt; got != want {
+			t.Fatalf("%s in PrefixOp is %v, parser says %v", op, got, want)
+		}
+	}
+}
+
+func TestGrammarVersion(t *testing.T) {
+	if header := fmt.Sprintf("(* Gisp grammar, version %d *)\n", GrammarVersion); !strings.HasPrefix(Grammar, header) {
+		t.Fatalf("Grammar does not start with %q", header)
+	}
+	sum := sha256.Sum256([]byte(Grammar))
+	if got := hex.EncodeToString(sum[:]); grammarDigests[GrammarVersion] != got {
+		t.Fatalf("Grammar does not match the digest recorded for version %d; raise GrammarVersion if it was already released, and record %s", GrammarVersion, got)
+	}
+}
+
+func TestGrammarDocumented(t *testing.T) {
+	doc, err := os.ReadFile("../docs/Language.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(doc), "```ebnf\n"+Grammar+"```\n") {
+		t.Fatal("the grammar in docs/Language.md differs from Grammar; paste the output of gisp grammar")
+	}
+}
@@ -21,8 +21,9 @@ type lexer struct {
 	lastToken    TokenType
 	lastPos      Position
 	bufferedTok  *Token
-	parenDepth   int
-	braceDepth   int
+	// open holds the opening token of each enclosing (, [, #[ or {,
+	// innermost last.
+	open []TokenType
 }
 
 type lexerState struct {
@@ -34,8 +35,7 @@ type lexerState struct {
 	lastPos      Position
 	hasBuffered  bool
 	bufferedTok  Token
-	parenDepth   int
-	braceDepth   int
+	open         []TokenType
 }
 
 func (lx *lexer) saveState() lexerState {
@@ -46,8 +46,7 @@ func (lx *lexer) saveState() lexerState {
 		hasLastToken: lx.hasLastToken,
 		lastToken:    lx.lastToken,
 		lastPos:      lx.lastPos,
-		parenDepth:   lx.parenDepth,
-		braceDepth:   lx.braceDepth,
+		open:         append([]TokenType(nil), lx.open...),
 	}
 	if lx.bufferedTok != nil {
 		state.hasBuffered = true
@@ -63,8 +62,7 @@ func (lx *lexer) restoreState(state lexerState) {
 	lx.hasLastToken = state.hasLastToken
 	lx.lastToken = state.lastToken
 	lx.lastPos = state.lastPos
-	lx.parenDepth = state.parenDepth
-	lx.braceDepth = state.braceDepth
+	lx.open = append(lx.open[:0], state.open...)
 	if state.hasBuffered {
 		tok := state.bufferedTok
 		lx.bufferedTok = &tok
@@ -232,16 +230,18 @@ func (lx *lexer) nextToken() (Token, error) {
 	}
 	if sawNewline && lx.shouldInsertSemicolon() && lx.canInsertSemicolon() {
 		return lx.emit(Token{
-			Type: tokenSemicolon,
-			Pos:  lx.lastPos,
+			Type:     tokenSemicolon,
+			Pos:      lx.lastPos,
+			Inserted: true,
 		}), nil
 	}
 
 	if lx.pos >= len(lx.src) {
 		if lx.shouldInsertSemicolon() && lx.canInsertSemicolon() {
 			return lx.emit(Token{
-				Type: tokenSemicolon,
-				Pos:  lx.lastPos,
+				Type:     tokenSemicolon,
+				Pos:      lx.lastPos,
+				Inserted: true,
 			}), nil
 		}
 		return lx.emit(Token{
@@ -259,8 +259,9 @@ func (lx *lexer) nextToken() (Token, error) {
 	if err == io.EOF {
 		if lx.shouldInsertSemicolon() && lx.canInsertSemicolon() {
 			return lx.emit(Token{
-				Type: tokenSemicolon,
-				Pos:  lx.lastPos,
+				Type:     tokenSemicolon,
+				Pos:      lx.lastPos,
+				Inserted: true,
 			}), nil
 		}
 		return lx.emit(Token{
@@ -306,6 +307,17 @@ func (lx *lexer) nextToken() (Token, error) {
 			Pos:   positionFromState(start),
 		}
 		return lx.maybeEmitWithBuffer(tok)
+	case r == '\'':
+		value, err := lx.scanChar(start)
+		if err != nil {
+			return Token{}, err
+		}
+		tok := Token{
+			Type:  tokenChar,
+			Value: value,
+			Pos:   positionFromState(start),
+		}
+		return lx.maybeEmitWithBuffer(tok)
 	case r == '`':
 		value, err := lx.scanSExpr(start)
 		if err != nil {
@@ -386,6 +398,18 @@ func (lx *lexer) nextToken() (Token, error) {
 		tok = simpleToken(tokenSemicolon, start)
 	case ':':
 		tok = simpleToken(tokenColon, start)
+	case '.':
+		if lx.peekIdentifierStart() {
+			// A dot before a name selects a field of the value before it,
+			// as in ps[0].x or mk().x.
+			tok = simpleToken(tokenDot, start)
+		} else {
+			if !lx.match('.') || !lx.match('.') {
+				illegal, err := illegalToken(start, fmt.Errorf("expected '...'"))
+				return lx.emit(illegal), err
+			}
+			tok = simpleToken(tokenEllipsis, start)
+		}
 	case '=':
 		if lx.match('=') {
 			tok = simpleToken(tokenEqualEqual, start)
@@ -441,6 +465,8 @@ func (lx *lexer) nextToken() (Token, error) {
 			tok = simpleToken(tokenOrOr, start)
 		} else if lx.match('=') {
 			tok = simpleToken(tokenPipeAssign, start)
+		} else if lx.match('>') {
+			tok = simpleToken(tokenPipeline, start)
 		} else {
 			tok = simpleToken(tokenPipe, start)
 		}
@@ -457,15 +483,16 @@ func (lx *lexer) maybeEmitWithBuffer(tok Token) (Token, error) {
 		copied := tok
 		lx.bufferedTok = &copied
 		return lx.emit(Token{
-			Type: tokenSemicolon,
-			Pos:  lx.lastPos,
+			Type:     tokenSemicolon,
+			Pos:      lx.lastPos,
+			Inserted: true,
 		}), nil
 	}
 	return lx.emit(tok), nil
 }
 
 func (lx *lexer) emit(tok Token) Token {
-	lx.adjustParenDepth(tok.Type)
+	lx.trackNesting(tok.Type)
 	if tok.Type != tokenIllegal {
 		lx.hasLastToken = true
 		lx.lastToken = tok.Type
@@ -477,21 +504,13 @@ func (lx *lexer) emit(tok Token) Token {
 	return tok
 }
 
-func (lx *lexer) adjustParenDepth(tt TokenType) {
+func (lx *lexer) trackNesting(tt TokenType) {
 	switch tt {
-	case tokenLParen, tokenLBracket:
-		lx.parenDepth++
-	case tokenVectorStart:
-		lx.parenDepth++
-	case tokenRParen, tokenRBracket:
-		if lx.parenDepth > 0 {
-			lx.parenDepth--
-		}
-	case tokenLBrace:
-		lx.braceDepth++
-	case tokenRBrace:
-		if lx.braceDepth > 0 {
-			lx.braceDepth--
+	case tokenLParen, tokenLBracket, tokenVectorStart, tokenLBrace:
+		lx.open = append(lx.open, tt)
+	case tokenRParen, tokenRBracket, tokenRBrace:
+		if len(lx.open) > 0 {
+			lx.open = lx.open[:len(lx.open)-1]
 		}
 	}
 }
@@ -504,6 +523,7 @@ func (lx *lexer) shouldInsertSemicolon() bool {
 	case tokenIdentifier,
 		tokenNumber,
 		tokenString,
+		tokenChar,
 		tokenSExpr,
 		tokenTrue,
 		tokenFalse,
@@ -521,32 +541,15 @@ func (lx *lexer) shouldInsertSemicolon() bool {
 	return false
 }
 
+// canInsertSemicolon reports whether a line break may end a statement
+// here: at the top level or directly inside a block, but not inside
+// parentheses or a list or vector literal, even one nested in a block or
+// holding a lambda whose body is.
 func (lx *lexer) canInsertSemicolon() bool {
-	if lx.parenDepth == 0 {
-		return true
-	}
-	if lx.braceDepth == 0 {
-		return false
-	}
-	r, err := lx.peekNextRune()
-	if err != nil {
+	if len(lx.open) == 0 {
 		return true
 	}
-	switch r {
-	case ')', ']':
-		return false
-	}
-	return true
-}
-
-func (lx *lexer) peekNextRune() (rune, error) {
-	state := lx.mark()
-	r, _, _, err := lx.readRune()
-	if err != nil {
-		return 0, err
-	}
-	lx.unread(state)
-	return r, nil
+	return lx.open[len(lx.open)-1] == tokenLBrace
 }
 
 func (lx *lexer) match(expected rune) bool {
@@ -562,6 +565,15 @@ func (lx *lexer) match(expected rune) bool {
 	return true
 }
 
+// peekIdentifierStart reports whether the next rune could start an
+// identifier, without consuming it.
+func (lx *lexer) peekIdentifierStart() bool {
+	state := lx.mark()
+	r, _, _, err := lx.readRune()
+	lx.unread(state)
+	return err == nil && isIdentifierStart(r)
+}
+
 func isIdentifierStart(r rune) bool {
 	return unicode.IsLetter(r) || r == '_'
 }
@@ -581,6 +593,18 @@ func (lx *lexer) scanIdentifier(initial rune) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if r == '.' {
+			// A dot followed by a name continues a qualified identifier,
+			// such as math.sqrt for a member of an imported module.
+			next, _, _, err := lx.readRune()
+			if err == nil && isIdentifierStart(next) {
+				builder.WriteRune(r)
+				builder.WriteRune(next)
+				continue
+			}
+			lx.unread(state)
+			break
+		}
 		if !isIdentifierPart(r) {
 			lx.unread(state)
 			break
@@ -681,6 +705,50 @@ func (lx *lexer) scanString() (string, error) {
 	return builder.String(), nil
 }
 
+// scanChar reads a character literal such as 'a' or '\n' after its
+// opening quote. The escapes are those of string literals, with \' for the
+// quote itself.
+func (lx *lexer) scanChar(start runeState) (rune, error) {
+	r, _, state, err := lx.readRune()
+	if err == io.EOF {
+		return 0, newIncompleteErrorAt(positionFromState(state), fmt.Errorf("unterminated character literal"))
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch r {
+	case '\'', '\n':
+		return 0, newErrorAt(positionFromState(start), fmt.Errorf("empty character literal"))
+	case '\\':
+		esc, _, escState, err := lx.readRune()
+		if err == io.EOF {
+			return 0, newIncompleteErrorAt(positionFromState(escState), fmt.Errorf("unterminated escape sequence"))
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch esc {
+		case 'n':
+			r = '\n'
+		case 't':
+			r = '\t'
+		default:
+			r = esc
+		}
+	}
+	closing, _, closeState, err := lx.readRune()
+	if err == io.EOF {
+		return 0, newIncompleteErrorAt(positionFromState(closeState), fmt.Errorf("unterminated character literal"))
+	}
+	if err != nil {
+		return 0, err
+	}
+	if closing != '\'' {
+		return 0, newErrorAt(positionFromState(start), fmt.Errorf("character literal must hold one character"))
+	}
+	return r, nil
+}
+
 func (lx *lexer) scanSExpr(start runeState) (lang.Value, error) {
 	value, end, err := sexpr.ParseLiteral(lx.src, lx.pos)
 	if err != nil {
@@ -734,18 +802,32 @@ func keywordToken(lexeme string) (TokenType, bool) {
 		return tokenElse, true
 	case "while":
 		return tokenWhile, true
+	case "for":
+		return tokenFor, true
 	case "break":
 		return tokenBreak, true
 	case "continue":
 		return tokenContinue, true
 	case "switch":
 		return tokenSwitch, true
+	case "select":
+		return tokenSelect, true
 	case "case":
 		return tokenCase, true
 	case "default":
 		return tokenDefault, true
 	case "return":
 		return tokenReturn, true
+	case "defer":
+		return tokenDefer, true
+	case "try":
+		return tokenTry, true
+	case "catch":
+		return tokenCatch, true
+	case "finally":
+		return tokenFinally, true
+	case "import":
+		return tokenImport, true
 	case "true":
 		return tokenTrue, true
 	case "false":
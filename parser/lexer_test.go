@@ -81,6 +81,20 @@ func TestLexerIdentifiersAndKeywords(t *testing.T) {
 	}
 }
 
+func TestLexerQualifiedIdentifiers(t *testing.T) {
+	tokens := lexAllTokens(t, "import \"lib/math\"\nmath.sqrt(a.b.c, rest...)\nps[0].x.y + mk().z")
+	tokens = tokens[:len(tokens)-1]
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.Text())
+	}
+	want := []string{"import", `"lib/math"`, ";", "math.sqrt", "(", "a.b.c", ",", "rest", "...", ")", ";",
+		"ps", "[", "0", "]", ".", "x.y", "+", "mk", "(", ")", ".", "z", ";"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tokens %q, want %q", got, want)
+	}
+}
+
 func TestLexerNumberLiterals(t *testing.T) {
 	src := "0 123 3.14 6.022e23 1e-9 42e+7 10."
 	tokens := lexAllTokens(t, src)
@@ -149,6 +163,47 @@ func TestLexerStringLiterals(t *testing.T) {
 	}
 }
 
+func TestLexerCharLiterals(t *testing.T) {
+	tokens := lexAllTokens(t, `'a' 'λ' '\n' '\'' '"'`)
+	tokens = dropTrailingSemicolons(tokens[:len(tokens)-1])
+
+	want := []rune{'a', 'λ', '\n', '\'', '"'}
+	if len(tokens) != len(want) {
+		t.Fatalf("expected %d tokens, got %d", len(want), len(tokens))
+	}
+	for i, expected := range want {
+		tok := tokens[i]
+		if tok.Type != tokenChar {
+			t.Errorf("token %d: expected char type, got %v", i, tok.Type)
+		}
+		if value, ok := tok.Value.(rune); !ok || value != expected {
+			t.Errorf("token %d: expected value %q, got %v", i, expected, tok.Value)
+		}
+	}
+}
+
+func TestLexerCharErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{name: "empty", src: "''", wantErr: "empty character literal"},
+		{name: "too long", src: "'ab'", wantErr: "character literal must hold one character"},
+		{name: "unterminated", src: "'a", wantErr: "unterminated character literal"},
+		{name: "newline", src: "'\n'", wantErr: "empty character literal"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lx := newLexer(tc.src)
+			if _, err := lx.nextToken(); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestLexerVectorLiteral(t *testing.T) {
 	src := "var vec = #[1, 2, true]"
 	tokens := lexAllTokens(t, src)
@@ -193,6 +248,44 @@ func TestLexerVectorLiteralMissingBracket(t *testing.T) {
 	}
 }
 
+func TestLexerEllipsis(t *testing.T) {
+	tokens := dropTrailingSemicolons(lexAllTokens(t, "[a, rest...]"))
+	want := []TokenType{tokenLBracket, tokenIdentifier, tokenComma, tokenIdentifier, tokenEllipsis, tokenRBracket, tokenEOF}
+	var got []TokenType
+	for _, tok := range tokens {
+		if tok.Type != tokenSemicolon {
+			got = append(got, tok.Type)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected tokens: got %v, want %v", got, want)
+	}
+
+	lx := newLexer("a..b")
+	mustNextToken(t, lx)
+	if tok, err := lx.nextToken(); err == nil || tok.Type != tokenIllegal {
+		t.Fatalf("expected illegal token for '..', got %v (%v)", tok.Type, err)
+	}
+}
+
+func TestLexerPipelineOperators(t *testing.T) {
+	tokens := dropTrailingSemicolons(lexAllTokens(t, "a |> b | c || d |= e"))
+	want := []TokenType{
+		tokenIdentifier, tokenPipeline, tokenIdentifier, tokenPipe,
+		tokenIdentifier, tokenOrOr, tokenIdentifier, tokenPipeAssign,
+		tokenIdentifier, tokenEOF,
+	}
+	var got []TokenType
+	for _, tok := range tokens {
+		if tok.Type != tokenSemicolon {
+			got = append(got, tok.Type)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected tokens: got %v, want %v", got, want)
+	}
+}
+
 func TestLexerStringErrors(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -2,6 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/sergev/gisp/lang"
 )
@@ -22,14 +25,30 @@ func Parse(src string) (*Program, error) {
 }
 
 type parser struct {
-	lx        *lexer
-	curr      Token
-	peekTok   Token
-	hasPeek   bool
-	loopDepth int
+	lx           *lexer
+	prev         Token
+	curr         Token
+	peekTok      Token
+	hasPeek      bool
+	loopDepth    int
+	funcDepth    int
+	loopsOutside int            // loops around the functions being parsed, out of reach of break and continue
+	infix        map[string]int // user-declared infix operators and their precedence
 }
 
+// Binary operator precedence levels, loosest first. User-declared infix
+// operators share one of these levels and associate to the left.
+const (
+	precLogicalOr = 1 + iota
+	precLogicalAnd
+	precEquality
+	precComparison
+	precTerm
+	precFactor
+)
+
 type parserState struct {
+	prev    Token
 	curr    Token
 	peekTok Token
 	hasPeek bool
@@ -38,6 +57,7 @@ type parserState struct {
 
 func (p *parser) saveState() parserState {
 	state := parserState{
+		prev:    p.prev,
 		curr:    p.curr,
 		hasPeek: p.hasPeek,
 	}
@@ -49,6 +69,7 @@ func (p *parser) saveState() parserState {
 }
 
 func (p *parser) restoreState(state parserState) {
+	p.prev = state.prev
 	p.curr = state.curr
 	p.peekTok = state.peekTok
 	p.hasPeek = state.hasPeek
@@ -56,6 +77,7 @@ func (p *parser) restoreState(state parserState) {
 }
 
 func (p *parser) advance() error {
+	p.prev = p.curr
 	if p.hasPeek {
 		p.curr = p.peekTok
 		p.hasPeek = false
@@ -83,7 +105,7 @@ func (p *parser) peek() (Token, error) {
 
 func (p *parser) expect(tt TokenType) (Token, error) {
 	if p.curr.Type != tt {
-		return Token{}, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "expected %s, found %s", tt, p.curr.Type)
+		return Token{}, p.unexpectedf(p.curr.Type == tokenEOF, "expected %s, found %s", tt, p.curr.Type)
 	}
 	tok := p.curr
 	if err := p.advance(); err != nil {
@@ -118,17 +140,52 @@ func (p *parser) parseTopLevelDecl() (Decl, error) {
 		return p.parseVarDecl(true)
 	case tokenConst:
 		return p.parseConstDecl(true)
+	case tokenImport:
+		return p.parseImportDecl()
+	case tokenTry:
+		stmt, err := p.parseTryStmt()
+		if err != nil {
+			return nil, err
+		}
+		return stmt.(*TryStmt), nil
+	case tokenFor:
+		stmt, err := p.parseForStmt()
+		if err != nil {
+			return nil, err
+		}
+		return stmt.(*ForStmt), nil
+	case tokenReturn:
+		return nil, p.returnOutsideFunction()
+	case tokenBreak, tokenContinue, tokenDefer:
+		// Outside loops and functions these fail with their own message.
+		_, err := p.parseStatement()
+		return nil, err
 	default:
+		if p.curr.Type == tokenIdentifier && (p.curr.Lexeme == "infix" || p.curr.Lexeme == "struct") {
+			next, err := p.peek()
+			if err != nil {
+				return nil, err
+			}
+			if next.Type == tokenIdentifier && p.curr.Lexeme == "infix" {
+				return p.parseInfixDecl()
+			}
+			if next.Type == tokenIdentifier && p.curr.Lexeme == "struct" {
+				return p.parseStructDecl()
+			}
+		}
 		if p.curr.Type == tokenIdentifier {
 			if stmt, ok, err := p.tryParseAssignmentStmt(); err != nil {
 				return nil, err
 			} else if ok {
-				assign, _ := stmt.(*AssignStmt)
-				return assign, nil
+				return stmt.(Decl), nil
 			}
 			if stmt, ok, err := p.tryParseIncDecStmt(); err != nil {
 				return nil, err
 			} else if ok {
+				// p.x++ is an assignment to the field.
+				if assign, ok := stmt.(*AssignStmt); ok {
+					return assign, nil
+				}
 				return nil, p.errorf(stmt.Pos(), false, "++/-- not allowed at top level")
 			}
 		}
@@ -166,6 +223,178 @@ func isAssignmentToken(tt TokenType) bool {
 	}
 }
 
+func (p *parser) parseInfixDecl() (Decl, error) {
+	start := p.curr
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		nameTok, err := p.expect(tokenIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		if nameTok.Lexeme == discardIdent {
+			return nil, p.errorf(nameTok.Pos, false, "cannot declare %s as an infix operator", discardIdent)
+		}
+		names = append(names, nameTok.Lexeme)
+		if p.curr.Type != tokenComma {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	precTok, err := p.expect(tokenNumber)
+	if err != nil {
+		return nil, err
+	}
+	prec, convErr := strconv.Atoi(precTok.Lexeme)
+	if convErr != nil || prec < precLogicalOr || prec > precFactor {
+		return nil, p.errorf(precTok.Pos, false, "infix precedence must be an integer from %d to %d, got %s", precLogicalOr, precFactor, precTok.Lexeme)
+	}
+	if _, err := p.expect(tokenSemicolon); err != nil {
+		return nil, err
+	}
+	if p.infix == nil {
+		p.infix = make(map[string]int)
+	}
+	for _, name := range names {
+		p.infix[name] = prec
+	}
+	return &InfixDecl{
+		Names:      names,
+		Precedence: prec,
+		Posn:       posFromToken(start),
+	}, nil
+}
+
+// atInfix reports whether the current token is a user-declared infix
+// operator at the given precedence level.
+func (p *parser) atInfix(level int) bool {
+	return p.curr.Type == tokenIdentifier && p.infix[p.curr.Lexeme] == level
+}
+
+// parseInfix applies the user-declared operator at the current token to
+// left, reading the right operand with next.
+func (p *parser) parseInfix(left Expr, next func() (Expr, error)) (Expr, error) {
+	opTok := p.curr
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	right, err := next()
+	if err != nil {
+		return nil, err
+	}
+	return &InfixExpr{
+		Name:  opTok.Lexeme,
+		Left:  left,
+		Right: right,
+		Posn:  posFromToken(opTok),
+	}, nil
+}
+
+// parseStructDecl parses `struct name { field, ... }`. Fields may also be
+// written one per line.
+func (p *parser) parseStructDecl() (Decl, error) {
+	start := p.curr
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	nameTok, err := p.expect(tokenIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	if !isPlainIdentifier(nameTok.Lexeme) {
+		return nil, p.errorf(nameTok.Pos, false, "invalid struct name %s", nameTok.Lexeme)
+	}
+	if _, err := p.expect(tokenLBrace); err != nil {
+		return nil, err
+	}
+	var fields []string
+	for p.curr.Type != tokenRBrace {
+		fieldTok, err := p.expect(tokenIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		if !isPlainIdentifier(fieldTok.Lexeme) {
+			return nil, p.errorf(fieldTok.Pos, false, "invalid field name %s", fieldTok.Lexeme)
+		}
+		for _, field := range fields {
+			if field == fieldTok.Lexeme {
+				return nil, p.errorf(fieldTok.Pos, false, "duplicate field %s in struct %s", field, nameTok.Lexeme)
+			}
+		}
+		fields = append(fields, fieldTok.Lexeme)
+		if p.curr.Type != tokenComma && p.curr.Type != tokenSemicolon {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(tokenRBrace); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenSemicolon); err != nil {
+		return nil, err
+	}
+	return &StructDecl{
+		Name:   nameTok.Lexeme,
+		Fields: fields,
+		Posn:   posFromToken(start),
+	}, nil
+}
+
+// parseImportDecl parses `import "path/name"` or `import alias "path/name"`.
+// Without an alias the module is named after the last element of its path.
+func (p *parser) parseImportDecl() (Decl, error) {
+	importTok, err := p.expect(tokenImport)
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	if p.curr.Type == tokenIdentifier {
+		nameTok, err := p.expect(tokenIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		name = nameTok.Lexeme
+	}
+	pathTok, err := p.expect(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	modPath, _ := pathTok.Value.(string)
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(modPath), path.Ext(modPath))
+		if !isPlainIdentifier(name) {
+			return nil, p.errorf(posFromToken(pathTok), false, "cannot name module %q after its path; write import name %q", modPath, modPath)
+		}
+	}
+	if !isPlainIdentifier(name) {
+		return nil, p.errorf(posFromToken(importTok), false, "invalid module name %s", name)
+	}
+	if _, err := p.expect(tokenSemicolon); err != nil {
+		return nil, err
+	}
+	return &ImportDecl{
+		Name: name,
+		Path: modPath,
+		Posn: posFromToken(importTok),
+	}, nil
+}
+
+// isPlainIdentifier reports whether name is an identifier without dots.
+func isPlainIdentifier(name string) bool {
+	for i, r := range name {
+		if i == 0 && !isIdentifierStart(r) || !isIdentifierPart(r) {
+			return false
+		}
+	}
+	return name != "" && name != discardIdent
+}
+
 func (p *parser) parseFuncDecl() (Decl, error) {
 	funcTok, err := p.expect(tokenFunc)
 	if err != nil {
@@ -178,20 +407,21 @@ func (p *parser) parseFuncDecl() (Decl, error) {
 	if _, err := p.expect(tokenLParen); err != nil {
 		return nil, err
 	}
-	params, err := p.parseParamNames()
+	params, rest, err := p.parseParamNames()
 	if err != nil {
 		return nil, err
 	}
 	if _, err := p.expect(tokenRParen); err != nil {
 		return nil, err
 	}
-	body, err := p.parseBlock()
+	body, err := p.parseFuncBody()
 	if err != nil {
 		return nil, err
 	}
 	return &FuncDecl{
 		Name:   nameTok.Lexeme,
 		Params: params,
+		Rest:   rest,
 		Body:   body,
 		Posn:   posFromToken(funcTok),
 	}, nil
@@ -214,10 +444,16 @@ func (p *parser) parseConstDecl(isTopLevel bool) (Decl, error) {
 }
 
 func (p *parser) finishBindingDecl(start Token, isConst bool, expectSemi bool) (Decl, error) {
+	if p.curr.Type == tokenLBracket {
+		return p.finishDestructureDecl(start, isConst, expectSemi)
+	}
 	nameTok, err := p.expect(tokenIdentifier)
 	if err != nil {
 		return nil, err
 	}
+	if p.curr.Type == tokenComma {
+		return p.finishValuesDecl(start, nameTok, isConst, expectSemi)
+	}
 	var init Expr
 	if p.curr.Type == tokenLBracket {
 		bracketTok, err := p.expect(tokenLBracket)
@@ -271,6 +507,139 @@ func (p *parser) finishBindingDecl(start Token, isConst bool, expectSemi bool) (
 	}, nil
 }
 
+// finishValuesDecl parses the rest of `var q, r = expr`, which binds the
+// multiple values of expr after the first name has been read, or of
+// `var a, b = x, y`, which binds one value to each name.
+func (p *parser) finishValuesDecl(start, first Token, isConst bool, expectSemi bool) (Decl, error) {
+	names := []string{first.Lexeme}
+	for p.curr.Type == tokenComma {
+		if _, err := p.expect(tokenComma); err != nil {
+			return nil, err
+		}
+		nameTok, err := p.expect(tokenIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, nameTok.Lexeme)
+	}
+	assignTok, err := p.expect(tokenAssign)
+	if err != nil {
+		return nil, err
+	}
+	exprs, err := p.parseExpressionList()
+	if err != nil {
+		return nil, err
+	}
+	init := exprs[0]
+	if len(exprs) > 1 {
+		if len(exprs) != len(names) {
+			return nil, p.errorf(assignTok.Pos, false, "assignment mismatch: %d variables but %d values", len(names), len(exprs))
+		}
+		// One value for each name: bind them as the values of one call.
+		init = &CallExpr{
+			Callee: &IdentifierExpr{Name: "values", Posn: exprs[0].Pos()},
+			Args:   exprs,
+			Posn:   exprs[0].Pos(),
+		}
+	}
+	if expectSemi {
+		if _, err := p.expect(tokenSemicolon); err != nil {
+			return nil, err
+		}
+	} else if p.curr.Type == tokenSemicolon {
+		if _, err := p.expect(tokenSemicolon); err != nil {
+			return nil, err
+		}
+	}
+	return &DestructureDecl{
+		Names:  names,
+		Init:   init,
+		Const:  isConst,
+		Values: true,
+		Posn:   posFromToken(start),
+	}, nil
+}
+
+func (p *parser) finishDestructureDecl(start Token, isConst bool, expectSemi bool) (Decl, error) {
+	bracketTok, err := p.expect(tokenLBracket)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	var rest string
+	for p.curr.Type != tokenRBracket {
+		nameTok, err := p.expect(tokenIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		if p.curr.Type == tokenEllipsis {
+			if _, err := p.expect(tokenEllipsis); err != nil {
+				return nil, err
+			}
+			rest = nameTok.Lexeme
+			break
+		}
+		names = append(names, nameTok.Lexeme)
+		if p.curr.Type != tokenComma {
+			break
+		}
+		if _, err := p.expect(tokenComma); err != nil {
+			return nil, err
+		}
+	}
+	if p.curr.Type != tokenRBracket {
+		if rest != "" {
+			return nil, p.unexpectedf(p.curr.Type == tokenEOF, "rest binding must be last in destructuring pattern")
+		}
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected ] to close destructuring pattern")
+	}
+	if _, err := p.expect(tokenRBracket); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 && rest == "" {
+		return nil, p.errorf(posFromToken(bracketTok), false, "destructuring pattern requires at least one name")
+	}
+	if _, err := p.expect(tokenAssign); err != nil {
+		return nil, err
+	}
+	init, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if expectSemi {
+		if _, err := p.expect(tokenSemicolon); err != nil {
+			return nil, err
+		}
+	} else if p.curr.Type == tokenSemicolon {
+		if _, err := p.expect(tokenSemicolon); err != nil {
+			return nil, err
+		}
+	}
+	return &DestructureDecl{
+		Names: names,
+		Rest:  rest,
+		Init:  init,
+		Const: isConst,
+		Posn:  posFromToken(start),
+	}, nil
+}
+
+// parseFuncBody parses the block of a function declaration or literal. The
+// loops around the function do not extend into it: a break or continue
+// there would jump through the continuation of a loop in another function,
+// which may have finished long before the function is called.
+func (p *parser) parseFuncBody() (*BlockStmt, error) {
+	outer := p.loopDepth
+	p.loopDepth = 0
+	p.loopsOutside += outer
+	p.funcDepth++
+	body, err := p.parseBlock()
+	p.funcDepth--
+	p.loopsOutside -= outer
+	p.loopDepth = outer
+	return body, err
+}
+
 func (p *parser) parseBlock() (*BlockStmt, error) {
 	braceTok, err := p.expect(tokenLBrace)
 	if err != nil {
@@ -291,7 +660,7 @@ func (p *parser) parseBlock() (*BlockStmt, error) {
 		stmts = append(stmts, stmt)
 	}
 	if p.curr.Type != tokenRBrace {
-		return nil, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "expected } to close block")
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected } to close block")
 	}
 	if _, err := p.expect(tokenRBrace); err != nil {
 		return nil, err
@@ -320,12 +689,20 @@ func (p *parser) parseStatement() (Stmt, error) {
 		return p.parseIfStmt()
 	case tokenWhile:
 		return p.parseWhileStmt()
+	case tokenFor:
+		return p.parseForStmt()
 	case tokenBreak:
 		return p.parseBreakStmt()
 	case tokenContinue:
 		return p.parseContinueStmt()
 	case tokenReturn:
 		return p.parseReturnStmt()
+	case tokenDefer:
+		return p.parseDeferStmt()
+	case tokenTry:
+		return p.parseTryStmt()
+	case tokenImport:
+		return nil, p.errorf(p.curr.Pos, false, "import is only allowed at top level")
 	case tokenLBrace:
 		block, err := p.parseBlock()
 		if err != nil {
@@ -361,32 +738,14 @@ func (p *parser) parseStatement() (Stmt, error) {
 
 func (p *parser) tryParseAssignmentStmt() (Stmt, bool, error) {
 	state := p.saveState()
-	nameTok, err := p.expect(tokenIdentifier)
+	nameTok := p.curr
+	target, err := p.parseAssignTarget()
 	if err != nil {
 		return nil, false, err
 	}
-	base := &IdentifierExpr{
-		Name: nameTok.Lexeme,
-		Posn: posFromToken(nameTok),
-	}
-	var target Expr = base
-	for p.curr.Type == tokenLBracket {
-		bracketTok, err := p.expect(tokenLBracket)
-		if err != nil {
-			return nil, false, err
-		}
-		indexExpr, err := p.parseExpression()
-		if err != nil {
-			return nil, false, err
-		}
-		if _, err := p.expect(tokenRBracket); err != nil {
-			return nil, false, err
-		}
-		target = &IndexExpr{
-			Target: target,
-			Index:  indexExpr,
-			Posn:   posFromToken(bracketTok),
-		}
+	if p.curr.Type == tokenComma {
+		stmt, err := p.finishTupleAssignStmt(nameTok, target)
+		return stmt, err == nil, err
 	}
 	if !isAssignmentToken(p.curr.Type) {
 		p.restoreState(state)
@@ -394,8 +753,8 @@ func (p *parser) tryParseAssignmentStmt() (Stmt, bool, error) {
 	}
 	assignType := p.curr.Type
 	if assignType != tokenAssign {
-		if _, ok := target.(*IdentifierExpr); !ok {
-			return nil, false, p.errorf(p.curr.Pos, false, "%s assignment targets must be identifiers", assignType)
+		if _, ok := target.(*IndexExpr); ok {
+			return nil, false, p.errorf(p.curr.Pos, false, "%s assignment targets must be identifiers or fields", assignType)
 		}
 	}
 	if _, err := p.expect(assignType); err != nil {
@@ -420,6 +779,95 @@ func (p *parser) tryParseAssignmentStmt() (Stmt, bool, error) {
 	return stmt, true, nil
 }
 
+// parseAssignTarget parses what an assignment may assign to: a variable,
+// or a chain of fields and elements selected from one, as in ps[0].x.
+func (p *parser) parseAssignTarget() (Expr, error) {
+	nameTok, err := p.expect(tokenIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	target := identifierExpr(nameTok)
+	for p.curr.Type == tokenLBracket || p.curr.Type == tokenDot {
+		if p.curr.Type == tokenDot {
+			target, err = p.parseSelector(target)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		bracketTok, err := p.expect(tokenLBracket)
+		if err != nil {
+			return nil, err
+		}
+		indexExpr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRBracket); err != nil {
+			return nil, err
+		}
+		target = &IndexExpr{
+			Target: target,
+			Index:  indexExpr,
+			Posn:   posFromToken(bracketTok),
+		}
+	}
+	return target, nil
+}
+
+// finishTupleAssignStmt parses the rest of `a, b = b, a` or
+// `q, r = divmod(x, y)` after the first target has been read.
+func (p *parser) finishTupleAssignStmt(start Token, first Expr) (Stmt, error) {
+	targets := []Expr{first}
+	for p.curr.Type == tokenComma {
+		if _, err := p.expect(tokenComma); err != nil {
+			return nil, err
+		}
+		target, err := p.parseAssignTarget()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	assignTok, err := p.expect(tokenAssign)
+	if err != nil {
+		return nil, err
+	}
+	exprs, err := p.parseExpressionList()
+	if err != nil {
+		return nil, err
+	}
+	if len(exprs) > 1 && len(exprs) != len(targets) {
+		return nil, p.errorf(assignTok.Pos, false, "assignment mismatch: %d targets but %d values", len(targets), len(exprs))
+	}
+	if _, err := p.expect(tokenSemicolon); err != nil {
+		return nil, err
+	}
+	return &TupleAssignStmt{
+		Targets: targets,
+		Exprs:   exprs,
+		Posn:    posFromToken(start),
+	}, nil
+}
+
+// parseExpressionList parses one or more expressions separated by commas.
+func (p *parser) parseExpressionList() ([]Expr, error) {
+	var exprs []Expr
+	for {
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if p.curr.Type != tokenComma {
+			return exprs, nil
+		}
+		if _, err := p.expect(tokenComma); err != nil {
+			return nil, err
+		}
+	}
+}
+
 func (p *parser) tryParseIncDecStmt() (Stmt, bool, error) {
 	nameTok := p.curr
 	peek, err := p.peek()
@@ -439,6 +887,18 @@ func (p *parser) tryParseIncDecStmt() (Stmt, bool, error) {
 	if _, err := p.expect(tokenSemicolon); err != nil {
 		return nil, false, err
 	}
+	if field, ok := identifierExpr(nameTok).(*FieldExpr); ok {
+		op := tokenPlusAssign
+		if opType == tokenMinusMinus {
+			op = tokenMinusAssign
+		}
+		return &AssignStmt{
+			Target: field,
+			Expr:   &NumberExpr{Value: "1", Posn: posFromToken(nameTok)},
+			Op:     op,
+			Posn:   posFromToken(nameTok),
+		}, true, nil
+	}
 	return &IncDecStmt{
 		Name: nameTok.Lexeme,
 		Op:   opType,
@@ -451,7 +911,7 @@ func (p *parser) parseIfStmt() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	cond, err := p.parseExpression()
+	cond, err := p.parseCondition("if")
 	if err != nil {
 		return nil, err
 	}
@@ -479,11 +939,24 @@ func (p *parser) parseIfStmt() (Stmt, error) {
 }
 
 func (p *parser) parseWhileStmt() (Stmt, error) {
+	expr, err := p.parseWhileExpr()
+	if err != nil {
+		return nil, err
+	}
+	loop := expr.(*WhileExpr)
+	return &WhileStmt{
+		Cond: loop.Cond,
+		Body: loop.Body,
+		Posn: loop.Posn,
+	}, nil
+}
+
+func (p *parser) parseWhileExpr() (Expr, error) {
 	whTok, err := p.expect(tokenWhile)
 	if err != nil {
 		return nil, err
 	}
-	cond, err := p.parseExpression()
+	cond, err := p.parseCondition("while")
 	if err != nil {
 		return nil, err
 	}
@@ -493,28 +966,135 @@ func (p *parser) parseWhileStmt() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &WhileStmt{
+	return &WhileExpr{
 		Cond: cond,
 		Body: body,
 		Posn: posFromToken(whTok),
 	}, nil
 }
 
+func (p *parser) parseForStmt() (Stmt, error) {
+	forTok, err := p.expect(tokenFor)
+	if err != nil {
+		return nil, err
+	}
+	nameTok, err := p.expect(tokenIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{nameTok.Lexeme}
+	if p.curr.Type == tokenComma {
+		if _, err := p.expect(tokenComma); err != nil {
+			return nil, err
+		}
+		nameTok, err := p.expect(tokenIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, nameTok.Lexeme)
+	}
+	// "in" is not reserved; it is recognized only here.
+	if p.curr.Type != tokenIdentifier || p.curr.Lexeme != "in" {
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected in after for loop variables, found %s", p.curr.Text())
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	iter, err := p.parseCondition("for")
+	if err != nil {
+		return nil, err
+	}
+	p.loopDepth++
+	body, err := p.parseBlock()
+	p.loopDepth--
+	if err != nil {
+		return nil, err
+	}
+	return &ForStmt{
+		Names: names,
+		Iter:  iter,
+		Body:  body,
+		Posn:  posFromToken(forTok),
+	}, nil
+}
+
+func (p *parser) parseTryStmt() (Stmt, error) {
+	tryTok, err := p.expect(tokenTry)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &TryStmt{
+		Body: body,
+		Posn: posFromToken(tryTok),
+	}
+	if p.curr.Type == tokenCatch {
+		if _, err := p.expect(tokenCatch); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenLParen); err != nil {
+			return nil, err
+		}
+		nameTok, err := p.expect(tokenIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen); err != nil {
+			return nil, err
+		}
+		block, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		stmt.CatchName = nameTok.Lexeme
+		stmt.Catch = block
+	}
+	if p.curr.Type == tokenFinally {
+		if _, err := p.expect(tokenFinally); err != nil {
+			return nil, err
+		}
+		block, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Finally = block
+	}
+	if stmt.Catch == nil && stmt.Finally == nil {
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected catch or finally after try block")
+	}
+	return stmt, nil
+}
+
 func (p *parser) parseBreakStmt() (Stmt, error) {
 	breakTok, err := p.expect(tokenBreak)
 	if err != nil {
 		return nil, err
 	}
 	if p.loopDepth == 0 {
+		if p.loopsOutside > 0 {
+			return nil, p.errorf(posFromToken(breakTok), false, "break not allowed in a function inside a loop; return from the function and break in the loop")
+		}
 		return nil, p.errorf(posFromToken(breakTok), false, "break not allowed outside loops")
 	}
+	var result Expr
+	if p.curr.Type != tokenSemicolon && p.curr.Type != tokenRBrace {
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		result = expr
+	}
 	if p.curr.Type == tokenSemicolon {
 		if _, err := p.expect(tokenSemicolon); err != nil {
 			return nil, err
 		}
 	}
 	return &BreakStmt{
-		Posn: posFromToken(breakTok),
+		Result: result,
+		Posn:   posFromToken(breakTok),
 	}, nil
 }
 
@@ -524,6 +1104,9 @@ func (p *parser) parseContinueStmt() (Stmt, error) {
 		return nil, err
 	}
 	if p.loopDepth == 0 {
+		if p.loopsOutside > 0 {
+			return nil, p.errorf(posFromToken(continueTok), false, "continue not allowed in a function inside a loop; return from the function and continue in the loop")
+		}
 		return nil, p.errorf(posFromToken(continueTok), false, "continue not allowed outside loops")
 	}
 	if p.curr.Type == tokenSemicolon {
@@ -536,7 +1119,42 @@ func (p *parser) parseContinueStmt() (Stmt, error) {
 	}, nil
 }
 
+func (p *parser) parseDeferStmt() (Stmt, error) {
+	deferTok, err := p.expect(tokenDefer)
+	if err != nil {
+		return nil, err
+	}
+	if p.funcDepth == 0 {
+		return nil, p.errorf(posFromToken(deferTok), false, "defer not allowed outside functions")
+	}
+	start := p.curr
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	call, ok := expr.(*CallExpr)
+	if !ok {
+		return nil, p.errorf(start.Pos, false, "defer expects a function call")
+	}
+	if _, err := p.expect(tokenSemicolon); err != nil {
+		return nil, err
+	}
+	return &DeferStmt{
+		Call: call,
+		Posn: posFromToken(deferTok),
+	}, nil
+}
+
+// returnOutsideFunction reports the return at p.curr, which has no
+// function to return from.
+func (p *parser) returnOutsideFunction() error {
+	return p.errorf(p.curr.Pos, false, "return not allowed outside functions; remove it, or call exit to end the script early")
+}
+
 func (p *parser) parseReturnStmt() (Stmt, error) {
+	if p.funcDepth == 0 {
+		return nil, p.returnOutsideFunction()
+	}
 	retTok, err := p.expect(tokenReturn)
 	if err != nil {
 		return nil, err
@@ -549,6 +1167,28 @@ func (p *parser) parseReturnStmt() (Stmt, error) {
 		}
 		result = expr
 	}
+	if p.curr.Type == tokenComma {
+		// `return q, r` returns multiple values.
+		args := []Expr{result}
+		for p.curr.Type == tokenComma {
+			if _, err := p.expect(tokenComma); err != nil {
+				return nil, err
+			}
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, expr)
+		}
+		result = &CallExpr{
+			Callee: &IdentifierExpr{
+				Name: "values",
+				Posn: posFromToken(retTok),
+			},
+			Args: args,
+			Posn: posFromToken(retTok),
+		}
+	}
 	if _, err := p.expect(tokenSemicolon); err != nil {
 		return nil, err
 	}
@@ -559,7 +1199,36 @@ func (p *parser) parseReturnStmt() (Stmt, error) {
 }
 
 func (p *parser) parseExpression() (Expr, error) {
-	return p.parseLogicalOr()
+	return p.parsePipeline()
+}
+
+// parsePipeline desugars `x |> f |> g(2)` into `g(f(x), 2)`: a call on the
+// right receives the piped value as its first argument, any other
+// expression is called with the value alone.
+func (p *parser) parsePipeline() (Expr, error) {
+	left, err := p.parseLogicalOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.curr.Type == tokenPipeline {
+		opTok := p.curr
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseLogicalOr()
+		if err != nil {
+			return nil, err
+		}
+		if call, ok := right.(*CallExpr); ok {
+			args := make([]Expr, 0, len(call.Args)+1)
+			args = append(args, left)
+			args = append(args, call.Args...)
+			left = &CallExpr{Callee: call.Callee, Args: args, Spread: call.Spread, Posn: call.Posn}
+			continue
+		}
+		left = &CallExpr{Callee: right, Args: []Expr{left}, Posn: posFromToken(opTok)}
+	}
+	return left, nil
 }
 
 func (p *parser) parseLogicalOr() (Expr, error) {
@@ -567,7 +1236,13 @@ func (p *parser) parseLogicalOr() (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	for p.curr.Type == tokenOrOr {
+	for p.curr.Type == tokenOrOr || p.atInfix(precLogicalOr) {
+		if p.curr.Type == tokenIdentifier {
+			if left, err = p.parseInfix(left, p.parseLogicalAnd); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		opTok, _ := p.expect(tokenOrOr)
 		right, err := p.parseLogicalAnd()
 		if err != nil {
@@ -588,7 +1263,13 @@ func (p *parser) parseLogicalAnd() (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	for p.curr.Type == tokenAndAnd {
+	for p.curr.Type == tokenAndAnd || p.atInfix(precLogicalAnd) {
+		if p.curr.Type == tokenIdentifier {
+			if left, err = p.parseInfix(left, p.parseEquality); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		opTok, _ := p.expect(tokenAndAnd)
 		right, err := p.parseEquality()
 		if err != nil {
@@ -609,7 +1290,13 @@ func (p *parser) parseEquality() (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	for p.curr.Type == tokenEqualEqual || p.curr.Type == tokenBangEqual {
+	for p.curr.Type == tokenEqualEqual || p.curr.Type == tokenBangEqual || p.atInfix(precEquality) {
+		if p.curr.Type == tokenIdentifier {
+			if left, err = p.parseInfix(left, p.parseComparison); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		opTok := p.curr
 		if err := p.advance(); err != nil {
 			return nil, err
@@ -634,7 +1321,13 @@ func (p *parser) parseComparison() (Expr, error) {
 		return nil, err
 	}
 	for p.curr.Type == tokenLess || p.curr.Type == tokenLessEqual ||
-		p.curr.Type == tokenGreater || p.curr.Type == tokenGreaterEqual {
+		p.curr.Type == tokenGreater || p.curr.Type == tokenGreaterEqual || p.atInfix(precComparison) {
+		if p.curr.Type == tokenIdentifier {
+			if left, err = p.parseInfix(left, p.parseTerm); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		opTok := p.curr
 		if err := p.advance(); err != nil {
 			return nil, err
@@ -675,6 +1368,13 @@ func (p *parser) parseTerm() (Expr, error) {
 				Right: right,
 				Posn:  posFromToken(opTok),
 			}
+		case tokenIdentifier:
+			if !p.atInfix(precTerm) {
+				return left, nil
+			}
+			if left, err = p.parseInfix(left, p.parseFactor); err != nil {
+				return nil, err
+			}
 		default:
 			return left, nil
 		}
@@ -703,6 +1403,13 @@ func (p *parser) parseFactor() (Expr, error) {
 				Right: right,
 				Posn:  posFromToken(opTok),
 			}
+		case tokenIdentifier:
+			if !p.atInfix(precFactor) {
+				return left, nil
+			}
+			if left, err = p.parseInfix(left, p.parseUnary); err != nil {
+				return nil, err
+			}
 		default:
 			return left, nil
 		}
@@ -737,7 +1444,7 @@ func (p *parser) parsePostfix() (Expr, error) {
 		switch p.curr.Type {
 		case tokenLParen:
 			callTok, _ := p.expect(tokenLParen)
-			args, err := p.parseArgumentList()
+			args, spread, err := p.parseArgumentList()
 			if err != nil {
 				return nil, err
 			}
@@ -747,6 +1454,7 @@ func (p *parser) parsePostfix() (Expr, error) {
 			expr = &CallExpr{
 				Callee: expr,
 				Args:   args,
+				Spread: spread,
 				Posn:   posFromToken(callTok),
 			}
 		case tokenLBracket:
@@ -766,46 +1474,104 @@ func (p *parser) parsePostfix() (Expr, error) {
 				Index:  indexExpr,
 				Posn:   posFromToken(bracketTok),
 			}
+		case tokenDot:
+			expr, err = p.parseSelector(expr)
+			if err != nil {
+				return nil, err
+			}
 		case tokenPlusPlus, tokenMinusMinus:
-			return nil, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "%s not allowed in expression context", p.curr.Type)
+			return nil, p.unexpectedf(p.curr.Type == tokenEOF, "%s not allowed in expression context", p.curr.Type)
 		default:
 			return expr, nil
 		}
 	}
 }
 
-func (p *parser) parseArgumentList() ([]Expr, error) {
+// parseSelector parses `.x` after target, the selection of a field from
+// a value that is not a plain variable, such as ps[0].x or mk().x. The
+// lexer reads a name following the dot as one identifier, so .x.y selects
+// both fields.
+func (p *parser) parseSelector(target Expr) (Expr, error) {
+	dotTok, err := p.expect(tokenDot)
+	if err != nil {
+		return nil, err
+	}
+	nameTok, err := p.expect(tokenIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	expr := target
+	for _, field := range strings.Split(nameTok.Lexeme, ".") {
+		expr = &FieldExpr{
+			Target: expr,
+			Field:  field,
+			Posn:   posFromToken(dotTok),
+		}
+	}
+	return expr, nil
+}
+
+// identifierExpr returns the expression for an identifier token. A
+// qualified identifier such as p.pos.x selects fields of the variable p.
+func identifierExpr(tok Token) Expr {
+	parts := strings.Split(tok.Lexeme, ".")
+	var expr Expr = &IdentifierExpr{
+		Name: parts[0],
+		Posn: posFromToken(tok),
+	}
+	for _, field := range parts[1:] {
+		expr = &FieldExpr{
+			Target: expr,
+			Field:  field,
+			Posn:   posFromToken(tok),
+		}
+	}
+	return expr
+}
+
+// parseArgumentList parses the arguments of a call up to the closing
+// parenthesis and reports whether the last one is spread with "...".
+func (p *parser) parseArgumentList() ([]Expr, bool, error) {
 	var args []Expr
 	if p.curr.Type == tokenRParen {
-		return args, nil
+		return args, false, nil
 	}
 	for {
 		expr, err := p.parseExpression()
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		args = append(args, expr)
+		if p.curr.Type == tokenEllipsis {
+			p.expect(tokenEllipsis)
+			if p.curr.Type != tokenRParen {
+				return nil, false, p.unexpectedf(p.curr.Type == tokenEOF, "spread argument must be last")
+			}
+			return args, true, nil
+		}
 		if p.curr.Type != tokenComma {
 			break
 		}
 		if _, err := p.expect(tokenComma); err != nil {
-			return nil, err
+			return nil, false, err
 		}
 	}
-	return args, nil
+	return args, false, nil
 }
 
 func (p *parser) parsePrimary() (Expr, error) {
 	switch p.curr.Type {
 	case tokenIdentifier:
+		if p.curr.Lexeme == "match" {
+			if expr, ok, err := p.tryParseMatchExpr(); err != nil || ok {
+				return expr, err
+			}
+		}
 		tok, err := p.expect(tokenIdentifier)
 		if err != nil {
 			return nil, err
 		}
-		return &IdentifierExpr{
-			Name: tok.Lexeme,
-			Posn: posFromToken(tok),
-		}, nil
+		return identifierExpr(tok), nil
 	case tokenNumber:
 		tok, err := p.expect(tokenNumber)
 		if err != nil {
@@ -825,6 +1591,16 @@ func (p *parser) parsePrimary() (Expr, error) {
 			Value: strVal,
 			Posn:  posFromToken(tok),
 		}, nil
+	case tokenChar:
+		tok, err := p.expect(tokenChar)
+		if err != nil {
+			return nil, err
+		}
+		r, _ := tok.Value.(rune)
+		return &CharExpr{
+			Value: r,
+			Posn:  posFromToken(tok),
+		}, nil
 	case tokenTrue, tokenFalse:
 		tok := p.curr
 		if err := p.advance(); err != nil {
@@ -854,10 +1630,14 @@ func (p *parser) parsePrimary() (Expr, error) {
 		}, nil
 	case tokenSwitch:
 		return p.parseSwitchExpr()
+	case tokenSelect:
+		return p.parseSelectExpr()
 	case tokenFunc:
 		return p.parseLambdaExpr()
 	case tokenIf:
 		return p.parseIfExpr()
+	case tokenWhile:
+		return p.parseWhileExpr()
 	case tokenLParen:
 		if _, err := p.expect(tokenLParen); err != nil {
 			return nil, err
@@ -875,7 +1655,10 @@ func (p *parser) parsePrimary() (Expr, error) {
 	case tokenVectorStart:
 		return p.parseVectorLiteral()
 	default:
-		return nil, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "unexpected token %s in expression", p.curr.Type)
+		if p.curr.Type == tokenReturn && p.funcDepth == 0 {
+			return nil, p.returnOutsideFunction()
+		}
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "unexpected token %s in expression", p.curr.Type)
 	}
 }
 
@@ -885,24 +1668,25 @@ func (p *parser) parseLambdaExpr() (Expr, error) {
 		return nil, err
 	}
 	if p.curr.Type != tokenLParen {
-		return nil, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "expected ( after func")
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected ( after func")
 	}
 	if _, err := p.expect(tokenLParen); err != nil {
 		return nil, err
 	}
-	params, err := p.parseParamNames()
+	params, rest, err := p.parseParamNames()
 	if err != nil {
 		return nil, err
 	}
 	if _, err := p.expect(tokenRParen); err != nil {
 		return nil, err
 	}
-	body, err := p.parseBlock()
+	body, err := p.parseFuncBody()
 	if err != nil {
 		return nil, err
 	}
 	return &LambdaExpr{
 		Params: params,
+		Rest:   rest,
 		Body:   body,
 		Posn:   posFromToken(funcTok),
 	}, nil
@@ -971,6 +1755,13 @@ func (p *parser) parseSwitchExpr() (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
+	var subject Expr
+	if p.curr.Type != tokenLBrace {
+		subject, err = p.parseCondition("switch")
+		if err != nil {
+			return nil, err
+		}
+	}
 	if _, err := p.expect(tokenLBrace); err != nil {
 		return nil, err
 	}
@@ -989,7 +1780,7 @@ func (p *parser) parseSwitchExpr() (Expr, error) {
 			if defaultEncountered {
 				return nil, p.errorf(posFromToken(caseTok), false, "case clause cannot follow default in switch")
 			}
-			cond, err := p.parseExpression()
+			values, err := p.parseExpressionList()
 			if err != nil {
 				return nil, err
 			}
@@ -1005,11 +1796,37 @@ func (p *parser) parseSwitchExpr() (Expr, error) {
 					return nil, err
 				}
 			}
-			clauses = append(clauses, &SwitchClause{
-				Cond: cond,
+			clause := &SwitchClause{
 				Body: body,
 				Posn: posFromToken(caseTok),
-			})
+			}
+			if subject != nil {
+				clause.Values = values
+			} else {
+				// Without a subject, case a, b: is case a || b:.
+				clause.Cond = values[0]
+				for _, cond := range values[1:] {
+					clause.Cond = &BinaryExpr{Op: tokenOrOr, Left: clause.Cond, Right: cond, Posn: cond.Pos()}
+				}
+			}
+			// "fallthrough" is not reserved; it is recognized only here,
+			// where no other identifier may appear.
+			if p.curr.Type == tokenIdentifier && p.curr.Lexeme == "fallthrough" {
+				ftTok := p.curr
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if p.curr.Type == tokenSemicolon {
+					if _, err := p.expect(tokenSemicolon); err != nil {
+						return nil, err
+					}
+				}
+				if p.curr.Type != tokenCase && p.curr.Type != tokenDefault {
+					return nil, p.errorf(posFromToken(ftTok), false, "cannot fallthrough final case in switch")
+				}
+				clause.Fallthrough = true
+			}
+			clauses = append(clauses, clause)
 		case tokenDefault:
 			defTok, err := p.expect(tokenDefault)
 			if err != nil {
@@ -1033,12 +1850,12 @@ func (p *parser) parseSwitchExpr() (Expr, error) {
 			defaultExpr = body
 			defaultEncountered = true
 		default:
-			return nil, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "unexpected token %s in switch", p.curr.Type)
+			return nil, p.unexpectedf(p.curr.Type == tokenEOF, "unexpected token %s in switch", p.curr.Type)
 		}
 	}
 
 	if p.curr.Type != tokenRBrace {
-		return nil, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "expected } to close switch")
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected } to close switch")
 	}
 	if _, err := p.expect(tokenRBrace); err != nil {
 		return nil, err
@@ -1049,18 +1866,345 @@ func (p *parser) parseSwitchExpr() (Expr, error) {
 	}
 
 	return &SwitchExpr{
+		Subject: subject,
 		Clauses: clauses,
 		Default: defaultExpr,
 		Posn:    posFromToken(switchTok),
 	}, nil
 }
 
+func (p *parser) parseSelectExpr() (Expr, error) {
+	selectTok, err := p.expect(tokenSelect)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenLBrace); err != nil {
+		return nil, err
+	}
+
+	var clauses []*SelectClause
+	var defaultExpr Expr
+	defaultEncountered := false
+
+	for p.curr.Type != tokenRBrace && p.curr.Type != tokenEOF {
+		switch p.curr.Type {
+		case tokenCase:
+			caseTok, err := p.expect(tokenCase)
+			if err != nil {
+				return nil, err
+			}
+			if defaultEncountered {
+				return nil, p.errorf(posFromToken(caseTok), false, "case clause cannot follow default in select")
+			}
+			clause, err := p.parseSelectClause(caseTok)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, clause)
+		case tokenDefault:
+			defTok, err := p.expect(tokenDefault)
+			if err != nil {
+				return nil, err
+			}
+			if defaultExpr != nil {
+				return nil, p.errorf(posFromToken(defTok), false, "duplicate default clause in select")
+			}
+			if _, err := p.expect(tokenColon); err != nil {
+				return nil, err
+			}
+			body, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if p.curr.Type == tokenSemicolon {
+				if _, err := p.expect(tokenSemicolon); err != nil {
+					return nil, err
+				}
+			}
+			defaultExpr = body
+			defaultEncountered = true
+		default:
+			return nil, p.unexpectedf(p.curr.Type == tokenEOF, "unexpected token %s in select", p.curr.Type)
+		}
+	}
+
+	if p.curr.Type != tokenRBrace {
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected } to close select")
+	}
+	if _, err := p.expect(tokenRBrace); err != nil {
+		return nil, err
+	}
+
+	if len(clauses) == 0 && defaultExpr == nil {
+		return nil, p.errorf(posFromToken(selectTok), false, "select requires at least one case")
+	}
+
+	return &SelectExpr{
+		Clauses: clauses,
+		Default: defaultExpr,
+		Posn:    posFromToken(selectTok),
+	}, nil
+}
+
+// parseSelectClause parses a select case after its case keyword: a call of
+// receive, optionally assigned to a name, or of send, then the body.
+func (p *parser) parseSelectClause(caseTok Token) (*SelectClause, error) {
+	clause := &SelectClause{Posn: posFromToken(caseTok)}
+	if p.curr.Type == tokenIdentifier {
+		next, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if next.Type == tokenAssign {
+			clause.Name = p.curr.Lexeme
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	opPos := p.curr.Pos
+	op, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	call, ok := op.(*CallExpr)
+	var callee string
+	if ok {
+		if ident, isIdent := call.Callee.(*IdentifierExpr); isIdent {
+			callee = ident.Name
+		}
+	}
+	switch {
+	case callee == "receive" && len(call.Args) == 1:
+		clause.Channel = call.Args[0]
+	case callee == "send" && len(call.Args) == 2:
+		if clause.Name != "" {
+			return nil, p.errorf(opPos, false, "send in select has no value to assign to %s", clause.Name)
+		}
+		clause.Channel, clause.Value = call.Args[0], call.Args[1]
+	default:
+		return nil, p.errorf(opPos, false, "select case must be receive(ch) or send(ch, x)")
+	}
+	if _, err := p.expect(tokenColon); err != nil {
+		return nil, err
+	}
+	body, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if p.curr.Type == tokenSemicolon {
+		if _, err := p.expect(tokenSemicolon); err != nil {
+			return nil, err
+		}
+	}
+	clause.Body = body
+	return clause, nil
+}
+
+// tryParseMatchExpr parses a match expression when the identifier match is
+// followed by a subject and a block of cases. "match" is not reserved, so
+// otherwise the parser backtracks and reads it as a plain identifier.
+func (p *parser) tryParseMatchExpr() (Expr, bool, error) {
+	state := p.saveState()
+	matchTok := p.curr
+	if err := p.advance(); err != nil {
+		p.restoreState(state)
+		return nil, false, nil
+	}
+	subject, err := p.parseExpression()
+	if err != nil || p.curr.Type != tokenLBrace {
+		p.restoreState(state)
+		return nil, false, nil
+	}
+	next, err := p.peek()
+	if err != nil || next.Type != tokenCase {
+		p.restoreState(state)
+		return nil, false, nil
+	}
+	if _, err := p.expect(tokenLBrace); err != nil {
+		return nil, true, err
+	}
+
+	var clauses []*MatchClause
+	for p.curr.Type != tokenRBrace && p.curr.Type != tokenEOF {
+		if p.curr.Type != tokenCase {
+			return nil, true, p.unexpectedf(false, "unexpected token %s in match", p.curr.Type)
+		}
+		caseTok, err := p.expect(tokenCase)
+		if err != nil {
+			return nil, true, err
+		}
+		pattern, err := p.parsePattern(make(map[string]bool))
+		if err != nil {
+			return nil, true, err
+		}
+		var guard Expr
+		if p.curr.Type == tokenIf {
+			if _, err := p.expect(tokenIf); err != nil {
+				return nil, true, err
+			}
+			guard, err = p.parseExpression()
+			if err != nil {
+				return nil, true, err
+			}
+		}
+		if _, err := p.expect(tokenColon); err != nil {
+			return nil, true, err
+		}
+		body, err := p.parseExpression()
+		if err != nil {
+			return nil, true, err
+		}
+		if p.curr.Type == tokenSemicolon {
+			if _, err := p.expect(tokenSemicolon); err != nil {
+				return nil, true, err
+			}
+		}
+		clauses = append(clauses, &MatchClause{
+			Pattern: pattern,
+			Guard:   guard,
+			Body:    body,
+			Posn:    posFromToken(caseTok),
+		})
+	}
+
+	if p.curr.Type != tokenRBrace {
+		return nil, true, p.unexpectedf(p.curr.Type == tokenEOF, "expected } to close match")
+	}
+	if _, err := p.expect(tokenRBrace); err != nil {
+		return nil, true, err
+	}
+	return &MatchExpr{
+		Subject: subject,
+		Clauses: clauses,
+		Posn:    posFromToken(matchTok),
+	}, true, nil
+}
+
+// parsePattern parses the pattern of a match case. bound collects the
+// variables the enclosing pattern binds, none of which may repeat.
+func (p *parser) parsePattern(bound map[string]bool) (Pattern, error) {
+	tok := p.curr
+	switch tok.Type {
+	case tokenIdentifier:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if tok.Lexeme == discardIdent {
+			return &WildcardPattern{Posn: posFromToken(tok)}, nil
+		}
+		if err := p.bindPatternVar(tok, bound); err != nil {
+			return nil, err
+		}
+		return &VarPattern{Name: tok.Lexeme, Posn: posFromToken(tok)}, nil
+	case tokenNumber, tokenString, tokenChar, tokenTrue, tokenFalse, tokenNil, tokenSExpr:
+		value, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &LiteralPattern{Value: value, Posn: posFromToken(tok)}, nil
+	case tokenMinus:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.curr.Type != tokenNumber {
+			return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected number after - in pattern, found %s", p.curr.Type)
+		}
+		num, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		value := &UnaryExpr{Op: tokenMinus, Expr: num, Posn: posFromToken(tok)}
+		return &LiteralPattern{Value: value, Posn: posFromToken(tok)}, nil
+	case tokenLBracket, tokenVectorStart:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var elems []Pattern
+		rest := ""
+		for p.curr.Type != tokenRBracket {
+			if tok.Type == tokenLBracket && p.curr.Type == tokenIdentifier {
+				next, err := p.peek()
+				if err != nil {
+					return nil, err
+				}
+				if next.Type == tokenEllipsis {
+					nameTok := p.curr
+					if nameTok.Lexeme != discardIdent {
+						if err := p.bindPatternVar(nameTok, bound); err != nil {
+							return nil, err
+						}
+					}
+					if err := p.advance(); err != nil {
+						return nil, err
+					}
+					if _, err := p.expect(tokenEllipsis); err != nil {
+						return nil, err
+					}
+					if p.curr.Type != tokenRBracket {
+						return nil, p.unexpectedf(p.curr.Type == tokenEOF, "rest pattern must be last")
+					}
+					rest = nameTok.Lexeme
+					break
+				}
+			}
+			elem, err := p.parsePattern(bound)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+			if p.curr.Type != tokenComma {
+				break
+			}
+			if _, err := p.expect(tokenComma); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.expect(tokenRBracket); err != nil {
+			return nil, err
+		}
+		if tok.Type == tokenVectorStart {
+			return &VectorPattern{Elements: elems, Posn: posFromToken(tok)}, nil
+		}
+		return &ListPattern{Elements: elems, Rest: rest, Posn: posFromToken(tok)}, nil
+	default:
+		return nil, p.errorf(tok.Pos, tok.Type == tokenEOF, "unexpected token %s in pattern", tok.Type)
+	}
+}
+
+// bindPatternVar records the variable named by tok in bound, rejecting a
+// name the pattern already binds.
+func (p *parser) bindPatternVar(tok Token, bound map[string]bool) error {
+	if bound[tok.Lexeme] {
+		return p.errorf(tok.Pos, false, "duplicate variable %s in pattern", tok.Lexeme)
+	}
+	bound[tok.Lexeme] = true
+	return nil
+}
+
+// parseCondition parses the condition of an if or while. A lone '=' after
+// it is almost always a mistyped comparison, so it is reported as such
+// instead of as a missing '{'.
+func (p *parser) parseCondition(keyword string) (Expr, error) {
+	cond, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if p.curr.Type == tokenAssign {
+		return nil, p.errorf(p.curr.Pos, false, "assignment in %s condition; did you mean '=='?", keyword)
+	}
+	return cond, nil
+}
+
 func (p *parser) parseIfExpr() (Expr, error) {
 	ifTok, err := p.expect(tokenIf)
 	if err != nil {
 		return nil, err
 	}
-	cond, err := p.parseExpression()
+	cond, err := p.parseCondition("if")
 	if err != nil {
 		return nil, err
 	}
@@ -1109,7 +2253,7 @@ func (p *parser) parseExprBlock(context string) (Expr, error) {
 		}
 	}
 	if p.curr.Type != tokenRBrace {
-		return nil, p.errorf(p.curr.Pos, p.curr.Type == tokenEOF, "expected } to close %s expression block", context)
+		return nil, p.unexpectedf(p.curr.Type == tokenEOF, "expected } to close %s expression block", context)
 	}
 	if _, err := p.expect(tokenRBrace); err != nil {
 		return nil, err
@@ -1117,25 +2261,35 @@ func (p *parser) parseExprBlock(context string) (Expr, error) {
 	return expr, nil
 }
 
-func (p *parser) parseParamNames() ([]string, error) {
+// parseParamNames parses the parameters of a function up to the closing
+// parenthesis, returning the fixed ones and the name of a final rest
+// parameter written name..., if any.
+func (p *parser) parseParamNames() ([]string, string, error) {
 	var params []string
 	if p.curr.Type == tokenRParen {
-		return params, nil
+		return params, "", nil
 	}
 	for {
 		tok, err := p.expect(tokenIdentifier)
 		if err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		if p.curr.Type == tokenEllipsis {
+			p.expect(tokenEllipsis)
+			if p.curr.Type != tokenRParen {
+				return nil, "", p.unexpectedf(p.curr.Type == tokenEOF, "rest parameter must be last")
+			}
+			return params, tok.Lexeme, nil
 		}
 		params = append(params, tok.Lexeme)
 		if p.curr.Type != tokenComma {
 			break
 		}
 		if _, err := p.expect(tokenComma); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
-	return params, nil
+	return params, "", nil
 }
 
 func (p *parser) errorf(pos Position, incomplete bool, format string, args ...interface{}) error {
@@ -1146,6 +2300,23 @@ func (p *parser) errorf(pos Position, incomplete bool, format string, args ...in
 	return newErrorAt(pos, err)
 }
 
+// unexpectedf reports that the parser cannot accept the token at p.curr.
+// When that token is a semicolon inserted at the end of a line, a note
+// says why it was inserted, since the source shows no semicolon there.
+func (p *parser) unexpectedf(incomplete bool, format string, args ...interface{}) error {
+	if !incomplete && p.curr.Inserted {
+		next, peekErr := p.peek()
+		if peekErr == nil {
+			return &Error{
+				Err:  fmt.Errorf(format, args...),
+				Pos:  p.curr.Pos,
+				Note: InsertionReason(p.prev, next) + " inserted a ';' here",
+			}
+		}
+	}
+	return p.errorf(p.curr.Pos, incomplete, format, args...)
+}
+
 func posFromToken(tok Token) Position {
 	return tok.Pos
 }
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"math"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -313,6 +314,65 @@ func demo() {
 	}
 }
 
+func TestParseWhileExpressionWithBreakValue(t *testing.T) {
+	prog := parseProgramFromSource(t, "var found = while true { break 42 }\n")
+	decl, ok := prog.Decls[0].(*VarDecl)
+	if !ok {
+		t.Fatalf("expected VarDecl, got %T", prog.Decls[0])
+	}
+	loop, ok := decl.Init.(*WhileExpr)
+	if !ok {
+		t.Fatalf("expected WhileExpr initializer, got %T", decl.Init)
+	}
+	brk, ok := loop.Body.Stmts[0].(*BreakStmt)
+	if !ok {
+		t.Fatalf("expected break statement, got %T", loop.Body.Stmts[0])
+	}
+	if lit, ok := brk.Result.(*NumberExpr); !ok || lit.Value != "42" {
+		t.Fatalf("expected break result 42, got %#v", brk.Result)
+	}
+}
+
+func TestParseForStatement(t *testing.T) {
+	prog := parseProgramFromSource(t, "for k, v in m { if v { break } }\nfunc f(xs) { for x in xs { continue } }\n")
+	loop, ok := prog.Decls[0].(*ForStmt)
+	if !ok {
+		t.Fatalf("expected top-level ForStmt, got %T", prog.Decls[0])
+	}
+	if !reflect.DeepEqual(loop.Names, []string{"k", "v"}) {
+		t.Fatalf("expected loop variables k, v, got %v", loop.Names)
+	}
+	if iter, ok := loop.Iter.(*IdentifierExpr); !ok || iter.Name != "m" {
+		t.Fatalf("expected iteration over m, got %#v", loop.Iter)
+	}
+	fn := prog.Decls[1].(*FuncDecl)
+	inner, ok := fn.Body.Stmts[0].(*ForStmt)
+	if !ok {
+		t.Fatalf("expected ForStmt in function body, got %T", fn.Body.Stmts[0])
+	}
+	if !reflect.DeepEqual(inner.Names, []string{"x"}) {
+		t.Fatalf("expected loop variable x, got %v", inner.Names)
+	}
+	if _, ok := inner.Body.Stmts[0].(*ContinueStmt); !ok {
+		t.Fatalf("expected continue in loop body, got %T", inner.Body.Stmts[0])
+	}
+
+	// in stays an ordinary identifier elsewhere.
+	parseProgramFromSource(t, "var in = 1\nfor x in [in] { display(x) }\n")
+
+	for src, want := range map[string]string{
+		"for x of xs { }":       "expected in after for loop variables, found of",
+		"for x, y, z in xs { }": "expected in after for loop variables, found ,",
+		"for 1 in xs { }":       "expected identifier, found number",
+		"for x in xs = ys { }":  "assignment in for condition",
+		"for x in xs\n{ }":      "expected {",
+	} {
+		if _, err := Parse(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
 func TestParseBreakOutsideLoopError(t *testing.T) {
 	src := `
 func demo() {
@@ -335,6 +395,117 @@ func demo() {
 	}
 }
 
+func TestParseTopLevelReturnError(t *testing.T) {
+	const want = "return not allowed outside functions; remove it, or call exit to end the script early"
+	cases := map[string]string{
+		"var x = 1\nreturn x":         "line 2:1: " + want,
+		"return":                      "line 1:1: " + want,
+		"if true { return 1 }":        "line 1:11: " + want,
+		"while true {\n\treturn 2\n}": "line 2:2: " + want,
+		"break":                       "break not allowed outside loops",
+		"continue":                    "continue not allowed outside loops",
+		"defer f()":                   "defer not allowed outside functions",
+	}
+	for src, wantErr := range cases {
+		if _, err := Parse(src); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("%q: expected error %q, got %v", src, wantErr, err)
+		}
+	}
+	if _, err := Parse("var g = func() { if true { return 5 } }"); err != nil {
+		t.Fatalf("return in a function literal: %v", err)
+	}
+}
+
+func TestParseLoopExitsInFunctionLiteral(t *testing.T) {
+	cases := map[string]string{
+		"func demo(f) {\n\twhile true {\n\t\tf(func() { break })\n\t}\n}":              "line 3:14: break not allowed in a function inside a loop; return from the function and break in the loop",
+		"func demo(xs) {\n\tfor x in xs {\n\t\tvar skip = func() { continue }\n\t}\n}": "line 3:23: continue not allowed in a function inside a loop; return from the function and continue in the loop",
+		"var g = func() { break }": "break not allowed outside loops",
+	}
+	for src, want := range cases {
+		if _, err := Parse(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected error containing %q, got %v", src, want, err)
+		}
+	}
+
+	// A loop inside the function literal is the function's own.
+	src := `
+func demo(xs) {
+	while true {
+		map(func(x) {
+			while x > 0 {
+				if x == 3 { break }
+				x--
+			}
+		}, xs)
+		break
+	}
+}
+`
+	if _, err := Parse(src); err != nil {
+		t.Fatalf("loops inside function literals: %v", err)
+	}
+}
+
+func TestParseTupleAssignment(t *testing.T) {
+	src := `
+func f(v) {
+	a, v[0] = v[1], a
+	q, _ = divmod(7, 2)
+}
+`
+	prog, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := prog.Decls[0].(*FuncDecl).Body.Stmts
+	swap := body[0].(*TupleAssignStmt)
+	if len(swap.Targets) != 2 || len(swap.Exprs) != 2 {
+		t.Fatalf("swap: %d targets, %d values", len(swap.Targets), len(swap.Exprs))
+	}
+	if _, ok := swap.Targets[1].(*IndexExpr); !ok {
+		t.Fatalf("expected an indexed target, got %T", swap.Targets[1])
+	}
+	if values := body[1].(*TupleAssignStmt); len(values.Targets) != 2 || len(values.Exprs) != 1 {
+		t.Fatalf("values: %d targets, %d values", len(values.Targets), len(values.Exprs))
+	}
+}
+
+func TestParseVariadicFunctionsAndSpreadCalls(t *testing.T) {
+	src := `
+func sum(first, rest...) { return apply(add, first, rest) }
+var f = func(all...) { return sum(0, all...) }
+`
+	prog := parseProgramFromSource(t, src)
+	fn := prog.Decls[0].(*FuncDecl)
+	if len(fn.Params) != 1 || fn.Params[0] != "first" || fn.Rest != "rest" {
+		t.Fatalf("sum: params %v, rest %q", fn.Params, fn.Rest)
+	}
+	lambda := prog.Decls[1].(*VarDecl).Init.(*LambdaExpr)
+	if len(lambda.Params) != 0 || lambda.Rest != "all" {
+		t.Fatalf("lambda: params %v, rest %q", lambda.Params, lambda.Rest)
+	}
+	ret := lambda.Body.Stmts[0].(*ReturnStmt)
+	call := ret.Result.(*CallExpr)
+	if !call.Spread || len(call.Args) != 2 {
+		t.Fatalf("expected a spread call with 2 arguments, got %+v", call)
+	}
+
+	forms, err := ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"(lambda (first. rest)", "(lambda all", "(__gisp_apply sum 0 all)"} {
+		found := false
+		for _, form := range forms {
+			found = found || strings.Contains(form.String(), want)
+		}
+		if !found {
+			t.Fatalf("expected %s in %v", want, forms)
+		}
+	}
+}
+
 func TestLambdaExpression(t *testing.T) {
 	src := `
 var inc = func(x) {
@@ -648,6 +819,119 @@ func demo() {
 	}
 }
 
+func TestParseDestructureDecl(t *testing.T) {
+	prog := parseProgramFromSource(t, "var [a, b, more...] = xs\nconst [c] = ys\n")
+	if len(prog.Decls) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(prog.Decls))
+	}
+	d, ok := prog.Decls[0].(*DestructureDecl)
+	if !ok {
+		t.Fatalf("expected DestructureDecl, got %T", prog.Decls[0])
+	}
+	if strings.Join(d.Names, ",") != "a,b" || d.Rest != "more" || d.Const {
+		t.Fatalf("unexpected pattern: %+v", d)
+	}
+	c, ok := prog.Decls[1].(*DestructureDecl)
+	if !ok {
+		t.Fatalf("expected DestructureDecl, got %T", prog.Decls[1])
+	}
+	if len(c.Names) != 1 || c.Rest != "" || !c.Const {
+		t.Fatalf("unexpected const pattern: %+v", c)
+	}
+}
+
+func TestParseValuesDeclAndReturn(t *testing.T) {
+	prog := parseProgramFromSource(t, "var q, r = divmod(7, 2)\nfunc f() {\n\treturn 1, 2\n}\n")
+	d, ok := prog.Decls[0].(*DestructureDecl)
+	if !ok || !d.Values || strings.Join(d.Names, ",") != "q,r" {
+		t.Fatalf("expected values declaration of q and r, got %#v", prog.Decls[0])
+	}
+	fn := prog.Decls[1].(*FuncDecl)
+	ret, ok := fn.Body.Stmts[0].(*ReturnStmt)
+	if !ok {
+		t.Fatalf("expected return statement, got %#v", fn.Body.Stmts[0])
+	}
+	call, ok := ret.Result.(*CallExpr)
+	if !ok || call.Callee.(*IdentifierExpr).Name != "values" || len(call.Args) != 2 {
+		t.Fatalf("expected return of values(1, 2), got %#v", ret.Result)
+	}
+}
+
+func TestParseInfixDeclAndExpr(t *testing.T) {
+	prog := parseProgramFromSource(t, "infix union, dot 6\nvar x = a union b + c dot d\n")
+	if len(prog.Decls) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(prog.Decls))
+	}
+	decl, ok := prog.Decls[0].(*InfixDecl)
+	if !ok || strings.Join(decl.Names, ",") != "union,dot" || decl.Precedence != precFactor {
+		t.Fatalf("unexpected infix declaration %#v", prog.Decls[0])
+	}
+	forms := compileSource(t, "infix union, dot 6\nvar x = a union b + c dot d\n")
+	if len(forms) != 1 {
+		t.Fatalf("expected infix declaration to compile to nothing, got %d forms", len(forms))
+	}
+	got := toDatum(t, forms[0])
+	want := []interface{}{
+		sexprSymbol("define"), sexprSymbol("x"),
+		[]interface{}{
+			sexprSymbol("+"),
+			[]interface{}{sexprSymbol("union"), sexprSymbol("a"), sexprSymbol("b")},
+			[]interface{}{sexprSymbol("dot"), sexprSymbol("c"), sexprSymbol("d")},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected compiled form %#v", got)
+	}
+
+	forms = compileSource(t, "infix orElse 1\nvar y = a && b orElse c orElse d\n")
+	got = toDatum(t, forms[0])
+	want = []interface{}{
+		sexprSymbol("define"), sexprSymbol("y"),
+		[]interface{}{
+			sexprSymbol("orElse"),
+			[]interface{}{
+				sexprSymbol("orElse"),
+				[]interface{}{sexprSymbol("and"), sexprSymbol("a"), sexprSymbol("b")},
+				sexprSymbol("c"),
+			},
+			sexprSymbol("d"),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected low-precedence form %#v", got)
+	}
+
+	// Without a declaration the identifier is still an ordinary name.
+	forms = compileSource(t, "var infix = 1\ninfix(2)\n")
+	if len(forms) != 2 {
+		t.Fatalf("expected infix to remain usable as an identifier, got %d forms", len(forms))
+	}
+}
+
+func TestParsePipelineOperator(t *testing.T) {
+	forms := compileSource(t, "var r = x + 1 |> f |> g(2) |> func(v) { return v }\n")
+	if len(forms) != 1 {
+		t.Fatalf("expected single form, got %d", len(forms))
+	}
+	define := toDatum(t, forms[0]).([]interface{})
+	call := define[2].([]interface{})
+	inner := call[1].([]interface{})
+	want := []interface{}{
+		sexprSymbol("g"),
+		[]interface{}{
+			sexprSymbol("f"),
+			[]interface{}{sexprSymbol("+"), sexprSymbol("x"), int64(1)},
+		},
+		int64(2),
+	}
+	if !reflect.DeepEqual(inner, want) {
+		t.Fatalf("unexpected pipeline expansion %#v", inner)
+	}
+	if lambda, ok := call[0].([]interface{}); !ok || lambda[0] != sexprSymbol("lambda") {
+		t.Fatalf("expected lambda callee at end of pipeline, got %#v", call[0])
+	}
+}
+
 func TestElseMustFollowClosingBraceOnSameLine(t *testing.T) {
 	src := `
 func demo() {
@@ -1022,6 +1306,254 @@ default: 0;
 	}
 }
 
+func TestParseSubjectSwitch(t *testing.T) {
+	src := `
+var kind = switch c {
+case 'a', 'e': 1; fallthrough
+case ' ': 2
+	fallthrough
+default: 0
+}
+var any = switch { case a, b: 1 }
+`
+	prog := parseProgramFromSource(t, src)
+	sw := prog.Decls[0].(*VarDecl).Init.(*SwitchExpr)
+	if sw.Subject == nil || len(sw.Clauses) != 2 || sw.Default == nil {
+		t.Fatalf("expected subject switch with two cases and a default, got %#v", sw)
+	}
+	if c := sw.Clauses[0]; len(c.Values) != 2 || c.Cond != nil || !c.Fallthrough {
+		t.Fatalf("expected two values falling through, got %#v", c)
+	}
+	if c := sw.Clauses[1]; len(c.Values) != 1 || !c.Fallthrough {
+		t.Fatalf("expected one value falling through, got %#v", c)
+	}
+	tagless := prog.Decls[1].(*VarDecl).Init.(*SwitchExpr)
+	if cond, ok := tagless.Clauses[0].Cond.(*BinaryExpr); !ok || cond.Op != tokenOrOr {
+		t.Fatalf("expected conditions joined with ||, got %#v", tagless.Clauses[0].Cond)
+	}
+
+	for src, want := range map[string]string{
+		"switch x { case 1: 2; fallthrough }":              "cannot fallthrough final case in switch",
+		"switch x { case 1: 2; fallthrough; fallthrough }": "cannot fallthrough final case in switch",
+		"switch x = 1 { case 1: 2 }":                       "assignment in switch condition",
+	} {
+		if _, err := Parse(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseSelectExpr(t *testing.T) {
+	src := `
+var got = select {
+case v = receive(in): v
+case receive(quit): nil
+case send(out, 1): true
+default: false
+}
+`
+	prog := parseProgramFromSource(t, src)
+	decl, ok := prog.Decls[0].(*VarDecl)
+	if !ok {
+		t.Fatalf("expected VarDecl, got %T", prog.Decls[0])
+	}
+	sel, ok := decl.Init.(*SelectExpr)
+	if !ok {
+		t.Fatalf("expected SelectExpr initializer, got %#v", decl.Init)
+	}
+	if len(sel.Clauses) != 3 || sel.Default == nil {
+		t.Fatalf("expected 3 cases and a default, got %#v", sel)
+	}
+	if c := sel.Clauses[0]; c.Name != "v" || c.Value != nil {
+		t.Fatalf("expected receive bound to v, got %#v", c)
+	}
+	if c := sel.Clauses[1]; c.Name != "" || c.Value != nil {
+		t.Fatalf("expected unbound receive, got %#v", c)
+	}
+	if c := sel.Clauses[2]; c.Name != "" || c.Value == nil {
+		t.Fatalf("expected send, got %#v", c)
+	}
+
+	for src, want := range map[string]string{
+		"select { case f(ch): 1 }":                   "select case must be receive(ch) or send(ch, x)",
+		"select { case receive(a, b): 1 }":           "select case must be receive(ch) or send(ch, x)",
+		"select { case x = send(ch, 1): 1 }":         "send in select has no value to assign to x",
+		"select { default: 1; case receive(ch): 2 }": "case clause cannot follow default in select",
+		"select { }":     "select requires at least one case",
+		"var select = 1": "expected identifier",
+	} {
+		if _, err := Parse(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseMatchExpr(t *testing.T) {
+	src := `
+var r = match e {
+case [op, a, rest...] if op == 1: a
+case #[x, _]: x
+case -2: nil
+case _: 0
+}
+var m = match(1) + match
+`
+	prog := parseProgramFromSource(t, src)
+	decl := prog.Decls[0].(*VarDecl)
+	m, ok := decl.Init.(*MatchExpr)
+	if !ok {
+		t.Fatalf("expected MatchExpr initializer, got %#v", decl.Init)
+	}
+	if len(m.Clauses) != 4 {
+		t.Fatalf("expected 4 cases, got %d", len(m.Clauses))
+	}
+	list, ok := m.Clauses[0].Pattern.(*ListPattern)
+	if !ok || len(list.Elements) != 2 || list.Rest != "rest" || m.Clauses[0].Guard == nil {
+		t.Fatalf("expected guarded list pattern with rest, got %#v", m.Clauses[0])
+	}
+	if vec, ok := m.Clauses[1].Pattern.(*VectorPattern); !ok || len(vec.Elements) != 2 {
+		t.Fatalf("expected vector pattern, got %#v", m.Clauses[1].Pattern)
+	}
+	if _, ok := m.Clauses[2].Pattern.(*LiteralPattern); !ok {
+		t.Fatalf("expected literal pattern, got %#v", m.Clauses[2].Pattern)
+	}
+	if _, ok := m.Clauses[3].Pattern.(*WildcardPattern); !ok {
+		t.Fatalf("expected wildcard pattern, got %#v", m.Clauses[3].Pattern)
+	}
+	if _, ok := prog.Decls[1].(*VarDecl).Init.(*BinaryExpr); !ok {
+		t.Fatalf("expected match used as a name, got %#v", prog.Decls[1].(*VarDecl).Init)
+	}
+
+	for src, want := range map[string]string{
+		"match x { case [a, a]: 1 }":        "duplicate variable a in pattern",
+		"match x { case [r..., a]: 1 }":     "rest pattern must be last",
+		"match x { case #[r...]: 1 }":       "expected ], found ...",
+		"match x { case f(y): 1 }":          "expected :, found (",
+		"match x { case 1: 2; default: 3 }": "unexpected token default in match",
+	} {
+		if _, err := Parse(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseTryStmt(t *testing.T) {
+	src := `
+func f() {
+	try {
+		g()
+	} catch (err) {
+		display(err)
+	} finally {
+		done()
+	}
+}
+try { g() } finally { done() }
+`
+	prog := parseProgramFromSource(t, src)
+	if len(prog.Decls) != 2 {
+		t.Fatalf("expected two declarations, got %d", len(prog.Decls))
+	}
+	fn, ok := prog.Decls[0].(*FuncDecl)
+	if !ok || len(fn.Body.Stmts) != 1 {
+		t.Fatalf("expected function with one statement, got %#v", prog.Decls[0])
+	}
+	try, ok := fn.Body.Stmts[0].(*TryStmt)
+	if !ok {
+		t.Fatalf("expected TryStmt, got %T", fn.Body.Stmts[0])
+	}
+	if try.CatchName != "err" || try.Catch == nil || try.Finally == nil {
+		t.Fatalf("unexpected try statement %#v", try)
+	}
+	top, ok := prog.Decls[1].(*TryStmt)
+	if !ok {
+		t.Fatalf("expected top-level TryStmt, got %T", prog.Decls[1])
+	}
+	if top.Catch != nil || top.Finally == nil {
+		t.Fatalf("expected try with finally only, got %#v", top)
+	}
+
+	forms := compileSource(t, "try { g() } catch (_) { h() } finally { done() }\n")
+	if len(forms) != 1 {
+		t.Fatalf("expected single form, got %d", len(forms))
+	}
+	form := toDatum(t, forms[0])
+	if !containsHead(form, "unwind-protect") || !containsHead(form, "catch") {
+		t.Fatalf("expected unwind-protect around catch, got %#v", form)
+	}
+	if !containsSymbolPrefix(form, "__gisp_discard_") {
+		t.Fatalf("expected generated name for discarded error, got %#v", form)
+	}
+}
+
+func TestParseImportDecl(t *testing.T) {
+	prog := parseProgramFromSource(t, `
+import "lib/geometry"
+import m "math.gisp"
+`)
+	if len(prog.Decls) != 2 {
+		t.Fatalf("expected two declarations, got %d", len(prog.Decls))
+	}
+	for i, want := range []ImportDecl{{Name: "geometry", Path: "lib/geometry"}, {Name: "m", Path: "math.gisp"}} {
+		decl, ok := prog.Decls[i].(*ImportDecl)
+		if !ok || decl.Name != want.Name || decl.Path != want.Path {
+			t.Fatalf("declaration %d: expected import %s %q, got %#v", i, want.Name, want.Path, prog.Decls[i])
+		}
+	}
+
+	forms := compileSource(t, "import \"lib/geometry\"\n")
+	if got := forms[0].String(); got != `(import "lib/geometry" (quote geometry))` {
+		t.Fatalf("unexpected import form %s", got)
+	}
+}
+
+func TestParseStructDecl(t *testing.T) {
+	prog := parseProgramFromSource(t, `
+struct point { x, y }
+struct line {
+	from
+	to
+}
+`)
+	for i, want := range []StructDecl{{Name: "point", Fields: []string{"x", "y"}}, {Name: "line", Fields: []string{"from", "to"}}} {
+		decl, ok := prog.Decls[i].(*StructDecl)
+		if !ok || decl.Name != want.Name || strings.Join(decl.Fields, ",") != strings.Join(want.Fields, ",") {
+			t.Fatalf("declaration %d: expected struct %s %v, got %#v", i, want.Name, want.Fields, prog.Decls[i])
+		}
+	}
+
+	forms := compileSource(t, `
+struct point { x, y }
+var d = l.from.x - p.x
+l.to.y = 3
+p.x += d
+p.y--
+m.f(1)
+var e = ps[0].x + mk().from.x
+ps[i].pos.x = 1
+ps[i].x += 1
+`)
+	want := []string{
+		"(defineStruct (quote point) (quote (x y)))",
+		"(define d (- (getField (getField l (quote from)) (quote x)) (getField p (quote x))))",
+		"(setField (getField l (quote to)) (quote y) 3)",
+		"(setField p (quote x) (+ (getField p (quote x)) d))",
+		"(setField p (quote y) (- (getField p (quote y)) 1))",
+		"((getField m (quote f)) 1)",
+		"(define e (+ (getField (ref ps 0) (quote x)) (getField (getField (mk) (quote from)) (quote x))))",
+		"(setField (getField (ref ps i) (quote pos)) (quote x) 1)",
+		"(let ((__gisp_obj_1 (ref ps i))) (setField __gisp_obj_1 (quote x) (+ (getField __gisp_obj_1 (quote x)) 1)))",
+	}
+	if len(forms) != len(want) {
+		t.Fatalf("expected %d forms, got %d", len(want), len(forms))
+	}
+	for i, form := range forms {
+		if got := form.String(); got != want[i] {
+			t.Fatalf("form %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
 func TestParseErrors(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -1061,6 +1593,96 @@ var value = switch {
 			src:     "var bad = #[1, 2\n",
 			wantErr: "expected ]",
 		},
+		{
+			name:    "infix precedence out of range",
+			src:     "infix dot 7",
+			wantErr: "infix precedence must be an integer from 1 to 6",
+		},
+		{
+			name:    "infix missing precedence",
+			src:     "infix dot;",
+			wantErr: "expected number",
+		},
+		{
+			name:    "undeclared infix operator",
+			src:     "var x = a dot b;",
+			wantErr: "expected ;",
+		},
+		{
+			name:    "destructure rest not last",
+			src:     "var [a..., b] = x;",
+			wantErr: "rest binding must be last in destructuring pattern",
+		},
+		{
+			name:    "destructure empty pattern",
+			src:     "var [] = x;",
+			wantErr: "destructuring pattern requires at least one name",
+		},
+		{
+			name:    "try without catch or finally",
+			src:     "try { f() }\nx = 1",
+			wantErr: "expected catch or finally after try block",
+		},
+		{
+			name:    "import inside function",
+			src:     "func f() {\n\timport \"lib\"\n}",
+			wantErr: "import is only allowed at top level",
+		},
+		{
+			name:    "duplicate struct field",
+			src:     "struct point { x, y, x }",
+			wantErr: "duplicate field x in struct point",
+		},
+		{
+			name:    "compound assignment to index",
+			src:     "v[0] += 1",
+			wantErr: "assignment targets must be identifiers or fields",
+		},
+		{
+			name:    "import path without a name",
+			src:     "import \"my-lib\"",
+			wantErr: `cannot name module "my-lib" after its path`,
+		},
+		{
+			name:    "catch without name",
+			src:     "try { f() } catch { g() }",
+			wantErr: "expected (",
+		},
+		{
+			name:    "rest parameter not last",
+			src:     "func f(a..., b) { }",
+			wantErr: "rest parameter must be last",
+		},
+		{
+			name:    "spread argument not last",
+			src:     "f(xs..., 1)",
+			wantErr: "spread argument must be last",
+		},
+		{
+			name:    "defer without call",
+			src:     "func f(x) {\n\tdefer x\n}",
+			wantErr: "defer expects a function call",
+		},
+		{
+			name:    "defer outside function",
+			src:     "try { defer f() } finally { g() }",
+			wantErr: "defer not allowed outside functions",
+		},
+		{
+			name:    "tuple assignment mismatch",
+			src:     "a, b = 1, 2, 3",
+			wantErr: "assignment mismatch: 2 targets but 3 values",
+		},
+		{
+			name:    "values declaration mismatch",
+			src:     "var a, b, c = 1, 2",
+			wantErr: "assignment mismatch: 3 variables but 2 values",
+		},
+		{
+			name:    "compound tuple assignment",
+			src:     "a, b += 1",
+			wantErr: "expected =",
+		},
 	}
 
 	for _, tc := range cases {
@@ -1185,8 +1807,8 @@ func TestCompileExpressionForms(t *testing.T) {
 					t.Fatalf("expected not head, got %#v", list)
 				}
 				inner, ok := list[1].([]interface{})
-				if !ok || getHead(inner) != "=" {
-					t.Fatalf("expected inner = list, got %#v", list[1])
+				if !ok || getHead(inner) != "==" {
+					t.Fatalf("expected inner == list, got %#v", list[1])
 				}
 				if left, ok := inner[1].(int64); !ok || left != 1 {
 					t.Fatalf("expected left operand 1, got %#v", inner[1])
@@ -1452,3 +2074,39 @@ func TestParseNumber(t *testing.T) {
 		})
 	}
 }
+
+// TestMultilineLiterals covers list and vector literals that span lines
+// inside blocks and around lambdas, where a line break must not end the
+// enclosing statement. Each source must compile as it does on one line.
+func TestMultilineLiterals(t *testing.T) {
+	cases := []struct {
+		name    string
+		src     string
+		oneLine string
+	}{
+		{"TopLevelVector", "var v = #[\n 1,\n 2\n]", "var v = #[1, 2]"},
+		{"VectorInBlock", "func f() {\n\tvar v = #[\n\t\t1,\n\t\t2\n\t]\n\treturn v\n}",
+			"func f() { var v = #[1, 2]; return v }"},
+		{"ListInBlock", "func f() {\n\treturn [\n\t\t1, 2,\n\t\t3\n\t]\n}", "func f() { return [1, 2, 3] }"},
+		{"LambdaInList", "var fs = [\n\tfunc(x) {\n\t\treturn x\n\t},\n\tfunc(x) { x }\n]",
+			"var fs = [func(x) { return x }, func(x) { x }]"},
+		{"LambdaBeforeElement", "func f() {\n\treturn [func() { 1 }\n\t\t, 2]\n}", "func f() { return [func() { 1 }, 2] }"},
+		{"ClauseTable", "func f() {\n\tvar clauses = [\n\t\t[[0], func(env) {\n\t\t\treturn [1]\n\t\t}],\n\t\t[[1], func(env) { [2] }]\n\t]\n\treturn clauses\n}",
+			"func f() { var clauses = [[[0], func(env) { return [1] }], [[1], func(env) { [2] }]]; return clauses }"},
+		{"CallArgsInLambda", "var g = func() {\n\treturn max(\n\t\t1,\n\t\t2\n\t)\n}", "var g = func() { return max(1, 2) }"},
+	}
+	compiled := func(src string) string {
+		var forms []string
+		for _, form := range compileSource(t, src) {
+			forms = append(forms, form.String())
+		}
+		return strings.Join(forms, "\n")
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := compiled(tc.src), compiled(tc.oneLine); got != want {
+				t.Fatalf("compiled %q\n got: %s\nwant: %s", tc.src, got, want)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package parser
 
+import "strconv"
+
 // TokenType enumerates lexical categories recognised by the Gisp lexer.
 type TokenType int
 
@@ -10,6 +12,7 @@ const (
 	tokenIdentifier
 	tokenNumber
 	tokenString
+	tokenChar
 	tokenSExpr
 
 	// Keywords
@@ -19,12 +22,19 @@ const (
 	tokenIf
 	tokenElse
 	tokenWhile
+	tokenFor
 	tokenBreak
 	tokenContinue
 	tokenSwitch
+	tokenSelect
 	tokenCase
 	tokenDefault
 	tokenReturn
+	tokenDefer
+	tokenTry
+	tokenCatch
+	tokenFinally
+	tokenImport
 	tokenTrue
 	tokenFalse
 	tokenNil
@@ -64,10 +74,13 @@ const (
 	tokenBang                 // !
 	tokenAndAnd               // &&
 	tokenOrOr                 // ||
+	tokenPipeline             // |>
 
 	tokenComma       // ,
 	tokenSemicolon   // ;
 	tokenColon       // :
+	tokenEllipsis    // ...
+	tokenDot         // .
 	tokenLParen      // (
 	tokenRParen      // )
 	tokenVectorStart // #[
@@ -89,6 +102,8 @@ func (tt TokenType) String() string {
 		return "number"
 	case tokenString:
 		return "string"
+	case tokenChar:
+		return "char"
 	case tokenSExpr:
 		return "sexpr"
 	case tokenFunc:
@@ -103,18 +118,32 @@ func (tt TokenType) String() string {
 		return "else"
 	case tokenWhile:
 		return "while"
+	case tokenFor:
+		return "for"
 	case tokenBreak:
 		return "break"
 	case tokenContinue:
 		return "continue"
 	case tokenSwitch:
 		return "switch"
+	case tokenSelect:
+		return "select"
 	case tokenCase:
 		return "case"
 	case tokenDefault:
 		return "default"
 	case tokenReturn:
 		return "return"
+	case tokenDefer:
+		return "defer"
+	case tokenTry:
+		return "try"
+	case tokenCatch:
+		return "catch"
+	case tokenFinally:
+		return "finally"
+	case tokenImport:
+		return "import"
 	case tokenTrue:
 		return "true"
 	case tokenFalse:
@@ -189,12 +218,18 @@ func (tt TokenType) String() string {
 		return "&&"
 	case tokenOrOr:
 		return "||"
+	case tokenPipeline:
+		return "|>"
 	case tokenComma:
 		return ","
 	case tokenSemicolon:
 		return ";"
 	case tokenColon:
 		return ":"
+	case tokenEllipsis:
+		return "..."
+	case tokenDot:
+		return "."
 	case tokenLParen:
 		return "("
 	case tokenRParen:
@@ -216,8 +251,25 @@ func (tt TokenType) String() string {
 
 // Token is a single lexical unit produced by the lexer.
 type Token struct {
-	Type   TokenType
-	Lexeme string      // raw lexeme when useful (identifiers, numbers)
-	Value  interface{} // decoded literal value for strings and s-expr literals
-	Pos    Position
+	Type     TokenType
+	Lexeme   string      // raw lexeme when useful (identifiers, numbers)
+	Value    interface{} // decoded literal value for strings and s-expr literals
+	Pos      Position
+	Inserted bool // a semicolon added by automatic semicolon insertion
+}
+
+// Text returns the token as it would be written in source: the lexeme of
+// an identifier or number, a quoted string literal, or the spelling of a
+// keyword or operator.
+func (t Token) Text() string {
+	if t.Lexeme != "" {
+		return t.Lexeme
+	}
+	if s, ok := t.Value.(string); ok && t.Type == tokenString {
+		return strconv.Quote(s)
+	}
+	if r, ok := t.Value.(rune); ok && t.Type == tokenChar {
+		return strconv.QuoteRune(r)
+	}
+	return t.Type.String()
 }
@@ -0,0 +1,506 @@
+// Package repl implements the interactive read-eval-print loop of the gisp
+// command, so that programs embedding Gisp can offer a console of their own.
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterh/liner"
+	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/parser"
+	"github.com/sergev/gisp/sexpr"
+)
+
+// Dialect selects the syntax the REPL reads.
+type Dialect int
+
+const (
+	// Gisp reads the Go-style surface syntax.
+	Gisp Dialect = iota
+	// Scheme reads s-expressions.
+	Scheme
+)
+
+// Options configures a REPL. The zero value reads Gisp from standard input
+// without line editing, prints to standard output and standard error, and
+// keeps no history.
+type Options struct {
+	// Prompt is shown before each entry and ContinuationPrompt before each
+	// further line of an unfinished one. With line editing they default to
+	// "gisp> " and ".... "; without it an empty prompt is not shown, so
+	// piped input produces only results.
+	Prompt             string
+	ContinuationPrompt string
+	Dialect            Dialect
+	// HistoryPath names the file entries are loaded from and saved to when
+	// line editing is on; empty keeps no history.
+	HistoryPath string
+	// Printer writes the value of an entry; nil writes its external
+	// representation and a newline.
+	Printer func(w io.Writer, v lang.Value)
+	// Input, Output and ErrorOutput default to the standard streams.
+	// Results go to Output; errors and notices go to ErrorOutput.
+	Input       io.Reader
+	Output      io.Writer
+	ErrorOutput io.Writer
+	// LineEditing edits lines and recalls history with the terminal
+	// when Input is left at standard input and that is a terminal.
+	LineEditing bool
+	// SoftTimeout is how long an entry may run before the REPL reminds
+	// the user that Ctrl-C interrupts it; zero disables the reminder.
+	SoftTimeout time.Duration
+	// Precision is the number of significant digits results show reals
+	// with, until ":precision" changes it; zero shows the shortest form
+	// that reads back as the same number.
+	Precision int
+}
+
+// Run reads entries and evaluates them in ev until the input ends. Each
+// entry is a complete declaration, statement or expression; a line that
+// leaves one unfinished makes the REPL wait for more. While an entry runs,
+// an interrupt signal (Ctrl-C) stops it through ev.Interrupt and returns to
+// the prompt. Run returns an error only when reading the input fails.
+func Run(ev *lang.Evaluator, opts Options) error {
+	s := &session{ev: ev, opts: opts, out: opts.Output, errOut: opts.ErrorOutput, precision: opts.Precision}
+	if s.out == nil {
+		s.out = os.Stdout
+	}
+	if s.errOut == nil {
+		s.errOut = os.Stderr
+	}
+	if opts.Input == nil && opts.LineEditing && isTerminal(os.Stdin) {
+		return s.runInteractive()
+	}
+	in := opts.Input
+	if in == nil {
+		in = os.Stdin
+	}
+	return s.runBuffered(bufio.NewReader(in))
+}
+
+// session is the state of one Run.
+type session struct {
+	ev     *lang.Evaluator
+	opts   Options
+	out    io.Writer
+	errOut io.Writer
+	// timing is set by ":time on"; evalAndPrint then reports how long
+	// each form took and what it allocated.
+	timing bool
+	// precision is the number of significant digits set by ":precision",
+	// or zero for the shortest form of each real.
+	precision int
+}
+
+func (s *session) parse(src string) ([]lang.Value, error) {
+	if s.opts.Dialect == Scheme {
+		return sexpr.ReadString(src)
+	}
+	return parser.ParseString(src)
+}
+
+// isIncomplete reports whether err means that src ended in the middle of
+// an entry.
+func (s *session) isIncomplete(err error) bool {
+	if s.opts.Dialect == Scheme {
+		return errors.Is(err, io.EOF) || strings.HasPrefix(err.Error(), "unterminated ")
+	}
+	return parser.IsIncomplete(err)
+}
+
+// echoes reports whether the values of the entry src are printed. A Gisp
+// entry ending in an explicit semicolon is evaluated silently.
+func (s *session) echoes(src string) bool {
+	return s.opts.Dialect == Scheme || !parser.EndsWithSemicolon(src)
+}
+
+// command runs line if it is one of the REPL commands other than :paste
+// and reports whether it was.
+func (s *session) command(line string) bool {
+	if code, ok := commandArgument(line, expandCommand); ok {
+		s.runExpand(code)
+		return true
+	}
+	if code, ok := commandArgument(line, mexpandCommand); ok {
+		s.runMexpand(code)
+		return true
+	}
+	if arg, ok := commandArgument(line, timeCommand); ok {
+		s.runTime(arg)
+		return true
+	}
+	if arg, ok := commandArgument(line, precisionCommand); ok {
+		s.runPrecision(arg)
+		return true
+	}
+	return false
+}
+
+func (s *session) runBuffered(reader *bufio.Reader) error {
+	var buffer strings.Builder
+
+	for {
+		prompt := s.opts.Prompt
+		if buffer.Len() > 0 {
+			prompt = s.opts.ContinuationPrompt
+		}
+		fmt.Fprint(s.out, prompt)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if buffer.Len() == 0 && line == "" {
+					return nil
+				}
+			} else {
+				return fmt.Errorf("read error: %w", err)
+			}
+		}
+		if buffer.Len() == 0 && s.command(line) {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			continue
+		}
+		buffer.WriteString(line)
+		src := buffer.String()
+		forms, parseErr := s.parse(src)
+		if parseErr != nil {
+			if s.isIncomplete(parseErr) && !errors.Is(err, io.EOF) {
+				continue
+			}
+			fmt.Fprintf(s.errOut, "parse error: %v\n", parseErr)
+			buffer.Reset()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			continue
+		}
+		buffer.Reset()
+		s.evalAndPrint(forms, s.echoes(src))
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+func (s *session) runInteractive() error {
+	state := liner.NewLiner()
+	defer state.Close()
+	state.SetCtrlCAborts(true)
+	state.SetMultiLineMode(true)
+
+	if path := s.opts.HistoryPath; path != "" {
+		if f, err := os.Open(path); err == nil {
+			state.ReadHistory(f)
+			f.Close()
+		}
+		defer func() {
+			os.MkdirAll(filepath.Dir(path), 0o755)
+			if f, err := os.Create(path); err == nil {
+				state.WriteHistory(f)
+				f.Close()
+			}
+		}()
+	}
+	mainPrompt, morePrompt := s.opts.Prompt, s.opts.ContinuationPrompt
+	if mainPrompt == "" {
+		mainPrompt = "gisp> "
+	}
+	if morePrompt == "" {
+		morePrompt = ".... "
+	}
+
+	var buffer strings.Builder
+
+	for {
+		prompt := mainPrompt
+		if buffer.Len() > 0 {
+			prompt = morePrompt
+		}
+		input, err := state.Prompt(prompt)
+		if err != nil {
+			switch {
+			case errors.Is(err, liner.ErrPromptAborted):
+				fmt.Fprintln(s.out)
+				buffer.Reset()
+				continue
+			case errors.Is(err, io.EOF):
+				fmt.Fprintln(s.out)
+				return nil
+			default:
+				return fmt.Errorf("read error: %w", err)
+			}
+		}
+		input = decodeHistoryEntry(input)
+		if buffer.Len() == 0 && strings.TrimSpace(input) == pasteCommand {
+			fmt.Fprintf(s.out, "// entering paste mode; finish with %s or Ctrl-D\n", pasteEndMarker)
+			src, pasteErr := collectPaste(func() (string, error) {
+				return state.Prompt("")
+			})
+			if pasteErr != nil {
+				if errors.Is(pasteErr, liner.ErrPromptAborted) {
+					fmt.Fprintln(s.out)
+					continue
+				}
+				return fmt.Errorf("read error: %w", pasteErr)
+			}
+			forms, parseErr := s.parse(src)
+			if parseErr != nil {
+				fmt.Fprintf(s.errOut, "parse error: %v\n", parseErr)
+				continue
+			}
+			if trimmed := strings.TrimSpace(src); trimmed != "" {
+				state.AppendHistory(encodeHistoryEntry(trimmed))
+			}
+			s.evalAndPrint(forms, s.echoes(src))
+			continue
+		}
+		if buffer.Len() == 0 && s.command(input) {
+			state.AppendHistory(encodeHistoryEntry(strings.TrimSpace(input)))
+			continue
+		}
+		buffer.WriteString(input)
+		buffer.WriteString("\n")
+
+		src := buffer.String()
+		forms, parseErr := s.parse(src)
+		if parseErr != nil {
+			if s.isIncomplete(parseErr) {
+				continue
+			}
+			fmt.Fprintf(s.errOut, "parse error: %v\n", parseErr)
+			buffer.Reset()
+			continue
+		}
+
+		buffer.Reset()
+		if trimmed := strings.TrimSpace(src); trimmed != "" {
+			state.AppendHistory(encodeHistoryEntry(trimmed))
+		}
+		s.evalAndPrint(forms, s.echoes(src))
+	}
+}
+
+const (
+	pasteCommand     = ":paste"
+	pasteEndMarker   = ":end"
+	expandCommand    = ":expand"
+	mexpandCommand   = ":mexpand"
+	timeCommand      = ":time"
+	precisionCommand = ":precision"
+)
+
+// commandArgument returns the text following command, if line invokes it.
+func commandArgument(line, command string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed != command && !strings.HasPrefix(trimmed, command+" ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(trimmed, command)), true
+}
+
+// runTime handles ":time on" and ":time off"; a bare ":time" reports the
+// current setting.
+func (s *session) runTime(arg string) {
+	switch arg {
+	case "on":
+		s.timing = true
+	case "off":
+		s.timing = false
+	case "":
+	default:
+		fmt.Fprintf(s.errOut, "usage: %s on|off\n", timeCommand)
+		return
+	}
+	state := "off"
+	if s.timing {
+		state = "on"
+	}
+	fmt.Fprintf(s.out, "// timing is %s\n", state)
+}
+
+// runPrecision handles ":precision n", which shows reals in results with
+// n significant digits, and ":precision off", which goes back to the
+// shortest form; a bare ":precision" reports the current setting.
+func (s *session) runPrecision(arg string) {
+	switch arg {
+	case "off":
+		s.precision = 0
+	case "":
+	default:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > 17 {
+			fmt.Fprintf(s.errOut, "usage: %s 1..17|off\n", precisionCommand)
+			return
+		}
+		s.precision = n
+	}
+	if s.precision == 0 {
+		fmt.Fprintln(s.out, "// precision is shortest")
+		return
+	}
+	fmt.Fprintf(s.out, "// precision is %d digits\n", s.precision)
+}
+
+// formatTiming describes the cost of evaluating one form.
+func formatTiming(elapsed time.Duration, allocs, bytes uint64) string {
+	if elapsed >= time.Microsecond {
+		elapsed = elapsed.Round(time.Microsecond)
+	}
+	return fmt.Sprintf("// %v, %d allocations, %d bytes", elapsed, allocs, bytes)
+}
+
+// runExpand prints the compiled forms of src without evaluating them.
+func (s *session) runExpand(src string) {
+	forms, err := s.parse(src)
+	if err != nil {
+		fmt.Fprintf(s.errOut, "parse error: %v\n", err)
+		return
+	}
+	printForms(s.out, forms)
+}
+
+// runMexpand compiles src and prints, for each resulting form, the form and
+// every successive macro expansion of it, one per line. Forms are separated
+// by a blank line.
+func (s *session) runMexpand(src string) {
+	forms, err := s.parse(src)
+	if err != nil {
+		fmt.Fprintf(s.errOut, "parse error: %v\n", err)
+		return
+	}
+	for i, form := range forms {
+		steps, err := s.ev.MacroexpandSteps(form, nil)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "error: %v\n", err)
+			return
+		}
+		if i > 0 {
+			fmt.Fprintln(s.out)
+		}
+		printForms(s.out, steps)
+	}
+}
+
+func printForms(w io.Writer, forms []lang.Value) {
+	for _, form := range forms {
+		fmt.Fprintln(w, sexpr.Format(form, sexpr.DefaultWidth))
+	}
+}
+
+// collectPaste gathers lines from next until the paste end marker or EOF,
+// so that blank lines inside a pasted function do not trigger evaluation
+// of a partial form.
+func collectPaste(next func() (string, error)) (string, error) {
+	var buffer strings.Builder
+	for {
+		line, err := next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return buffer.String(), nil
+			}
+			return "", err
+		}
+		if strings.TrimSpace(line) == pasteEndMarker {
+			return buffer.String(), nil
+		}
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+	}
+}
+
+// evalAndPrint evaluates forms in order, printing each result when echo is
+// set. Pressing Ctrl-C meanwhile stops the running form and returns to the
+// prompt; definitions made before it are kept. With :time on, the cost of
+// each form follows it.
+func (s *session) evalAndPrint(forms []lang.Value, echo bool) {
+	stop := interruptOnSignal(s.ev)
+	defer stop()
+	for _, expr := range forms {
+		var before, after goruntime.MemStats
+		if s.timing {
+			goruntime.ReadMemStats(&before)
+		}
+		stopNotice := startSlowNotice(s.errOut, s.opts.SoftTimeout)
+		start := time.Now()
+		val, evalErr := s.ev.Eval(expr, nil)
+		elapsed := time.Since(start)
+		stopNotice()
+		if evalErr != nil {
+			fmt.Fprintf(s.errOut, "error: %v\n", evalErr)
+		} else if echo {
+			s.print(val)
+		}
+		if s.timing {
+			goruntime.ReadMemStats(&after)
+			fmt.Fprintln(s.errOut, formatTiming(elapsed, after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc))
+		}
+		if evalErr != nil {
+			break
+		}
+	}
+}
+
+func (s *session) print(val lang.Value) {
+	if s.opts.Printer != nil {
+		s.opts.Printer(s.out, val)
+		return
+	}
+	fmt.Fprintln(s.out, val.StringPrecision(s.precision))
+}
+
+// startSlowNotice prints a reminder to w if the returned stop function is
+// not called within after.
+func startSlowNotice(w io.Writer, after time.Duration) (stop func()) {
+	if after <= 0 {
+		return func() {}
+	}
+	timer := time.AfterFunc(after, func() {
+		fmt.Fprintf(w, "still running after %v… press Ctrl-C to abort\n", after)
+	})
+	return func() { timer.Stop() }
+}
+
+// interruptOnSignal forwards SIGINT to ev.Interrupt until the returned
+// function is called.
+func interruptOnSignal(ev *lang.Evaluator) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				ev.Interrupt()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// historyNewline stands in for line breaks inside a history entry, so that a
+// multi-line definition is stored, recalled and edited as one logical entry.
+const historyNewline = "\u2424"
+
+func encodeHistoryEntry(src string) string {
+	return strings.ReplaceAll(src, "\n", historyNewline)
+}
+
+func decodeHistoryEntry(line string) string {
+	return strings.ReplaceAll(line, historyNewline, "\n")
+}
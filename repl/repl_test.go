@@ -0,0 +1,203 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/parser"
+	"github.com/sergev/gisp/runtime"
+)
+
+func TestRunGisp(t *testing.T) {
+	var out, errOut strings.Builder
+	in := strings.NewReader("var x = 40;\nfunc add(n) {\n  return x + n\n}\nadd(2)\nx +\n1\nundefinedThing\n:time\n[x, 1]")
+	err := Run(runtime.NewEvaluator(), Options{
+		Prompt:             "> ",
+		ContinuationPrompt: "| ",
+		Input:              in,
+		Output:             &out,
+		ErrorOutput:        &errOut,
+	})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	want := "> > | | <closure>\n> 42\n> | 41\n> > // timing is off\n> (40 1)\n"
+	if got := out.String(); got != want {
+		t.Fatalf("output %q, want %q", got, want)
+	}
+	if got := errOut.String(); got != "error: unbound variable: undefinedThing\n" {
+		t.Fatalf("unexpected error output %q", got)
+	}
+}
+
+func TestRunScheme(t *testing.T) {
+	var out, errOut strings.Builder
+	err := Run(runtime.NewEvaluator(), Options{
+		Dialect:     Scheme,
+		Input:       strings.NewReader("(define (sq x)\n  (* x x))\n(sq 7) \"a\n b\"\n)"),
+		Output:      &out,
+		ErrorOutput: &errOut,
+		Printer: func(w io.Writer, v lang.Value) {
+			fmt.Fprintf(w, "=> %s\n", v.String())
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if got, want := out.String(), "=> <closure>\n=> 49\n=> \"a\\n b\"\n"; got != want {
+		t.Fatalf("output %q, want %q", got, want)
+	}
+	if got := errOut.String(); got != "parse error: unexpected )\n" {
+		t.Fatalf("unexpected error output %q", got)
+	}
+}
+
+func TestCollectPaste(t *testing.T) {
+	feed := func(lines ...string) func() (string, error) {
+		return func() (string, error) {
+			if len(lines) == 0 {
+				return "", io.EOF
+			}
+			line := lines[0]
+			lines = lines[1:]
+			return line, nil
+		}
+	}
+
+	src, err := collectPaste(feed("func f() {", "", "\treturn 1", "}", ":end", "ignored"))
+	if err != nil {
+		t.Fatalf("collectPaste returned error: %v", err)
+	}
+	if want := "func f() {\n\n\treturn 1\n}\n"; src != want {
+		t.Fatalf("collectPaste => %q, want %q", src, want)
+	}
+	if _, err := parser.ParseString(src); err != nil {
+		t.Fatalf("pasted source failed to parse: %v", err)
+	}
+
+	src, err = collectPaste(feed("1 + 2"))
+	if err != nil || src != "1 + 2\n" {
+		t.Fatalf("collectPaste at EOF => %q, %v", src, err)
+	}
+
+	aborted := errors.New("aborted")
+	if _, err := collectPaste(func() (string, error) { return "", aborted }); !errors.Is(err, aborted) {
+		t.Fatalf("expected abort error, got %v", err)
+	}
+}
+
+func TestHistoryEntryRoundTrip(t *testing.T) {
+	src := "func f() {\n\treturn 1\n}"
+	encoded := encodeHistoryEntry(src)
+	if strings.Contains(encoded, "\n") {
+		t.Fatalf("encoded history entry still contains newlines: %q", encoded)
+	}
+	if got := decodeHistoryEntry(encoded); got != src {
+		t.Fatalf("decodeHistoryEntry => %q, want %q", got, src)
+	}
+	if _, err := parser.ParseString(decodeHistoryEntry(encoded)); err != nil {
+		t.Fatalf("recalled entry failed to parse: %v", err)
+	}
+}
+
+func TestExpandCommand(t *testing.T) {
+	if code, ok := commandArgument(":expand  x + 1 ", expandCommand); !ok || code != "x + 1" {
+		t.Fatalf("commandArgument => %q, %v", code, ok)
+	}
+	if _, ok := commandArgument(":expanded", expandCommand); ok {
+		t.Fatalf("expected :expanded not to be treated as :expand")
+	}
+	var out strings.Builder
+	s := &session{ev: runtime.NewEvaluator(), out: &out, errOut: &out}
+	s.runExpand("x << 2")
+	if got, want := out.String(), "(<< x 2)\n"; got != want {
+		t.Fatalf("runExpand output %q, want %q", got, want)
+	}
+}
+
+func TestMexpandCommand(t *testing.T) {
+	ev := runtime.NewEvaluator()
+	if _, err := runtime.EvaluateGispString(ev, "`(define-macro (twice x) (list 'begin x x))"); err != nil {
+		t.Fatalf("defining macro: %v", err)
+	}
+	if code, ok := commandArgument(":mexpand twice(f())", mexpandCommand); !ok || code != "twice(f())" {
+		t.Fatalf("commandArgument => %q, %v", code, ok)
+	}
+	var out strings.Builder
+	s := &session{ev: ev, out: &out}
+	s.runMexpand("twice(f()); g(1)")
+	if got, want := out.String(), "(twice (f))\n(begin (f) (f))\n\n(g 1)\n"; got != want {
+		t.Fatalf("runMexpand output %q, want %q", got, want)
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	if arg, ok := commandArgument(" :time on ", timeCommand); !ok || arg != "on" {
+		t.Fatalf("commandArgument => %q, %v", arg, ok)
+	}
+	if _, ok := commandArgument(":timeout", timeCommand); ok {
+		t.Fatalf("expected :timeout not to be treated as :time")
+	}
+	var out strings.Builder
+	s := &session{out: &out}
+	s.runTime("on")
+	s.runTime("")
+	s.runTime("off")
+	if got, want := out.String(), "// timing is on\n// timing is on\n// timing is off\n"; got != want {
+		t.Fatalf("runTime output %q, want %q", got, want)
+	}
+	if s.timing {
+		t.Fatalf("expected timing to be off")
+	}
+	if got, want := formatTiming(1234567*time.Nanosecond, 3, 96), "// 1.235ms, 3 allocations, 96 bytes"; got != want {
+		t.Fatalf("formatTiming => %q, want %q", got, want)
+	}
+}
+
+func TestPrecisionCommand(t *testing.T) {
+	var out, errOut strings.Builder
+	in := strings.NewReader(":precision 4\n3.14159265\n[1.0 / 3, 2.5]\n:precision 0\n:precision off\n3.14159265\n:precision\n")
+	err := Run(runtime.NewEvaluator(), Options{Input: in, Output: &out, ErrorOutput: &errOut})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	want := "// precision is 4 digits\n3.142\n(0.3333 2.5)\n// precision is shortest\n3.14159265\n// precision is shortest\n"
+	if got := out.String(); got != want {
+		t.Fatalf("output %q, want %q", got, want)
+	}
+	if got := errOut.String(); got != "usage: :precision 1..17|off\n" {
+		t.Fatalf("unexpected error output %q", got)
+	}
+}
+
+func TestStartSlowNotice(t *testing.T) {
+	var mu sync.Mutex
+	var out strings.Builder
+	w := writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return out.Write(p)
+	})
+
+	stop := startSlowNotice(w, time.Hour)
+	stop()
+	stop = startSlowNotice(w, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := out.String(); !strings.HasPrefix(got, "still running after 1ms") || strings.Count(got, "\n") != 1 {
+		t.Fatalf("unexpected notice output %q", got)
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,15 @@
+//go:build windows
+
+package repl
+
+import (
+	"os"
+	"syscall"
+)
+
+// isTerminal reports whether f is a console. The NUL device is a character
+// device too, so the mode bits used elsewhere are not enough on Windows.
+func isTerminal(f *os.File) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode) == nil
+}
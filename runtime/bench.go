@@ -0,0 +1,39 @@
+package runtime
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed bench/*.gisp
+var benchFiles embed.FS
+
+// BenchScript is one program of the built-in benchmark suite. Each script
+// ends with an expression whose value is the benchmark result.
+type BenchScript struct {
+	Name   string
+	Source string
+}
+
+// BenchScripts returns the built-in benchmark suite sorted by name.
+func BenchScripts() []BenchScript {
+	entries, err := benchFiles.ReadDir("bench")
+	if err != nil {
+		panic(err)
+	}
+	scripts := make([]BenchScript, 0, len(entries))
+	for _, entry := range entries {
+		data, err := benchFiles.ReadFile(path.Join("bench", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		scripts = append(scripts, BenchScript{
+			Name:   strings.TrimSuffix(entry.Name(), ".gisp"),
+			Source: string(data),
+		})
+	}
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].Name < scripts[j].Name })
+	return scripts
+}
@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// addNumbers, subNumbers and mulNumbers combine two numbers. Integers stay
+// exact: a result that overflows int64 becomes a big integer, and a big
+// integer result that fits in int64 becomes an ordinary one again. A real
+// operand makes the result real.
+
+func addNumbers(a, b lang.Value) lang.Value {
+	if a.Type == lang.TypeInt && b.Type == lang.TypeInt {
+		x, y := a.Int(), b.Int()
+		sum := x + y
+		if (sum > x) == (y > 0) {
+			return lang.IntValue(sum)
+		}
+	} else if a.Type == lang.TypeReal || b.Type == lang.TypeReal {
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		return lang.RealValue(x + y)
+	}
+	return lang.BigIntValue(new(big.Int).Add(a.BigInt(), b.BigInt()))
+}
+
+func subNumbers(a, b lang.Value) lang.Value {
+	if a.Type == lang.TypeInt && b.Type == lang.TypeInt {
+		x, y := a.Int(), b.Int()
+		diff := x - y
+		if (diff < x) == (y > 0) {
+			return lang.IntValue(diff)
+		}
+	} else if a.Type == lang.TypeReal || b.Type == lang.TypeReal {
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		return lang.RealValue(x - y)
+	}
+	return lang.BigIntValue(new(big.Int).Sub(a.BigInt(), b.BigInt()))
+}
+
+func mulNumbers(a, b lang.Value) lang.Value {
+	if a.Type == lang.TypeInt && b.Type == lang.TypeInt {
+		if prod, ok := mulInt64(a.Int(), b.Int()); ok {
+			return lang.IntValue(prod)
+		}
+	} else if a.Type == lang.TypeReal || b.Type == lang.TypeReal {
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		return lang.RealValue(x * y)
+	}
+	return lang.BigIntValue(new(big.Int).Mul(a.BigInt(), b.BigInt()))
+}
+
+// mulInt64 multiplies x and y, reporting false when the product overflows.
+func mulInt64(x, y int64) (int64, bool) {
+	if x == 0 || y == 0 {
+		return 0, true
+	}
+	if (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64) {
+		return 0, false
+	}
+	prod := x * y
+	return prod, prod/y == x
+}
+
+// shiftLeftInt shifts an integer left, becoming a big integer when bits
+// would be lost.
+func shiftLeftInt(v lang.Value, shift int64) lang.Value {
+	if v.Type == lang.TypeInt {
+		x := v.Int()
+		if x == 0 {
+			return v
+		}
+		// The shift is safe while it leaves a sign bit and at least one
+		// redundant copy of it above the significant bits.
+		mag := uint64(x)
+		if x < 0 {
+			mag = ^mag
+		}
+		if shift < int64(bits.LeadingZeros64(mag)) {
+			return lang.IntValue(x << uint(shift))
+		}
+	}
+	return lang.BigIntValue(new(big.Int).Lsh(v.BigInt(), uint(shift)))
+}
+
+// isOddInt reports whether an integer of either representation is odd.
+func isOddInt(v lang.Value) bool {
+	if v.Type == lang.TypeInt {
+		return v.Int()%2 != 0
+	}
+	return v.BigInt().Bit(0) == 1
+}
+
+// requireIntegerArg accepts an integer of either representation.
+func requireIntegerArg(name string, v lang.Value) (lang.Value, error) {
+	if !lang.IsInteger(v) {
+		return lang.Value{}, typeError(name, "integer", v)
+	}
+	return v, nil
+}
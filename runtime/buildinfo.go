@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	goruntime "runtime"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Version is the version of the Gisp interpreter reported by gispVersion.
+const Version = "0.9.0"
+
+// features lists what featureAvailable knows about. Language features are
+// always there; the others depend on how the evaluator was set up.
+var features = map[string]func(ev *lang.Evaluator) bool{
+	"bigints":    always,
+	"chars":      always,
+	"maps":       always,
+	"structs":    always,
+	"objects":    always,
+	"modules":    always,
+	"channels":   always,
+	"getopt":     always,
+	"positions":  always,
+	"backtraces": func(ev *lang.Evaluator) bool { return ev.BacktraceDepth >= 0 },
+	"bytecode":   func(ev *lang.Evaluator) bool { return ev.Engine != nil },
+
+	// Capability groups, present when NewEvaluator installed them.
+	"math": hasBuiltin("sqrt"),
+	"io":   hasBuiltin("display"),
+	"os":   hasBuiltin("listDir"),
+
+	// Resources the security policy may deny.
+	"fs":   func(ev *lang.Evaluator) bool { return ev.SecurityPolicy().AllowFS },
+	"net":  func(ev *lang.Evaluator) bool { return ev.SecurityPolicy().AllowNet },
+	"exec": func(ev *lang.Evaluator) bool { return ev.SecurityPolicy().AllowExec },
+	"exit": func(ev *lang.Evaluator) bool { return ev.SecurityPolicy().AllowExit },
+}
+
+func always(*lang.Evaluator) bool { return true }
+
+func hasBuiltin(name string) func(ev *lang.Evaluator) bool {
+	return func(ev *lang.Evaluator) bool {
+		if _, ok := ev.Builtin(name); ok {
+			return true
+		}
+		_, err := ev.Global.Get(name)
+		return err == nil
+	}
+}
+
+func installBuildInfoPrimitives(env *lang.Env) {
+	Register(env, "gispVersion", 0, false,
+		"gispVersion() returns the version of the interpreter as a string such as \"0.9.0\".", primGispVersion)
+	Register(env, "featureAvailable", 1, false,
+		"featureAvailable(name) reports whether the feature name, such as \"maps\" or \"fs\", is available; unknown features are not.", primFeatureAvailable)
+	Register(env, "platform", 0, false,
+		"platform() returns a map with the operating system (os), processor architecture (arch) and Go version (go) the interpreter runs on.", primPlatform)
+}
+
+func primGispVersion(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.StringValue(Version), nil
+}
+
+func primFeatureAvailable(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	var name string
+	switch args[0].Type {
+	case lang.TypeString:
+		name = args[0].Str()
+	case lang.TypeSymbol:
+		name = args[0].Sym()
+	default:
+		return lang.Value{}, typeError("featureAvailable", "string or symbol", args[0])
+	}
+	check, ok := features[name]
+	return lang.BoolValue(ok && check(ev)), nil
+}
+
+func primPlatform(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m := lang.NewMap()
+	m.Set(lang.SymbolValue("os"), lang.StringValue(goruntime.GOOS))
+	m.Set(lang.SymbolValue("arch"), lang.StringValue(goruntime.GOARCH))
+	m.Set(lang.SymbolValue("go"), lang.StringValue(goruntime.Version()))
+	return lang.MapValue(m), nil
+}
@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func TestBuildInfo(t *testing.T) {
+	full := NewEvaluator()
+	sandboxed := NewEvaluator()
+	sandboxed.Sandbox = true
+	core := NewEvaluator(CapCore)
+	untraced := NewEvaluator()
+	untraced.BacktraceDepth = -1
+
+	cases := []struct {
+		ev   *lang.Evaluator
+		src  string
+		want string
+	}{
+		{full, `gispVersion()`, `"` + Version + `"`},
+		{full, "[featureAvailable(\"maps\"), featureAvailable(`'objects), featureAvailable(\"teleport\")]", `(#t #t #f)`},
+		{full, `[featureAvailable("math"), featureAvailable("io"), featureAvailable("os"), featureAvailable("fs")]`, `(#t #t #t #t)`},
+		{core, `[featureAvailable("maps"), featureAvailable("math"), featureAvailable("io"), featureAvailable("os")]`, `(#t #f #f #f)`},
+		{sandboxed, `[featureAvailable("fs"), featureAvailable("net"), featureAvailable("exec"), featureAvailable("exit")]`, `(#f #f #f #f)`},
+		{full, `featureAvailable("bytecode")`, `#f`},
+		{full, `featureAvailable("backtraces")`, `#t`},
+		{untraced, `featureAvailable("backtraces")`, `#f`},
+		{full, "var p = platform()\n[p.os, p.arch]", `("` + goruntime.GOOS + `" "` + goruntime.GOARCH + `")`},
+		{full, "`(ref (platform) 'go)", `"` + goruntime.Version() + `"`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(tc.ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	_, err := EvaluateGispString(full, `featureAvailable(1)`)
+	if err == nil || !strings.Contains(err.Error(), "featureAvailable expects string or symbol") {
+		t.Fatalf("featureAvailable(1) error %v", err)
+	}
+}
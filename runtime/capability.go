@@ -0,0 +1,24 @@
+package runtime
+
+// Capability selects a group of primitives for NewEvaluator. Capabilities
+// combine as a bitmask.
+type Capability uint
+
+const (
+	// CapCore covers arithmetic, lists, vectors, strings, equality and the
+	// higher-order utilities. The prelude macros depend on it, so it is
+	// always installed.
+	CapCore Capability = 1 << iota
+	// CapMath covers the math functions and constants, the exact integer
+	// helpers and the random number generator.
+	CapMath
+	// CapIO covers console output and read.
+	CapIO
+	// CapOS covers the filesystem, the clock and exit.
+	CapOS
+	// CapNet is reserved for network primitives; none exist yet.
+	CapNet
+
+	// CapAll enables every capability group.
+	CapAll = CapCore | CapMath | CapIO | CapOS | CapNet
+)
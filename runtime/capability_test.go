@@ -0,0 +1,68 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func TestNewEvaluatorCapabilities(t *testing.T) {
+	ev := NewEvaluator(CapIO)
+	for _, name := range []string{"exit", "listDir", "currentTime", "randomInteger"} {
+		if _, err := ev.Global.Get(name); err == nil {
+			t.Fatalf("expected %s to be excluded", name)
+		}
+	}
+	for _, name := range []string{"cons", "display", "and"} {
+		if _, err := ev.Global.Get(name); err != nil {
+			t.Fatalf("expected %s to be installed: %v", name, err)
+		}
+	}
+	if _, err := EvaluateGispString(ev, "exit(1)"); err == nil || !strings.Contains(err.Error(), "unbound variable") {
+		t.Fatalf("expected unbound exit, got %v", err)
+	}
+
+	ev = NewEvaluator(CapCore)
+	if _, err := ev.Global.Get("display"); err == nil {
+		t.Fatalf("expected display to be excluded from core-only evaluator")
+	}
+	val, err := EvaluateGispString(ev, "1 + 2")
+	if err != nil || val.Int() != 3 {
+		t.Fatalf("core evaluator => %v, %v", val, err)
+	}
+
+	ev = NewEvaluator()
+	for _, name := range []string{"exit", "listDir", "currentTime", "randomInteger", "display"} {
+		if _, err := ev.Global.Get(name); err != nil {
+			t.Fatalf("expected default evaluator to install %s: %v", name, err)
+		}
+	}
+}
+
+func TestInstallIntoCustomEvaluator(t *testing.T) {
+	ev := lang.NewEvaluator()
+	for i := 0; i < 2; i++ {
+		if err := InstallCore(ev.Global); err != nil {
+			t.Fatalf("InstallCore failed: %v", err)
+		}
+		InstallMath(ev.Global)
+	}
+	val, err := EvaluateGispString(ev, "randomSeed(1); randomInteger(10) >= 0 && length([1, 2, 3]) == 3")
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if val.Type != lang.TypeBool || !val.Bool() {
+		t.Fatalf("expected #t, got %s", val.String())
+	}
+	if _, err := ev.Global.Get("display"); err == nil {
+		t.Fatalf("expected display to be absent without InstallIO")
+	}
+
+	if err := AddStdlib(ev.Global, CapIO); err != nil {
+		t.Fatalf("AddStdlib failed: %v", err)
+	}
+	if _, err := ev.Global.Get("display"); err != nil {
+		t.Fatalf("expected display after AddStdlib: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// go runs a procedure on a new goroutine with an evaluator forked from the
+// caller's. A closure runs in a copy of its local frames, so assignments
+// to captured variables made by either side are not seen by the other;
+// the global environment is shared. Goroutines communicate through
+// channels, and Gisp's select expression compiles to channelSelect.
+
+// pollInterval is how often a goroutine waiting on a channel checks
+// whether its evaluation has been interrupted.
+const pollInterval = 50 * time.Millisecond
+
+func installConcurrencyPrimitives(env *lang.Env) {
+	Register(env, "go", 1, true,
+		"go(fn, args...) calls fn with args on a new goroutine and returns at once; errors are reported on standard error.", primGo)
+	Register(env, "makeChannel", 0, true,
+		"makeChannel(size) returns a channel buffering up to size values, or none when size is omitted.", primMakeChannel)
+	Register(env, "send", 2, false,
+		"send(ch, x) sends x on the channel ch, waiting for a receiver or for room in its buffer.", primSend)
+	Register(env, "channelReceive", 1, false,
+		"channelReceive(ch) waits for a value from the channel ch and returns it, or the eof object once ch is closed and drained.", primChannelReceive)
+	Register(env, "closeChannel", 1, false,
+		"closeChannel(ch) closes the channel ch; later sends on it are errors. Closing a channel from linesOf or datumsOf stops the reading instead.", primCloseChannel)
+	Register(env, "channelp", 1, false,
+		"channelp(x) reports whether x is a channel.", primIsChannel)
+	Register(env, "channelSelect", 2, false,
+		"channelSelect(cases, wait) performs one of the channel operations in the vector cases and returns its index and the value received.", primChannelSelect)
+}
+
+func requireChannelArg(name string, v lang.Value) (*lang.Channel, error) {
+	if v.Type != lang.TypeChannel || v.Channel() == nil {
+		return nil, typeError(name, "channel", v)
+	}
+	return v.Channel(), nil
+}
+
+func primGo(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	proc := args[0]
+	switch proc.Type {
+	case lang.TypePrimitive:
+	case lang.TypeClosure:
+		c := proc.Closure()
+		proc = lang.ClosureValue(c.Params, c.Rest, c.Body, c.Env.CloneUntil(ev.Global))
+	default:
+		return lang.Value{}, typeError("go", "procedure", proc)
+	}
+	fork := ev.Fork()
+	callArgs := append([]lang.Value(nil), args[1:]...)
+	go func() {
+		if _, err := fork.Apply(proc, callArgs); err != nil {
+			fmt.Fprintf(fork.Stderr(), "go: %v\n", err)
+		}
+	}()
+	return lang.EmptyList, nil
+}
+
+func primMakeChannel(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 1 {
+		return lang.Value{}, arityError("makeChannel", 0, 1, len(args))
+	}
+	var size int64
+	if len(args) == 1 {
+		var err error
+		size, err = requireIntArg("makeChannel", args[0])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if size < 0 {
+			return lang.Value{}, fmt.Errorf("makeChannel size must be non-negative, got %d", size)
+		}
+		if err := ev.CheckAlloc(size); err != nil {
+			return lang.Value{}, err
+		}
+	}
+	return lang.ChannelValue(lang.NewChannel(int(size))), nil
+}
+
+func primSend(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	ch, err := requireChannelArg("send", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	_, _, err = selectChannels(ev, []reflect.SelectCase{sendCase(ch, args[1])}, true)
+	return lang.EmptyList, err
+}
+
+func primChannelReceive(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	ch, err := requireChannelArg("channelReceive", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	_, val, err := selectChannels(ev, []reflect.SelectCase{receiveCase(ch)}, true)
+	return val, err
+}
+
+func primCloseChannel(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	ch, err := requireChannelArg("closeChannel", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if ch.Stop != nil {
+		ch.Stop()
+		return lang.EmptyList, nil
+	}
+	if err := closeChannel(ch); err != nil {
+		return lang.Value{}, err
+	}
+	return lang.EmptyList, nil
+}
+
+func closeChannel(ch *lang.Channel) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("closeChannel: channel is already closed")
+		}
+	}()
+	close(ch.C)
+	return nil
+}
+
+func primIsChannel(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeChannel), nil
+}
+
+// primChannelSelect implements select. Each element of cases is a vector
+// holding a channel to receive from, or a channel and a value to send on
+// it. When wait is false and no operation can proceed at once, the index
+// returned is -1.
+func primChannelSelect(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	vec, err := requireVectorArg("channelSelect", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	cases := make([]reflect.SelectCase, len(vec.Elements))
+	for i, c := range vec.Elements {
+		op, err := requireVectorArg("channelSelect", c)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if len(op.Elements) != 1 && len(op.Elements) != 2 {
+			return lang.Value{}, fmt.Errorf("channelSelect case must hold a channel and at most one value, got %s", c.String())
+		}
+		ch, err := requireChannelArg("channelSelect", op.Elements[0])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if len(op.Elements) == 2 {
+			cases[i] = sendCase(ch, op.Elements[1])
+		} else {
+			cases[i] = receiveCase(ch)
+		}
+	}
+	chosen, val, err := selectChannels(ev, cases, lang.IsTruthy(args[1]))
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.MultipleValues(lang.IntValue(int64(chosen)), val), nil
+}
+
+func receiveCase(ch *lang.Channel) reflect.SelectCase {
+	return reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.C)}
+}
+
+func sendCase(ch *lang.Channel, v lang.Value) reflect.SelectCase {
+	return reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(ch.C), Send: reflect.ValueOf(v)}
+}
+
+// selectChannels performs one of cases and returns its index and the value
+// it received, which is the eof object for a closed channel and the empty
+// list for a send. Without wait it returns -1 at once when no case is
+// ready. While it waits it checks for an interrupt every pollInterval.
+func selectChannels(ev *lang.Evaluator, cases []reflect.SelectCase, wait bool) (chosen int, val lang.Value, err error) {
+	defer func() {
+		if recover() != nil {
+			chosen, val, err = 0, lang.Value{}, fmt.Errorf("send on closed channel")
+		}
+	}()
+	n := len(cases)
+	if wait {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ticker.C)})
+	} else {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+	for {
+		i, recv, ok := reflect.Select(cases)
+		switch {
+		case i < n && cases[i].Dir == reflect.SelectSend:
+			return i, lang.EmptyList, nil
+		case i < n && !ok:
+			return i, lang.EOFObject, nil
+		case i < n:
+			return i, recv.Interface().(lang.Value), nil
+		case !wait:
+			return -1, lang.EmptyList, nil
+		}
+		if err := ev.Tick(); err != nil {
+			return 0, lang.Value{}, err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoroutinesAndChannels(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"workers", `
+func worker(jobs, results) {
+	while true {
+		var j = receive(jobs)
+		if eofp(j) { break }
+		send(results, j * j)
+	}
+}
+var jobs = makeChannel(10)
+var results = makeChannel(10)
+for _ in [1, 2, 3] { go(worker, jobs, results) }
+for j in [1, 2, 3, 4, 5] { send(jobs, j) }
+closeChannel(jobs)
+var total = 0
+for _ in [1, 2, 3, 4, 5] { total += receive(results) }
+total`, "55"},
+		{"unbuffered", `
+var ch = makeChannel()
+go(func(x) { send(ch, x + 1) }, 41)
+receive(ch)`, "42"},
+		{"closed", `
+var ch = makeChannel(2)
+send(ch, 1)
+closeChannel(ch)
+[receive(ch), eofp(receive(ch)), eofp(receive(ch))]`, "(1 #t #t)"},
+		{"localsCopied", `
+func f() {
+	var n = 1
+	var done = makeChannel()
+	go(func() { n = 100; send(done, n) })
+	var seen = receive(done)
+	return [n, seen]
+}
+f()`, "(1 100)"},
+		{"globalsShared", `
+var counter = 0
+var done = makeChannel()
+go(func() { counter = 5; send(done, true) })
+receive(done)
+counter`, "5"},
+		{"selectReceive", `
+var a = makeChannel()
+var b = makeChannel()
+go(func() { send(b, "b") })
+select {
+case v = receive(a): ["a", v]
+case v = receive(b): ["b", v]
+}`, `("b" "b")`},
+		{"selectSend", `
+var full = makeChannel()
+var room = makeChannel(1)
+var r = select {
+case send(full, 1): "full"
+case send(room, 2): "room"
+}
+[r, receive(room)]`, `("room" 2)`},
+		{"selectDefault", `
+var ch = makeChannel()
+select {
+case receive(ch): "received"
+default: "idle"
+}`, `"idle"`},
+		{"selectClosed", `
+var ch = makeChannel()
+closeChannel(ch)
+select { case x = receive(ch): eofp(x) }`, "#t"},
+		{"receiveValues", "`(receive (q r) (divmod 7 2) (list q r))", "(3 1)"},
+		{"channelp", `[channelp(makeChannel()), channelp(1), makeChannel()]`, "(#t #f #<channel>)"},
+	}
+	for _, tc := range cases {
+		ev := NewEvaluator()
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.name, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	ev := NewEvaluator()
+	for src, want := range map[string]string{
+		`send(1, 2)`:      "send expects channel",
+		`makeChannel(-1)`: "makeChannel size must be non-negative",
+		`go(1)`:           "go expects procedure",
+		`var c = makeChannel(1); closeChannel(c); send(c, 1)`:     "send on closed channel",
+		`var c = makeChannel(); closeChannel(c); closeChannel(c)`: "already closed",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+// lineWriter passes each write to a channel, so that a test can wait for
+// output written by a goroutine.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestGoroutineErrors(t *testing.T) {
+	ev := NewEvaluator()
+	stderr := make(lineWriter, 1)
+	ev.SetStderr(stderr)
+	if _, err := EvaluateGispString(ev, `go(func() { nosuch() })`); err != nil {
+		t.Fatalf("go failed: %v", err)
+	}
+	select {
+	case line := <-stderr:
+		if want := "go: line 1:19: unbound variable: nosuch\n"; line != want {
+			t.Fatalf("goroutine reported %q, want %q", line, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("goroutine error was not reported")
+	}
+}
@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Encoding primitives treat strings as byte sequences, so decoding may
+// produce strings that are not valid UTF-8.
+
+func installEncodingPrimitives(env *lang.Env) {
+	Register(env, "hexEncode", 1, false,
+		"hexEncode(s) returns the bytes of s as lowercase hexadecimal digits.", primHexEncode)
+	Register(env, "hexDecode", 1, false,
+		"hexDecode(s) returns the bytes spelled by the hexadecimal digits in s.", primHexDecode)
+	Register(env, "base64Encode", 1, false,
+		"base64Encode(s) returns the standard padded base64 encoding of s.", primBase64Encode)
+	Register(env, "base64Decode", 1, false,
+		"base64Decode(s) decodes standard padded base64 text.", primBase64Decode)
+}
+
+func primHexEncode(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("hexEncode", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(hex.EncodeToString([]byte(str))), nil
+}
+
+func primHexDecode(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("hexDecode", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	data, err := hex.DecodeString(str)
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("hexDecode: %v", err)
+	}
+	return lang.StringValue(string(data)), nil
+}
+
+func primBase64Encode(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("base64Encode", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(base64.StdEncoding.EncodeToString([]byte(str))), nil
+}
+
+func primBase64Decode(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("base64Decode", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	data, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("base64Decode: %v", err)
+	}
+	return lang.StringValue(string(data)), nil
+}
@@ -0,0 +1,48 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodingPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`hexEncode("Hi!")`, `"486921"`},
+		{`hexEncode("")`, `""`},
+		{`hexDecode("486921")`, `"Hi!"`},
+		{`hexDecode("4A4b")`, `"JK"`},
+		{`base64Encode("hello")`, `"aGVsbG8="`},
+		{`base64Decode("aGVsbG8=")`, `"hello"`},
+		{`base64Decode(base64Encode("日本語"))`, `"日本語"`},
+		{`stringLength(hexDecode("00ff"))`, "2"},
+		{`hexEncode(base64Decode("AP8="))`, `"00ff"`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	errCases := []struct {
+		src  string
+		want string
+	}{
+		{`hexDecode("abc")`, "hexDecode: encoding/hex: odd length hex string"},
+		{`hexDecode("zz")`, "hexDecode: encoding/hex: invalid byte"},
+		{`base64Decode("aGVsbG8")`, "base64Decode: illegal base64 data"},
+		{`base64Encode(1)`, "base64Encode expects string"},
+	}
+	for _, tc := range errCases {
+		if _, err := EvaluateGispString(ev, tc.src); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.src, tc.want, err)
+		}
+	}
+}
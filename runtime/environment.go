@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"github.com/sergev/gisp/lang"
+)
+
+// Environments are values, so a program can evaluate code it builds in a
+// scope of its choosing: the-environment captures the scope it is called
+// from, makeChildEnv extends one without changing it, and eval runs an
+// expression there. Definitions made by eval go into the environment it is
+// given.
+
+func installEnvironmentPrimitives(env *lang.Env) {
+	for _, name := range []string{"theEnvironment", "the-environment"} {
+		Register(env, name, 0, false,
+			name+"() returns the environment it is called from.", primTheEnvironment)
+	}
+	Register(env, "eval", 1, true,
+		"eval(expr, env) evaluates the expression expr in env, or in the global environment when env is omitted.", primEval)
+	Register(env, "makeChildEnv", 1, false,
+		"makeChildEnv(env) returns a new empty environment whose bindings extend those of env.", primMakeChildEnv)
+	Register(env, "environmentp", 1, false,
+		"environmentp(x) reports whether x is an environment.", primIsEnvironment)
+}
+
+func requireEnvironmentArg(name string, v lang.Value) (*lang.Env, error) {
+	if v.Type != lang.TypeEnvironment || v.Environment() == nil {
+		return nil, typeError(name, "environment", v)
+	}
+	return v.Environment(), nil
+}
+
+func primTheEnvironment(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.EnvironmentValue(ev.CurrentEnv()), nil
+}
+
+func primEval(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 2 {
+		return lang.Value{}, arityError("eval", 1, 2, len(args))
+	}
+	env := ev.Global
+	if len(args) == 2 {
+		var err error
+		env, err = requireEnvironmentArg("eval", args[1])
+		if err != nil {
+			return lang.Value{}, err
+		}
+	}
+	return ev.Eval(args[0], env)
+}
+
+func primMakeChildEnv(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	parent, err := requireEnvironmentArg("makeChildEnv", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.EnvironmentValue(lang.NewEnv(parent)), nil
+}
+
+func primIsEnvironment(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeEnvironment), nil
+}
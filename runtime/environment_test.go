@@ -0,0 +1,50 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvironments(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"eval(`'(+ 1 2))", "3"},
+		{"environmentp(theEnvironment())", "#t"},
+		{"environmentp(1)", "#f"},
+		{"theEnvironment()", "#<environment>"},
+		{"func f(x) { return theEnvironment() }; eval(`'x, f(42))", "42"},
+		{"func counter() { var n = 0; return theEnvironment() }; var c = counter(); eval(`'(set! n (+ n 1)), c); eval(`'(set! n (+ n 1)), c)", "2"},
+		{"var box = makeChildEnv(theEnvironment()); eval(`'(define hidden 7), box); eval(`'hidden, box)", "7"},
+		{"var g = theEnvironment(); eq(g, theEnvironment())", "#t"},
+		{"func f() { return theEnvironment() }; eq(f(), f())", "#f"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	val := evalString(t, ev, "(let ((x 5)) (eval '(* x x) (the-environment)))")
+	if got := val.String(); got != "25" {
+		t.Fatalf("eval in let environment => %s, want 25", got)
+	}
+
+	for src, want := range map[string]string{
+		"eval(`'nosuch, makeChildEnv(theEnvironment()))": "nosuch",
+		"hidden":                       "unbound variable: hidden",
+		"eval(1, 2)":                   "eval expects environment",
+		"makeChildEnv(1)":              "makeChildEnv expects environment",
+		"eval(1, theEnvironment(), 3)": "eval",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"errors"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// A catch handler receives the value given to throw, or an error object for
+// an error raised by the interpreter or by error(...). The primitives below
+// raise values and take error objects apart.
+
+func installExceptionPrimitives(env *lang.Env) {
+	Register(env, "throw", 1, false,
+		"throw(x) raises x to the nearest catch; an error object is raised again as the original error.", primThrow)
+	Register(env, "errorp", 1, false, "errorp(x) reports whether x is an error object.", primIsError)
+	Register(env, "errorMessage", 1, false, "errorMessage(e) returns the message of error object e.", primErrorMessage)
+	Register(env, "errorTag", 1, false,
+		"errorTag(e) returns the category of error object e, such as 'type-error, or false if it has none.", primErrorTag)
+	Register(env, "errorArgs", 1, false,
+		"errorArgs(e) returns the arguments given to error(...) for e, or the empty list.", primErrorArgs)
+}
+
+func requireErrorArg(name string, v lang.Value) (*lang.ErrorObject, error) {
+	if v.Type != lang.TypeErrorObject || v.ErrorObject() == nil {
+		return nil, typeError(name, "error-object", v)
+	}
+	return v.ErrorObject(), nil
+}
+
+func primThrow(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if e := args[0].ErrorObject(); args[0].Type == lang.TypeErrorObject && e != nil {
+		return lang.Value{}, e.Err
+	}
+	return lang.Value{}, &lang.ThrownError{Value: args[0]}
+}
+
+func primIsError(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeErrorObject), nil
+}
+
+func primErrorMessage(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	e, err := requireErrorArg("errorMessage", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(e.Err.Error()), nil
+}
+
+func primErrorTag(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	e, err := requireErrorArg("errorTag", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if tag := lang.ErrorTag(e.Err); tag != "" {
+		return lang.SymbolValue(tag), nil
+	}
+	return lang.BoolValue(false), nil
+}
+
+func primErrorArgs(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	e, err := requireErrorArg("errorArgs", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	var user *lang.UserError
+	if errors.As(e.Err, &user) {
+		return lang.List(user.Args...), nil
+	}
+	return lang.EmptyList, nil
+}
@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// formatValues formats args under the control of format, using the verbs of
+// Go's fmt applied to Gisp values: %v and %s print a value as display does
+// and %q in the reader syntax, quoting strings; %d, %b, %o, %x and %X take
+// integers, big integers included; %c and %U take a character or a code
+// point; %e, %f and %g, and their upper-case forms, take any number; %t
+// takes a boolean; and %% prints a percent sign. Flags, width and precision are passed on to fmt,
+// and a * takes either from the next argument. A missing or surplus
+// argument is an error, where fmt would note it in the output.
+func formatValues(name, format string, args []lang.Value) (string, error) {
+	var b strings.Builder
+	next := 0
+	arg := func(verb byte) (lang.Value, error) {
+		if next >= len(args) {
+			return lang.Value{}, fmt.Errorf("%s: missing argument for %%%c", name, verb)
+		}
+		v := args[next]
+		next++
+		return v, nil
+	}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		spec := []byte{'%'}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			spec = append(spec, format[i])
+			i++
+		}
+		for _, part := range []string{"width", "precision"} {
+			if part == "precision" {
+				if i >= len(format) || format[i] != '.' {
+					break
+				}
+				spec = append(spec, '.')
+				i++
+			}
+			if i < len(format) && format[i] == '*' {
+				v, err := arg('*')
+				if err != nil {
+					return "", err
+				}
+				n, err := requireIntArg(name, v)
+				if err != nil {
+					return "", err
+				}
+				spec = strconv.AppendInt(spec, n, 10)
+				i++
+				continue
+			}
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				spec = append(spec, format[i])
+				i++
+			}
+		}
+		if i >= len(format) {
+			return "", fmt.Errorf("%s: format ends in an incomplete verb", name)
+		}
+		verb := format[i]
+		if verb == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		v, err := arg(verb)
+		if err != nil {
+			return "", err
+		}
+		text, err := formatVerb(name, string(spec), verb, v)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(text)
+	}
+	if next < len(args) {
+		return "", fmt.Errorf("%s: %d arguments unused by format %q", name, len(args)-next, format)
+	}
+	return b.String(), nil
+}
+
+// formatVerb formats v for a single verb, spec holding its flags, width and
+// precision.
+func formatVerb(name, spec string, verb byte, v lang.Value) (string, error) {
+	switch verb {
+	case 'v', 's':
+		return fmt.Sprintf(spec+"s", displayString(v)), nil
+	case 'q':
+		return fmt.Sprintf(spec+"s", v.String()), nil
+	case 'd', 'b', 'o', 'x', 'X':
+		switch v.Type {
+		case lang.TypeInt:
+			return fmt.Sprintf(spec+string(verb), v.Int()), nil
+		case lang.TypeBigInt:
+			return fmt.Sprintf(spec+string(verb), v.BigInt()), nil
+		}
+		return "", typeError(name, "integer", v)
+	case 'c', 'U':
+		switch v.Type {
+		case lang.TypeChar:
+			return fmt.Sprintf(spec+string(verb), v.Char()), nil
+		case lang.TypeInt:
+			return fmt.Sprintf(spec+string(verb), rune(v.Int())), nil
+		}
+		return "", typeError(name, "character", v)
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		f, err := lang.AsFloat(v)
+		if err != nil {
+			return "", typeError(name, "number", v)
+		}
+		return fmt.Sprintf(spec+string(verb), f), nil
+	case 't':
+		if v.Type != lang.TypeBool {
+			return "", typeError(name, "boolean", v)
+		}
+		return fmt.Sprintf(spec+"t", v.Bool()), nil
+	}
+	return "", fmt.Errorf("%s: unknown verb %%%c", name, verb)
+}
@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// getopt parses command-line options the way Go's flag package does, so a
+// script can take the same options whether it is written in Gisp or in
+// s-expressions: both call this primitive with a map of defaults and take
+// its two results apart with var opts, args = ... or receive.
+
+func installGetoptPrimitives(env *lang.Env) {
+	Register(env, "getopt", 2, false,
+		"getopt(args, defaults) parses options from the list of strings args and returns a map of their values and the list of remaining arguments.", primGetopt)
+}
+
+func primGetopt(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	argValues, err := lang.ToSlice(args[0])
+	if err != nil {
+		return lang.Value{}, typeError("getopt", "list of strings", args[0])
+	}
+	defaults, err := requireMapArg("getopt", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	keys := map[string]lang.Value{}
+	for _, key := range defaults.Keys() {
+		var name string
+		switch key.Type {
+		case lang.TypeSymbol:
+			name = key.Sym()
+		case lang.TypeString:
+			name = key.Str()
+		default:
+			return lang.Value{}, fmt.Errorf("getopt: option name must be a symbol or string, got %s", key.String())
+		}
+		val, _ := defaults.Get(key)
+		switch val.Type {
+		case lang.TypeBool, lang.TypeInt, lang.TypeReal, lang.TypeString:
+		default:
+			return lang.Value{}, fmt.Errorf("getopt: default of option %s must be a boolean, integer, real or string, got %s", name, val.String())
+		}
+		keys[name] = key
+	}
+
+	words := make([]string, len(argValues))
+	for i, v := range argValues {
+		if v.Type != lang.TypeString {
+			return lang.Value{}, typeError("getopt", "list of strings", args[0])
+		}
+		words[i] = v.Str()
+	}
+	opts := lang.NewMap()
+	for _, key := range defaults.Keys() {
+		val, _ := defaults.Get(key)
+		opts.Set(key, val)
+	}
+	i := 0
+	for i < len(words) {
+		word := words[i]
+		if word == "--" {
+			i++
+			break
+		}
+		if len(word) < 2 || word[0] != '-' {
+			break
+		}
+		i++
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(word[1:], "-"), "=")
+		key, ok := keys[name]
+		if !ok {
+			return lang.Value{}, fmt.Errorf("getopt: unknown option -%s", name)
+		}
+		def, _ := defaults.Get(key)
+		if def.Type == lang.TypeBool && !hasValue {
+			opts.Set(key, lang.BoolValue(true))
+			continue
+		}
+		if !hasValue {
+			if i == len(words) {
+				return lang.Value{}, fmt.Errorf("getopt: option -%s needs a value", name)
+			}
+			value = words[i]
+			i++
+		}
+		val, err := parseOptionValue(def, value)
+		if err != nil {
+			return lang.Value{}, fmt.Errorf("getopt: invalid value %q for option -%s", value, name)
+		}
+		opts.Set(key, val)
+	}
+	rest := make([]lang.Value, 0, len(words)-i)
+	for _, word := range words[i:] {
+		rest = append(rest, lang.StringValue(word))
+	}
+	return lang.MultipleValues(lang.MapValue(opts), lang.List(rest...)), nil
+}
+
+// parseOptionValue converts the text of an option to the type of its
+// default value.
+func parseOptionValue(def lang.Value, text string) (lang.Value, error) {
+	switch def.Type {
+	case lang.TypeBool:
+		b, err := strconv.ParseBool(text)
+		return lang.BoolValue(b), err
+	case lang.TypeInt:
+		n, err := strconv.ParseInt(text, 0, 64)
+		return lang.IntValue(n), err
+	case lang.TypeReal:
+		f, err := strconv.ParseFloat(text, 64)
+		return lang.RealValue(f), err
+	}
+	return lang.StringValue(text), nil
+}
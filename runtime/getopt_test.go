@@ -0,0 +1,50 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGetoptDialects parses each command line from Gisp and from
+// s-expressions and expects the same options and arguments from both.
+func TestGetoptDialects(t *testing.T) {
+	const defaults = `{verbose: #f, n: 1, name: "x", scale: 0.5}`
+	cases := []struct {
+		args string
+		want string
+	}{
+		{`()`, `({verbose: #f, n: 1, name: "x", scale: 0.5} ())`},
+		{`("-verbose" "-n" "3" "--name=y" "a" "-b")`, `({verbose: #t, n: 3, name: "y", scale: 0.5} ("a" "-b"))`},
+		{`("-verbose=false" "-n=0x10" "-scale" "2.5")`, `({verbose: #f, n: 16, name: "x", scale: 2.5} ())`},
+		{`("-n" "2" "--" "-verbose")`, `({verbose: #f, n: 2, name: "x", scale: 0.5} ("-verbose"))`},
+		{`("-" "-n" "2")`, `({verbose: #f, n: 1, name: "x", scale: 0.5} ("-" "-n" "2"))`},
+	}
+	for _, tc := range cases {
+		gisp := "var opts, args = getopt(`'" + tc.args + ", `" + defaults + ")\nlist(opts, args)"
+		val, err := EvaluateGispString(NewEvaluator(), gisp)
+		if err != nil {
+			t.Fatalf("%s failed: %v", gisp, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", gisp, got, tc.want)
+		}
+		scheme := "(receive (opts args) (getopt '" + tc.args + " " + defaults + ") (list opts args))"
+		if got := evalString(t, NewEvaluator(), scheme).String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", scheme, got, tc.want)
+		}
+	}
+
+	ev := NewEvaluator()
+	for src, want := range map[string]string{
+		"getopt(`'(\"-x\"), `{n: 1})":          "getopt: unknown option -x",
+		"getopt(`'(\"-n\"), `{n: 1})":          "getopt: option -n needs a value",
+		"getopt(`'(\"-n\" \"many\"), `{n: 1})": `getopt: invalid value "many" for option -n`,
+		"getopt(`'(1), `{n: 1})":               "getopt expects list of strings",
+		"getopt(`'(), `{n: (1)})":              "getopt: default of option n must be a boolean, integer, real or string",
+		"getopt(`'(), `{1: 2})":                "getopt: option name must be a symbol or string",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -50,6 +51,361 @@ sign;
 	if val.Type != lang.TypeInt || val.Int() != -1 {
 		t.Fatalf("expected -1, got %v", val)
 	}
+
+	src = `
+var calls = []
+func note(x) { calls = cons(x, calls); return x }
+func f(n) {
+	return switch n {
+	case note(0), note(1): "low"; fallthrough
+	case 2: "two"
+	case 3: note("three")
+		fallthrough
+	default: "many"
+	}
+}
+[map(f, [1, 2, 3, 7]), calls, switch { case false, 2 > 1: "yes" }]
+`
+	val, err = EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString subject switch returned error: %v", err)
+	}
+	want := `(("two" "two" "many" "many") (1 0 "three" 1 0 1 0 1 0) "yes")`
+	if got := val.String(); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestEvaluateGispMatch(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func describe(x) {
+	return match x {
+	case 0: "zero"
+	case -1: "minus one"
+	case 'c': "char"
+	case nil: "empty"
+	case ` + "`" + `'sym : "symbol"
+	case [h, t...] if h > 10: t
+	case [a, [b, _]]: a + b
+	case [_, _...]: "list"
+	case #[a, a2]: a * a2
+	case n if numberp(n): n + 1
+	}
+}
+func firstNegative(xs) {
+	for x in xs {
+		if match x { case n if n < 0: true; case _: false } {
+			return x
+		}
+	}
+	return false
+}
+var match = 5
+[map(describe, [0, -1, 'c', nil, ` + "`" + `'sym, [11, 2], [1, [2, 3]], [1], #[3, 4], 7, "s"]),
+ firstNegative([3, -2, -5]), match]
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString match returned error: %v", err)
+	}
+	want := `(("zero" "minus one" "char" "empty" "symbol" (2) 3 "list" 12 8 ()) -2 5)`
+	if got := val.String(); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	// Patterns still work where the builtins they use are shadowed.
+	val, err = EvaluateGispString(ev, `
+func pick(first, rest, vectorRef, equal) {
+	return match [first, rest] {
+	case [#[1, x], "a"]: x
+	case [h, t...]: [h, t]
+	}
+}
+[pick(#[1, 2], "a", nil, nil), pick(3, 4, nil, nil)]
+`)
+	if err != nil {
+		t.Fatalf("match with shadowed builtins returned error: %v", err)
+	}
+	if got, want := val.String(), "(2 (3 (4)))"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestEvaluateGispDestructuring(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+var [a, b, more...] = [1, 2, 3, 4]
+func swap(pair) {
+	var [x, y] = pair
+	return [y, x]
+}
+var [p, q] = swap([a, b])
+p * 100 + q * 10 + length(more)
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString destructuring returned error: %v", err)
+	}
+	if val.Type != lang.TypeInt || val.Int() != 212 {
+		t.Fatalf("expected 212, got %v", val)
+	}
+
+	for _, bad := range []string{"var [x, y] = [1];", "var [x, y] = [1, 2, 3];", "var [x, y, z...] = [1];"} {
+		if _, err := EvaluateGispString(ev, bad); err == nil || !strings.Contains(err.Error(), "destructuring expects") {
+			t.Fatalf("expected arity error for %q, got %v", bad, err)
+		}
+	}
+
+	// Patterns may bind the names of the builtins that take lists apart,
+	// at the top level and over parameters of the same names.
+	ev = NewEvaluator()
+	src = `
+var [first, second] = ["x", "y"]
+var [a, b, rest...] = [1, 2, 3, 4]
+func f(first, rest) {
+	var [p, q] = [first, rest]
+	return [q, p]
+}
+[first, second, a, b, rest, f(5, 6)]
+`
+	val, err = EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("destructuring into first and rest returned error: %v", err)
+	}
+	if got, want := val.String(), `("x" "y" 1 2 (3 4) (6 5))`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	// Nor do redefinitions of the comparisons that check the element count.
+	ev = NewEvaluator()
+	if _, err := EvaluateReader(ev, strings.NewReader("(define = (lambda args #f)) (define < (lambda args #t))")); err != nil {
+		t.Fatalf("redefining = and < returned error: %v", err)
+	}
+	val, err = EvaluateGispString(ev, "var [a, b] = [1, 2]\nvar [c, more...] = [3]\n[a, b, c, more]")
+	if err != nil {
+		t.Fatalf("destructuring after redefining = and < returned error: %v", err)
+	}
+	if got, want := val.String(), "(1 2 3 ())"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestEvaluateGispMultipleValues(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func minMax(xs) {
+	var lo = first(xs)
+	var hi = lo
+	var items = rest(xs)
+	while items != [] {
+		var x = first(items)
+		if x < lo { lo = x }
+		if x > hi { hi = x }
+		items = rest(items)
+	}
+	return lo, hi
+}
+func describe(xs) {
+	var lo, hi = minMax(xs)
+	var small, _ = partition(func(x) { return x < 5 }, xs)
+	return [lo, hi, small]
+}
+var q, r = divmod(-17, 5)
+var n, ok = parseInt("7f", 16)
+var _, bad = parseInt("12x")
+[describe([4, 9, 1, 7]), q, r, n, ok, bad,
+ callWithValues(func() { return values(1, 2, 3) }, func(a, b, c) { return a + b + c }),
+ ` + "`(receive (x . more) (values 1 2 3) (list x more))" + `]
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString multiple values returned error: %v", err)
+	}
+	if got, want := val.String(), "((1 9 (4 1)) -3 -2 127 #t #f 6 (1 (2 3)))"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	tuples := `
+func fib(n) {
+	var a, b = 0, 1
+	while n > 0 {
+		a, b = b, a + b
+		n--
+	}
+	return a
+}
+func reverse(v) {
+	var i, j = 0, vectorLength(v) - 1
+	while i < j {
+		v[i], v[j] = v[j], v[i]
+		i, j = i + 1, j - 1
+	}
+	return v
+}
+struct point { x, y }
+var p = makePoint(1, 2)
+p.x, p.y = p.y, p.x
+var lo, hi = 0, 0
+lo, hi = minMax([5, 3, 8])
+var _, last = 1, "two"
+[fib(10), reverse(#[1, 2, 3, 4, 5]), p.x, p.y, lo, hi, last]
+`
+	val, err = EvaluateGispString(ev, tuples)
+	if err != nil {
+		t.Fatalf("EvaluateGispString tuple assignment returned error: %v", err)
+	}
+	if got, want := val.String(), "(55 #(5 4 3 2 1) 2 1 3 8 \"two\")"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	for _, bad := range []string{"var x, y = values(1, 2, 3);", "lo, hi = values(1, 2, 3);"} {
+		if _, err := EvaluateGispString(ev, bad); err == nil || !strings.Contains(err.Error(), "expected exactly 2 arguments, got 3") {
+			t.Fatalf("%s: expected arity error, got %v", bad, err)
+		}
+	}
+	if val, err := EvaluateGispString(ev, "divmod(7, 2)"); err != nil || val.String() != "3 1" {
+		t.Fatalf("expected multiple values printing as 3 1, got %v, %v", val, err)
+	}
+}
+
+func TestEvaluateGispDiscardIdentifier(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func second(_, x, _) { return x }
+func run() {
+	var _ = 1
+	_ = 2
+	var [_, b, _...] = [10, 20, 30, 40]
+	return second(1, b, 3)
+}
+run()
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString discard returned error: %v", err)
+	}
+	if val.Type != lang.TypeInt || val.Int() != 20 {
+		t.Fatalf("expected 20, got %v", val)
+	}
+	if _, err := ev.Global.Get("_"); err == nil {
+		t.Fatalf("expected _ to remain unbound")
+	}
+}
+
+func TestEvaluateGispInfixOperators(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+infix dot 6
+infix union 5
+func dot(a, b) {
+	return first(a) * first(b) + first(rest(a)) * first(rest(b))
+}
+func union(a, b) {
+	return append(a, b)
+}
+var joined = [1] union [2] union [3]
+[1, 2] dot [3, 4] + length(joined)
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString infix returned error: %v", err)
+	}
+	if val.Type != lang.TypeInt || val.Int() != 14 {
+		t.Fatalf("expected 14, got %v", val)
+	}
+}
+
+func TestEvaluateGispPipeline(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func inc(x) { return x + 1 }
+func add(a, b) { return a + b }
+[1, 2, 3] |> length |> inc |> add(10) |> func(n) { return n * 2 }
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString pipeline returned error: %v", err)
+	}
+	if val.Type != lang.TypeInt || val.Int() != 28 {
+		t.Fatalf("expected 28, got %v", val)
+	}
+}
+
+func TestEvaluateGispBacktickDataLiterals(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"`#[1 2 3]", "#(1 2 3)"},
+		{"vectorRef(`#[a (b c)], 1)", "(b c)"},
+		{"`{a: 1, \"b\": (2)}", `{a: 1, "b": (2)}`},
+		{"mapGet(`{a: 1, b: 2}, `'b)", "2"},
+		{"mapKeys(`{z: 1 y: 2 x: 3})", "(z y x)"},
+		{"equal(`{n: {m: 1}}, makeMap(`'n, makeMap(`'m, 1)))", "#t"},
+		{"var n = 2; var ns = [3, 4]; ``(1 ,n ,@ns . ,ns)", "(1 2 3 4 3 4)"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluateGispEqualityOperator(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"1 == 1.0", "#t"},
+		{`"abc" == "abc"`, "#t"},
+		{`"abc" != "abd"`, "#t"},
+		{"true == true", "#t"},
+		{"true == false", "#f"},
+		{"`'sym` == `'sym`", "#t"},
+		{`"1" == 1`, "#f"},
+		{"nil == nil", "#t"},
+		{"[1, 2] == nil", "#f"},
+		{"[] == nil", "#t"},
+		{"false == nil", "#f"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	if _, err := EvaluateGispString(ev, "[1] == [1]"); err == nil || !strings.Contains(err.Error(), "== cannot compare pair values; use equal") {
+		t.Fatalf("expected == to reject lists, got %v", err)
+	}
+}
+
+func TestEvaluateGispLiteralSharing(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func board() { return [0, 0] }
+func score() { return length([1, 2, 3]) + vectorRef(#[4, 5], 1) }
+var a = board()
+var b = board()
+setFirst(a, 1)
+[first(b), score() + score()]
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString literal sharing returned error: %v", err)
+	}
+	if got := val.String(); got != "(0 16)" {
+		t.Fatalf("expected (0 16), got %s", got)
+	}
 }
 
 func TestEvaluateGispWhileBreakContinue(t *testing.T) {
@@ -81,25 +437,619 @@ compute()
 	}
 }
 
-func runTutorialExample(t *testing.T, scriptName, expected string) {
-	t.Helper()
+func TestEvaluateGispWhileExpression(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func firstOver(xs, limit) {
+	return while true {
+		if xs == nil { break -1 }
+		if first(xs) > limit { break first(xs) }
+		xs = rest(xs)
+	}
+}
+var exhausted = while false { }
+[firstOver([3, 8, 11, 4], 5), firstOver([1, 2], 5), exhausted]
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString while expression returned error: %v", err)
+	}
+	if got := val.String(); got != "(8 -1 ())" {
+		t.Fatalf("expected (8 -1 ()), got %s", got)
+	}
+}
 
-	scriptPath := filepath.Join("..", "examples", scriptName)
+func TestEvaluateGispForIn(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"var t = 0; for x in [1, 2, 3] { t += x }; t", "6"},
+		{"var t = []; for i, x in #[`'a, `'b] { t = cons([i, x], t) }; t", "((1 b) (0 a))"},
+		{`var t = []; for c in "aλ" { t = cons(c, t) }; t`, `(#\λ #\a)`},
+		{`var t = []; for i, c in "aλb" { t = cons(i, t) }; t`, "(2 1 0)"},
+		{"var m = makeMap(`'a, 1, `'b, 2); var t = []; for k in m { t = cons(k, t) }; t", "(b a)"},
+		{"var m = makeMap(`'a, 1, `'b, 2); var t = 0; for _, v in m { t += v }; t", "3"},
+		{"var n = 0; for x in nil { n++ }; for x in #[] { n++ }; for x in \"\" { n++ }; n", "0"},
+		// break and continue, and a value for the next iteration that the
+		// body stores ahead of the loop.
+		{`
+func f() {
+	var t = []
+	var v = #[1, 2, 3, 4, 5, 6]
+	for i, x in v {
+		if i == 0 { v[2] = 30 }
+		if x == 2 { continue }
+		if x == 5 { break }
+		t = cons(x, t)
+	}
+	return t
+}
+f()`, "(4 30 1)"},
+		// Each iteration has its own variable.
+		{"var fs = []; for x in [1, 2, 3] { fs = cons(func() { return x }, fs) }; map(func(f) { return f() }, fs)", "(3 2 1)"},
+		// Nested loops and return from inside a loop.
+		{`
+func find(rows, want) {
+	for i, row in rows {
+		for j, x in row {
+			if x == want { return [i, j] }
+		}
+	}
+	return nil
+}
+[find([[1, 2], [3, 4]], 4), find([[1]], 5)]`, "((1 1) ())"},
+		// The index of a character is the index that reaches it with s[i].
+		{`var s = "héllo, 世界"; var same = true; for i, c in s { same = same && s[i] == c }; same`, "#t"},
+		// Loops work where the builtins they use are shadowed.
+		{`
+func total(vectorLength, vectorRef, rangeItems) {
+	var t = 0
+	for x in #[1, 2, 3] { t += x }
+	for i, x in [4, 5] { t += i * x }
+	return t
+}
+total(nil, nil, nil)`, "11"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	for src, want := range map[string]string{
+		"for x in 5 { }":          "for expects list, vector, string or map, got integer",
+		"for x in cons(1, 2) { }": "for expects proper list",
+		"for k, v in `'sym { }":   "for expects list, vector, string or map, got symbol",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
 
+func TestEvaluateGispLiteralsPassedToShadowedBuiltins(t *testing.T) {
 	ev := NewEvaluator()
-	SetArgv(ev.Global, []string{})
+	// Only the builtin first leaves its argument alone; a parameter of
+	// that name must get a fresh vector on every call.
+	src := `
+func h(first) { return first(#[1, 2]) }
+func bump(v) {
+	v[0] = v[0] + 1
+	return v
+}
+[h(bump), h(bump), first([7, 8])]
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString returned error: %v", err)
+	}
+	if got, want := val.String(), "(#(2 2) #(2 2) 7)"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
 
-	var (
-		val     lang.Value
-		evalErr error
-	)
+func TestEvaluateGispTryCatchFinally(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"throw", `
+var caught = nil
+try {
+	throw("boom")
+} catch (e) {
+	caught = e
+}
+caught`, `"boom"`},
+		{"runtimeError", `
+var tag = nil
+try {
+	vectorRef(#[1, 2], "x")
+} catch (e) {
+	tag = [errorp(e), errorTag(e)]
+}
+tag`, "(#t type-error)"},
+		{"userError", `
+var info = nil
+try {
+	error("bad input", 42)
+} catch (e) {
+	info = [errorMessage(e), errorArgs(e)]
+}
+info`, `("bad input 42" ("bad input" 42))`},
+		{"rethrow", `
+var outer = nil
+try {
+	try {
+		throw(1)
+	} catch (e) {
+		throw(e + 1)
+	}
+} catch (e) {
+	outer = e
+}
+outer`, "2"},
+		{"finallyOnReturn", `
+var log = []
+func f() {
+	try {
+		return 1
+	} finally {
+		log = cons("finally", log)
+	}
+	return 2
+}
+[f(), log]`, `(1 ("finally"))`},
+		{"finallyOnError", `
+var log = []
+try {
+	try {
+		throw("inner")
+	} finally {
+		log = cons("finally", log)
+	}
+} catch (e) {
+	log = cons(e, log)
+}
+log`, `("inner" "finally")`},
+		{"finallyOnBreak", `
+var i = 0
+while true {
+	try {
+		if i == 3 { break }
+	} finally {
+		i++
+	}
+}
+i`, "4"},
+	} {
+		ev := NewEvaluator()
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+
+	// An uncaught throw aborts the program with the thrown value.
+	_, err := EvaluateGispString(NewEvaluator(), `throw("unhandled")`)
+	if err == nil || err.Error() != "line 1:6: uncaught throw: unhandled" {
+		t.Fatalf("expected an uncaught throw error, got %v", err)
+	}
+}
+
+func TestEvaluateGispVariadic(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func sum(first, rest...) {
+	var s = first
+	for x in rest { s += x }
+	return s
+}
+var collect = func(all...) { return all }
+var more = [3, 4]
+`
+	if _, err := EvaluateGispString(ev, src); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"sum(1)", "1"},
+		{"sum(1, 2, 3)", "6"},
+		{"sum(1, more...)", "8"},
+		{"sum(more...)", "7"},
+		{"[collect(), collect(1, 2)]", "(() (1 2))"},
+		{"1 |> sum(more...)", "8"},
+		{"max(more...)", "4"},
+		{"var tail = func(_, rest...) { return rest }\ntail(1, 2)", "(2)"},
+		{"func g(apply, xs) { return list(xs...) }\ng(1, more)", "(3 4)"},
+	} {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.src, tc.want, got)
+		}
+	}
 
-	output := captureOutput(func() {
-		val, evalErr = EvaluateFile(ev, scriptPath)
+	for src, want := range map[string]string{
+		"sum()":           "expected at least 1 arguments, got 0",
+		"sum(1, 2...)":    "expected '...'",
+		"sum(1, #[2]...)": "apply expects list as final argument, got vector",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: error %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestEvaluateGispDefer(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"order", `
+var log = []
+func note(x) { log = cons(x, log) }
+func f() {
+	defer note(1)
+	defer note(2)
+	note(0)
+}
+f()
+log`, "(1 2 0)"},
+		{"argumentsEvaluatedAtDefer", `
+var log = []
+func note(x) { log = cons(x, log) }
+func f() {
+	var x = "before"
+	defer note(x)
+	x = "after"
+	return x
+}
+[f(), log]`, `("after" ("before"))`},
+		{"earlyReturnAndLoop", `
+var log = []
+func note(x) { log = cons(x, log) }
+func f(n) {
+	var i = 0
+	while i < n {
+		defer note(i)
+		if i == 2 { return "early" }
+		i++
+	}
+	return "late"
+}
+[f(5), log]`, `("early" (0 1 2))`},
+		{"onError", `
+var log = []
+func note(x) { log = cons(x, log) }
+func f() {
+	defer note("cleanup")
+	throw("boom")
+}
+var caught = nil
+try { f() } catch (e) { caught = e }
+[caught, log]`, `("boom" ("cleanup"))`},
+		{"failingDeferredCall", `
+var log = []
+func note(x) { log = cons(x, log) }
+func f() {
+	defer note("outer")
+	defer first(1)
+	return 1
+}
+var caught = nil
+try { f() } catch (e) { caught = errorMessage(e) }
+[caught, log]`, `("first expects pair, got integer" ("outer"))`},
+		{"shadowedListBuiltins", `
+var log = []
+func note(x) { log = cons(x, log) }
+func f(first, rest, cons, nullp) {
+	defer note("x")
+	return first + rest + cons + nullp
+}
+[f(1, 2, 3, 4), log]`, `(10 ("x"))`},
+		{"macroCallee", `
+var lock = makeChannel(1)
+func withLock(f) {
+	send(lock, true)
+	defer receive(lock)
+	return f()
+}
+[withLock(func() { return 1 }), withLock(func() { return 2 })]`, "(1 2)"},
+		{"perFunction", `
+var log = []
+func note(x) { log = cons(x, log) }
+func outer() {
+	defer note("outer")
+	var inner = func() { defer note("inner") }
+	inner()
+	note("body")
+}
+outer()
+log`, `("outer" "body" "inner")`},
+	} {
+		val, err := EvaluateGispString(NewEvaluator(), tc.src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestEvaluateGispOneShotContinuations(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"predicates", `
+var k = callcc(func(k) { return k })
+var k1 = call1cc(func(k) { return k })
+[continuationp(k), continuationp(k1), continuationp(func() {}), oneShotp(k), oneShotp(k1), oneShotp(1)]`,
+			"(#t #t #f #f #t #f)"},
+		{"comparedByIdentity", `
+var saved = []
+func f() { return call1cc(func(k) { saved = cons(k, saved); return k }) }
+var a = f()
+var b = f()
+[eq(a, first(rest(saved))), eq(a, b), equal(b, first(saved)), position(a, saved)]`,
+			"(#t #f #t 1)"},
+		{"escape", `
+func find(pred, xs) {
+	return call1cc(func(found) {
+		for x in xs { if pred(x) { found(x) } }
+		return false
 	})
+}
+[find(func(x) { return x > 2 }, [1, 2, 3, 4]), find(func(x) { return x > 9 }, [1, 2])]`,
+			"(3 #f)"},
+		{"resumedOnce", `
+func f() {
+	var saved = false
+	var n = 0
+	var r = call1cc(func(k) { saved = k; return 0 })
+	n = n + 1
+	if r == 0 { saved(5) }
+	return [r, n]
+}
+f()`, "(5 2)"},
+	} {
+		val, err := EvaluateGispString(NewEvaluator(), tc.src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+
+	_, err := EvaluateGispString(NewEvaluator(), `
+func f() {
+	var saved = false
+	var r = call1cc(func(k) { saved = k; return 0 })
+	if r < 2 { saved(r + 1) }
+	return r
+}
+f()`)
+	if err == nil || !strings.Contains(err.Error(), "one-shot continuation resumed twice") {
+		t.Fatalf("expected a second resume to fail, got %v", err)
+	}
+}
+
+func TestEvaluateGispErrorPositions(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"var x = 1\nx + nosuch", "line 2:3: unbound variable: nosuch"},
+		{"func f(a) {\n    return first(a)\n}\nf(1)", "line 2:17: first expects pair, got integer\n  in f, called at line 4:2"},
+		{"func f(a) {\n    var b = a\n    return b.x\n}\nf(2)", "line 3:12: getField expects struct, module or object, got integer\n  in f, called at line 5:2"},
+		{"func f(a, b) { return a }\nf(1)", "line 2:2: expected exactly 2 arguments, got 1"},
+		{"var v = [1]\nfor x in v {\n    display(x[0])\n}", "line 3:14: ref expects vector, string, list or map, got integer"},
+		{"func g() { throw(\"up\") }\ntry { g() } catch (e) { throw(e) }", "line 2:30: uncaught throw: up"},
+		{"`(first 1)", "line 1:1: first expects pair, got integer"},
+	}
+	for _, tc := range cases {
+		_, err := EvaluateGispString(NewEvaluator(), tc.src)
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("%q: error %v, want %s", tc.src, err, tc.want)
+		}
+	}
+
+	// A caught error carries no position: it is the error the program
+	// raised, and the position is added only when it escapes.
+	val, err := EvaluateGispString(NewEvaluator(), "var m = false\ntry { first(1) } catch (e) { m = errorMessage(e) }\nm")
+	if err != nil || val.String() != `"first expects pair, got integer"` {
+		t.Fatalf("caught error message => %v, %v", val, err)
+	}
+}
+
+func TestEvaluateGispStruct(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"fields", `
+struct point { x, y }
+var p = makePoint(1, 2)
+p.x = p.x + 10
+p.y *= 3
+p.y++
+[p.x, p.y, p]`, "(11 7 #<point x: 11, y: 7>)"},
+		{"predicate", `
+struct point { x, y }
+struct size { x, y }
+[pointp(makePoint(1, 2)), pointp(makeSize(1, 2)), pointp([1, 2]), recordp(makeSize(0, 0))]`, "(#t #f #f #t)"},
+		{"nested", `
+struct point { x, y }
+struct line { from, to }
+func length2(l) {
+	var dx = l.to.x - l.from.x
+	var dy = l.to.y - l.from.y
+	return dx * dx + dy * dy
+}
+var l = makeLine(makePoint(0, 0), makePoint(3, 4))
+l.to.x = 6
+[length2(l), equal(makePoint(1, 2), makePoint(1, 2)), eq(l.from, l.from)]`, "(52 #t #t)"},
+		{"selected from any value", `
+struct point { x, y }
+struct line { from, to }
+var ps = #[makePoint(1, 2), makePoint(3, 4)]
+func mk() { return makeLine(ps[0], ps[1]) }
+ps[0].x = 5
+ps[1].y += 10
+var calls = 0
+func second() { calls++; return 1 }
+ps[second()].x *= 2
+[ps[0].x, ps[1].y, mk().to.y, mk().from.x + ps[1].x, [ps[1]][0].x, calls]`, "(5 14 14 11 6 1)"},
+	} {
+		ev := NewEvaluator()
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		src     string
+		wantErr string
+	}{
+		{"struct point { x, y }\nmakePoint(1)", "makePoint expects 2 arguments, got 1"},
+		{"struct point { x, y }\nvar p = makePoint(1, 2)\np.z", "point has no field z"},
+		{"struct point { x, y }\nvar p = makePoint(1, 2)\np.z = 1", "point has no field z"},
+		{"var n = 1\nn.x", "getField expects struct, module or object"},
+	} {
+		if _, err := EvaluateGispString(NewEvaluator(), tc.src); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%q: expected error containing %q, got %v", tc.src, tc.wantErr, err)
+		}
+	}
+}
+
+func TestEvaluateGispTailCallsRunInConstantDepth(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"self", `
+func count(n, acc) {
+	if n == 0 { return acc }
+	return count(n - 1, acc + 1)
+}
+count(100000, 0)`, "100000"},
+		{"mutual", `
+func isEven(n) { if n == 0 { return true } return isOdd(n - 1) }
+func isOdd(n) { if n == 0 { return false } return isEven(n - 1) }
+isEven(100001)`, "#f"},
+		{"ifExpression", `
+func down(n) { return if n == 0 { "done" } else { down(n - 1) } }
+down(100000)`, `"done"`},
+		{"while", `
+var i = 0
+var odd = 0
+while i < 100000 {
+	i++
+	if i % 2 == 0 { continue }
+	odd++
+}
+odd`, "50000"},
+	} {
+		ev := NewEvaluator()
+		ev.MaxDepth = 100
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+}
 
+func TestEvaluateGispFactorialIsExact(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+func fact(n) {
+	if n == 0 { return 1 }
+	return n * fact(n - 1)
+}
+fact(100)
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString factorial returned error: %v", err)
+	}
+	want := "93326215443944152681699238856266700490715968264381621468592963895217599993229915608941463976156518286253697920827223758251185210916864000000000000000000000000"
+	if val.Type != lang.TypeBigInt || val.String() != want {
+		t.Fatalf("expected 100! = %s, got %v", want, val)
+	}
+}
+
+func TestEvaluateGispIndexSyntaxIsPolymorphic(t *testing.T) {
+	ev := NewEvaluator()
+	src := `
+var word = "gísp"
+var backwards = ""
+var i = vectorLength(stringToVector(word)) - 1
+while i >= 0 {
+	backwards = str(backwards, word[i])
+	i--
+}
+var ages = makeMap("ann", 31, "bob", 27)
+[backwards, [10, 20, 30][2], #[4, 5][0], ages["bob"], ages["eve"]]
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("EvaluateGispString index syntax returned error: %v", err)
+	}
+	if got := val.String(); got != `("psíg" 30 4 27 #f)` {
+		t.Fatalf("expected (\"psíg\" 30 4 27 #f), got %s", got)
+	}
+
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{`"abc"[3]`, "ref index 3 out of range for length 3"},
+		{`"héllo"[5]`, "ref index 5 out of range for length 5"},
+		{`[1, 2][-1]`, "ref index -1 out of range for list"},
+		{`[1, 2][5]`, "ref index 5 out of range for list"},
+		{`#[1]["a"]`, "ref expects integer, got string"},
+		{`var n = 5; n[0]`, "ref expects vector, string, list or map, got integer"},
+	} {
+		if _, err := EvaluateGispString(ev, tc.src); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.src, tc.want, err)
+		}
+	}
+}
+
+func runTutorialExample(t *testing.T, scriptName, expected string) {
+	t.Helper()
+
+	scriptPath := filepath.Join("..", "examples", scriptName)
+	val, output, evalErr := RunScriptCaptured(scriptPath)
 	if evalErr != nil {
-		t.Fatalf("EvaluateFile(%s) error: %v", scriptName, evalErr)
+		t.Fatalf("RunScriptCaptured(%s) error: %v", scriptName, evalErr)
 	}
 
 	if val.Type == lang.TypeContinuation || val.Type == lang.TypeMacro {
@@ -442,3 +1392,36 @@ func TestUnifyComplex(t *testing.T) {
 		t.Fatalf("unify((f x x), (f a a)) should succeed, got error: %s", val.String())
 	}
 }
+
+func TestRunScriptCapturedKeepsOutputOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fail.gisp")
+	src := "display(\"before\");\nnewline();\nundefinedFunction();\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, output, err := RunScriptCaptured(path)
+	if err == nil || !strings.Contains(err.Error(), "undefinedFunction") {
+		t.Fatalf("expected unbound variable error, got %v", err)
+	}
+	if output != "before\n" {
+		t.Fatalf("unexpected output %q", output)
+	}
+}
+
+func TestEvaluateFileCallsMain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.gisp")
+	src := "func main(args) {\n    display(first(args));\n}\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ev := NewEvaluator()
+	SetArgv(ev.Global, []string{"hello"})
+	var out strings.Builder
+	ev.SetOutput(&out)
+	if _, err := EvaluateFile(ev, path); err != nil {
+		t.Fatalf("EvaluateFile failed: %v", err)
+	}
+	if out.String() != "hello" {
+		t.Fatalf("expected main to print its first argument, got %q", out.String())
+	}
+}
@@ -0,0 +1,386 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sergev/gisp/lang"
+)
+
+var (
+	valueType     = reflect.TypeOf(lang.Value{})
+	evaluatorType = reflect.TypeOf((*lang.Evaluator)(nil))
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterFunc binds the Go function fn to name in env, converting
+// arguments and results with reflection so that no Primitive wrapper has to
+// be written by hand. Parameters and results may be integers, floats,
+// strings, booleans, slices and maps of those, interface{} or lang.Value;
+// a first parameter of type *lang.Evaluator receives the calling evaluator.
+// Slices are passed in as lists or vectors and come back as lists. A
+// trailing error result, when not nil, becomes the error of the call; no
+// other result yields the empty list, and several yield a list of them. A
+// variadic fn accepts any number of trailing arguments.
+func RegisterFunc(env *lang.Env, name string, fn interface{}) error {
+	fv := reflect.ValueOf(fn)
+	if !fv.IsValid() {
+		return fmt.Errorf("RegisterFunc %s: expected a function, got nil", name)
+	}
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return fmt.Errorf("RegisterFunc %s: expected a function, got %s", name, ft)
+	}
+	if fv.IsNil() {
+		return fmt.Errorf("RegisterFunc %s: expected a function, got a nil %s", name, ft)
+	}
+	first := 0
+	if ft.NumIn() > 0 && ft.In(0) == evaluatorType {
+		first = 1
+	}
+	for i := first; i < ft.NumIn(); i++ {
+		t := ft.In(i)
+		if ft.IsVariadic() && i == ft.NumIn()-1 {
+			t = t.Elem()
+		}
+		if !convertible(t) {
+			return fmt.Errorf("RegisterFunc %s: unsupported parameter type %s", name, t)
+		}
+	}
+	results := ft.NumOut()
+	withError := results > 0 && ft.Out(results-1) == errorType
+	if withError {
+		results--
+	}
+	for i := 0; i < results; i++ {
+		if !convertible(ft.Out(i)) {
+			return fmt.Errorf("RegisterFunc %s: unsupported result type %s", name, ft.Out(i))
+		}
+	}
+
+	arity := ft.NumIn() - first
+	if ft.IsVariadic() {
+		arity--
+	}
+	doc := name + strings.TrimPrefix(ft.String(), "func")
+	Register(env, name, arity, ft.IsVariadic(), doc, func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		in := make([]reflect.Value, 0, first+len(args))
+		if first == 1 {
+			in = append(in, reflect.ValueOf(ev))
+		}
+		for i, arg := range args {
+			var t reflect.Type
+			if ft.IsVariadic() && first+i >= ft.NumIn()-1 {
+				t = ft.In(ft.NumIn() - 1).Elem()
+			} else {
+				t = ft.In(first + i)
+			}
+			v, err := toGo(name, arg, t)
+			if err != nil {
+				return lang.Value{}, err
+			}
+			in = append(in, v)
+		}
+		out := fv.Call(in)
+		if withError {
+			if err, _ := out[results].Interface().(error); err != nil {
+				return lang.Value{}, err
+			}
+		}
+		vals := make([]lang.Value, results)
+		for i := range vals {
+			val, err := fromGo(name, out[i])
+			if err != nil {
+				return lang.Value{}, err
+			}
+			vals[i] = val
+		}
+		switch results {
+		case 0:
+			return lang.EmptyList, nil
+		case 1:
+			return vals[0], nil
+		default:
+			return lang.List(vals...), nil
+		}
+	})
+	return nil
+}
+
+// DefineConst binds name in env to value, converted from Go the way
+// RegisterFunc converts results: integers, floats, strings, booleans,
+// slices as lists, maps, and interface{} holding any of those. A lang.Value
+// is bound as it is, and nil binds the empty list. Embedders use it to hand
+// configuration to a script before evaluating it.
+func DefineConst(env *lang.Env, name string, value interface{}) error {
+	val, err := constValue(name, value)
+	if err != nil {
+		return err
+	}
+	env.Define(name, val)
+	return nil
+}
+
+// DefineConsts binds each name of values in env like DefineConst. It
+// converts every value before binding any, so that on error env is left
+// unchanged.
+func DefineConsts(env *lang.Env, values map[string]interface{}) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vals := make([]lang.Value, len(names))
+	for i, name := range names {
+		val, err := constValue(name, values[name])
+		if err != nil {
+			return err
+		}
+		vals[i] = val
+	}
+	for i, name := range names {
+		env.Define(name, vals[i])
+	}
+	return nil
+}
+
+// constValue converts the Go value of the constant name to a Gisp value.
+func constValue(name string, value interface{}) (lang.Value, error) {
+	if name == "" {
+		return lang.Value{}, errors.New("DefineConst: empty name")
+	}
+	if value == nil {
+		return lang.EmptyList, nil
+	}
+	v := reflect.ValueOf(value)
+	if !convertible(v.Type()) {
+		return lang.Value{}, fmt.Errorf("DefineConst %s: unsupported type %s", name, v.Type())
+	}
+	return fromGo("DefineConst "+name, v)
+}
+
+// convertible reports whether values of type t can cross between Gisp and
+// Go.
+func convertible(t reflect.Type) bool {
+	if t == valueType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Interface:
+		return t.NumMethod() == 0
+	case reflect.Slice:
+		return convertible(t.Elem())
+	case reflect.Map:
+		return convertible(t.Key()) && convertible(t.Elem())
+	default:
+		return false
+	}
+}
+
+// toGo converts an argument of the primitive name to the Go type t.
+func toGo(name string, v lang.Value, t reflect.Type) (reflect.Value, error) {
+	if t == valueType {
+		return reflect.ValueOf(v), nil
+	}
+	out := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := lang.AsBool(v)
+		if err != nil {
+			return out, typeError(name, "boolean", v)
+		}
+		out.SetBool(b)
+	case reflect.String:
+		s, err := lang.AsString(v)
+		if err != nil {
+			return out, typeError(name, "string", v)
+		}
+		out.SetString(s)
+	case reflect.Float32, reflect.Float64:
+		f, err := lang.AsFloat(v)
+		if err != nil {
+			return out, typeError(name, "number", v)
+		}
+		out.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type != lang.TypeInt {
+			return out, typeError(name, "integer", v)
+		}
+		if out.OverflowInt(v.Int()) {
+			return out, fmt.Errorf("%s: %d overflows %s", name, v.Int(), t)
+		}
+		out.SetInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		switch {
+		case v.Type == lang.TypeInt && v.Int() >= 0:
+			n = uint64(v.Int())
+		case v.Type == lang.TypeBigInt && v.BigInt().IsUint64():
+			n = v.BigInt().Uint64()
+		case v.Type == lang.TypeInt || v.Type == lang.TypeBigInt:
+			return out, fmt.Errorf("%s: %s overflows %s", name, v, t)
+		default:
+			return out, typeError(name, "integer", v)
+		}
+		if out.OverflowUint(n) {
+			return out, fmt.Errorf("%s: %d overflows %s", name, n, t)
+		}
+		out.SetUint(n)
+	case reflect.Slice:
+		items, err := lang.AsSlice(v)
+		if err != nil {
+			return out, typeError(name, "list or vector", v)
+		}
+		out = reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			elem, err := toGo(name, item, t.Elem())
+			if err != nil {
+				return out, err
+			}
+			out.Index(i).Set(elem)
+		}
+	case reflect.Map:
+		m := v.Map()
+		if v.Type != lang.TypeMap || m == nil {
+			return out, typeError(name, "map", v)
+		}
+		out = reflect.MakeMapWithSize(t, m.Len())
+		for _, key := range m.Keys() {
+			k, err := toGo(name, key, t.Key())
+			if err != nil {
+				return out, err
+			}
+			val, _ := m.Get(key)
+			elem, err := toGo(name, val, t.Elem())
+			if err != nil {
+				return out, err
+			}
+			out.SetMapIndex(k, elem)
+		}
+	case reflect.Interface:
+		if g := plainGo(v); g != nil {
+			out.Set(reflect.ValueOf(g))
+		}
+	}
+	return out, nil
+}
+
+// plainGo returns the Go value an interface{} parameter receives for v:
+// int64, *big.Int, float64, string, bool, []interface{} for a list or
+// vector, map[interface{}]interface{} for a map, and v itself otherwise.
+func plainGo(v lang.Value) interface{} {
+	switch v.Type {
+	case lang.TypeInt:
+		return v.Int()
+	case lang.TypeBigInt:
+		return v.BigInt()
+	case lang.TypeReal:
+		return v.Real()
+	case lang.TypeString:
+		return v.Str()
+	case lang.TypeBool:
+		return v.Bool()
+	case lang.TypeEmpty, lang.TypePair, lang.TypeVector:
+		items, err := lang.AsSlice(v)
+		if err != nil {
+			return v
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = plainGo(item)
+		}
+		return out
+	case lang.TypeMap:
+		m := v.Map()
+		if m == nil {
+			return v
+		}
+		out := make(map[interface{}]interface{}, m.Len())
+		for _, key := range m.Keys() {
+			val, _ := m.Get(key)
+			out[plainGo(key)] = plainGo(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// fromGo converts a result of the primitive name to a Gisp value.
+func fromGo(name string, v reflect.Value) (lang.Value, error) {
+	if v.Type() == valueType {
+		return v.Interface().(lang.Value), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return lang.BoolValue(v.Bool()), nil
+	case reflect.String:
+		return lang.StringValue(v.String()), nil
+	case reflect.Float32, reflect.Float64:
+		return lang.RealValue(v.Float()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lang.IntValue(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n := v.Uint(); n > math.MaxInt64 {
+			return lang.BigIntValue(new(big.Int).SetUint64(n)), nil
+		}
+		return lang.IntValue(int64(v.Uint())), nil
+	case reflect.Slice:
+		items := make([]lang.Value, v.Len())
+		for i := range items {
+			item, err := fromGo(name, v.Index(i))
+			if err != nil {
+				return lang.Value{}, err
+			}
+			items[i] = item
+		}
+		return lang.List(items...), nil
+	case reflect.Map:
+		type entry struct{ key, val lang.Value }
+		entries := make([]entry, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromGo(name, iter.Key())
+			if err != nil {
+				return lang.Value{}, err
+			}
+			val, err := fromGo(name, iter.Value())
+			if err != nil {
+				return lang.Value{}, err
+			}
+			entries = append(entries, entry{key, val})
+		}
+		// Go maps have no order; sorting the keys keeps the result the
+		// same on every run.
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key.String() < entries[j].key.String()
+		})
+		m := lang.NewMap()
+		for _, e := range entries {
+			if err := m.Set(e.key, e.val); err != nil {
+				return lang.Value{}, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return lang.MapValue(m), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return lang.EmptyList, nil
+		}
+		inner := v.Elem()
+		if !convertible(inner.Type()) {
+			return lang.Value{}, fmt.Errorf("%s: cannot convert result of type %s", name, inner.Type())
+		}
+		return fromGo(name, inner)
+	default:
+		return lang.Value{}, errors.New(name + ": cannot convert result of type " + v.Type().String())
+	}
+}
@@ -0,0 +1,161 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	ev := NewEvaluator()
+	funcs := map[string]interface{}{
+		"goAdd": func(a, b int64) int64 { return a + b },
+		"goScale": func(xs []float64, k float64) []float64 {
+			out := make([]float64, len(xs))
+			for i, x := range xs {
+				out[i] = x * k
+			}
+			return out
+		},
+		"goJoin": func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"goNot":  func(b bool) bool { return !b },
+		"goByte": func(b uint8) uint8 { return b },
+		"goCounts": func(words []string) map[string]int {
+			counts := make(map[string]int)
+			for _, w := range words {
+				counts[w]++
+			}
+			return counts
+		},
+		"goSum": func(m map[string]int) int {
+			total := 0
+			for _, n := range m {
+				total += n
+			}
+			return total
+		},
+		"goDivMod": func(a, b int) (int, int, error) {
+			if b == 0 {
+				return 0, 0, errors.New("division by zero")
+			}
+			return a / b, a % b, nil
+		},
+		"goDescribe": func(x interface{}) string { return fmt.Sprintf("%T", x) },
+		"goIdentity": func(v lang.Value) lang.Value { return v },
+		"goDepth":    func(ev *lang.Evaluator, n int) bool { return ev != nil && n > 0 },
+		"goNothing":  func() {},
+	}
+	for name, fn := range funcs {
+		if err := RegisterFunc(ev.Global, name, fn); err != nil {
+			t.Fatalf("RegisterFunc(%s) failed: %v", name, err)
+		}
+	}
+
+	cases := []struct {
+		src     string
+		want    string
+		wantErr string
+	}{
+		{src: "goAdd(40, 2)", want: "42"},
+		{src: "goAdd(1)", wantErr: "goAdd expects 2 arguments, got 1"},
+		{src: `goAdd(1, "x")`, wantErr: "goAdd expects integer, got string"},
+		{src: "goScale([1, 2.5], 2)", want: "(2 5)"},
+		{src: "goScale(vector(1, 2), 3)", want: "(3 6)"},
+		{src: `goJoin("-", "a", "b", "c")`, want: `"a-b-c"`},
+		{src: `goJoin(",")`, want: `""`},
+		{src: "goNot(false)", want: "#t"},
+		{src: "goByte(255)", want: "255"},
+		{src: "goByte(256)", wantErr: "goByte: 256 overflows uint8"},
+		{src: "goByte(-1)", wantErr: "goByte: -1 overflows uint8"},
+		{src: `goCounts(["b", "a", "b"])`, want: `{"a": 1, "b": 2}`},
+		{src: `goSum(makeMap("x", 3, "y", 4))`, want: "7"},
+		{src: "goDivMod(7, 2)", want: "(3 1)"},
+		{src: "goDivMod(7, 0)", wantErr: "division by zero"},
+		{src: "goDescribe(1)", want: `"int64"`},
+		{src: "goDescribe([1, 2])", want: `"[]interface {}"`},
+		{src: "goDescribe(`'sym)", want: `"lang.Value"`},
+		{src: "goIdentity(`'sym)", want: "sym"},
+		{src: "goDepth(3)", want: "#t"},
+		{src: "goNothing()", want: "()"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("%s: expected error %q, got %v", tc.src, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	if info, ok := LookupPrimitive("goAdd"); !ok || info.Doc != "goAdd(int64, int64) int64" {
+		t.Fatalf("unexpected goAdd info %+v", info)
+	}
+}
+
+func TestRegisterFuncRejectsUnsupportedTypes(t *testing.T) {
+	env := NewEvaluator().Global
+	cases := []struct {
+		fn      interface{}
+		wantErr string
+	}{
+		{42, "expected a function"},
+		{nil, "expected a function, got nil"},
+		{(func(int) int)(nil), "expected a function, got a nil func(int) int"},
+		{func(c chan int) {}, "unsupported parameter type chan int"},
+		{func() *int { return nil }, "unsupported result type *int"},
+	}
+	for _, tc := range cases {
+		err := RegisterFunc(env, "bad", tc.fn)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("RegisterFunc(%T): expected error %q, got %v", tc.fn, tc.wantErr, err)
+		}
+	}
+}
+
+func TestDefineConst(t *testing.T) {
+	ev := NewEvaluator()
+	if err := DefineConst(ev.Global, "maxUsers", 100); err != nil {
+		t.Fatalf("DefineConst failed: %v", err)
+	}
+	err := DefineConsts(ev.Global, map[string]interface{}{
+		"appName": "demo",
+		"ratio":   0.5,
+		"debug":   true,
+		"hosts":   []string{"a", "b"},
+		"limits":  map[string]int{"cpu": 2},
+		"nothing": nil,
+		"mixed":   []interface{}{1, "x", nil},
+		"sym":     lang.SymbolValue("ok"),
+	})
+	if err != nil {
+		t.Fatalf("DefineConsts failed: %v", err)
+	}
+	val, err := EvaluateGispString(ev, `[maxUsers + 1, appName, ratio, debug, hosts, limits["cpu"], nothing, mixed, sym]`)
+	if err != nil {
+		t.Fatalf("evaluating constants failed: %v", err)
+	}
+	if got, want := val.String(), `(101 "demo" 0.5 #t ("a" "b") 2 () (1 "x" ()) ok)`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	err = DefineConsts(ev.Global, map[string]interface{}{"good": 1, "bad": make(chan int)})
+	if err == nil || !strings.Contains(err.Error(), "DefineConst bad: unsupported type chan int") {
+		t.Fatalf("expected unsupported type error, got %v", err)
+	}
+	if _, ok := ev.Global.Own("good"); ok {
+		t.Fatal("DefineConsts bound a name despite failing")
+	}
+	if err := DefineConst(ev.Global, "", 1); err == nil {
+		t.Fatal("expected an error for an empty name")
+	}
+}
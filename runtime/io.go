@@ -0,0 +1,104 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/sexpr"
+)
+
+func installIOPrimitives(env *lang.Env) {
+	define := func(name string, fn lang.Primitive) {
+		env.Define(name, lang.PrimitiveValue(fn))
+	}
+
+	define("display", primDisplay)
+	define("newline", primNewline)
+	Register(env, "printf", 1, true,
+		"printf(format, x, ...) prints format with Go-style verbs replaced by the arguments, like format.", primPrintf)
+	define("prettyPrint", primPrettyPrint)
+	define("read", primRead)
+}
+
+func primDisplay(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) != 1 {
+		return lang.Value{}, arityError("display", 1, 1, len(args))
+	}
+	fmt.Fprint(ev.Output(), displayString(args[0]))
+	return lang.EmptyList, nil
+}
+
+// displayString returns v as display prints it: strings and characters
+// bare, and other values in the reader syntax.
+func displayString(v lang.Value) string {
+	switch v.Type {
+	case lang.TypeString:
+		return v.Str()
+	case lang.TypeChar:
+		return string(v.Char())
+	default:
+		return v.String()
+	}
+}
+
+func primPrettyPrint(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return lang.Value{}, arityError("prettyPrint", 1, 2, len(args))
+	}
+	width := int64(sexpr.DefaultWidth)
+	if len(args) == 2 {
+		w, err := requireIntArg("prettyPrint", args[1])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if w <= 0 {
+			return lang.Value{}, fmt.Errorf("prettyPrint width must be positive, got %d", w)
+		}
+		width = w
+	}
+	fmt.Fprintln(ev.Output(), sexpr.Format(args[0], int(width)))
+	return lang.EmptyList, nil
+}
+
+func primNewline(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) != 0 {
+		return lang.Value{}, arityError("newline", 0, 0, len(args))
+	}
+	fmt.Fprintln(ev.Output())
+	return lang.EmptyList, nil
+}
+
+func primPrintf(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	format, err := requireStringArg("printf", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	text, err := formatValues("printf", format, args[1:])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	fmt.Fprint(ev.Output(), text)
+	return lang.EmptyList, nil
+}
+
+func primRead(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) != 0 {
+		return lang.Value{}, arityError("read", 0, 0, len(args))
+	}
+	val, err := ev.StdinValues(openValues).Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return lang.EOFObject, nil
+		}
+		return lang.Value{}, err
+	}
+	return val, nil
+}
+
+// openValues parses the evaluator's standard input as s-expressions for
+// read.
+func openValues(r io.Reader) lang.ValueReader {
+	return sexpr.NewReader(r)
+}
@@ -21,5 +21,13 @@ var preludeForms = []string{
             (let ((sym (gensym)))
               (list 'let (list (list sym (first args)))
                     (list 'if sym sym (cons 'or rst))))))))
+`,
+	`
+(define-macro (receive formals . more)
+  (if (nullp more)
+      (list 'channelReceive formals)
+      (list 'callWithValues
+            (list 'lambda '() (first more))
+            (cons 'lambda (cons formals (rest more))))))
 `,
 }
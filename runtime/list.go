@@ -0,0 +1,180 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func installListPrimitives(env *lang.Env) {
+	Register(env, "position", 2, false,
+		"position(x, list) returns the index of the first element equal to x, or false.", primPosition)
+	Register(env, "count", 2, false,
+		"count(pred, list) returns how many elements satisfy pred.", primCount)
+	Register(env, "findIf", 2, false,
+		"findIf(pred, list) returns the first element satisfying pred, or false.", primFindIf)
+	Register(env, "removeIf", 2, false,
+		"removeIf(pred, list) returns a new list without the elements satisfying pred.", primRemoveIf)
+	Register(env, "zip", 0, true,
+		"zip(a, b, ...) returns a list of lists holding the elements of the given lists or vectors at each index, up to the shortest.", primZip)
+	Register(env, "unzip", 1, false,
+		"unzip(rows) returns the columns of a list of equally long lists, undoing zip.", primUnzip)
+	Register(env, "enumerate", 1, false,
+		"enumerate(seq) returns a list of (index value) pairs for the elements of a list or vector.", primEnumerate)
+}
+
+// requireSequenceArg returns the elements of the list or vector v.
+func requireSequenceArg(name string, v lang.Value) ([]lang.Value, error) {
+	items, err := lang.AsSlice(v)
+	if err != nil {
+		return nil, typeError(name, "list or vector", v)
+	}
+	return items, nil
+}
+
+func requireListArg(name string, v lang.Value) ([]lang.Value, error) {
+	items, err := lang.ToSlice(v)
+	if err != nil {
+		return nil, typeError(name, "list", v)
+	}
+	return items, nil
+}
+
+func primPosition(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	items, err := requireListArg("position", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	for i, item := range items {
+		if equalValues(args[0], item) {
+			return lang.IntValue(int64(i)), nil
+		}
+	}
+	return lang.BoolValue(false), nil
+}
+
+// scanList applies pred to each element of list in order and calls visit
+// with the element and whether pred held; visit returns false to stop. The
+// predicate runs through lang.Callback, and the primitive's result is done
+// once the scan ends.
+func scanList(name string, pred, list lang.Value, visit func(item lang.Value, match bool) bool, done func() lang.Value) (lang.Value, error) {
+	items, err := requireListArg(name, list)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	var step func(i int) lang.Value
+	step = func(i int) lang.Value {
+		if i == len(items) {
+			return done()
+		}
+		return lang.Callback(pred, []lang.Value{items[i]}, func(res lang.Value) (lang.Value, error) {
+			if !visit(items[i], lang.IsTruthy(res)) {
+				return done(), nil
+			}
+			return step(i + 1), nil
+		})
+	}
+	return step(0), nil
+}
+
+func primCount(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	var n int64
+	return scanList("count", args[0], args[1], func(item lang.Value, match bool) bool {
+		if match {
+			n++
+		}
+		return true
+	}, func() lang.Value {
+		return lang.IntValue(n)
+	})
+}
+
+func primFindIf(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	found := lang.BoolValue(false)
+	return scanList("findIf", args[0], args[1], func(item lang.Value, match bool) bool {
+		if match {
+			found = item
+		}
+		return !match
+	}, func() lang.Value {
+		return found
+	})
+}
+
+func primRemoveIf(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	var kept []lang.Value
+	return scanList("removeIf", args[0], args[1], func(item lang.Value, match bool) bool {
+		if !match {
+			kept = append(kept, item)
+		}
+		return true
+	}, func() lang.Value {
+		return lang.List(kept...)
+	})
+}
+
+func primZip(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) == 0 {
+		return lang.EmptyList, nil
+	}
+	seqs := make([][]lang.Value, len(args))
+	n := -1
+	for i, arg := range args {
+		items, err := requireSequenceArg("zip", arg)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		seqs[i] = items
+		if n < 0 || len(items) < n {
+			n = len(items)
+		}
+	}
+	rows := make([]lang.Value, n)
+	for i := range rows {
+		row := make([]lang.Value, len(seqs))
+		for j, items := range seqs {
+			row[j] = items[i]
+		}
+		rows[i] = lang.List(row...)
+	}
+	return lang.List(rows...), nil
+}
+
+func primUnzip(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	rows, err := requireSequenceArg("unzip", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	var cols [][]lang.Value
+	for i, row := range rows {
+		items, err := requireSequenceArg("unzip", row)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if i == 0 {
+			cols = make([][]lang.Value, len(items))
+		} else if len(items) != len(cols) {
+			return lang.Value{}, fmt.Errorf("unzip: element %d has %d items, want %d", i, len(items), len(cols))
+		}
+		for j, item := range items {
+			cols[j] = append(cols[j], item)
+		}
+	}
+	out := make([]lang.Value, len(cols))
+	for j, col := range cols {
+		out[j] = lang.List(col...)
+	}
+	return lang.List(out...), nil
+}
+
+func primEnumerate(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	items, err := requireSequenceArg("enumerate", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	pairs := make([]lang.Value, len(items))
+	for i, item := range items {
+		pairs[i] = lang.List(lang.IntValue(int64(i)), item)
+	}
+	return lang.List(pairs...), nil
+}
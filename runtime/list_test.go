@@ -0,0 +1,99 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestListScanPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"position found", `position("b", ["a", "b", "c"])`, "1"},
+		{"position uses equal", "position([1, 2], [[0], [1, 2]])", "1"},
+		{"position missing", "position(9, [1, 2, 3])", "#f"},
+		{"count", "count(func(x) { return x > 1 }, [1, 2, 3, 4])", "3"},
+		{"count empty", "count(func(x) { return true }, [])", "0"},
+		{"findIf", "findIf(func(x) { return x % 2 == 0 }, [1, 3, 4, 6])", "4"},
+		{"findIf missing", "findIf(func(x) { return x > 10 }, [1, 2])", "#f"},
+		{"removeIf", "removeIf(func(x) { return x % 2 == 0 }, [1, 2, 3, 4])", "(1 3)"},
+		{"removeIf all", "removeIf(func(x) { return true }, [1, 2])", "()"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			val, err := EvaluateGispString(ev, tc.src)
+			if err != nil {
+				t.Fatalf("%s failed: %v", tc.src, err)
+			}
+			if got := val.String(); got != tc.want {
+				t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+			}
+		})
+	}
+
+	// findIf stops at the first match.
+	val, err := EvaluateGispString(ev, `
+var calls = 0
+findIf(func(x) { calls = calls + 1; return x == 2 }, [1, 2, 3, 4])
+calls
+`)
+	if err != nil || val.String() != "2" {
+		t.Fatalf("expected findIf to stop after 2 calls, got %v (%v)", val, err)
+	}
+
+	errorCases := map[string]string{
+		"position(1, 2)":                 "position expects list, got integer",
+		"count(func(x) { return x }, 5)": "count expects list, got integer",
+		"removeIf(1, [1])":               "attempt to call non-function",
+	}
+	for src, want := range errorCases {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestZipAndEnumerate(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`zip([1, 2, 3], ["a", "b", "c"])`, `((1 "a") (2 "b") (3 "c"))`},
+		{`zip([1, 2, 3], #["a", "b"], [true, false, true])`, `((1 "a" #t) (2 "b" #f))`},
+		{`zip([1, 2])`, `((1) (2))`},
+		{`zip([], [1])`, `()`},
+		{`zip()`, `()`},
+		{`unzip([[1, "a"], [2, "b"], [3, "c"]])`, `((1 2 3) ("a" "b" "c"))`},
+		{`unzip(zip([1, 2, 3], [4, 5]))`, `((1 2) (4 5))`},
+		{`unzip(#[#[1, 2]])`, `((1) (2))`},
+		{`unzip([])`, `()`},
+		{`enumerate(["x", "y"])`, `((0 "x") (1 "y"))`},
+		{`enumerate(#[7])`, `((0 7))`},
+		{`enumerate([])`, `()`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	errorCases := map[string]string{
+		`zip([1], 2)`:          "zip expects list or vector, got integer",
+		`unzip([[1, 2], [3]])`: "unzip: element 1 has 1 items, want 2",
+		`unzip([1])`:           "unzip expects list or vector, got integer",
+		`enumerate("ab")`:      "enumerate expects list or vector, got string",
+	}
+	for src, want := range errorCases {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
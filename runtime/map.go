@@ -0,0 +1,225 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Maps iterate in the order their keys were first inserted, so every
+// primitive below that lists or builds a map produces the same order on
+// every run.
+
+func installMapPrimitives(env *lang.Env) {
+	Register(env, "makeMap", 0, true,
+		"makeMap(k1, v1, ...) returns a new map holding the given key/value pairs.", primMakeMap)
+	Register(env, "mapp", 1, false, "mapp(x) reports whether x is a map.", primIsMap)
+	Register(env, "mapLength", 1, false, "mapLength(m) returns the number of entries in m.", primMapLength)
+	Register(env, "mapGet", 2, true,
+		"mapGet(m, key [, default]) returns the value stored under key, or default (false if omitted).", primMapGet)
+	Register(env, "mapSet", 3, false, "mapSet(m, key, value) stores value under key and returns m.", primMapSet)
+	Register(env, "mapHas", 2, false, "mapHas(m, key) reports whether m has an entry for key.", primMapHas)
+	Register(env, "mapDelete", 2, false,
+		"mapDelete(m, key) removes the entry for key and reports whether it existed.", primMapDelete)
+	Register(env, "mapKeys", 1, false, "mapKeys(m) returns the keys of m in insertion order.", primMapKeys)
+	Register(env, "mapValues", 1, false, "mapValues(m) returns the values of m in insertion order.", primMapValues)
+	Register(env, "mapEntries", 1, false,
+		"mapEntries(m) returns the entries of m as (key . value) pairs in insertion order.", primMapEntries)
+	Register(env, "mapMerge", 1, true,
+		"mapMerge(m1, m2, ...) returns a new map with the entries of all maps; later maps win.", primMapMerge)
+	Register(env, "mapMap", 2, false,
+		"mapMap(f, m) returns a new map whose values are f(key, value).", primMapMap)
+	Register(env, "mapFilter", 2, false,
+		"mapFilter(pred, m) returns a new map with the entries for which pred(key, value) holds.", primMapFilter)
+}
+
+func requireMapArg(name string, v lang.Value) (*lang.Map, error) {
+	if v.Type != lang.TypeMap || v.Map() == nil {
+		return nil, typeError(name, "map", v)
+	}
+	return v.Map(), nil
+}
+
+func equalMaps(a, b *lang.Map) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Len() != b.Len() {
+		return false
+	}
+	for _, key := range a.Keys() {
+		av, _ := a.Get(key)
+		bv, ok := b.Get(key)
+		if !ok || !equalValues(av, bv) {
+			return false
+		}
+	}
+	return true
+}
+
+func primMakeMap(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args)%2 != 0 {
+		return lang.Value{}, fmt.Errorf("makeMap expects key/value pairs, got %d arguments", len(args))
+	}
+	m := lang.NewMap()
+	for i := 0; i < len(args); i += 2 {
+		if err := m.Set(args[i], args[i+1]); err != nil {
+			return lang.Value{}, fmt.Errorf("makeMap: %w", err)
+		}
+	}
+	return lang.MapValue(m), nil
+}
+
+func primIsMap(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeMap), nil
+}
+
+func primMapLength(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapLength", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.IntValue(int64(m.Len())), nil
+}
+
+func primMapGet(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 3 {
+		return lang.Value{}, arityError("mapGet", 2, 3, len(args))
+	}
+	m, err := requireMapArg("mapGet", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if val, ok := m.Get(args[1]); ok {
+		return val, nil
+	}
+	if len(args) == 3 {
+		return args[2], nil
+	}
+	return lang.BoolValue(false), nil
+}
+
+func primMapSet(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapSet", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if err := m.Set(args[1], args[2]); err != nil {
+		return lang.Value{}, fmt.Errorf("mapSet: %w", err)
+	}
+	return args[0], nil
+}
+
+func primMapHas(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapHas", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	_, ok := m.Get(args[1])
+	return lang.BoolValue(ok), nil
+}
+
+func primMapDelete(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapDelete", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(m.Delete(args[1])), nil
+}
+
+func primMapKeys(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapKeys", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.List(m.Keys()...), nil
+}
+
+func primMapValues(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapValues", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.List(m.Values()...), nil
+}
+
+func primMapEntries(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapEntries", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	keys, values := m.Keys(), m.Values()
+	entries := make([]lang.Value, len(keys))
+	for i := range keys {
+		entries[i] = lang.PairValue(keys[i], values[i])
+	}
+	return lang.List(entries...), nil
+}
+
+// primMapMerge keeps keys in the order they first appear across the maps;
+// a later map replaces the value but not the position of an earlier key.
+func primMapMerge(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	out := lang.NewMap()
+	for _, arg := range args {
+		m, err := requireMapArg("mapMerge", arg)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		values := m.Values()
+		for i, key := range m.Keys() {
+			if err := out.Set(key, values[i]); err != nil {
+				return lang.Value{}, fmt.Errorf("mapMerge: %w", err)
+			}
+		}
+	}
+	return lang.MapValue(out), nil
+}
+
+// eachEntry calls f with every key and value of m in order through
+// lang.Callback and hands each result to visit; the primitive's result is
+// done once all entries are visited.
+func eachEntry(m *lang.Map, f lang.Value, visit func(key, value, result lang.Value) error, done func() lang.Value) lang.Value {
+	keys, values := m.Keys(), m.Values()
+	var step func(i int) lang.Value
+	step = func(i int) lang.Value {
+		if i == len(keys) {
+			return done()
+		}
+		return lang.Callback(f, []lang.Value{keys[i], values[i]}, func(res lang.Value) (lang.Value, error) {
+			if err := visit(keys[i], values[i], res); err != nil {
+				return lang.Value{}, err
+			}
+			return step(i + 1), nil
+		})
+	}
+	return step(0)
+}
+
+func primMapMap(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapMap", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	out := lang.NewMap()
+	return eachEntry(m, args[0], func(key, value, result lang.Value) error {
+		return out.Set(key, result)
+	}, func() lang.Value {
+		return lang.MapValue(out)
+	}), nil
+}
+
+func primMapFilter(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("mapFilter", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	out := lang.NewMap()
+	return eachEntry(m, args[0], func(key, value, result lang.Value) error {
+		if lang.IsTruthy(result) {
+			return out.Set(key, value)
+		}
+		return nil
+	}, func() lang.Value {
+		return lang.MapValue(out)
+	}), nil
+}
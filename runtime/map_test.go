@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMapPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	if _, err := EvaluateGispString(ev, `var m = makeMap("z", 1, "a", 2, "m", 3)`); err != nil {
+		t.Fatalf("makeMap failed: %v", err)
+	}
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`mapKeys(m)`, `("z" "a" "m")`},
+		{`mapValues(m)`, `(1 2 3)`},
+		{`mapEntries(m)`, `(("z". 1) ("a". 2) ("m". 3))`},
+		{`mapGet(m, "a")`, `2`},
+		{`mapGet(m, "q")`, `#f`},
+		{`mapGet(m, "q", 0)`, `0`},
+		{`mapHas(m, "m")`, `#t`},
+		{`mapLength(mapSet(m, "b", 4))`, `4`},
+		{`mapDelete(m, "z")`, `#t`},
+		{`mapKeys(m)`, `("a" "m" "b")`},
+		{`mapMerge(m, makeMap("a", 20, "c", 5))`, `{"a": 20, "m": 3, "b": 4, "c": 5}`},
+		{`mapMap(func(k, v) { return v * 10 }, m)`, `{"a": 20, "m": 30, "b": 40}`},
+		{`mapFilter(func(k, v) { return v % 2 == 0 }, m)`, `{"a": 2, "b": 4}`},
+		{`equal(makeMap(1, 2, 3, 4), makeMap(3, 4, 1, 2))`, `#t`},
+		{`eq(m, mapMerge(m))`, `#f`},
+		{`mapp(m)`, `#t`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	for src, want := range map[string]string{
+		`makeMap(1)`:                      "makeMap expects key/value pairs",
+		`makeMap([1], 2)`:                 "makeMap: pair cannot be used as a map key",
+		`mapGet([], 1)`:                   "mapGet expects map, got empty-list",
+		`mapMap(func(k) { return k }, m)`: "expected exactly 1 arguments, got 2",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s => %v, want error containing %q", src, err, want)
+		}
+	}
+}
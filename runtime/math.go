@@ -0,0 +1,354 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sergev/gisp/lang"
+)
+
+var (
+	randomMu   sync.Mutex
+	randomRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func installMathPrimitives(env *lang.Env) {
+	define := func(name string, fn lang.Primitive) {
+		env.Define(name, lang.PrimitiveValue(fn))
+	}
+
+	define("randomInteger", primRandomInteger)
+	define("randomSeed", primRandomSeed)
+	Register(env, "roundTo", 2, false,
+		"roundTo(x, digits) rounds x to digits decimal places; negative digits round to tens, hundreds and so on.", primRoundTo)
+	Register(env, "isqrt", 1, false,
+		"isqrt(n) returns the largest integer whose square does not exceed the non-negative integer n.", primIsqrt)
+	Register(env, "floorDiv", 2, false,
+		"floorDiv(a, b) divides integers, rounding the quotient toward negative infinity.", primFloorDiv)
+	Register(env, "ceilDiv", 2, false,
+		"ceilDiv(a, b) divides integers, rounding the quotient toward positive infinity.", primCeilDiv)
+	Register(env, "exactFloor", 1, false,
+		"exactFloor(x) returns the largest integer not greater than x, as an exact integer.", primExactFloor)
+	Register(env, "exactCeil", 1, false,
+		"exactCeil(x) returns the smallest integer not less than x, as an exact integer.", primExactCeil)
+
+	env.Define("pi", lang.RealValue(math.Pi))
+	env.Define("e", lang.RealValue(math.E))
+	realFuncs := []struct {
+		name, doc string
+		fn        func(float64) float64
+	}{
+		{"sqrt", "returns the square root of x.", math.Sqrt},
+		{"sin", "returns the sine of x radians.", math.Sin},
+		{"cos", "returns the cosine of x radians.", math.Cos},
+		{"tan", "returns the tangent of x radians.", math.Tan},
+		{"asin", "returns the arcsine of x in radians.", math.Asin},
+		{"acos", "returns the arccosine of x in radians.", math.Acos},
+		{"atan", "returns the arctangent of x in radians.", math.Atan},
+		{"exp", "returns e raised to the power x.", math.Exp},
+		{"log", "returns the natural logarithm of x.", math.Log},
+	}
+	for _, f := range realFuncs {
+		Register(env, f.name, 1, false, f.name+"(x) "+f.doc, realFunc(f.name, f.fn))
+	}
+	Register(env, "atan2", 2, false,
+		"atan2(y, x) returns the angle in radians of the point (x, y), using the signs of both to pick the quadrant.", primAtan2)
+	Register(env, "pow", 2, false,
+		"pow(x, y) returns x raised to the power y, exactly when x is an integer and y a non-negative integer.", primPow)
+	roundFuncs := []struct {
+		name, doc string
+		fn        func(float64) float64
+	}{
+		{"floor", "returns the largest integral value not greater than x.", math.Floor},
+		{"ceil", "returns the smallest integral value not less than x.", math.Ceil},
+		{"round", "returns x rounded to the nearest integral value, halves away from zero.", math.Round},
+		{"truncate", "returns x with its fractional part removed.", math.Trunc},
+	}
+	for _, f := range roundFuncs {
+		Register(env, f.name, 1, false, f.name+"(x) "+f.doc, roundFunc(f.name, f.fn))
+	}
+	Register(env, "abs", 1, false, "abs(x) returns the absolute value of x.", primAbs)
+	Register(env, "min", 1, true, "min(x, ...) returns the smallest of its numeric arguments.", primMin)
+	Register(env, "max", 1, true, "max(x, ...) returns the largest of its numeric arguments.", primMax)
+}
+
+func primRandomInteger(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) != 1 {
+		return lang.Value{}, arityError("randomInteger", 1, 1, len(args))
+	}
+	limitVal := args[0]
+	if limitVal.Type != lang.TypeInt {
+		return lang.Value{}, typeError("randomInteger", "integer", limitVal)
+	}
+	limit := limitVal.Int()
+	if limit <= 0 {
+		return lang.Value{}, fmt.Errorf("randomInteger limit must be positive, got %d", limit)
+	}
+	randomMu.Lock()
+	result := randomRand.Int63n(limit)
+	randomMu.Unlock()
+	return lang.IntValue(result), nil
+}
+
+func primRandomSeed(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) != 1 {
+		return lang.Value{}, arityError("randomSeed", 1, 1, len(args))
+	}
+	seedVal := args[0]
+	if seedVal.Type != lang.TypeInt {
+		return lang.Value{}, typeError("randomSeed", "integer", seedVal)
+	}
+	randomMu.Lock()
+	randomRand.Seed(seedVal.Int())
+	randomMu.Unlock()
+	return lang.EmptyList, nil
+}
+
+// primRoundTo rounds to a number of decimal places, halves away from zero.
+// A real is rounded as its exact binary value, so roundTo(2.675, 2) is 2.67
+// just as printing it with two decimals would give. Integers stay exact.
+func primRoundTo(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	x, digitsVal := args[0], args[1]
+	if digitsVal.Type != lang.TypeInt {
+		return lang.Value{}, typeError("roundTo", "integer", digitsVal)
+	}
+	digits := digitsVal.Int()
+	switch x.Type {
+	case lang.TypeInt, lang.TypeBigInt:
+		if digits >= 0 {
+			return x, nil
+		}
+		unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(-digits), nil)
+		n := new(big.Int).Abs(x.BigInt())
+		n.Add(n, new(big.Int).Rsh(unit, 1))
+		n.Mul(n.Quo(n, unit), unit)
+		if x.BigInt().Sign() < 0 {
+			n.Neg(n)
+		}
+		return lang.BigIntValue(n), nil
+	case lang.TypeReal:
+		f := x.Real()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return x, nil
+		}
+		if digits < 0 {
+			unit := math.Pow(10, float64(-digits))
+			return lang.RealValue(math.Round(f/unit) * unit), nil
+		}
+		if digits > maxRoundDigits {
+			return x, nil
+		}
+		return lang.RealValue(roundDecimal(f, int(digits))), nil
+	default:
+		return lang.Value{}, typeError("roundTo", "number", x)
+	}
+}
+
+// maxRoundDigits is the number of decimal places beyond which every
+// float64 is already exact.
+const maxRoundDigits = 1100
+
+// roundDecimal rounds f to digits decimal places, halves away from zero,
+// working on the exact value of f.
+func roundDecimal(f float64, digits int) float64 {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	scaled := new(big.Float).SetPrec(uint(64 + 4*digits)).SetMode(big.ToZero).SetFloat64(math.Abs(f))
+	scaled.Mul(scaled, new(big.Float).SetInt(unit))
+	scaled.Add(scaled, big.NewFloat(0.5))
+	n, _ := scaled.Int(nil)
+	rounded, _ := new(big.Rat).SetFrac(n, unit).Float64()
+	return math.Copysign(rounded, f)
+}
+
+func primIsqrt(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	n, err := requireIntegerArg("isqrt", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	b := n.BigInt()
+	if b.Sign() < 0 {
+		return lang.Value{}, fmt.Errorf("isqrt: negative argument %s", n)
+	}
+	return lang.BigIntValue(new(big.Int).Sqrt(b)), nil
+}
+
+func primFloorDiv(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return roundedDiv("floorDiv", args, -1)
+}
+
+func primCeilDiv(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return roundedDiv("ceilDiv", args, 1)
+}
+
+// roundedDiv divides two integers and, when there is a remainder, moves the
+// truncated quotient one step in direction if the exact quotient lies that
+// way: -1 rounds toward negative infinity and 1 toward positive infinity.
+func roundedDiv(name string, args []lang.Value, direction int) (lang.Value, error) {
+	a, err := requireIntegerArg(name, args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	b, err := requireIntegerArg(name, args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if b.Type == lang.TypeInt && b.Int() == 0 {
+		return lang.Value{}, fmt.Errorf("%s: division by zero", name)
+	}
+	q, r := new(big.Int).QuoRem(a.BigInt(), b.BigInt(), new(big.Int))
+	if r.Sign() != 0 && r.Sign()*b.BigInt().Sign() == direction {
+		q.Add(q, big.NewInt(int64(direction)))
+	}
+	return lang.BigIntValue(q), nil
+}
+
+func primExactFloor(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return exactInteger("exactFloor", args[0], math.Floor)
+}
+
+func primExactCeil(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return exactInteger("exactCeil", args[0], math.Ceil)
+}
+
+// exactInteger rounds a real with round and returns the result as an exact
+// integer, a big one when it does not fit in 64 bits. Integers are returned
+// unchanged.
+func exactInteger(name string, x lang.Value, round func(float64) float64) (lang.Value, error) {
+	switch x.Type {
+	case lang.TypeInt, lang.TypeBigInt:
+		return x, nil
+	case lang.TypeReal:
+		f := x.Real()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return lang.Value{}, fmt.Errorf("%s: %s has no integer value", name, x)
+		}
+		n, _ := big.NewFloat(round(f)).Int(nil)
+		return lang.BigIntValue(n), nil
+	default:
+		return lang.Value{}, typeError(name, "number", x)
+	}
+}
+
+// realFunc adapts a float64 function from the math package to a primitive
+// that accepts any number and returns a real.
+func realFunc(name string, fn func(float64) float64) lang.Primitive {
+	return func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		x, err := realArg(name, args[0])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return lang.RealValue(fn(x)), nil
+	}
+}
+
+// roundFunc is realFunc for the rounding functions, which return integers
+// unchanged.
+func roundFunc(name string, fn func(float64) float64) lang.Primitive {
+	real := realFunc(name, fn)
+	return func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		if lang.IsInteger(args[0]) {
+			return args[0], nil
+		}
+		return real(ev, args)
+	}
+}
+
+func realArg(name string, v lang.Value) (float64, error) {
+	if !isNumber(v) {
+		return 0, typeError(name, "number", v)
+	}
+	return toFloat(v)
+}
+
+func primAtan2(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	y, err := realArg("atan2", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	x, err := realArg("atan2", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.RealValue(math.Atan2(y, x)), nil
+}
+
+// primPow keeps integer powers exact, growing into big integers as * does;
+// like <<, the result is limited by ev.MaxAlloc. Any other combination is
+// computed with math.Pow.
+func primPow(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	x, y := args[0], args[1]
+	if lang.IsInteger(x) && lang.IsInteger(y) && y.BigInt().Sign() >= 0 {
+		base := x.BigInt()
+		// The result has about BitLen(x) * y bits, one word for every 64.
+		if bits := int64(base.BitLen()); bits > 1 {
+			if !y.BigInt().IsInt64() || y.Int() > math.MaxInt64/bits {
+				return lang.Value{}, fmt.Errorf("pow: %s to the power %s is too large", x, y)
+			}
+			if err := ev.CheckAlloc(bits * y.Int() / 64); err != nil {
+				return lang.Value{}, err
+			}
+		}
+		return lang.BigIntValue(new(big.Int).Exp(base, y.BigInt(), nil)), nil
+	}
+	b, err := realArg("pow", x)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	p, err := realArg("pow", y)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.RealValue(math.Pow(b, p)), nil
+}
+
+func primAbs(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	x := args[0]
+	switch x.Type {
+	case lang.TypeInt, lang.TypeBigInt:
+		if x.BigInt().Sign() >= 0 {
+			return x, nil
+		}
+		return lang.BigIntValue(new(big.Int).Neg(x.BigInt())), nil
+	case lang.TypeReal:
+		return lang.RealValue(math.Abs(x.Real())), nil
+	default:
+		return lang.Value{}, typeError("abs", "number", x)
+	}
+}
+
+func primMin(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return extremum("min", -1, args)
+}
+
+func primMax(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return extremum("max", 1, args)
+}
+
+// extremum returns the argument that compares furthest in direction, -1 for
+// the smallest and 1 for the largest. The winning argument is returned as
+// it is, so integers stay exact; a NaN argument makes the result NaN.
+func extremum(name string, direction int, args []lang.Value) (lang.Value, error) {
+	best := args[0]
+	if !isNumber(best) {
+		return lang.Value{}, typeError(name, "number", best)
+	}
+	for _, arg := range args[1:] {
+		if !isNumber(arg) {
+			return lang.Value{}, typeError(name, "number", arg)
+		}
+		c, ok := compareNumbers(arg, best)
+		switch {
+		case !ok:
+			if arg.Type == lang.TypeReal && math.IsNaN(arg.Real()) {
+				best = arg
+			}
+		case c == direction:
+			best = arg
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,121 @@
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sergev/gisp/lang"
+	gispparser "github.com/sergev/gisp/parser"
+	"github.com/sergev/gisp/sexpr"
+)
+
+// ModulePathEnv names the environment variable listing the directories,
+// separated as in PATH, that are searched for modules after the directory
+// of the importing file.
+const ModulePathEnv = "GISP_PATH"
+
+// LoadModule loads the module name, such as "lib/math", and returns the
+// environment holding its top-level definitions. A name without an
+// extension refers to a .gisp file; a .scm file is read as s-expressions.
+// Relative names are looked up next to the file being loaded, or in the
+// current directory when there is none, and then in each directory of
+// GISP_PATH. A module is evaluated once per evaluator; later loads return
+// the same environment. Its definitions do not reach the global
+// environment, though the module can see the global bindings.
+func LoadModule(ev *lang.Evaluator, name string) (*lang.Env, error) {
+	path, err := findModule(ev, name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = filepath.Clean(path)
+	}
+	if env, ok := ev.Module(key); ok {
+		return env, nil
+	}
+	if err := ev.EnterFile(path); err != nil {
+		return nil, err
+	}
+	defer ev.LeaveFile()
+	data, err := readFileSkippingShebang(path)
+	if err != nil {
+		return nil, err
+	}
+	var forms []lang.Value
+	if filepath.Ext(path) == ".gisp" {
+		forms, err = gispparser.ParseString(string(data))
+	} else {
+		forms, err = sexpr.ParseAll(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	env := lang.NewEnv(ev.Global)
+	if _, err := ev.EvalAll(forms, env); err != nil {
+		return nil, err
+	}
+	ev.SetModule(key, env)
+	return env, nil
+}
+
+// findModule returns the path of the file for module name.
+func findModule(ev *lang.Evaluator, name string) (string, error) {
+	file := filepath.FromSlash(name)
+	if filepath.Ext(file) == "" {
+		file += ".gisp"
+	}
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	dirs := []string{"."}
+	if current := ev.CurrentFile(); current != "" {
+		dirs[0] = filepath.Dir(current)
+	}
+	for _, dir := range filepath.SplitList(os.Getenv(ModulePathEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, file)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("module %s not found in %s", name, strings.Join(dirs, string(filepath.ListSeparator)))
+}
+
+// primImport implements Gisp's import declaration: (import "lib/math" 'math)
+// loads the module and binds math, in the environment of the importing
+// code, to a record holding each of its definitions, so that math.sqrt
+// reaches sqrt.
+func primImport(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if err := requireFilesystem(ev, "import"); err != nil {
+		return lang.Value{}, err
+	}
+	if len(args) != 2 {
+		return lang.Value{}, arityError("import", 2, 2, len(args))
+	}
+	name, err := requireStringArg("import", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if args[1].Type != lang.TypeSymbol {
+		return lang.Value{}, typeError("import", "symbol", args[1])
+	}
+	prefix := args[1].Sym()
+	module, err := LoadModule(ev, name)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	record, err := moduleRecord(prefix, module)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	ev.CurrentEnv().Define(prefix, record)
+	return args[1], nil
+}
@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImportModule(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.gisp": `
+import "lib/geometry"
+import g "lib/geometry"
+import "lib/shapes"
+[geometry.area(2), g.square(7), shapes.unitArea(), shapes.geometry.pi]
+`,
+		"lib/geometry.gisp": `
+display("loading geometry\n")
+var pi = 3
+func square(x) { return x * x }
+func area(r) { return pi * square(r) }
+`,
+		// Imports are relative to the importing file.
+		"lib/shapes.gisp": `
+import "geometry"
+func unitArea() { return geometry.area(1) }
+`,
+	})
+
+	ev := NewEvaluator()
+	var out strings.Builder
+	ev.SetOutput(&out)
+	val, err := EvaluateFile(ev, filepath.Join(dir, "main.gisp"))
+	if err != nil {
+		t.Fatalf("EvaluateFile returned error: %v", err)
+	}
+	if got := val.String(); got != "(12 49 3 3)" {
+		t.Fatalf("expected (12 49 3 3), got %s", got)
+	}
+	if got := out.String(); got != "loading geometry\n" {
+		t.Fatalf("expected the module to be evaluated once, got output %q", got)
+	}
+	for _, name := range []string{"square", "unitArea"} {
+		if _, err := ev.Global.Get(name); err == nil {
+			t.Fatalf("expected %s to stay unbound in the importing file", name)
+		}
+	}
+	// The module's pi shadows the builtin only inside the module.
+	if pi, err := ev.Global.Get("pi"); err != nil || pi.Real() != math.Pi {
+		t.Fatalf("expected pi to stay the builtin in the importing file, got %v, %v", pi, err)
+	}
+}
+
+func TestLoadModuleSearchPath(t *testing.T) {
+	lib := t.TempDir()
+	writeFiles(t, lib, map[string]string{
+		"strs.gisp":   "func shout(s) { return stringAppend(s, \"!\") }\n",
+		"cycle.gisp":  "import \"cycle2\"\n",
+		"cycle2.gisp": "import \"cycle\"\n",
+	})
+	t.Setenv(ModulePathEnv, filepath.Join(lib, "missing")+string(filepath.ListSeparator)+lib)
+
+	ev := NewEvaluator()
+	env, err := LoadModule(ev, "strs")
+	if err != nil {
+		t.Fatalf("LoadModule returned error: %v", err)
+	}
+	if _, err := env.Get("shout"); err != nil {
+		t.Fatalf("expected the module to define shout: %v", err)
+	}
+	if again, err := LoadModule(ev, "strs"); err != nil || again != env {
+		t.Fatalf("expected the cached module, got %p (err=%v)", again, err)
+	}
+	val, err := EvaluateGispString(ev, "import \"strs\"\nstrs.shout(\"hi\")")
+	if err != nil || val.Str() != "hi!" {
+		t.Fatalf("expected \"hi!\", got %s (err=%v)", val, err)
+	}
+
+	if _, err := LoadModule(ev, "nowhere"); err == nil || !strings.Contains(err.Error(), "module nowhere not found") {
+		t.Fatalf("expected a not-found error, got %v", err)
+	}
+	var cycle *lang.ImportCycleError
+	if _, err := LoadModule(ev, "cycle"); !errors.As(err, &cycle) {
+		t.Fatalf("expected ImportCycleError, got %v", err)
+	}
+
+	sandboxed := NewEvaluator()
+	sandboxed.Sandbox = true
+	if _, err := EvaluateGispString(sandboxed, "import \"strs\"\n"); err == nil || !strings.Contains(err.Error(), "import is disabled") {
+		t.Fatalf("expected import to be disabled in sandbox mode, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Objects are maps with symbol keys whose proto slot names another object
+// to inherit from. A slot missing from an object is looked up in its
+// prototype, then in the prototype's prototype, and so on. callMethod
+// finds a procedure this way and calls it with the object as its first
+// argument; when there is none it calls the object's methodMissing slot
+// instead, if it has one. getField and setField accept objects, so obj.x
+// reads a slot through the chain and obj.x = v sets it on obj itself.
+
+// protoSlot is the slot that links an object to its prototype.
+const protoSlot = "proto"
+
+func installObjectPrimitives(env *lang.Env) {
+	Register(env, "makeObject", 1, true,
+		"makeObject(proto, k1, v1, ...) returns a new object inheriting from proto, or from nothing when proto is false, with the given slots.", primMakeObject)
+	Register(env, "slot", 2, true,
+		"slot(obj, name [, default]) returns the slot name of obj or its prototypes, or default (false if omitted).", primSlot)
+	Register(env, "callMethod", 2, true,
+		"callMethod(obj, name, args...) calls the method name of obj with obj and args, or obj's methodMissing with obj, name and the list of args.", primCallMethod)
+	Register(env, "respondsTo", 2, false,
+		"respondsTo(obj, name) reports whether obj or one of its prototypes has a procedure in slot name.", primRespondsTo)
+}
+
+// lookupSlot returns the value of slot name in m or the nearest of its
+// prototypes that has it.
+func lookupSlot(m *lang.Map, name string) (lang.Value, bool, error) {
+	key := lang.SymbolValue(name)
+	seen := map[*lang.Map]bool{}
+	for m != nil {
+		if seen[m] {
+			return lang.Value{}, false, fmt.Errorf("prototype chain of object is circular")
+		}
+		seen[m] = true
+		if val, ok := m.Get(key); ok {
+			return val, true, nil
+		}
+		proto, ok := m.Get(lang.SymbolValue(protoSlot))
+		if !ok || proto.Type != lang.TypeMap {
+			break
+		}
+		m = proto.Map()
+	}
+	return lang.Value{}, false, nil
+}
+
+func requireSlotName(name string, v lang.Value) (string, error) {
+	if v.Type != lang.TypeSymbol {
+		return "", typeError(name, "symbol", v)
+	}
+	return v.Sym(), nil
+}
+
+func isProcedure(v lang.Value) bool {
+	return v.Type == lang.TypePrimitive || v.Type == lang.TypeClosure || v.Type == lang.TypeContinuation
+}
+
+func primMakeObject(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	proto := args[0]
+	if proto.Type != lang.TypeMap && lang.IsTruthy(proto) {
+		return lang.Value{}, typeError("makeObject", "object or false", proto)
+	}
+	if len(args)%2 != 1 {
+		return lang.Value{}, fmt.Errorf("makeObject expects a prototype and key/value pairs, got %d arguments", len(args))
+	}
+	m := lang.NewMap()
+	if proto.Type == lang.TypeMap {
+		m.Set(lang.SymbolValue(protoSlot), proto)
+	}
+	for i := 1; i < len(args); i += 2 {
+		if args[i].Type != lang.TypeSymbol {
+			return lang.Value{}, typeError("makeObject", "symbol", args[i])
+		}
+		m.Set(args[i], args[i+1])
+	}
+	return lang.MapValue(m), nil
+}
+
+func primSlot(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 3 {
+		return lang.Value{}, arityError("slot", 2, 3, len(args))
+	}
+	m, err := requireMapArg("slot", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	name, err := requireSlotName("slot", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	val, ok, err := lookupSlot(m, name)
+	switch {
+	case err != nil:
+		return lang.Value{}, err
+	case ok:
+		return val, nil
+	case len(args) == 3:
+		return args[2], nil
+	}
+	return lang.BoolValue(false), nil
+}
+
+func primCallMethod(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("callMethod", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	name, err := requireSlotName("callMethod", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	method, ok, err := lookupSlot(m, name)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if ok {
+		if !isProcedure(method) {
+			return lang.Value{}, fmt.Errorf("callMethod: slot %s of object is not a procedure", name)
+		}
+		callArgs := append([]lang.Value{args[0]}, args[2:]...)
+		return lang.TailCall(method, callArgs), nil
+	}
+	missing, ok, err := lookupSlot(m, "methodMissing")
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if !ok || !isProcedure(missing) {
+		return lang.Value{}, fmt.Errorf("callMethod: object has no method %s", name)
+	}
+	return lang.TailCall(missing, []lang.Value{args[0], args[1], lang.List(args[2:]...)}), nil
+}
+
+func primRespondsTo(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	m, err := requireMapArg("respondsTo", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	name, err := requireSlotName("respondsTo", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	method, ok, err := lookupSlot(m, name)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(ok && isProcedure(method)), nil
+}
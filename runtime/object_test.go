@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjects(t *testing.T) {
+	ev := NewEvaluator()
+	src := "var shape = makeObject(false, `'name, \"shape\",\n" +
+		"    `'describe, func(self) { return stringAppend(self.name, \" of area \", numberToString(callMethod(self, `'area))) })\n" +
+		"var square = makeObject(shape, `'name, \"square\", `'side, 2, `'area, func(self) { return self.side * self.side })\n" +
+		"var logger = makeObject(false, `'methodMissing, func(self, name, args) { return cons(name, args) })\n"
+	if _, err := EvaluateGispString(ev, src); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"callMethod(square, `'area)", `4`},
+		{"callMethod(square, `'describe)", `"square of area 4"`},
+		{"eq(slot(square, `'describe), slot(shape, `'describe))", `#t`},
+		{"slot(square, `'color)", `#f`},
+		{"slot(square, `'color, \"red\")", `"red"`},
+		{"square.side = 3\ncallMethod(square, `'area)", `9`},
+		{`shape.name`, `"shape"`},
+		{"[respondsTo(square, `'area), respondsTo(shape, `'area), respondsTo(square, `'side)]", `(#t #f #f)`},
+		{"callMethod(logger, `'write, 1, 2)", `(write 1 2)`},
+		{`mapp(square)`, `#t`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	for src, want := range map[string]string{
+		"callMethod(shape, `'area)":  "callMethod: object has no method area",
+		"callMethod(square, `'side)": "callMethod: slot side of object is not a procedure",
+		`shape.color`:                "object has no field color",
+		`makeObject(1)`:              "makeObject expects object or false",
+		"makeObject(false, `'x)":     "makeObject expects a prototype and key/value pairs",
+		`makeObject(false, "x", 1)`:  "makeObject expects symbol",
+		`callMethod(square, "area")`: "callMethod expects symbol",
+		"var loop = makeObject(false)\nmapSet(loop, `'proto, loop)\nslot(loop, `'x)": "prototype chain of object is circular",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
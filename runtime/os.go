@@ -0,0 +1,236 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func installOSPrimitives(env *lang.Env) {
+	define := func(name string, fn lang.Primitive) {
+		env.Define(name, lang.PrimitiveValue(fn))
+	}
+
+	define("exit", primExit)
+	define("listDir", primListDir)
+	define("fileExists", primFileExists)
+	define("isDir", primIsDir)
+	define("mkdir", primMkdir)
+	define("removeFile", primRemoveFile)
+	define("rename", primRename)
+	define("fileSize", primFileSize)
+	define("absPath", primAbsPath)
+	define("joinPath", primJoinPath)
+	define("tempFile", primTempFile)
+	define("load", primLoad)
+	define("import", primImport)
+	installStreamPrimitives(env)
+}
+
+func primExit(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if ev != nil && !ev.SecurityPolicy().AllowExit {
+		return lang.Value{}, fmt.Errorf("exit is disabled in sandbox mode")
+	}
+	code := 0
+	if len(args) > 0 {
+		if len(args) != 1 {
+			return lang.Value{}, arityError("exit", 0, 1, len(args))
+		}
+		switch args[0].Type {
+		case lang.TypeInt:
+			code = int(args[0].Int())
+		case lang.TypeBool:
+			if args[0].Bool() {
+				code = 0
+			} else {
+				code = 1
+			}
+		default:
+			return lang.Value{}, typeError("exit", "integer or boolean", args[0])
+		}
+	}
+	os.Exit(code)
+	return lang.EmptyList, nil
+}
+
+// requireFilesystem rejects filesystem access when the evaluator's security
+// policy denies it.
+func requireFilesystem(ev *lang.Evaluator, name string) error {
+	if ev != nil && !ev.SecurityPolicy().AllowFS {
+		return fmt.Errorf("%s is disabled in sandbox mode", name)
+	}
+	return nil
+}
+
+// pathArgs validates the arity and string types of path arguments shared by
+// the filesystem primitives. Slashes in the paths are converted to the
+// platform's separator, so scripts can use them everywhere.
+func pathArgs(ev *lang.Evaluator, name string, args []lang.Value, count int) ([]string, error) {
+	if err := requireFilesystem(ev, name); err != nil {
+		return nil, err
+	}
+	if len(args) != count {
+		return nil, arityError(name, count, count, len(args))
+	}
+	paths := make([]string, count)
+	for i, arg := range args {
+		path, err := requireStringArg(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = filepath.FromSlash(path)
+	}
+	return paths, nil
+}
+
+func primListDir(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "listDir", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	entries, err := os.ReadDir(paths[0])
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("listDir: %w", err)
+	}
+	names := make([]lang.Value, len(entries))
+	for i, entry := range entries {
+		names[i] = lang.StringValue(entry.Name())
+	}
+	return lang.List(names...), nil
+}
+
+func primFileExists(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "fileExists", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if _, err := os.Stat(paths[0]); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lang.BoolValue(false), nil
+		}
+		return lang.Value{}, fmt.Errorf("fileExists: %w", err)
+	}
+	return lang.BoolValue(true), nil
+}
+
+func primIsDir(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "isDir", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lang.BoolValue(false), nil
+		}
+		return lang.Value{}, fmt.Errorf("isDir: %w", err)
+	}
+	return lang.BoolValue(info.IsDir()), nil
+}
+
+func primMkdir(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "mkdir", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if err := os.MkdirAll(paths[0], 0o755); err != nil {
+		return lang.Value{}, fmt.Errorf("mkdir: %w", err)
+	}
+	return lang.EmptyList, nil
+}
+
+func primRemoveFile(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "removeFile", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if err := os.Remove(paths[0]); err != nil {
+		return lang.Value{}, fmt.Errorf("removeFile: %w", err)
+	}
+	return lang.EmptyList, nil
+}
+
+func primRename(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "rename", args, 2)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if err := os.Rename(paths[0], paths[1]); err != nil {
+		return lang.Value{}, fmt.Errorf("rename: %w", err)
+	}
+	return lang.EmptyList, nil
+}
+
+func primFileSize(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "fileSize", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("fileSize: %w", err)
+	}
+	return lang.IntValue(info.Size()), nil
+}
+
+func primAbsPath(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "absPath", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	abs, err := filepath.Abs(paths[0])
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("absPath: %w", err)
+	}
+	return lang.StringValue(abs), nil
+}
+
+// primJoinPath only manipulates strings, so it stays available in sandbox mode.
+func primJoinPath(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		part, err := requireStringArg("joinPath", arg)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		parts[i] = part
+	}
+	return lang.StringValue(filepath.Join(parts...)), nil
+}
+
+func primTempFile(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if err := requireFilesystem(ev, "tempFile"); err != nil {
+		return lang.Value{}, err
+	}
+	if len(args) > 1 {
+		return lang.Value{}, arityError("tempFile", 0, 1, len(args))
+	}
+	pattern := "gisp-*"
+	if len(args) == 1 {
+		p, err := requireStringArg("tempFile", args[0])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		pattern = p
+	}
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("tempFile: %w", err)
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return lang.Value{}, fmt.Errorf("tempFile: %w", err)
+	}
+	return lang.StringValue(name), nil
+}
+
+func primLoad(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	paths, err := pathArgs(ev, "load", args, 1)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return EvaluateFile(ev, paths[0])
+}
@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func TestFilesystemPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	dir := t.TempDir()
+	ev.Global.Define("dir", lang.StringValue(dir))
+
+	src := `
+var sub = joinPath(dir, "a", "b")
+mkdir(sub)
+var tmp = tempFile("probe-*")
+var target = joinPath(sub, "data.txt")
+rename(tmp, target)
+[isDir(sub), fileExists(target), fileSize(target), listDir(sub)]
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("filesystem script failed: %v", err)
+	}
+	if got, want := val.String(), `(#t #t 0 ("data.txt"))`; got != want {
+		t.Fatalf("unexpected result %s, want %s", got, want)
+	}
+
+	target := filepath.Join(dir, "a", "b", "data.txt")
+	if _, err := primRemoveFile(ev, []lang.Value{lang.StringValue(target)}); err != nil {
+		t.Fatalf("removeFile failed: %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, stat error %v", target, err)
+	}
+	exists, err := primFileExists(ev, []lang.Value{lang.StringValue(target)})
+	if err != nil || exists.Bool() {
+		t.Fatalf("expected fileExists to report false, got %v (%v)", exists, err)
+	}
+
+	abs, err := primAbsPath(ev, []lang.Value{lang.StringValue(".")})
+	if err != nil || !filepath.IsAbs(abs.Str()) {
+		t.Fatalf("absPath returned %v (%v)", abs, err)
+	}
+
+	if _, err := primFileSize(ev, []lang.Value{lang.StringValue(target)}); err == nil || !strings.Contains(err.Error(), "fileSize") {
+		t.Fatalf("expected fileSize error for missing file, got %v", err)
+	}
+	if _, err := primRename(ev, []lang.Value{lang.StringValue("x")}); err == nil || !strings.Contains(err.Error(), "expects 2 arguments") {
+		t.Fatalf("expected rename arity error, got %v", err)
+	}
+	if _, err := primListDir(ev, []lang.Value{lang.IntValue(1)}); err == nil || !strings.Contains(err.Error(), "listDir expects string") {
+		t.Fatalf("expected listDir type error, got %v", err)
+	}
+}
+
+func TestFilesystemPrimitivesSandbox(t *testing.T) {
+	ev := NewEvaluator()
+	ev.Sandbox = true
+
+	if _, err := EvaluateGispString(ev, `listDir(".")`); err == nil || !strings.Contains(err.Error(), "listDir is disabled in sandbox mode") {
+		t.Fatalf("expected sandbox error, got %v", err)
+	}
+	if _, err := EvaluateGispString(ev, `tempFile()`); err == nil || !strings.Contains(err.Error(), "sandbox") {
+		t.Fatalf("expected sandbox error for tempFile, got %v", err)
+	}
+	val, err := EvaluateGispString(ev, `joinPath("a", "b")`)
+	if err != nil {
+		t.Fatalf("joinPath should work in sandbox mode: %v", err)
+	}
+	if val.Str() != filepath.Join("a", "b") {
+		t.Fatalf("unexpected joinPath result %v", val)
+	}
+}
+
+func TestSecurityPolicy(t *testing.T) {
+	ev := NewEvaluator()
+	ev.Sandbox = true
+	if _, err := EvaluateGispString(ev, `exit(0)`); err == nil || !strings.Contains(err.Error(), "exit is disabled") {
+		t.Fatalf("expected exit to be denied, got %v", err)
+	}
+
+	// An explicit policy overrides Sandbox.
+	ev.Policy = &lang.Policy{AllowFS: true}
+	val, err := EvaluateGispString(ev, `fileExists(".")`)
+	if err != nil || !val.Bool() {
+		t.Fatalf("expected filesystem access, got %v, %v", val, err)
+	}
+	if _, err := EvaluateGispString(ev, `exit(0)`); err == nil || !strings.Contains(err.Error(), "exit is disabled") {
+		t.Fatalf("expected exit to stay denied, got %v", err)
+	}
+}
+
+func TestLoadDetectsImportCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.gisp")
+	b := filepath.Join(dir, "b.gisp")
+	c := filepath.Join(dir, "c.gisp")
+	files := map[string]string{
+		a: "load(joinPath(bDir, \"b.gisp\"));\n",
+		b: "load(joinPath(bDir, \"a.gisp\"));\n",
+		c: "var loaded = 7;\n",
+	}
+	for path, src := range files {
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ev := NewEvaluator()
+	ev.Global.Define("bDir", lang.StringValue(dir))
+	_, err := EvaluateFile(ev, a)
+	var cycle *lang.ImportCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected ImportCycleError, got %v", err)
+	}
+	if got, want := cycle.Chain, []string{a, b, a}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("cycle chain %v, want %v", got, want)
+	}
+	if !strings.Contains(err.Error(), "a.gisp → "+b+" → "+a) {
+		t.Fatalf("unexpected message %q", err)
+	}
+
+	// The failed load leaves no file marked as loading, and loading a file
+	// twice in sequence is not a cycle.
+	if _, err := EvaluateGispString(ev, `load(joinPath(bDir, "c.gisp")); load(joinPath(bDir, "c.gisp")); loaded`); err != nil {
+		t.Fatalf("sequential loads failed: %v", err)
+	}
+}
@@ -3,29 +3,17 @@ package runtime
 import (
 	"errors"
 	"fmt"
-	"io"
-	"math/rand"
-	"os"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/sergev/gisp/lang"
-	"github.com/sergev/gisp/sexpr"
 )
 
-var (
-	randomMu   sync.Mutex
-	randomRand = rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	readMu     sync.Mutex
-	readStream = sexpr.NewReader(os.Stdin)
-)
-
-func installPrimitives(ev *lang.Evaluator) {
-	env := ev.Global
+func installCorePrimitives(env *lang.Env) {
 	define := func(name string, fn lang.Primitive) {
 		env.Define(name, lang.PrimitiveValue(fn))
 	}
@@ -34,6 +22,7 @@ func installPrimitives(ev *lang.Evaluator) {
 	define("-", primSub)
 	define("*", primMul)
 	define("/", primDiv)
+	define("reciprocal", primReciprocal)
 	define("%", primMod)
 	define("++", primPostInc)
 	define("--", primPostDec)
@@ -60,59 +49,123 @@ func installPrimitives(ev *lang.Evaluator) {
 	define("<=", primLessEq)
 	define(">", primGreater)
 	define(">=", primGreaterEq)
+	Register(env, "==", 2, false,
+		"==(a, b) compares numbers numerically and strings, symbols, booleans and nil by value.", primEqualOp)
+	Register(env, "not=", 0, true, "not=(a, b, ...) is true unless all numbers are equal.", primNumNotEq)
+
+	// Numeric predicates are available under the Gisp name (zerop) and the
+	// Scheme name (zero?).
+	numberPredicates := []struct {
+		gisp, scheme, doc string
+		build             func(name string) lang.Primitive
+	}{
+		{"zerop", "zero?", "reports whether a number is zero.", func(name string) lang.Primitive {
+			return signPredicate(name, func(sign int) bool { return sign == 0 })
+		}},
+		{"positivep", "positive?", "reports whether a number is greater than zero.", func(name string) lang.Primitive {
+			return signPredicate(name, func(sign int) bool { return sign > 0 })
+		}},
+		{"negativep", "negative?", "reports whether a number is less than zero.", func(name string) lang.Primitive {
+			return signPredicate(name, func(sign int) bool { return sign < 0 })
+		}},
+		{"evenp", "even?", "reports whether an integer is even.", func(name string) lang.Primitive {
+			return parityPredicate(name, false)
+		}},
+		{"oddp", "odd?", "reports whether an integer is odd.", func(name string) lang.Primitive {
+			return parityPredicate(name, true)
+		}},
+	}
+	for _, p := range numberPredicates {
+		for _, name := range []string{p.gisp, p.scheme} {
+			Register(env, name, 1, false, name+"(x) "+p.doc, p.build(name))
+		}
+	}
 
-	define("not", primNot)
-
-	define("numberp", primIsNumber)
-	define("integerp", primIsInteger)
-	define("realp", primIsReal)
-	define("booleanp", primIsBoolean)
-	define("stringp", primIsString)
-	define("symbolp", primIsSymbol)
-	define("pairp", primIsPair)
-	define("nullp", primIsNull)
-	define("listp", primIsList)
-	define("procedurep", primIsProcedure)
-
-	define("cons", primCons)
-	define("first", primFirst)
-	define("rest", primRest)
+	Register(env, "not", 1, false, "not(x) returns true when x is false and false otherwise.", primNot)
+
+	Register(env, "numberp", 1, false, "numberp(x) reports whether x is an integer or real.", primIsNumber)
+	Register(env, "integerp", 1, false, "integerp(x) reports whether x is an integer.", primIsInteger)
+	Register(env, "realp", 1, false, "realp(x) reports whether x is a real number; integers count.", primIsReal)
+	Register(env, "booleanp", 1, false, "booleanp(x) reports whether x is true or false.", primIsBoolean)
+	Register(env, "stringp", 1, false, "stringp(x) reports whether x is a string.", primIsString)
+	Register(env, "symbolp", 1, false, "symbolp(x) reports whether x is a symbol.", primIsSymbol)
+	Register(env, "pairp", 1, false, "pairp(x) reports whether x is a pair.", primIsPair)
+	Register(env, "nullp", 1, false, "nullp(x) reports whether x is the empty list.", primIsNull)
+	Register(env, "listp", 1, false, "listp(x) reports whether x is a proper list.", primIsList)
+	Register(env, "procedurep", 1, false, "procedurep(x) reports whether x can be called.", primIsProcedure)
+	Register(env, "continuationp", 1, false, "continuationp(x) reports whether x is a continuation.", primIsContinuation)
+	Register(env, "oneShotp", 1, false, "oneShotp(x) reports whether x is a one-shot continuation, captured by call1cc.", primIsOneShot)
+	Register(env, "eofp", 1, false, "eofp(x) reports whether x is the eof object.", primIsEOF)
+
+	Register(env, "cons", 2, false, "cons(a, b) returns a new pair of a and b.", primCons)
+	Register(env, "first", 1, false, "first(pair) returns the first element of a pair.", primFirst)
+	Register(env, "rest", 1, false, "rest(pair) returns the rest of a pair.", primRest)
 	define("setFirst", primSetFirst)
 	define("setRest", primSetRest)
 	define("list", primList)
 	define("append", primAppend)
 	define("length", primLength)
+	installListPrimitives(env)
+	installRegexPrimitives(env)
+	installEncodingPrimitives(env)
+	installMapPrimitives(env)
+	installStructPrimitives(env)
+	installObjectPrimitives(env)
+	installGetoptPrimitives(env)
+	installBuildInfoPrimitives(env)
+	installValuesPrimitives(env)
+	installRangePrimitives(env)
+	installStringPrimitives(env)
+	installEnvironmentPrimitives(env)
+	installConcurrencyPrimitives(env)
 	define("vector", primVector)
 	define("vectorp", primIsVector)
 	define("makeVector", primMakeVector)
 	define("vectorLength", primVectorLength)
 	define("vectorRef", primVectorRef)
+	Register(env, "ref", 2, false,
+		"ref(c, key) returns the element of a vector, string, list or map c at key.", primRef)
 	define("vectorSet", primVectorSet)
 	define("vectorFill", primVectorFill)
 	define("vectorToList", primVectorToList)
 	define("listToVector", primListToVector)
 
-	define("eq", primEq)
-	define("equal", primEqual)
+	Register(env, "eq", 2, false, "eq(a, b) reports whether a and b are the same object.", primEq)
+	Register(env, "equal", 2, false, "equal(a, b) reports whether a and b are structurally equal.", primEqual)
 
-	define("display", primDisplay)
-	define("newline", primNewline)
-	define("read", primRead)
-	define("exit", primExit)
 	define("error", primError)
+	Register(env, "errorf", 1, true,
+		"errorf(format, x, ...) raises an error whose message is formatted with Go-style verbs such as %v, %d and %.2f.", primErrorf)
+	installExceptionPrimitives(env)
 
 	define("apply", primApply)
 	define("gensym", primGensym)
-	define("randomInteger", primRandomInteger)
-	define("randomSeed", primRandomSeed)
+	Register(env, "help", 1, false, "help(name) returns the documentation of the named primitive.", primHelp)
+	Register(env, "builtin", 1, false, "builtin(name) returns the original builtin bound to name, even if it was redefined.", primBuiltin)
+	Register(env, "macroexpandSteps", 1, false,
+		"macroexpandSteps(expr) returns expr followed by each successive expansion of its head macro.", primMacroexpandSteps)
+	define("trace", primTrace)
+	define("untrace", primUntrace)
+	define("traceContinuations", primTraceContinuations)
 	define("stringLength", primStringLength)
 	define("makeString", primMakeString)
 	define("stringAppend", primStringAppend)
 	define("stringSlice", primStringSlice)
+	Register(env, "stringFields", 1, false,
+		"stringFields(s) splits s around runs of whitespace.", primStringFields)
+	Register(env, "stringLines", 1, false,
+		"stringLines(s) splits s into lines without their line terminators.", primStringLines)
+	Register(env, "codePointToString", 1, false,
+		"codePointToString(n) returns the one-character string for the Unicode code point n.", primCodePointToString)
+	Register(env, "stringToCodePoints", 1, false,
+		"stringToCodePoints(s) returns the Unicode code points of s as a list of integers.", primStringToCodePoints)
+	Register(env, "utf8Length", 1, false,
+		"utf8Length(s) returns the number of characters (code points) in s.", primUTF8Length)
 	define("symbolToString", primSymbolToString)
 	define("stringToSymbol", primStringToSymbol)
 	define("numberToString", primNumberToString)
 	define("stringToNumber", primStringToNumber)
+	define("renderTemplate", primRenderTemplate)
 
 	env.Define("callcc", lang.ClosureValue(
 		[]string{"f"},
@@ -126,6 +179,18 @@ func installPrimitives(ev *lang.Evaluator) {
 		env,
 	))
 
+	env.Define("call1cc", lang.ClosureValue(
+		[]string{"f"},
+		"",
+		[]lang.Value{
+			lang.List(
+				lang.SymbolValue("call/1cc"),
+				lang.SymbolValue("f"),
+			),
+		},
+		env,
+	))
+
 	env.Define("map", lang.ClosureValue(
 		[]string{"proc", "lst"},
 		"",
@@ -221,125 +286,60 @@ func installPrimitives(ev *lang.Evaluator) {
 }
 
 func primAdd(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	sumInt := int64(0)
-	sumFloat := 0.0
-	useFloat := false
+	sum := lang.IntValue(0)
 	for _, arg := range args {
-		switch arg.Type {
-		case lang.TypeInt:
-			if useFloat {
-				sumFloat += float64(arg.Int())
-			} else {
-				sumInt += arg.Int()
-			}
-		case lang.TypeReal:
-			if !useFloat {
-				useFloat = true
-				sumFloat = float64(sumInt)
-			}
-			sumFloat += arg.Real()
-		default:
+		if !isNumber(arg) {
 			return lang.Value{}, typeError("+", "number", arg)
 		}
+		sum = addNumbers(sum, arg)
 	}
-	if useFloat {
-		return lang.RealValue(sumFloat), nil
-	}
-	return lang.IntValue(sumInt), nil
+	return sum, nil
 }
 
 func primMul(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	prodInt := int64(1)
-	prodFloat := 1.0
-	useFloat := false
-	if len(args) == 0 {
-		return lang.IntValue(1), nil
-	}
+	prod := lang.IntValue(1)
 	for _, arg := range args {
-		switch arg.Type {
-		case lang.TypeInt:
-			if useFloat {
-				prodFloat *= float64(arg.Int())
-			} else {
-				prodInt *= arg.Int()
-			}
-		case lang.TypeReal:
-			if !useFloat {
-				useFloat = true
-				prodFloat = float64(prodInt)
-			}
-			prodFloat *= arg.Real()
-		default:
+		if !isNumber(arg) {
 			return lang.Value{}, typeError("*", "number", arg)
 		}
+		prod = mulNumbers(prod, arg)
 	}
-	if useFloat {
-		return lang.RealValue(prodFloat), nil
-	}
-	return lang.IntValue(prodInt), nil
+	return prod, nil
 }
 
 func primSub(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) == 0 {
 		return lang.Value{}, errors.New("- expects at least one argument")
 	}
-	first := args[0]
-	useFloat := first.Type == lang.TypeReal
-	accInt := int64(0)
-	accFloat := 0.0
-	switch first.Type {
-	case lang.TypeInt:
-		accInt = first.Int()
-	case lang.TypeReal:
-		accFloat = first.Real()
-	default:
-		return lang.Value{}, typeError("-", "number", first)
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return lang.Value{}, typeError("-", "number", arg)
+		}
 	}
 	if len(args) == 1 {
-		if useFloat {
-			return lang.RealValue(-accFloat), nil
+		if args[0].Type == lang.TypeReal {
+			return lang.RealValue(-args[0].Real()), nil
 		}
-		return lang.IntValue(-accInt), nil
+		return subNumbers(lang.IntValue(0), args[0]), nil
 	}
+	acc := args[0]
 	for _, arg := range args[1:] {
-		switch arg.Type {
-		case lang.TypeInt:
-			if useFloat {
-				accFloat -= float64(arg.Int())
-			} else {
-				accInt -= arg.Int()
-			}
-		case lang.TypeReal:
-			if !useFloat {
-				useFloat = true
-				accFloat = float64(accInt)
-			}
-			accFloat -= arg.Real()
-		default:
-			return lang.Value{}, typeError("-", "number", arg)
-		}
+		acc = subNumbers(acc, arg)
 	}
-	if useFloat {
-		return lang.RealValue(accFloat), nil
-	}
-	return lang.IntValue(accInt), nil
+	return acc, nil
 }
 
 func primDiv(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) == 0 {
 		return lang.Value{}, errors.New("/ expects at least one argument")
 	}
-	initial, err := toFloat(args[0])
+	if len(args) == 1 {
+		return reciprocal("/", args[0])
+	}
+	acc, err := toFloat(args[0])
 	if err != nil {
 		return lang.Value{}, typeError("/", "number", args[0])
 	}
-	if initial == 0 {
-		return lang.Value{}, errors.New("division by zero")
-	}
-	acc := initial
-	if len(args) == 1 {
-		return lang.RealValue(1 / acc), nil
-	}
 	for _, arg := range args[1:] {
 		val, err := toFloat(arg)
 		if err != nil {
@@ -353,25 +353,54 @@ func primDiv(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	return lang.RealValue(acc), nil
 }
 
+func primReciprocal(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) != 1 {
+		return lang.Value{}, arityError("reciprocal", 1, 1, len(args))
+	}
+	return reciprocal("reciprocal", args[0])
+}
+
+// reciprocal computes 1/x as a real. Without rational numbers an exact
+// result is impossible for most integers, so the result is always inexact.
+func reciprocal(name string, x lang.Value) (lang.Value, error) {
+	val, err := toFloat(x)
+	if err != nil {
+		return lang.Value{}, typeError(name, "number", x)
+	}
+	if val == 0 {
+		return lang.Value{}, fmt.Errorf("%s: division by zero", name)
+	}
+	return lang.RealValue(1 / val), nil
+}
+
 func primMod(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 2 {
 		return lang.Value{}, errors.New("% expects at least 2 arguments")
 	}
-	if args[0].Type != lang.TypeInt {
-		return lang.Value{}, typeError("%", "integer", args[0])
+	result, err := requireIntegerArg("%", args[0])
+	if err != nil {
+		return lang.Value{}, err
 	}
-	result := args[0].Int()
 	for _, arg := range args[1:] {
-		if arg.Type != lang.TypeInt {
-			return lang.Value{}, typeError("%", "integer", arg)
+		divisor, err := requireIntegerArg("%", arg)
+		if err != nil {
+			return lang.Value{}, err
 		}
-		divisor := arg.Int()
-		if divisor == 0 {
+		if divisor.Type == lang.TypeInt && divisor.Int() == 0 {
 			return lang.Value{}, errors.New("modulo by zero")
 		}
-		result %= divisor
+		if result.Type == lang.TypeInt && divisor.Type == lang.TypeInt {
+			if divisor.Int() == -1 {
+				// Avoids the overflow of math.MinInt64 % -1.
+				result = lang.IntValue(0)
+			} else {
+				result = lang.IntValue(result.Int() % divisor.Int())
+			}
+			continue
+		}
+		result = lang.BigIntValue(new(big.Int).Rem(result.BigInt(), divisor.BigInt()))
 	}
-	return lang.IntValue(result), nil
+	return result, nil
 }
 
 func primAddAssign(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
@@ -449,55 +478,128 @@ func primBitClearAssign(ev *lang.Evaluator, args []lang.Value) (lang.Value, erro
 }
 
 func primNumEq(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) < 2 {
-		return lang.BoolValue(true), nil
+	equal, err := numbersEqual("=", args)
+	if err != nil {
+		return lang.Value{}, err
 	}
-	first, err := toFloat(args[0])
+	return lang.BoolValue(equal), nil
+}
+
+func primNumNotEq(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	equal, err := numbersEqual("not=", args)
 	if err != nil {
-		return lang.Value{}, typeError("=", "number", args[0])
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(!equal), nil
+}
+
+func numbersEqual(name string, args []lang.Value) (bool, error) {
+	if len(args) < 2 {
+		return true, nil
+	}
+	first := args[0]
+	if !isNumber(first) {
+		return false, typeError(name, "number", first)
 	}
 	for _, arg := range args[1:] {
-		val, err := toFloat(arg)
-		if err != nil {
-			return lang.Value{}, typeError("=", "number", arg)
+		if !isNumber(arg) {
+			return false, typeError(name, "number", arg)
 		}
-		if val != first {
-			return lang.BoolValue(false), nil
+		if c, ok := compareNumbers(first, arg); !ok || c != 0 {
+			return false, nil
 		}
 	}
-	return lang.BoolValue(true), nil
+	return true, nil
+}
+
+// primEqualOp implements the Gisp == operator. Numbers compare numerically;
+// strings, symbols and booleans by value; nil equals only nil, so comparing
+// a list with nil tests for emptiness. Values of different kinds are
+// unequal. Other non-empty values, such as lists and vectors, are rejected so
+// that structural comparison is requested explicitly with equal.
+func primEqualOp(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	a, b := args[0], args[1]
+	if isNumber(a) && isNumber(b) {
+		c, ok := compareNumbers(a, b)
+		return lang.BoolValue(ok && c == 0), nil
+	}
+	if a.Type == lang.TypeEmpty || b.Type == lang.TypeEmpty {
+		return lang.BoolValue(a.Type == b.Type), nil
+	}
+	for _, v := range args {
+		switch v.Type {
+		case lang.TypeInt, lang.TypeReal, lang.TypeString, lang.TypeChar, lang.TypeSymbol, lang.TypeBool:
+		default:
+			return lang.Value{}, fmt.Errorf("== cannot compare %s values; use equal", typeName(v))
+		}
+	}
+	if a.Type != b.Type {
+		return lang.BoolValue(false), nil
+	}
+	switch a.Type {
+	case lang.TypeString:
+		return lang.BoolValue(a.Str() == b.Str()), nil
+	case lang.TypeChar:
+		return lang.BoolValue(a.Char() == b.Char()), nil
+	case lang.TypeSymbol:
+		return lang.BoolValue(a.Sym() == b.Sym()), nil
+	default:
+		return lang.BoolValue(a.Bool() == b.Bool()), nil
+	}
+}
+
+// signPredicate builds a one-argument predicate on the sign of a number.
+// NaN has no sign, so every such predicate is false for it.
+func signPredicate(name string, test func(sign int) bool) lang.Primitive {
+	return func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		if !isNumber(args[0]) {
+			return lang.Value{}, typeError(name, "number", args[0])
+		}
+		sign, ok := compareNumbers(args[0], lang.IntValue(0))
+		return lang.BoolValue(ok && test(sign)), nil
+	}
+}
+
+// parityPredicate builds evenp or oddp, which accept only integers.
+func parityPredicate(name string, odd bool) lang.Primitive {
+	return func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		n, err := requireIntegerArg(name, args[0])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return lang.BoolValue(isOddInt(n) == odd), nil
+	}
 }
 
 func primLess(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	return compareChain("<", func(a, b float64) bool { return a < b }, args)
+	return compareChain("<", func(c int) bool { return c < 0 }, args)
 }
 
 func primLessEq(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	return compareChain("<=", func(a, b float64) bool { return a <= b }, args)
+	return compareChain("<=", func(c int) bool { return c <= 0 }, args)
 }
 
 func primGreater(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	return compareChain(">", func(a, b float64) bool { return a > b }, args)
+	return compareChain(">", func(c int) bool { return c > 0 }, args)
 }
 
 func primGreaterEq(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	return compareChain(">=", func(a, b float64) bool { return a >= b }, args)
+	return compareChain(">=", func(c int) bool { return c >= 0 }, args)
 }
 
-func compareChain(name string, cmp func(float64, float64) bool, args []lang.Value) (lang.Value, error) {
+func compareChain(name string, cmp func(int) bool, args []lang.Value) (lang.Value, error) {
 	if len(args) < 2 {
 		return lang.BoolValue(true), nil
 	}
-	prev, err := toFloat(args[0])
-	if err != nil {
-		return lang.Value{}, typeError(name, "number", args[0])
+	prev := args[0]
+	if !isNumber(prev) {
+		return lang.Value{}, typeError(name, "number", prev)
 	}
-	for _, arg := range args[1:] {
-		cur, err := toFloat(arg)
-		if err != nil {
-			return lang.Value{}, typeError(name, "number", arg)
+	for _, cur := range args[1:] {
+		if !isNumber(cur) {
+			return lang.Value{}, typeError(name, "number", cur)
 		}
-		if !cmp(prev, cur) {
+		if c, ok := compareNumbers(prev, cur); !ok || !cmp(c) {
 			return lang.BoolValue(false), nil
 		}
 		prev = cur
@@ -505,16 +607,49 @@ func compareChain(name string, cmp func(float64, float64) bool, args []lang.Valu
 	return lang.BoolValue(true), nil
 }
 
-func primNot(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("not expects 1 argument, got %d", len(args))
+// compareNumbers orders two numeric values, returning -1, 0 or 1. Integers
+// are compared exactly; float64 is used only when a real is involved. ok is
+// false when the operands are unordered because one of them is NaN.
+func compareNumbers(a, b lang.Value) (int, bool) {
+	if a.Type == lang.TypeInt && b.Type == lang.TypeInt {
+		x, y := a.Int(), b.Int()
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+	if lang.IsInteger(a) && lang.IsInteger(b) {
+		return a.BigInt().Cmp(b.BigInt()), true
+	}
+	x, _ := toFloat(a)
+	y, _ := toFloat(b)
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	case x == y:
+		return 0, true
+	default:
+		return 0, false
 	}
+}
+
+func isNumber(v lang.Value) bool {
+	return lang.IsInteger(v) || v.Type == lang.TypeReal
+}
+
+func primNot(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	return lang.BoolValue(!lang.IsTruthy(args[0])), nil
 }
 
 func primBitAnd(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 2 {
-		return lang.Value{}, fmt.Errorf("& expects at least 2 arguments, got %d", len(args))
+		return lang.Value{}, &lang.ArityError{Proc: "&", Want: 2, AtLeast: true, Got: len(args)}
 	}
 	result, err := requireIntArg("&", args[0])
 	if err != nil {
@@ -532,7 +667,7 @@ func primBitAnd(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primBitOr(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 2 {
-		return lang.Value{}, fmt.Errorf("| expects at least 2 arguments, got %d", len(args))
+		return lang.Value{}, &lang.ArityError{Proc: "|", Want: 2, AtLeast: true, Got: len(args)}
 	}
 	result, err := requireIntArg("|", args[0])
 	if err != nil {
@@ -550,7 +685,7 @@ func primBitOr(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primBitXor(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) == 0 {
-		return lang.Value{}, fmt.Errorf("^ expects at least 1 argument, got %d", len(args))
+		return lang.Value{}, &lang.ArityError{Proc: "^", Want: 1, AtLeast: true, Got: len(args)}
 	}
 	if len(args) == 1 {
 		value, err := requireIntArg("^", args[0])
@@ -575,7 +710,7 @@ func primBitXor(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primBitClear(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 2 {
-		return lang.Value{}, fmt.Errorf("&^ expects at least 2 arguments, got %d", len(args))
+		return lang.Value{}, &lang.ArityError{Proc: "&^", Want: 2, AtLeast: true, Got: len(args)}
 	}
 	result, err := requireIntArg("&^", args[0])
 	if err != nil {
@@ -593,9 +728,9 @@ func primBitClear(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primShiftLeft(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("<< expects 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError("<<", 2, 2, len(args))
 	}
-	value, err := requireIntArg("<<", args[0])
+	value, err := requireIntegerArg("<<", args[0])
 	if err != nil {
 		return lang.Value{}, err
 	}
@@ -606,12 +741,16 @@ func primShiftLeft(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if shift < 0 {
 		return lang.Value{}, fmt.Errorf("<< expects non-negative shift, got %d", shift)
 	}
-	return lang.IntValue(value << uint(shift)), nil
+	// A shift grows the integer by one word for every 64 bits.
+	if err := ev.CheckAlloc(shift / 64); err != nil {
+		return lang.Value{}, err
+	}
+	return shiftLeftInt(value, shift), nil
 }
 
 func primShiftRight(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf(">> expects 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError(">>", 2, 2, len(args))
 	}
 	value, err := requireIntArg(">>", args[0])
 	if err != nil {
@@ -627,54 +766,16 @@ func primShiftRight(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	return lang.IntValue(value >> uint(shift)), nil
 }
 
-func primRandomInteger(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("randomInteger expects 1 argument, got %d", len(args))
-	}
-	limitVal := args[0]
-	if limitVal.Type != lang.TypeInt {
-		return lang.Value{}, typeError("randomInteger", "integer", limitVal)
-	}
-	limit := limitVal.Int()
-	if limit <= 0 {
-		return lang.Value{}, fmt.Errorf("randomInteger limit must be positive, got %d", limit)
-	}
-	randomMu.Lock()
-	result := randomRand.Int63n(limit)
-	randomMu.Unlock()
-	return lang.IntValue(result), nil
-}
-
-func primRandomSeed(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("randomSeed expects 1 argument, got %d", len(args))
-	}
-	seedVal := args[0]
-	if seedVal.Type != lang.TypeInt {
-		return lang.Value{}, typeError("randomSeed", "integer", seedVal)
-	}
-	randomMu.Lock()
-	randomRand.Seed(seedVal.Int())
-	randomMu.Unlock()
-	return lang.EmptyList, nil
-}
-
 func primIsNumber(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	return unaryTypePredicate("numberp", args, func(v lang.Value) bool {
-		return v.Type == lang.TypeInt || v.Type == lang.TypeReal
-	})
+	return unaryTypePredicate("numberp", args, isNumber)
 }
 
 func primIsInteger(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	return unaryTypePredicate("integerp", args, func(v lang.Value) bool {
-		return v.Type == lang.TypeInt
-	})
+	return unaryTypePredicate("integerp", args, lang.IsInteger)
 }
 
 func primIsReal(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	return unaryTypePredicate("realp", args, func(v lang.Value) bool {
-		return v.Type == lang.TypeReal || v.Type == lang.TypeInt
-	})
+	return unaryTypePredicate("realp", args, isNumber)
 }
 
 func primIsBoolean(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
@@ -720,45 +821,49 @@ func primIsProcedure(ev *lang.Evaluator, args []lang.Value) (lang.Value, error)
 	})
 }
 
+func primIsContinuation(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeContinuation), nil
+}
+
+func primIsOneShot(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	cont := args[0].Continuation()
+	return lang.BoolValue(args[0].Type == lang.TypeContinuation && cont != nil && cont.OneShot), nil
+}
+
+func primIsEOF(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeEOF), nil
+}
+
 func primCons(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("cons expects 2 arguments, got %d", len(args))
-	}
 	return lang.PairValue(args[0], args[1]), nil
 }
 
 func primFirst(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("first expects 1 argument, got %d", len(args))
-	}
 	v := args[0]
 	p := v.Pair()
 	if v.Type != lang.TypePair || p == nil {
-		return lang.Value{}, fmt.Errorf("first expects a pair")
+		return lang.Value{}, typeError("first", "pair", v)
 	}
 	return p.First, nil
 }
 
 func primRest(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("rest expects 1 argument, got %d", len(args))
-	}
 	v := args[0]
 	p := v.Pair()
 	if v.Type != lang.TypePair || p == nil {
-		return lang.Value{}, fmt.Errorf("rest expects a pair")
+		return lang.Value{}, typeError("rest", "pair", v)
 	}
 	return p.Rest, nil
 }
 
 func primSetFirst(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("set-first! expects 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError("set-first!", 2, 2, len(args))
 	}
 	pair := args[0]
 	p := pair.Pair()
 	if pair.Type != lang.TypePair || p == nil {
-		return lang.Value{}, fmt.Errorf("set-first! expects a pair")
+		return lang.Value{}, typeError("set-first!", "pair", pair)
 	}
 	p.First = args[1]
 	return pair, nil
@@ -766,12 +871,12 @@ func primSetFirst(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primSetRest(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("set-rest! expects 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError("set-rest!", 2, 2, len(args))
 	}
 	pair := args[0]
 	p := pair.Pair()
 	if pair.Type != lang.TypePair || p == nil {
-		return lang.Value{}, fmt.Errorf("set-rest! expects a pair")
+		return lang.Value{}, typeError("set-rest!", "pair", pair)
 	}
 	p.Rest = args[1]
 	return pair, nil
@@ -800,7 +905,7 @@ func primAppend(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primLength(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("length expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("length", 1, 1, len(args))
 	}
 	items, err := lang.ToSlice(args[0])
 	if err != nil {
@@ -821,7 +926,7 @@ func primIsVector(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primMakeVector(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 1 || len(args) > 2 {
-		return lang.Value{}, fmt.Errorf("makeVector expects 1 or 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError("makeVector", 1, 2, len(args))
 	}
 	sizeArg := args[0]
 	if sizeArg.Type != lang.TypeInt {
@@ -835,6 +940,9 @@ func primMakeVector(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if int64(length) != length64 {
 		return lang.Value{}, fmt.Errorf("makeVector length %d exceeds platform limit", length64)
 	}
+	if err := ev.CheckAlloc(length64); err != nil {
+		return lang.Value{}, fmt.Errorf("makeVector: %w", err)
+	}
 	fill := lang.EmptyList
 	if len(args) == 2 {
 		fill = args[1]
@@ -844,7 +952,7 @@ func primMakeVector(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primVectorLength(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("vectorLength expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("vectorLength", 1, 1, len(args))
 	}
 	vec, err := requireVectorArg("vectorLength", args[0])
 	if err != nil {
@@ -855,7 +963,7 @@ func primVectorLength(ev *lang.Evaluator, args []lang.Value) (lang.Value, error)
 
 func primVectorRef(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("vectorRef expects 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError("vectorRef", 2, 2, len(args))
 	}
 	vec, err := requireVectorArg("vectorRef", args[0])
 	if err != nil {
@@ -874,9 +982,52 @@ func primVectorRef(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	return vec.Elements[idx], nil
 }
 
+// primRef implements index syntax. Strings are indexed by byte, like
+// stringLength and stringSlice, and maps behave like mapGet.
+func primRef(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	container, key := args[0], args[1]
+	if container.Type == lang.TypeMap {
+		return primMapGet(ev, args)
+	}
+	idx, err := requireIntArg("ref", key)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	switch container.Type {
+	case lang.TypeVector:
+		vec, err := requireVectorArg("ref", container)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if idx < 0 || idx >= int64(len(vec.Elements)) {
+			return lang.Value{}, fmt.Errorf("ref index %d out of range for length %d", idx, len(vec.Elements))
+		}
+		return vec.Elements[idx], nil
+	case lang.TypeString:
+		return charAt("ref", container.Str(), idx)
+	case lang.TypeEmpty, lang.TypePair:
+		if idx < 0 {
+			return lang.Value{}, fmt.Errorf("ref index %d out of range for list", idx)
+		}
+		curr := container
+		for i := int64(0); curr.Type == lang.TypePair; i++ {
+			if i == idx {
+				return curr.Pair().First, nil
+			}
+			curr = curr.Pair().Rest
+		}
+		if curr.Type != lang.TypeEmpty {
+			return lang.Value{}, typeError("ref", "proper list", container)
+		}
+		return lang.Value{}, fmt.Errorf("ref index %d out of range for list", idx)
+	default:
+		return lang.Value{}, typeError("ref", "vector, string, list or map", container)
+	}
+}
+
 func primVectorSet(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 3 {
-		return lang.Value{}, fmt.Errorf("vectorSet expects 3 arguments, got %d", len(args))
+		return lang.Value{}, arityError("vectorSet", 3, 3, len(args))
 	}
 	vecVal := args[0]
 	vec, err := requireVectorArg("vectorSet", vecVal)
@@ -899,7 +1050,7 @@ func primVectorSet(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primVectorFill(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("vectorFill expects 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError("vectorFill", 2, 2, len(args))
 	}
 	vecVal := args[0]
 	vec, err := requireVectorArg("vectorFill", vecVal)
@@ -915,7 +1066,7 @@ func primVectorFill(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 
 func primVectorToList(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("vectorToList expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("vectorToList", 1, 1, len(args))
 	}
 	vec, err := requireVectorArg("vectorToList", args[0])
 	if err != nil {
@@ -926,7 +1077,7 @@ func primVectorToList(ev *lang.Evaluator, args []lang.Value) (lang.Value, error)
 
 func primListToVector(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("listToVector expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("listToVector", 1, 1, len(args))
 	}
 	items, err := lang.ToSlice(args[0])
 	if err != nil {
@@ -936,86 +1087,16 @@ func primListToVector(ev *lang.Evaluator, args []lang.Value) (lang.Value, error)
 }
 
 func primEq(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("eq expects 2 arguments, got %d", len(args))
-	}
 	return lang.BoolValue(eqValues(args[0], args[1])), nil
 }
 
 func primEqual(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 2 {
-		return lang.Value{}, fmt.Errorf("equal expects 2 arguments, got %d", len(args))
-	}
 	return lang.BoolValue(equalValues(args[0], args[1])), nil
 }
 
-func primDisplay(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("display expects 1 argument, got %d", len(args))
-	}
-	v := args[0]
-	switch v.Type {
-	case lang.TypeString:
-		fmt.Fprint(os.Stdout, v.Str())
-	default:
-		fmt.Fprint(os.Stdout, v.String())
-	}
-	return lang.EmptyList, nil
-}
-
-func primNewline(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 0 {
-		return lang.Value{}, fmt.Errorf("newline expects no arguments")
-	}
-	fmt.Fprintln(os.Stdout)
-	return lang.EmptyList, nil
-}
-
-func primRead(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	if len(args) != 0 {
-		return lang.Value{}, fmt.Errorf("read expects no arguments")
-	}
-	readMu.Lock()
-	defer readMu.Unlock()
-	if readStream == nil {
-		readStream = sexpr.NewReader(os.Stdin)
-	}
-	val, err := readStream.Read()
-	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return lang.EOFObject, nil
-		}
-		return lang.Value{}, err
-	}
-	return val, nil
-}
-
-func primExit(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
-	code := 0
-	if len(args) > 0 {
-		if len(args) != 1 {
-			return lang.Value{}, fmt.Errorf("exit expects at most 1 argument")
-		}
-		switch args[0].Type {
-		case lang.TypeInt:
-			code = int(args[0].Int())
-		case lang.TypeBool:
-			if args[0].Bool() {
-				code = 0
-			} else {
-				code = 1
-			}
-		default:
-			return lang.Value{}, typeError("exit", "integer or boolean", args[0])
-		}
-	}
-	os.Exit(code)
-	return lang.EmptyList, nil
-}
-
 func primError(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) == 0 {
-		return lang.Value{}, fmt.Errorf("error")
+		return lang.Value{}, &lang.UserError{Message: "error"}
 	}
 	parts := make([]string, len(args))
 	for i, arg := range args {
@@ -1025,12 +1106,32 @@ func primError(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 			parts[i] = arg.String()
 		}
 	}
-	return lang.Value{}, fmt.Errorf("%s", strings.Join(parts, " "))
+	return lang.Value{}, &lang.UserError{Message: strings.Join(parts, " "), Args: append([]lang.Value(nil), args...)}
+}
+
+func primErrorf(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	format, err := requireStringArg("errorf", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	message, err := formatValues("errorf", format, args[1:])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.Value{}, &lang.UserError{Message: message, Args: append([]lang.Value(nil), args[1:]...)}
+}
+
+func primMacroexpandSteps(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	steps, err := ev.MacroexpandSteps(args[0], ev.CurrentEnv())
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("macroexpandSteps: %w", err)
+	}
+	return lang.List(steps...), nil
 }
 
 func primApply(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 2 {
-		return lang.Value{}, fmt.Errorf("apply expects at least 2 arguments")
+		return lang.Value{}, &lang.ArityError{Proc: "apply", Want: 2, AtLeast: true, Got: len(args)}
 	}
 	proc := args[0]
 	var callArgs []lang.Value
@@ -1040,20 +1141,19 @@ func primApply(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	last := args[len(args)-1]
 	lastArgs, err := lang.ToSlice(last)
 	if err != nil {
-		return lang.Value{}, fmt.Errorf("apply expects final argument to be a list")
+		return lang.Value{}, typeError("apply", "list as final argument", last)
 	}
 	callArgs = append(callArgs, lastArgs...)
-	return ev.Apply(proc, callArgs)
+	return lang.TailCall(proc, callArgs), nil
 }
 
-var gensymCounter int64
+var gensymCounter atomic.Int64
 
 func primGensym(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 0 {
-		return lang.Value{}, fmt.Errorf("gensym expects no arguments")
+		return lang.Value{}, arityError("gensym", 0, 0, len(args))
 	}
-	name := fmt.Sprintf("g%d", gensymCounter)
-	gensymCounter++
+	name := fmt.Sprintf("g%d", gensymCounter.Add(1)-1)
 	return lang.SymbolValue(name), nil
 }
 
@@ -1070,7 +1170,7 @@ func primStringAppend(ev *lang.Evaluator, args []lang.Value) (lang.Value, error)
 
 func primStringSlice(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 2 || len(args) > 3 {
-		return lang.Value{}, fmt.Errorf("stringSlice expects 2 or 3 arguments, got %d", len(args))
+		return lang.Value{}, arityError("stringSlice", 2, 3, len(args))
 	}
 	source := args[0]
 	if source.Type != lang.TypeString {
@@ -1082,7 +1182,7 @@ func primStringSlice(ev *lang.Evaluator, args []lang.Value) (lang.Value, error)
 	}
 	start := startVal.Int()
 	str := source.Str()
-	length := int64(len(str))
+	length := int64(utf8.RuneCountInString(str))
 	if start < 0 || start > length {
 		return lang.Value{}, fmt.Errorf("stringSlice start index %d out of range 0..%d", start, length)
 	}
@@ -1100,22 +1200,55 @@ func primStringSlice(ev *lang.Evaluator, args []lang.Value) (lang.Value, error)
 	if end < start {
 		return lang.Value{}, fmt.Errorf("stringSlice end index %d precedes start %d", end, start)
 	}
-	return lang.StringValue(str[start:end]), nil
+	return lang.StringValue(charSlice(str, start, end)), nil
+}
+
+func primStringFields(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("stringFields", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return stringList(strings.Fields(str)), nil
+}
+
+// primStringLines splits on "\n", dropping a trailing "\r" from each line and
+// the empty line after a final newline.
+func primStringLines(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("stringLines", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if str == "" {
+		return lang.EmptyList, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(str, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return stringList(lines), nil
+}
+
+func stringList(parts []string) lang.Value {
+	values := make([]lang.Value, len(parts))
+	for i, part := range parts {
+		values[i] = lang.StringValue(part)
+	}
+	return lang.List(values...)
 }
 
 func primStringLength(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("stringLength expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("stringLength", 1, 1, len(args))
 	}
 	if args[0].Type != lang.TypeString {
 		return lang.Value{}, typeError("stringLength", "string", args[0])
 	}
-	return lang.IntValue(int64(len(args[0].Str()))), nil
+	return lang.IntValue(int64(utf8.RuneCountInString(args[0].Str()))), nil
 }
 
 func primMakeString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) < 1 || len(args) > 2 {
-		return lang.Value{}, fmt.Errorf("makeString expects 1 or 2 arguments, got %d", len(args))
+		return lang.Value{}, arityError("makeString", 1, 2, len(args))
 	}
 	lengthArg := args[0]
 	if lengthArg.Type != lang.TypeInt {
@@ -1125,6 +1258,9 @@ func primMakeString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if length < 0 {
 		return lang.Value{}, fmt.Errorf("makeString length must be non-negative, got %d", length)
 	}
+	if err := ev.CheckAlloc(length); err != nil {
+		return lang.Value{}, fmt.Errorf("makeString: %w", err)
+	}
 	fill := " "
 	if len(args) == 2 {
 		if args[1].Type != lang.TypeString {
@@ -1147,9 +1283,42 @@ func primMakeString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	return lang.StringValue(builder.String()), nil
 }
 
+func primCodePointToString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	n, err := requireIntArg("codePointToString", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if n < 0 || n > utf8.MaxRune || !utf8.ValidRune(rune(n)) {
+		return lang.Value{}, fmt.Errorf("codePointToString: invalid code point %d", n)
+	}
+	return lang.StringValue(string(rune(n))), nil
+}
+
+// primStringToCodePoints decodes s as UTF-8; each invalid byte becomes
+// U+FFFD, as when ranging over a Go string.
+func primStringToCodePoints(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("stringToCodePoints", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	points := make([]lang.Value, 0, utf8.RuneCountInString(str))
+	for _, r := range str {
+		points = append(points, lang.IntValue(int64(r)))
+	}
+	return lang.List(points...), nil
+}
+
+func primUTF8Length(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("utf8Length", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.IntValue(int64(utf8.RuneCountInString(str))), nil
+}
+
 func primSymbolToString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("symbolToString expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("symbolToString", 1, 1, len(args))
 	}
 	if args[0].Type != lang.TypeSymbol {
 		return lang.Value{}, typeError("symbolToString", "symbol", args[0])
@@ -1159,7 +1328,7 @@ func primSymbolToString(ev *lang.Evaluator, args []lang.Value) (lang.Value, erro
 
 func primStringToSymbol(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("stringToSymbol expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("stringToSymbol", 1, 1, len(args))
 	}
 	if args[0].Type != lang.TypeString {
 		return lang.Value{}, typeError("stringToSymbol", "string", args[0])
@@ -1169,13 +1338,15 @@ func primStringToSymbol(ev *lang.Evaluator, args []lang.Value) (lang.Value, erro
 
 func primNumberToString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("numberToString expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("numberToString", 1, 1, len(args))
 	}
 	switch args[0].Type {
 	case lang.TypeInt:
 		return lang.StringValue(strconv.FormatInt(args[0].Int(), 10)), nil
+	case lang.TypeBigInt:
+		return lang.StringValue(args[0].BigInt().String()), nil
 	case lang.TypeReal:
-		return lang.StringValue(strconv.FormatFloat(args[0].Real(), 'g', -1, 64)), nil
+		return lang.StringValue(lang.FormatReal(args[0].Real(), 0)), nil
 	default:
 		return lang.Value{}, typeError("numberToString", "number", args[0])
 	}
@@ -1183,7 +1354,7 @@ func primNumberToString(ev *lang.Evaluator, args []lang.Value) (lang.Value, erro
 
 func primStringToNumber(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("stringToNumber expects 1 argument, got %d", len(args))
+		return lang.Value{}, arityError("stringToNumber", 1, 1, len(args))
 	}
 	if args[0].Type != lang.TypeString {
 		return lang.Value{}, typeError("stringToNumber", "string", args[0])
@@ -1194,6 +1365,10 @@ func primStringToNumber(ev *lang.Evaluator, args []lang.Value) (lang.Value, erro
 	}
 	if i, err := strconv.ParseInt(str, 10, 64); err == nil {
 		return lang.IntValue(i), nil
+	} else if errors.Is(err, strconv.ErrRange) {
+		if b, ok := new(big.Int).SetString(str, 10); ok {
+			return lang.BigIntValue(b), nil
+		}
 	}
 	if f, err := strconv.ParseFloat(str, 64); err == nil {
 		return lang.RealValue(f), nil
@@ -1203,13 +1378,19 @@ func primStringToNumber(ev *lang.Evaluator, args []lang.Value) (lang.Value, erro
 
 func unaryTypePredicate(name string, args []lang.Value, pred func(lang.Value) bool) (lang.Value, error) {
 	if len(args) != 1 {
-		return lang.Value{}, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+		return lang.Value{}, arityError(name, 1, 1, len(args))
 	}
 	return lang.BoolValue(pred(args[0])), nil
 }
 
+// arityError reports a call of name with got arguments when it takes
+// between want and max.
+func arityError(name string, want, max, got int) error {
+	return &lang.ArityError{Proc: name, Want: want, Max: max, Got: got}
+}
+
 func typeError(name, expected string, got lang.Value) error {
-	return fmt.Errorf("%s expects %s, got %s", name, expected, typeName(got))
+	return &lang.TypeError{Proc: name, Want: expected, Got: got}
 }
 
 func requireIntArg(name string, v lang.Value) (int64, error) {
@@ -1219,6 +1400,13 @@ func requireIntArg(name string, v lang.Value) (int64, error) {
 	return v.Int(), nil
 }
 
+func requireStringArg(name string, v lang.Value) (string, error) {
+	if v.Type != lang.TypeString {
+		return "", typeError(name, "string", v)
+	}
+	return v.Str(), nil
+}
+
 func requireVectorArg(name string, v lang.Value) (*lang.Vector, error) {
 	if v.Type != lang.TypeVector {
 		return nil, typeError(name, "vector", v)
@@ -1231,47 +1419,11 @@ func requireVectorArg(name string, v lang.Value) (*lang.Vector, error) {
 }
 
 func typeName(v lang.Value) string {
-	switch v.Type {
-	case lang.TypeEmpty:
-		return "empty-list"
-	case lang.TypeBool:
-		return "boolean"
-	case lang.TypeInt:
-		return "integer"
-	case lang.TypeReal:
-		return "real"
-	case lang.TypeString:
-		return "string"
-	case lang.TypeSymbol:
-		return "symbol"
-	case lang.TypePair:
-		return "pair"
-	case lang.TypeVector:
-		return "vector"
-	case lang.TypePrimitive:
-		return "primitive"
-	case lang.TypeClosure:
-		return "closure"
-	case lang.TypeContinuation:
-		return "continuation"
-	case lang.TypeMacro:
-		return "macro"
-	case lang.TypeEOF:
-		return "eof-object"
-	default:
-		return "unknown"
-	}
+	return v.Type.String()
 }
 
 func toFloat(v lang.Value) (float64, error) {
-	switch v.Type {
-	case lang.TypeInt:
-		return float64(v.Int()), nil
-	case lang.TypeReal:
-		return v.Real(), nil
-	default:
-		return 0, fmt.Errorf("expected number")
-	}
+	return lang.AsFloat(v)
 }
 
 func eqValues(a, b lang.Value) bool {
@@ -1285,10 +1437,14 @@ func eqValues(a, b lang.Value) bool {
 		return a.Bool() == b.Bool()
 	case lang.TypeInt:
 		return a.Int() == b.Int()
+	case lang.TypeBigInt:
+		return a.BigInt().Cmp(b.BigInt()) == 0
 	case lang.TypeReal:
 		return a.Real() == b.Real()
 	case lang.TypeString:
 		return a.Str() == b.Str()
+	case lang.TypeChar:
+		return a.Char() == b.Char()
 	case lang.TypeSymbol:
 		return a.Sym() == b.Sym()
 	case lang.TypePair:
@@ -1303,6 +1459,18 @@ func eqValues(a, b lang.Value) bool {
 		return a.Continuation() == b.Continuation()
 	case lang.TypeMacro:
 		return a.Macro() == b.Macro()
+	case lang.TypeRegex:
+		return a.Regex() == b.Regex()
+	case lang.TypeMap:
+		return a.Map() == b.Map()
+	case lang.TypeRecord:
+		return a.Record() == b.Record()
+	case lang.TypeErrorObject:
+		return a.ErrorObject() == b.ErrorObject()
+	case lang.TypeEnvironment:
+		return a.Environment() == b.Environment()
+	case lang.TypeChannel:
+		return a.Channel() == b.Channel()
 	case lang.TypeEOF:
 		return true
 	default:
@@ -1311,13 +1479,11 @@ func eqValues(a, b lang.Value) bool {
 }
 
 func equalValues(a, b lang.Value) bool {
-	if a.Type == lang.TypeInt && b.Type == lang.TypeReal {
-		return float64(a.Int()) == b.Real()
-	}
-	if a.Type == lang.TypeReal && b.Type == lang.TypeInt {
-		return a.Real() == float64(b.Int())
-	}
 	if a.Type != b.Type {
+		if isNumber(a) && isNumber(b) {
+			c, ok := compareNumbers(a, b)
+			return ok && c == 0
+		}
 		return false
 	}
 	switch a.Type {
@@ -1327,10 +1493,14 @@ func equalValues(a, b lang.Value) bool {
 		return a.Bool() == b.Bool()
 	case lang.TypeInt:
 		return a.Int() == b.Int()
+	case lang.TypeBigInt:
+		return a.BigInt().Cmp(b.BigInt()) == 0
 	case lang.TypeReal:
 		return a.Real() == b.Real()
 	case lang.TypeString:
 		return a.Str() == b.Str()
+	case lang.TypeChar:
+		return a.Char() == b.Char()
 	case lang.TypeSymbol:
 		return a.Sym() == b.Sym()
 	case lang.TypePair:
@@ -1363,6 +1533,18 @@ func equalValues(a, b lang.Value) bool {
 		return a.Continuation() == b.Continuation()
 	case lang.TypeMacro:
 		return a.Macro() == b.Macro()
+	case lang.TypeRegex:
+		return a.Regex() == b.Regex()
+	case lang.TypeMap:
+		return equalMaps(a.Map(), b.Map())
+	case lang.TypeRecord:
+		return equalRecords(a.Record(), b.Record())
+	case lang.TypeErrorObject:
+		return a.ErrorObject() == b.ErrorObject()
+	case lang.TypeEnvironment:
+		return a.Environment() == b.Environment()
+	case lang.TypeChannel:
+		return a.Channel() == b.Channel()
 	case lang.TypeEOF:
 		return true
 	default:
@@ -1370,16 +1552,6 @@ func equalValues(a, b lang.Value) bool {
 	}
 }
 
-func setReadInput(r io.Reader) {
-	readMu.Lock()
-	defer readMu.Unlock()
-	if r == nil {
-		readStream = sexpr.NewReader(os.Stdin)
-		return
-	}
-	readStream = sexpr.NewReader(r)
-}
-
 func primitivePointer(p lang.Primitive) uintptr {
 	if p == nil {
 		return 0
@@ -1422,14 +1594,10 @@ func incDecPrimitive(ev *lang.Evaluator, name string, args []lang.Value, delta i
 		env = ev.Global
 	}
 	return env.Update(targetName, func(current lang.Value) (lang.Value, error) {
-		switch current.Type {
-		case lang.TypeInt:
-			return lang.IntValue(current.Int() + delta), nil
-		case lang.TypeReal:
-			return lang.RealValue(current.Real() + float64(delta)), nil
-		default:
+		if !isNumber(current) {
 			return lang.Value{}, typeError(name, "number", current)
 		}
+		return addNumbers(current, lang.IntValue(delta)), nil
 	})
 }
 
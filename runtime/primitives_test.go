@@ -1,12 +1,17 @@
 package runtime
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/sexpr"
 )
 
 func TestPrimSubAndDivEdgeCases(t *testing.T) {
@@ -41,6 +46,41 @@ func TestPrimSubAndDivEdgeCases(t *testing.T) {
 	})
 }
 
+func TestPrimDivAndReciprocal(t *testing.T) {
+	ev := NewEvaluator()
+
+	val, err := primDiv(ev, []lang.Value{lang.IntValue(0), lang.IntValue(5)})
+	if err != nil {
+		t.Fatalf("zero dividend should be allowed: %v", err)
+	}
+	if val.Type != lang.TypeReal || val.Real() != 0 {
+		t.Fatalf("expected 0.0, got %v", val)
+	}
+
+	for _, prim := range []struct {
+		name string
+		fn   func(*lang.Evaluator, []lang.Value) (lang.Value, error)
+	}{{"/", primDiv}, {"reciprocal", primReciprocal}} {
+		val, err := prim.fn(ev, []lang.Value{lang.IntValue(4)})
+		if err != nil {
+			t.Fatalf("%s reciprocal error: %v", prim.name, err)
+		}
+		if val.Type != lang.TypeReal || val.Real() != 0.25 {
+			t.Fatalf("%s: expected 0.25, got %v", prim.name, val)
+		}
+		if _, err := prim.fn(ev, []lang.Value{lang.IntValue(0)}); err == nil || err.Error() != prim.name+": division by zero" {
+			t.Fatalf("%s: expected division by zero error, got %v", prim.name, err)
+		}
+		if _, err := prim.fn(ev, []lang.Value{lang.StringValue("x")}); err == nil || !strings.Contains(err.Error(), prim.name+" expects number") {
+			t.Fatalf("%s: expected type error, got %v", prim.name, err)
+		}
+	}
+
+	if _, err := primReciprocal(ev, []lang.Value{lang.IntValue(1), lang.IntValue(2)}); err == nil || !strings.Contains(err.Error(), "reciprocal expects 1 argument") {
+		t.Fatalf("expected reciprocal arity error, got %v", err)
+	}
+}
+
 func TestPrimMod(t *testing.T) {
 	ev := NewEvaluator()
 
@@ -234,6 +274,129 @@ func TestPrimRandomIntegerAndSeed(t *testing.T) {
 	})
 }
 
+func TestPrimRoundTo(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"roundTo(3.14159, 2)", "3.14"},
+		{"roundTo(2.675, 2)", "2.67"},
+		{"roundTo(2.5, 0)", "3"},
+		{"roundTo(-2.5, 0)", "-3"},
+		{"roundTo(1234.5, -1)", "1230"},
+		{"roundTo(0.1 + 0.2, 10)", "0.3"},
+		{"roundTo(7, 3)", "7"},
+		{"roundTo(1250, -2)", "1300"},
+		{"roundTo(-1249, -2)", "-1200"},
+		{"roundTo(123456789012345678901234567890, -29)", "100000000000000000000000000000"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	if _, err := EvaluateGispString(ev, `roundTo("x", 1)`); err == nil || !strings.Contains(err.Error(), "roundTo expects number") {
+		t.Fatalf("expected type error, got %v", err)
+	}
+	if _, err := EvaluateGispString(ev, `roundTo(1.5, 0.5)`); err == nil || !strings.Contains(err.Error(), "roundTo expects integer") {
+		t.Fatalf("expected type error for digits, got %v", err)
+	}
+}
+
+func TestExactIntegerPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"isqrt(0)", "0"},
+		{"isqrt(15)", "3"},
+		{"isqrt(16)", "4"},
+		{"isqrt(100000000000000000000000000000000000000000)", "316227766016837933199"},
+		{"[floorDiv(7, 2), floorDiv(-7, 2), floorDiv(7, -2), floorDiv(-7, -2), floorDiv(-8, 2)]", "(3 -4 -4 3 -4)"},
+		{"[ceilDiv(7, 2), ceilDiv(-7, 2), ceilDiv(7, -2), ceilDiv(-7, -2), ceilDiv(8, 2)]", "(4 -3 -3 4 4)"},
+		{"floorDiv(-9223372036854775808, -1)", "9223372036854775808"},
+		{"[exactFloor(2.5), exactFloor(-2.5), exactCeil(2.1), exactCeil(-2.5), exactCeil(3)]", "(2 -3 3 -2 3)"},
+		{"integerp(exactFloor(2.0))", "#t"},
+		{"exactFloor(1e20)", "100000000000000000000"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	for src, want := range map[string]string{
+		"isqrt(-1)":              "isqrt: negative argument -1",
+		"isqrt(2.0)":             "isqrt expects integer",
+		"floorDiv(1, 0)":         "floorDiv: division by zero",
+		"ceilDiv(1.5, 1)":        "ceilDiv expects integer",
+		`exactCeil("x")`:         "exactCeil expects number",
+		"exactFloor(1e308 * 10)": "has no integer value",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestMathPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"[pi, e]", "(3.141592653589793 2.718281828459045)"},
+		{"[sqrt(16), sqrt(2.25), sqrt(-1)]", "(4 1.5 NaN)"},
+		{"[sin(0), cos(0), tan(0), asin(1) * 2 == pi, acos(1), atan(1) * 4 == pi]", "(0 1 0 #t 0 #t)"},
+		{"[atan2(1, 0) * 2 == pi, atan2(0, -1) == pi]", "(#t #t)"},
+		{"[exp(0), log(1), log(e), log(0)]", "(1 0 1 -Inf)"},
+		{"[pow(2, 10), pow(-3, 3), pow(2, 0), pow(2, -1), pow(4, 0.5), pow(2.0, 3)]", "(1024 -27 1 0.5 2 8)"},
+		{"pow(2, 100)", "1267650600228229401496703205376"},
+		{"pow(1, 100000000000000000000)", "1"},
+		{"[floor(2.5), floor(-2.5), ceil(2.1), ceil(-2.5), round(2.5), round(-2.5), round(2.4), truncate(-2.7)]",
+			"(2 -3 3 -2 3 -3 2 -2)"},
+		{"[floor(7), ceil(-7), round(100000000000000000000), truncate(3)]", "(7 -7 100000000000000000000 3)"},
+		{"[abs(-3), abs(3), abs(-2.5), abs(-9223372036854775808)]", "(3 3 2.5 9223372036854775808)"},
+		{"[min(3, 1, 2), max(3, 1, 2), min(1, 1.5), max(1, 0.5), min(7)]", "(1 3 1 1 7)"},
+		{"max(1, 100000000000000000000, 2.5)", "100000000000000000000"},
+		{"min(1, 0 * (1e308 * 10), 2)", "NaN"},
+		{"[realp(sqrt(16)), integerp(sqrt(16)), integerp(floor(2.5)), integerp(pow(2, 3)), integerp(pow(2.0, 3))]", "(#t #f #f #t #f)"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	ev.MaxAlloc = 100
+	for src, want := range map[string]string{
+		`sqrt("x")`:                   "sqrt expects number",
+		`pow(2, "x")`:                 "pow expects number",
+		"pow(2, 100000)":              "exceeds limit",
+		"pow(3, 9223372036854775807)": "too large",
+		"floor(nil)":                  "floor expects number",
+		"abs(`'a)":                    "abs expects number",
+		`max(1, "2")`:                 "max expects number",
+		"min()":                       "min",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
 func TestCompoundAssignPrimitives(t *testing.T) {
 	ev := NewEvaluator()
 	env := lang.NewEnv(ev.Global)
@@ -282,6 +445,13 @@ func TestCompoundAssignPrimitives(t *testing.T) {
 	if err == nil || !strings.Contains(err.Error(), "symbol") {
 		t.Fatalf("expected symbol type error, got %v", err)
 	}
+
+	// The delta may be the result of a call, which must not leave the
+	// update looking for the variable in the callee's frame.
+	val, err = EvaluateGispString(ev, "func one(n) { return 1 }; func total() { var s = 0; s += one(0); return s }; total()")
+	if err != nil || val.String() != "1" {
+		t.Fatalf("+= with a call as delta => %v, %v; want 1", val, err)
+	}
 }
 
 func TestPostIncDecPrimitives(t *testing.T) {
@@ -358,8 +528,7 @@ func TestPrimRead(t *testing.T) {
 	})
 
 	t.Run("reads successive datums and EOF", func(t *testing.T) {
-		setReadInput(strings.NewReader("(+ 1 2) 42 #t"))
-		t.Cleanup(func() { setReadInput(nil) })
+		ev.SetStdin(strings.NewReader("(+ 1 2) 42 #t"))
 
 		expr, err := primRead(ev, nil)
 		if err != nil {
@@ -407,6 +576,91 @@ func TestPrimRead(t *testing.T) {
 	})
 }
 
+func TestEvaluatorsHaveIsolatedStreams(t *testing.T) {
+	const n = 8
+	outs := make([]strings.Builder, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		ev := NewEvaluator()
+		ev.SetStdin(strings.NewReader(fmt.Sprintf("%d %d", i, i*10)))
+		ev.SetStdout(&outs[i])
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = EvaluateGispString(ev, `
+display(read())
+newline()
+display(read())
+newline()`)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("evaluator %d: %v", i, errs[i])
+		}
+		if want := fmt.Sprintf("%d\n%d\n", i, i*10); outs[i].String() != want {
+			t.Fatalf("evaluator %d printed %q, want %q", i, outs[i].String(), want)
+		}
+	}
+}
+
+// sliceValues is a ValueReader over fixed values.
+type sliceValues []lang.Value
+
+func (s *sliceValues) Read() (lang.Value, error) {
+	if len(*s) == 0 {
+		return lang.Value{}, io.EOF
+	}
+	v := (*s)[0]
+	*s = (*s)[1:]
+	return v, nil
+}
+
+func TestSetReadInput(t *testing.T) {
+	ev := NewEvaluator()
+	ev.SetStdin(strings.NewReader("from-stdin"))
+	ev.SetReadInput(&sliceValues{lang.IntValue(1), lang.StringValue("two")})
+	val, err := EvaluateGispString(ev, `[read(), read(), eofp(read())]`)
+	if err != nil || val.String() != `(1 "two" #t)` {
+		t.Fatalf("read from SetReadInput => %v, %v", val, err)
+	}
+	ev.SetReadInput(nil)
+	val, err = EvaluateGispString(ev, `read()`)
+	if err != nil || val.String() != "from-stdin" {
+		t.Fatalf("read after SetReadInput(nil) => %v, %v", val, err)
+	}
+}
+
+func TestForksShareReadInput(t *testing.T) {
+	// Goroutines started by go read from the same stream as their parent,
+	// each value going to exactly one of them.
+	var input strings.Builder
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&input, "%d ", i)
+	}
+	ev := NewEvaluator()
+	ev.SetStdin(strings.NewReader(input.String()))
+	val, err := EvaluateGispString(ev, `
+var sums = makeChannel()
+func reader() {
+	var s = 0
+	var i = 0
+	while i < 10 { s += read(); i++ }
+	send(sums, s)
+}
+var i = 0
+while i < 4 { go(reader); i++ }
+var total = 0
+i = 0
+while i < 4 { total += receive(sums); i++ }
+[total, eofp(read())]`)
+	if err != nil || val.String() != "(820 #t)" {
+		t.Fatalf("forked reads => %v, %v", val, err)
+	}
+}
+
 func TestPrimComparisonAndNot(t *testing.T) {
 	ev := NewEvaluator()
 
@@ -423,6 +677,132 @@ func TestPrimComparisonAndNot(t *testing.T) {
 	}
 }
 
+func TestPrimComparisonLargeIntegers(t *testing.T) {
+	ev := NewEvaluator()
+	big := int64(1) << 53
+	cases := []struct {
+		name string
+		prim func(*lang.Evaluator, []lang.Value) (lang.Value, error)
+		args []lang.Value
+		want bool
+	}{
+		{"distinct huge ints are not equal", primNumEq, []lang.Value{lang.IntValue(big), lang.IntValue(big + 1)}, false},
+		{"equal huge ints", primNumEq, []lang.Value{lang.IntValue(math.MaxInt64), lang.IntValue(math.MaxInt64)}, true},
+		{"less on huge ints", primLess, []lang.Value{lang.IntValue(big), lang.IntValue(big + 1)}, true},
+		{"greater on max ints", primGreater, []lang.Value{lang.IntValue(math.MaxInt64), lang.IntValue(math.MaxInt64 - 1)}, true},
+		{"less-equal chain", primLessEq, []lang.Value{lang.IntValue(big), lang.IntValue(big), lang.IntValue(big + 1)}, true},
+		{"greater-equal chain fails", primGreaterEq, []lang.Value{lang.IntValue(big + 1), lang.IntValue(big + 2)}, false},
+		{"mixed types use floats", primNumEq, []lang.Value{lang.IntValue(2), lang.RealValue(2.0)}, true},
+		{"mixed less", primLess, []lang.Value{lang.RealValue(1.5), lang.IntValue(2)}, true},
+		{"NaN is unordered", primNumEq, []lang.Value{lang.RealValue(math.NaN()), lang.RealValue(math.NaN())}, false},
+		{"NaN fails less", primLess, []lang.Value{lang.RealValue(math.NaN()), lang.IntValue(1)}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			val, err := tc.prim(ev, tc.args)
+			if err != nil {
+				t.Fatalf("comparison error: %v", err)
+			}
+			if val.Type != lang.TypeBool || val.Bool() != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, val)
+			}
+		})
+	}
+
+	if _, err := primNumEq(ev, []lang.Value{lang.IntValue(1), lang.StringValue("1")}); err == nil || !strings.Contains(err.Error(), "= expects number") {
+		t.Fatalf("expected type error from primNumEq, got %v", err)
+	}
+}
+
+func TestIntegerOverflowPromotesToBigInt(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"(+ 9223372036854775807 1)", "9223372036854775808"},
+		{"(- -9223372036854775808 1)", "-9223372036854775809"},
+		{"(- -9223372036854775808)", "9223372036854775808"},
+		{"(* 4294967296 4294967296)", "18446744073709551616"},
+		{"(* -1 -9223372036854775808)", "9223372036854775808"},
+		{"(<< 1 64)", "18446744073709551616"},
+		{"(<< -3 62)", "-13835058055282163712"},
+		{"(<< 3 61)", "6917529027641081856"},
+		{"(- (+ 9223372036854775807 1) 1)", "9223372036854775807"},
+		{"(% 100000000000000000000 7)", "2"},
+		{"(+ 100000000000000000000 0.5)", "1e+20"},
+		{"(< 9223372036854775807 9223372036854775808)", "#t"},
+		{"(= 100000000000000000000 100000000000000000000)", "#t"},
+		{"(equal 100000000000000000000 1e20)", "#t"},
+		{"(list (integerp 100000000000000000000) (evenp 100000000000000000001))", "(#t #f)"},
+		{"(begin (define n 9223372036854775807) (+= 'n 1) (*= 'n 2) (<<= 'n 1) n)", "36893488147419103232"},
+		{"(begin (define m 9223372036854775807) (++ 'm) m)", "9223372036854775808"},
+		{"(numberToString (stringToNumber \"123456789012345678901234567890\"))", `"123456789012345678901234567890"`},
+	}
+	for _, tc := range cases {
+		if got := evalString(t, ev, tc.src).String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.src, tc.want, got)
+		}
+	}
+
+	if val := evalString(t, ev, "(- (+ 9223372036854775807 1) 1)"); val.Type != lang.TypeInt {
+		t.Fatalf("expected a result in int64 range to be TypeInt, got %s", val.Type)
+	}
+	if _, err := primShiftLeft(ev, []lang.Value{lang.IntValue(1), lang.IntValue(1 << 40)}); !errors.Is(err, lang.ErrAllocLimit) {
+		t.Fatalf("expected a huge shift to hit the allocation limit, got %v", err)
+	}
+	if _, err := primBitAnd(ev, []lang.Value{evalString(t, ev, "100000000000000000000"), lang.IntValue(1)}); err == nil || !strings.Contains(err.Error(), "got big-integer") {
+		t.Fatalf("expected bitwise and to reject a big integer, got %v", err)
+	}
+}
+
+func TestNumericPredicates(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"(list (zerop 0) (zero? 0.0) (zerop -0.0) (zerop 1))", "(#t #t #t #f)"},
+		{"(list (positivep 3) (positive? 0) (positivep -1.5))", "(#t #f #f)"},
+		{"(list (negativep -3) (negative? 0) (negativep 2.5))", "(#t #f #f)"},
+		{"(list (evenp 0) (even? -4) (evenp 7) (oddp -3) (odd? 10))", "(#t #t #f #t #f)"},
+		{"(list (not= 1 2) (not= 1 1.0) (not= 1 1 2) (not=))", "(#t #f #t #f)"},
+	}
+	for _, tc := range cases {
+		if got := evalString(t, ev, tc.src).String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	nan := lang.RealValue(math.NaN())
+	for _, name := range []string{"zerop", "positivep", "negativep"} {
+		proc, err := ev.Global.Get(name)
+		if err != nil {
+			t.Fatalf("%s not defined: %v", name, err)
+		}
+		val, err := ev.Apply(proc, []lang.Value{nan})
+		if err != nil || val.Bool() {
+			t.Fatalf("%s(NaN) => %v, %v; want #f", name, val, err)
+		}
+	}
+
+	errorCases := map[string]string{
+		`(zero? "0")`:  "zero? expects number, got string",
+		"(evenp 2.0)":  "evenp expects integer, got real",
+		`(not= 1 "1")`: "not= expects number, got string",
+		"(oddp)":       "oddp expects 1 argument, got 0",
+	}
+	for src, want := range errorCases {
+		forms, err := sexpr.ReadString(src)
+		if err != nil {
+			t.Fatalf("parse %s: %v", src, err)
+		}
+		if _, err := ev.EvalAll(forms, nil); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error %q, got %v", src, want, err)
+		}
+	}
+}
+
 func TestPrimListAndPairMutation(t *testing.T) {
 	ev := NewEvaluator()
 
@@ -544,7 +924,7 @@ func TestPrimApplyAndDisplay(t *testing.T) {
 		t.Fatalf("failed to get + primitive: %v", err)
 	}
 
-	result, err := primApply(ev, []lang.Value{
+	result, err := ev.Apply(lang.PrimitiveValue(primApply), []lang.Value{
 		plus,
 		lang.IntValue(1),
 		lang.IntValue(2),
@@ -557,7 +937,7 @@ func TestPrimApplyAndDisplay(t *testing.T) {
 		t.Fatalf("expected 10 from primApply, got %v", result)
 	}
 
-	if _, err := primApply(ev, []lang.Value{plus, lang.IntValue(1), lang.IntValue(2), lang.IntValue(3)}); err == nil || !strings.Contains(err.Error(), "apply expects final argument to be a list") {
+	if _, err := primApply(ev, []lang.Value{plus, lang.IntValue(1), lang.IntValue(2), lang.IntValue(3)}); err == nil || !strings.Contains(err.Error(), "apply expects list as final argument, got integer") {
 		t.Fatalf("expected primApply final argument error, got %v", err)
 	}
 
@@ -582,6 +962,19 @@ func TestPrimApplyAndDisplay(t *testing.T) {
 	if output != "\n" {
 		t.Fatalf("expected newline output, got %q", output)
 	}
+
+	nested := lang.List(lang.SymbolValue("define"), lang.SymbolValue("x"), lang.List(lang.SymbolValue("+"), lang.IntValue(1), lang.IntValue(2)))
+	output = captureOutput(func() {
+		if _, err := primPrettyPrint(ev, []lang.Value{nested, lang.IntValue(10)}); err != nil {
+			t.Fatalf("primPrettyPrint error: %v", err)
+		}
+	})
+	if want := "(define x\n  (+ 1 2))\n"; output != want {
+		t.Fatalf("expected prettyPrint output %q, got %q", want, output)
+	}
+	if _, err := primPrettyPrint(ev, []lang.Value{nested, lang.IntValue(0)}); err == nil {
+		t.Fatalf("expected prettyPrint to reject non-positive width")
+	}
 }
 
 func TestPrimMap(t *testing.T) {
@@ -0,0 +1,80 @@
+package runtime
+
+import (
+	"github.com/sergev/gisp/lang"
+)
+
+// A Gisp `for x in c { ... }` loop compiles to a walk over the vector that
+// rangeItems returns, and `for k, v in c` over the two that rangeEntries
+// returns. Errors name the for statement, since that is what the user wrote.
+
+func installRangePrimitives(env *lang.Env) {
+	Register(env, "rangeItems", 1, false,
+		"rangeItems(c) returns a vector of the elements of a list or vector, the characters of a string, or the keys of a map.", primRangeItems)
+	Register(env, "rangeEntries", 1, false,
+		"rangeEntries(c) returns two vectors: the indices and elements of a list, vector or string, or the keys and values of a map.", primRangeEntries)
+}
+
+// rangeValues returns the elements of c, or for a map its keys and values.
+// A vector is returned as it is, so a loop sees elements stored by its body,
+// as Go's range over a slice does.
+func rangeValues(c lang.Value) (keys, values []lang.Value, err error) {
+	switch c.Type {
+	case lang.TypeEmpty, lang.TypePair:
+		values, err = lang.ToSlice(c)
+		if err != nil {
+			return nil, nil, typeError("for", "proper list", c)
+		}
+	case lang.TypeVector:
+		vec, err := requireVectorArg("for", c)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = vec.Elements
+	case lang.TypeString:
+		for _, r := range c.Str() {
+			values = append(values, lang.CharValue(r))
+		}
+	case lang.TypeMap:
+		m, err := requireMapArg("for", c)
+		if err != nil {
+			return nil, nil, err
+		}
+		return m.Keys(), m.Values(), nil
+	default:
+		return nil, nil, typeError("for", "list, vector, string or map", c)
+	}
+	return nil, values, nil
+}
+
+func primRangeItems(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	keys, values, err := rangeValues(args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if keys != nil {
+		return lang.VectorValue(keys), nil
+	}
+	if args[0].Type == lang.TypeVector {
+		return args[0], nil
+	}
+	return lang.VectorValue(values), nil
+}
+
+func primRangeEntries(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	keys, values, err := rangeValues(args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if keys == nil {
+		keys = make([]lang.Value, len(values))
+		for i := range keys {
+			keys[i] = lang.IntValue(int64(i))
+		}
+	}
+	items := lang.VectorValue(values)
+	if args[0].Type == lang.TypeVector {
+		items = args[0]
+	}
+	return lang.MultipleValues(lang.VectorValue(keys), items), nil
+}
@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Regex primitives accept either a pattern string or a value returned by
+// regexCompile. Pattern strings are compiled through a shared cache, so a
+// loop matching the same pattern compiles it only once.
+
+func installRegexPrimitives(env *lang.Env) {
+	Register(env, "regexCompile", 1, false,
+		"regexCompile(pattern) compiles a regular expression in Go RE2 syntax.", primRegexCompile)
+	Register(env, "regexMatch", 2, false,
+		"regexMatch(re, s) reports whether s contains a match of re.", primRegexMatch)
+	Register(env, "regexFind", 2, false,
+		"regexFind(re, s) returns the first match and its groups as a list of strings, or false.", primRegexFind)
+	Register(env, "regexFindAll", 2, false,
+		"regexFindAll(re, s) returns every non-overlapping match of re in s.", primRegexFindAll)
+	Register(env, "regexReplace", 3, false,
+		"regexReplace(re, s, repl) replaces every match of re in s; $1 in repl names a group.", primRegexReplace)
+}
+
+// regexCacheSize bounds the number of compiled patterns kept by regexCache.
+const regexCacheSize = 128
+
+// regexCache is a least-recently-used cache of compiled patterns shared by
+// all evaluators.
+type regexCache struct {
+	mu      sync.Mutex
+	limit   int
+	order   *list.List // of *regexp.Regexp, most recently used first
+	entries map[string]*list.Element
+}
+
+func newRegexCache(limit int) *regexCache {
+	return &regexCache{limit: limit, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+var compiledPatterns = newRegexCache(regexCacheSize)
+
+// compile returns the cached expression for pattern, compiling it on a miss
+// and evicting the least recently used entry when the cache is full.
+func (c *regexCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[pattern]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[pattern] = c.order.PushFront(re)
+	if c.order.Len() > c.limit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*regexp.Regexp).String())
+	}
+	return re, nil
+}
+
+func (c *regexCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func requireRegexArg(name string, v lang.Value) (*regexp.Regexp, error) {
+	switch v.Type {
+	case lang.TypeRegex:
+		return v.Regex(), nil
+	case lang.TypeString:
+		re, err := compiledPatterns.compile(v.Str())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return re, nil
+	default:
+		return nil, typeError(name, "regex or string", v)
+	}
+}
+
+func primRegexCompile(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if args[0].Type == lang.TypeRegex {
+		return args[0], nil
+	}
+	pattern, err := requireStringArg("regexCompile", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	re, err := compiledPatterns.compile(pattern)
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("regexCompile: %w", err)
+	}
+	return lang.RegexValue(re), nil
+}
+
+// regexSubject unpacks the pattern and subject arguments shared by the
+// matching primitives.
+func regexSubject(name string, args []lang.Value) (*regexp.Regexp, string, error) {
+	re, err := requireRegexArg(name, args[0])
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := requireStringArg(name, args[1])
+	if err != nil {
+		return nil, "", err
+	}
+	return re, s, nil
+}
+
+func primRegexMatch(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	re, s, err := regexSubject("regexMatch", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(re.MatchString(s)), nil
+}
+
+// primRegexFind returns the whole match followed by one entry per group;
+// groups that did not take part in the match are false.
+func primRegexFind(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	re, s, err := regexSubject("regexFind", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return lang.BoolValue(false), nil
+	}
+	groups := make([]lang.Value, len(loc)/2)
+	for i := range groups {
+		start, end := loc[2*i], loc[2*i+1]
+		if start < 0 {
+			groups[i] = lang.BoolValue(false)
+		} else {
+			groups[i] = lang.StringValue(s[start:end])
+		}
+	}
+	return lang.List(groups...), nil
+}
+
+func primRegexFindAll(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	re, s, err := regexSubject("regexFindAll", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return stringList(re.FindAllString(s, -1)), nil
+}
+
+func primRegexReplace(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	re, s, err := regexSubject("regexReplace", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	repl, err := requireStringArg("regexReplace", args[2])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(re.ReplaceAllString(s, repl)), nil
+}
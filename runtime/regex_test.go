@@ -0,0 +1,72 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegexPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`regexMatch("b+", "abbc")`, "#t"},
+		{`regexMatch(regexCompile("^b"), "abbc")`, "#f"},
+		{`regexFind("(\\w+)@(\\w+)?", "mail bob@ now")`, `("bob@" "bob" #f)`},
+		{`regexFind("z", "abc")`, "#f"},
+		{`regexFindAll("[0-9]+", "a1 b22 c333")`, `("1" "22" "333")`},
+		{`regexReplace("(\\w+)=(\\w+)", "a=1 b=2", "$2=$1")`, `"1=a 2=b"`},
+		{`regexCompile("a.c")`, `#<regex "a.c">`},
+		{`equal(regexCompile("a.c"), regexCompile("a.c"))`, "#t"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	if _, err := EvaluateGispString(ev, `regexCompile("(")`); err == nil || !strings.Contains(err.Error(), "regexCompile: error parsing regexp") {
+		t.Fatalf("expected compile error, got %v", err)
+	}
+	if _, err := EvaluateGispString(ev, `regexMatch(1, "a")`); err == nil || !strings.Contains(err.Error(), "regexMatch expects regex or string") {
+		t.Fatalf("expected type error, got %v", err)
+	}
+}
+
+func TestRegexCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newRegexCache(2)
+	first, err := cache.compile("a")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if _, err := cache.compile("b"); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	// Touch "a" so that "b" is the one evicted.
+	if again, _ := cache.compile("a"); again != first {
+		t.Fatalf("expected cached pattern to be reused")
+	}
+	if _, err := cache.compile("c"); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if cache.len() != 2 {
+		t.Fatalf("expected cache to hold 2 patterns, got %d", cache.len())
+	}
+	if _, ok := cache.entries["b"]; ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	if again, _ := cache.compile("a"); again != first {
+		t.Fatalf("expected a to survive eviction")
+	}
+	if _, err := cache.compile("("); err == nil {
+		t.Fatalf("expected invalid pattern error")
+	}
+	if cache.len() != 2 {
+		t.Fatalf("invalid patterns must not be cached")
+	}
+}
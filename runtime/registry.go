@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// PrimitiveInfo describes a primitive installed through Register.
+type PrimitiveInfo struct {
+	Name string
+	// Arity is the number of required arguments. A variadic primitive
+	// accepts Arity or more; any other primitive exactly Arity.
+	Arity    int
+	Variadic bool
+	Doc      string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]PrimitiveInfo{}
+)
+
+// Register binds fn to name in env and records its metadata. Calls with the
+// wrong number of arguments are rejected before fn runs, so fn may index
+// args up to Arity without checking.
+func Register(env *lang.Env, name string, arity int, variadic bool, doc string, fn lang.Primitive) {
+	info := PrimitiveInfo{Name: name, Arity: arity, Variadic: variadic, Doc: doc}
+	registryMu.Lock()
+	registry[name] = info
+	registryMu.Unlock()
+	env.Define(name, lang.PrimitiveValue(func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		if err := info.checkArity(len(args)); err != nil {
+			return lang.Value{}, err
+		}
+		return fn(ev, args)
+	}))
+}
+
+func (info PrimitiveInfo) checkArity(got int) error {
+	if info.Variadic && got >= info.Arity || !info.Variadic && got == info.Arity {
+		return nil
+	}
+	return &lang.ArityError{Proc: info.Name, Want: info.Arity, AtLeast: info.Variadic, Got: got}
+}
+
+// LookupPrimitive returns the metadata recorded for a registered primitive.
+func LookupPrimitive(name string) (PrimitiveInfo, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	info, ok := registry[name]
+	return info, ok
+}
+
+// RegisteredPrimitives lists the names of all registered primitives in
+// sorted order.
+func RegisteredPrimitives() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func primHelp(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	var name string
+	switch args[0].Type {
+	case lang.TypeSymbol:
+		name = args[0].Sym()
+	case lang.TypeString:
+		name = args[0].Str()
+	default:
+		return lang.Value{}, typeError("help", "symbol or string", args[0])
+	}
+	info, ok := LookupPrimitive(name)
+	if !ok {
+		return lang.Value{}, fmt.Errorf("help: no documentation for %s", name)
+	}
+	return lang.StringValue(info.Doc), nil
+}
+
+func primBuiltin(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	var name string
+	switch args[0].Type {
+	case lang.TypeSymbol:
+		name = args[0].Sym()
+	case lang.TypeString:
+		name = args[0].Str()
+	default:
+		return lang.Value{}, typeError("builtin", "symbol or string", args[0])
+	}
+	val, ok := ev.Builtin(name)
+	if !ok {
+		return lang.Value{}, fmt.Errorf("builtin: no builtin named %s", name)
+	}
+	return val, nil
+}
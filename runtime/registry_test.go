@@ -0,0 +1,213 @@
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+	gispparser "github.com/sergev/gisp/parser"
+)
+
+func TestRegisterChecksArity(t *testing.T) {
+	ev := NewEvaluator()
+	calls := 0
+	fn := func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		calls++
+		return lang.IntValue(int64(len(args))), nil
+	}
+	Register(ev.Global, "testFixed", 2, false, "testFixed(a, b) is a test primitive.", fn)
+	Register(ev.Global, "testVariadic", 1, true, "", fn)
+	Register(ev.Global, "testNullary", 0, false, "", fn)
+
+	cases := []struct {
+		src     string
+		want    string
+		wantErr string
+	}{
+		{src: "testFixed(1, 2)", want: "2"},
+		{src: "testFixed(1)", wantErr: "testFixed expects 2 arguments, got 1"},
+		{src: "testVariadic(1, 2, 3)", want: "3"},
+		{src: "testVariadic()", wantErr: "testVariadic expects at least 1 argument, got 0"},
+		{src: "testNullary()", want: "0"},
+		{src: "testNullary(1)", wantErr: "testNullary expects no arguments"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("%s: expected error %q, got %v", tc.src, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls to reach the primitive, got %d", calls)
+	}
+
+	info, ok := LookupPrimitive("testFixed")
+	if !ok || info.Arity != 2 || info.Variadic || info.Doc != "testFixed(a, b) is a test primitive." {
+		t.Fatalf("LookupPrimitive => %+v, %v", info, ok)
+	}
+}
+
+func TestHelpPrimitive(t *testing.T) {
+	ev := NewEvaluator()
+	val, err := EvaluateGispString(ev, `help("cons")`)
+	if err != nil {
+		t.Fatalf("help failed: %v", err)
+	}
+	if !strings.HasPrefix(val.Str(), "cons(a, b)") {
+		t.Fatalf("unexpected help text %q", val.Str())
+	}
+	if _, err := EvaluateGispString(ev, `help("noSuchPrimitive")`); err == nil || !strings.Contains(err.Error(), "no documentation") {
+		t.Fatalf("expected missing documentation error, got %v", err)
+	}
+
+	names := RegisteredPrimitives()
+	found := false
+	for i, name := range names {
+		if i > 0 && names[i-1] > name {
+			t.Fatalf("RegisteredPrimitives not sorted: %v", names)
+		}
+		found = found || name == "daysInMonth"
+	}
+	if !found {
+		t.Fatalf("expected daysInMonth among registered primitives")
+	}
+}
+
+func TestBuiltinPrimitive(t *testing.T) {
+	ev := NewEvaluator()
+	val, err := EvaluateGispString(ev, `
+func list(a) { return "mine"; }
+builtin("list")(1, 2, list(3))
+`)
+	if err != nil {
+		t.Fatalf("builtin failed: %v", err)
+	}
+	if got := val.String(); got != `(1 2 "mine")` {
+		t.Fatalf("unexpected result %s", got)
+	}
+	if _, err := EvaluateGispString(ev, `builtin("noSuchPrimitive")`); err == nil || !strings.Contains(err.Error(), "no builtin named") {
+		t.Fatalf("expected missing builtin error, got %v", err)
+	}
+}
+
+func TestPrimitiveErrorsAreTyped(t *testing.T) {
+	ev := NewEvaluator()
+
+	_, err := EvaluateGispString(ev, "vectorRef([1, 2], 0, 1)")
+	var arity *lang.ArityError
+	if !errors.As(err, &arity) || arity.Proc != "vectorRef" || arity.Want != 2 || arity.Got != 3 {
+		t.Fatalf("expected ArityError from vectorRef, got %v", err)
+	}
+
+	_, err = EvaluateGispString(ev, `makeVector(1, 2, 3)`)
+	if !errors.As(err, &arity) || err.Error() != "line 1:11: makeVector expects 1 or 2 arguments, got 3" {
+		t.Fatalf("unexpected makeVector error: %v", err)
+	}
+
+	_, err = EvaluateGispString(ev, `stringLength(5)`)
+	var typeErr *lang.TypeError
+	if !errors.As(err, &typeErr) || typeErr.Proc != "stringLength" || typeErr.Want != "string" || typeErr.Got.Type != lang.TypeInt {
+		t.Fatalf("expected TypeError from stringLength, got %v", err)
+	}
+
+	_, err = EvaluateGispString(ev, `undefinedName + 1`)
+	var unbound *lang.UnboundVariableError
+	if !errors.As(err, &unbound) || unbound.Name != "undefinedName" {
+		t.Fatalf("expected UnboundVariableError, got %v", err)
+	}
+}
+
+func TestErrorTagsSeparateUserErrors(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src string
+		tag string
+	}{
+		{`vectorRef([1, 2], 0, 1)`, lang.TagArityError},
+		{`stringLength(5)`, lang.TagTypeError},
+		{`first(1)`, lang.TagTypeError},
+		{`rest(nil)`, lang.TagTypeError},
+		{`setFirst(nil, 1)`, lang.TagTypeError},
+		{`apply(list, 1)`, lang.TagTypeError},
+		{"`(& 1)", lang.TagArityError},
+		{"`(^)", lang.TagArityError},
+		{`undefinedName + 1`, lang.TagUnboundVariable},
+		{`error("stringLength expects string")`, lang.TagUserError},
+		{`error()`, lang.TagUserError},
+	}
+	for _, tc := range cases {
+		_, err := EvaluateGispString(ev, tc.src)
+		if got := lang.ErrorTag(err); got != tc.tag {
+			t.Fatalf("%s: tag %q, want %q (err %v)", tc.src, got, tc.tag, err)
+		}
+	}
+
+	_, err := EvaluateGispString(ev, `error("bad value:", 42, true)`)
+	var userErr *lang.UserError
+	if !errors.As(err, &userErr) || userErr.Message != "bad value: 42 #t" || len(userErr.Args) != 3 || userErr.Args[1].Int() != 42 {
+		t.Fatalf("expected UserError with arguments, got %#v", err)
+	}
+	if lang.ErrorTag(errors.New("plain")) != "" {
+		t.Fatal("expected no tag for an untyped error")
+	}
+}
+
+func TestErrorfFormatsMessage(t *testing.T) {
+	ev := NewEvaluator()
+	_, err := EvaluateGispString(ev, "var x = 7\nerrorf(\"bad %s: %d of %5.2f (%q, %v, %t, %x, %c%%)\", \"count\", x, 2, \"a\", [1, \"b\"], true, 255, integerToChar(122))")
+	var userErr *lang.UserError
+	if !errors.As(err, &userErr) || len(userErr.Args) != 8 || userErr.Args[1].Int() != 7 {
+		t.Fatalf("expected UserError with arguments, got %#v", err)
+	}
+	if want := `bad count: 7 of  2.00 ("a", (1 "b"), true, ff, z%)`; userErr.Message != want {
+		t.Fatalf("message %q, want %q", userErr.Message, want)
+	}
+	if want := "line 2:7: " + userErr.Message; err.Error() != want {
+		t.Fatalf("error %q, want %q", err.Error(), want)
+	}
+
+	errs := map[string]string{
+		`errorf("%d", "x")`:      "errorf expects integer, got string",
+		`errorf("%d and %d", 1)`: "errorf: missing argument for %d",
+		`errorf("done", 1)`:      `errorf: 1 arguments unused by format "done"`,
+		`errorf("%w", 1)`:        "errorf: unknown verb %w",
+		`errorf("50%")`:          "errorf: format ends in an incomplete verb",
+		`errorf(5)`:              "errorf expects string, got integer",
+	}
+	for src, want := range errs {
+		_, err := EvaluateGispString(ev, src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: got %v, want error containing %q", src, err, want)
+		}
+		if lang.ErrorTag(err) == lang.TagUserError {
+			t.Fatalf("%s: formatting failure reported as a user error", src)
+		}
+	}
+	_, err = EvaluateGispString(ev, `errorf("%*d|%-4s|%.*f", 4, 42, "ab", 1, 3.14159)`)
+	if !errors.As(err, &userErr) || userErr.Message != "  42|ab  |3.1" {
+		t.Fatalf("expected star width and precision, got %v", err)
+	}
+}
+
+func TestHelperBuiltinsAreBound(t *testing.T) {
+	ev := NewEvaluator()
+	for _, name := range gispparser.HelperBuiltins {
+		alias, err := ev.Global.Get(gispparser.BuiltinAlias(name))
+		if err != nil {
+			t.Fatalf("helper builtin %s: %v", name, err)
+		}
+		if builtin, _ := ev.Builtin(name); !eqValues(alias, builtin) {
+			t.Fatalf("%s is not bound to the builtin %s", gispparser.BuiltinAlias(name), name)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/sergev/gisp/lang"
 	gispparser "github.com/sergev/gisp/parser"
@@ -13,15 +14,80 @@ import (
 )
 
 // NewEvaluator constructs an evaluator with the standard runtime installed.
-func NewEvaluator() *lang.Evaluator {
+// Passing capabilities restricts the primitives to those groups, for example
+// NewEvaluator(CapCore|CapIO) leaves out exit and the filesystem; with no
+// arguments every group is installed.
+func NewEvaluator(caps ...Capability) *lang.Evaluator {
+	enabled := CapAll
+	if len(caps) > 0 {
+		enabled = 0
+		for _, c := range caps {
+			enabled |= c
+		}
+	}
 	ev := lang.NewEvaluator()
-	installPrimitives(ev)
-	if err := installLibrary(ev); err != nil {
+	if err := AddStdlib(ev.Global, enabled); err != nil {
 		panic(fmt.Errorf("runtime bootstrap failed: %w", err))
 	}
+	ev.SealBuiltins()
 	return ev
 }
 
+// AddStdlib installs the selected capability groups into env. CapCore is
+// always included. Like the Install functions it calls, it may be applied
+// to the same environment more than once.
+func AddStdlib(env *lang.Env, caps Capability) error {
+	if err := InstallCore(env); err != nil {
+		return err
+	}
+	if caps&CapMath != 0 {
+		InstallMath(env)
+	}
+	if caps&CapIO != 0 {
+		InstallIO(env)
+	}
+	if caps&CapOS != 0 {
+		InstallOS(env)
+	}
+	return nil
+}
+
+// InstallCore defines the core primitives and the prelude macros in env.
+// Reinstalling rebinds the same names, so repeated calls are harmless.
+func InstallCore(env *lang.Env) error {
+	installCorePrimitives(env)
+	installHelperAliases(env)
+	return installPrelude(env)
+}
+
+// installHelperAliases binds the names under which compiled Gisp code
+// reaches the builtins behind its constructs.
+func installHelperAliases(env *lang.Env) {
+	for _, name := range gispparser.HelperBuiltins {
+		if val, ok := env.Own(name); ok {
+			env.Define(gispparser.BuiltinAlias(name), val)
+		}
+	}
+}
+
+// InstallMath defines the math functions, pi and e, and the random number
+// primitives in env.
+func InstallMath(env *lang.Env) {
+	installMathPrimitives(env)
+}
+
+// InstallIO defines display, newline, prettyPrint and read in env.
+func InstallIO(env *lang.Env) {
+	installIOPrimitives(env)
+}
+
+// InstallOS defines the filesystem, file streaming, clock and exit
+// primitives in env.
+func InstallOS(env *lang.Env) {
+	installOSPrimitives(env)
+	installTimePrimitives(env)
+}
+
 // SetArgv stores the command-line arguments as a Scheme list in the given environment.
 func SetArgv(env *lang.Env, args []string) {
 	values := make([]lang.Value, len(args))
@@ -31,17 +97,19 @@ func SetArgv(env *lang.Env, args []string) {
 	env.Define("*argv*", lang.List(values...))
 }
 
-func installLibrary(ev *lang.Evaluator) error {
+func installPrelude(env *lang.Env) error {
 	if len(preludeForms) == 0 {
 		return nil
 	}
+	ev := lang.NewEvaluator()
+	ev.Global = env
 	for _, form := range preludeForms {
 		forms, err := sexpr.ReadString(form)
 		if err != nil {
 			return err
 		}
 		for _, expr := range forms {
-			if _, err := ev.Eval(expr, nil); err != nil {
+			if _, err := ev.Eval(expr, env); err != nil {
 				return err
 			}
 		}
@@ -90,16 +158,40 @@ func EvaluateGispString(ev *lang.Evaluator, src string) (lang.Value, error) {
 	return ev.EvalAll(forms, nil)
 }
 
-// EvaluateFile loads and executes a Scheme file, allowing #! shebang.
+// EvaluateFile loads and executes a Scheme file, allowing #! shebang. Gisp
+// files (.gisp) are parsed with ParseProgram, so a declared main runs after
+// the rest of the file. Loading a file again while it is still being loaded
+// fails with a lang.ImportCycleError.
 func EvaluateFile(ev *lang.Evaluator, path string) (lang.Value, error) {
+	if err := ev.EnterFile(path); err != nil {
+		return lang.Value{}, err
+	}
+	defer ev.LeaveFile()
 	data, err := readFileSkippingShebang(path)
 	if err != nil {
 		return lang.Value{}, err
 	}
 	switch filepath.Ext(path) {
 	case ".gisp":
-		return EvaluateGispReader(ev, bytes.NewReader(data))
+		forms, err := gispparser.ParseProgramFile(path, string(data))
+		if err != nil {
+			return lang.Value{}, err
+		}
+		return ev.EvalAll(forms, nil)
 	default:
 		return EvaluateReader(ev, bytes.NewReader(data))
 	}
 }
+
+// RunScriptCaptured runs the script at path in a fresh evaluator with every
+// capability installed and an empty *argv*, and returns its result along
+// with everything it printed. Output is captured even when the script fails,
+// so tests can compare it against expected transcripts.
+func RunScriptCaptured(path string) (result lang.Value, stdout string, err error) {
+	ev := NewEvaluator()
+	SetArgv(ev.Global, []string{})
+	var out strings.Builder
+	ev.SetOutput(&out)
+	result, err = EvaluateFile(ev, path)
+	return result, out.String(), err
+}
@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -87,6 +88,22 @@ inc(41);
 	}
 }
 
+func TestEvaluateFileErrorsNameTheFile(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "prog.gisp")
+	src := "func head(x) {\n    var y = first(x)\n    return y\n}\nhead(1)\n"
+	if err := os.WriteFile(script, []byte(src), 0o600); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	_, err := EvaluateFile(NewEvaluator(), script)
+	var located *lang.PositionError
+	if !errors.As(err, &located) || located.Pos.File != script || located.Pos.Line != 2 {
+		t.Fatalf("expected an error at %s line 2, got %v", script, err)
+	}
+	if want := script + ":2:18: first expects pair, got integer\n  in head, called at " + script + ":5:5"; err.Error() != want {
+		t.Fatalf("error %q, want %q", err.Error(), want)
+	}
+}
+
 func TestSetArgvProducesSchemeList(t *testing.T) {
 	env := lang.NewEnv(nil)
 	SetArgv(env, []string{"foo", "bar"})
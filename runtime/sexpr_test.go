@@ -55,6 +55,77 @@ func TestMacroExpansion(t *testing.T) {
 	}
 }
 
+func TestQuasiquoteShorthand(t *testing.T) {
+	ev := NewEvaluator()
+	evalString(t, ev, "(define-macro (swap! a b)"+
+		"  (let ((tmp (gensym)))"+
+		"    `(let ((,tmp ,a)) (set! ,a ,b) (set! ,b ,tmp))))"+
+		"(define x 1) (define y 2) (define xs '(3 4))")
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"`(a ,x ,@xs b)", "(a 1 3 4 b)"},
+		{"`(a . ,xs)", "(a 3 4)"},
+		{"`(1 `(2 ,(3 ,x)))", "(1 (quasiquote (2 (unquote (3 1)))))"},
+		{"(begin (swap! x y) (list x y))", "(2 1)"},
+		{"(begin (swap! x y) (list x y))", "(1 2)"},
+
+		// Each quasiquote raises the level and each unquote lowers it; only
+		// what an unquote brings to level zero is evaluated.
+		{"``,x", "(quasiquote (unquote x))"},
+		{"``,,x", "(quasiquote (unquote 1))"},
+		{"``(a ,@,xs)", "(quasiquote (a (unquote-splicing (3 4))))"},
+		{"``(a ,,@xs)", "(quasiquote (a (unquote 3 4)))"},
+		{"`(1 `(2 `(3 ,(4 ,(5 ,x)))))", "(1 (quasiquote (2 (quasiquote (3 (unquote (4 (unquote (5 1)))))))))"},
+		{"(let ((x 10)) (eval ``(,x ,,x)))", "(1 10)"},
+
+		// Vectors are templates too.
+		{"`#(1 ,x)", "#(1 1)"},
+		{"`#(a ,@xs b)", "#(a 3 4 b)"},
+		{"`(v #(,x (y ,x)))", "(v #(1 (y 1)))"},
+		{"`#(1 `#(2 ,(3 ,x)))", "#(1 (quasiquote #(2 (unquote (3 1)))))"},
+		{"(vectorp `#(,x))", "#t"},
+		{"`#(a b)", "#(a b)"},
+		{"`#()", "#()"},
+	}
+	for _, tc := range cases {
+		if got := evalString(t, ev, tc.src).String(); got != tc.want {
+			t.Fatalf("%s: expected %s, got %s", tc.src, tc.want, got)
+		}
+	}
+}
+
+func TestMacroexpandSteps(t *testing.T) {
+	ev := NewEvaluator()
+	evalString(t, ev, `
+(define-macro (unless c . body) (list 'if c '() (cons 'begin body)))
+(define-macro (twice x) (list 'unless #f x x))
+(define-macro (forever x) (list 'forever x))
+`)
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"(macroexpandSteps '(twice (f)))", "((twice (f)) (unless #f (f) (f)) (if #f () (begin (f) (f))))"},
+		{"(macroexpandSteps '(f (twice x)))", "((f (twice x)))"},
+		{"(macroexpandSteps 42)", "(42)"},
+	}
+	for _, tc := range cases {
+		if got := evalString(t, ev, tc.src).String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	forms, err := sexpr.ReadString("(macroexpandSteps '(forever 1))")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if _, err := ev.EvalAll(forms, nil); err == nil || err.Error() != "macroexpandSteps: macro expansion of forever did not finish after 1000 steps" {
+		t.Fatalf("expected runaway expansion error, got %v", err)
+	}
+}
+
 func TestContinuation(t *testing.T) {
 	ev := NewEvaluator()
 	val := evalString(t, ev, `
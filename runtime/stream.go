@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sergev/gisp/lang"
+	"github.com/sergev/gisp/sexpr"
+)
+
+// linesOf and datumsOf read a file lazily: a goroutine reads ahead into a
+// channel with a small buffer and waits while the buffer is full, so a
+// program filtering a file of any size holds only a few lines in memory.
+// The channel is closed, and the file with it, once the file is exhausted.
+// A program that stops early closes the channel itself, which tells the
+// reader to stop and close it, so closing is safe even after the end. A
+// read error arrives as an error object before the channel is closed.
+
+// defaultStreamBuffer is the number of values read ahead by default.
+const defaultStreamBuffer = 64
+
+func installStreamPrimitives(env *lang.Env) {
+	Register(env, "linesOf", 1, true,
+		"linesOf(path, size) returns a channel delivering the lines of the file path without their line endings, reading at most size lines (64 by default) ahead.", primLinesOf)
+	Register(env, "datumsOf", 1, true,
+		"datumsOf(path, size) returns a channel delivering the s-expressions read from the file path, reading at most size values (64 by default) ahead.", primDatumsOf)
+}
+
+func primLinesOf(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return openStream(ev, "linesOf", args, func(r io.Reader) func() (lang.Value, error) {
+		br := bufio.NewReader(r)
+		return func() (lang.Value, error) {
+			line, err := br.ReadString('\n')
+			if err == io.EOF && line != "" {
+				err = nil
+			}
+			if err != nil {
+				return lang.Value{}, err
+			}
+			line = strings.TrimSuffix(line, "\n")
+			return lang.StringValue(strings.TrimSuffix(line, "\r")), nil
+		}
+	})
+}
+
+func primDatumsOf(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return openStream(ev, "datumsOf", args, func(r io.Reader) func() (lang.Value, error) {
+		return sexpr.NewReader(bufio.NewReader(r)).Read
+	})
+}
+
+// openStream opens the file named by the first of args and returns a
+// channel to which a goroutine sends the values that next, made by open,
+// returns until io.EOF.
+func openStream(ev *lang.Evaluator, name string, args []lang.Value, open func(io.Reader) func() (lang.Value, error)) (lang.Value, error) {
+	if err := requireFilesystem(ev, name); err != nil {
+		return lang.Value{}, err
+	}
+	if len(args) > 2 {
+		return lang.Value{}, arityError(name, 1, 2, len(args))
+	}
+	path, err := requireStringArg(name, args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	size := int64(defaultStreamBuffer)
+	if len(args) == 2 {
+		size, err = requireIntArg(name, args[1])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if size < 0 {
+			return lang.Value{}, fmt.Errorf("%s size must be non-negative, got %d", name, size)
+		}
+		if err := ev.CheckAlloc(size); err != nil {
+			return lang.Value{}, err
+		}
+	}
+	f, err := os.Open(filepath.FromSlash(path))
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("%s: %w", name, err)
+	}
+	ch := lang.NewChannel(int(size))
+	stop := make(chan struct{})
+	ch.Stop = sync.OnceFunc(func() { close(stop) })
+	next := open(f)
+	go func() {
+		defer f.Close()
+		defer close(ch.C)
+		for {
+			val, err := next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				val = lang.ErrorObjectValue(fmt.Errorf("%s: %w", name, err))
+			}
+			select {
+			case ch.C <- val:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return lang.ChannelValue(ch), nil
+}
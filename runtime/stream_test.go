@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func TestStreamPrimitives(t *testing.T) {
+	dir := t.TempDir()
+	lines := filepath.Join(dir, "lines.txt")
+	if err := os.WriteFile(lines, []byte("alpha\r\nbeta\n\ngamma"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	datums := filepath.Join(dir, "datums.txt")
+	if err := os.WriteFile(datums, []byte("(a 1) \"two\" 3\n#! 4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := NewEvaluator()
+	ev.Global.Define("linesPath", lang.StringValue(filepath.ToSlash(lines)))
+	ev.Global.Define("datumsPath", lang.StringValue(filepath.ToSlash(datums)))
+	ev.Global.Define("missingPath", lang.StringValue(filepath.ToSlash(filepath.Join(dir, "missing"))))
+	if _, err := EvaluateGispString(ev, `
+func collect(ch) {
+    var items = `+"`'()"+`
+    var x = receive(ch)
+    while !eofp(x) {
+        items = append(items, list(x))
+        x = receive(ch)
+    }
+    return items
+}
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`collect(linesOf(linesPath))`, `("alpha" "beta" "" "gamma")`},
+		{`collect(linesOf(linesPath, 0))`, `("alpha" "beta" "" "gamma")`},
+		{`channelp(linesOf(linesPath))`, `#t`},
+		{`var ds = collect(datumsOf(datumsPath)); list(length(ds), first(ds), errorp(ref(ds, 3)))`, `(4 (a 1) #t)`},
+		// Closing the channel stops the reader, even once it is done.
+		{`var ch = linesOf(linesPath, 1); var x = receive(ch); closeChannel(ch); closeChannel(ch); x`, `"alpha"`},
+		{`var ch = linesOf(linesPath); collect(ch); closeChannel(ch); receive(ch)`, `#<eof>`},
+	}
+	for _, tt := range tests {
+		val, err := EvaluateGispString(ev, tt.src)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		if got := val.String(); got != tt.want {
+			t.Fatalf("%s => %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	errorsCases := map[string]string{
+		`linesOf(missingPath)`:     "linesOf: open",
+		`linesOf(linesPath, -1)`:   "linesOf size must be non-negative",
+		`datumsOf(1)`:              "datumsOf expects string",
+		`linesOf(linesPath, 1, 2)`: "linesOf",
+	}
+	for src, want := range errorsCases {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+
+	ev.Sandbox = true
+	if _, err := EvaluateGispString(ev, `linesOf(linesPath)`); err == nil || !strings.Contains(err.Error(), "linesOf is disabled") {
+		t.Fatalf("expected linesOf to be denied, got %v", err)
+	}
+}
+
+// BenchmarkLinesOf counts the errors in a log of a hundred thousand lines
+// read through linesOf, which holds no more than its buffer of lines at a
+// time however large the file is.
+func BenchmarkLinesOf(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "log.txt")
+	var sb strings.Builder
+	for i := 0; i < 100000; i++ {
+		level := "INFO"
+		if i%10 == 0 {
+			level = "ERROR"
+		}
+		fmt.Fprintf(&sb, "2024-01-01T00:00:00Z %s request %d handled\n", level, i)
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	ev := NewEvaluator()
+	ev.Global.Define("logPath", lang.StringValue(filepath.ToSlash(path)))
+	src := `
+var errors = 0
+var re = regexCompile(" ERROR ")
+var lines = linesOf(logPath)
+var line = receive(lines)
+while !eofp(line) {
+    if regexMatch(re, line) {
+        errors++
+    }
+    line = receive(lines)
+}
+errors
+`
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		val, err := EvaluateGispString(ev, src)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if got := val.String(); got != "10000" {
+			b.Fatalf("counted %s errors, want 10000", got)
+		}
+	}
+}
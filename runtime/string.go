@@ -0,0 +1,337 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// The primitives here work on UTF-8 text: separators and substrings are
+// matched as whole characters, and case mapping follows Unicode. Positions
+// count characters, like stringLength, stringSlice and index syntax, so the
+// result of stringIndex can be passed to stringSlice directly. A byte that
+// is not valid UTF-8 counts as one character.
+
+func installStringPrimitives(env *lang.Env) {
+	Register(env, "str", 0, true,
+		"str(x, ...) concatenates its arguments in the form display prints them.", primStr)
+	Register(env, "format", 1, true,
+		"format(format, x, ...) returns format with Go-style verbs such as %v, %d and %.2f replaced by the arguments.", primFormat)
+	Register(env, "stringSplit", 2, false,
+		"stringSplit(s, sep) splits s around each occurrence of sep; an empty sep splits s into characters.", primStringSplit)
+	Register(env, "stringJoin", 2, false,
+		"stringJoin(list, sep) concatenates a list of strings with sep between them.", primStringJoin)
+	Register(env, "stringTrim", 1, true,
+		"stringTrim(s, cutset) removes leading and trailing whitespace from s, or the characters in cutset when given.", primStringTrim)
+	Register(env, "stringIndex", 2, false,
+		"stringIndex(s, sub) returns the character position of the first occurrence of sub in s, or -1 if there is none.", primStringIndex)
+	Register(env, "stringReplace", 3, true,
+		"stringReplace(s, old, new, n) replaces the first n occurrences of old in s with new, or all of them when n is omitted or negative.", primStringReplace)
+	Register(env, "stringUpper", 1, false,
+		"stringUpper(s) returns s with all letters mapped to upper case.", primStringUpper)
+	Register(env, "stringLower", 1, false,
+		"stringLower(s) returns s with all letters mapped to lower case.", primStringLower)
+	Register(env, "stringContains", 2, false,
+		"stringContains(s, sub) reports whether sub occurs in s.", primStringContains)
+	Register(env, "stringStartsWith", 2, false,
+		"stringStartsWith(s, prefix) reports whether s begins with prefix.", primStringStartsWith)
+	Register(env, "stringEndsWith", 2, false,
+		"stringEndsWith(s, suffix) reports whether s ends with suffix.", primStringEndsWith)
+
+	Register(env, "charp", 1, false, "charp(x) reports whether x is a character.", primIsChar)
+	Register(env, "charToInteger", 1, false,
+		"charToInteger(c) returns the Unicode code point of the character c.", primCharToInteger)
+	Register(env, "integerToChar", 1, false,
+		"integerToChar(n) returns the character with Unicode code point n.", primIntegerToChar)
+	Register(env, "charToString", 1, false,
+		"charToString(c) returns the one-character string holding c.", primCharToString)
+	Register(env, "utf8Ref", 2, false,
+		"utf8Ref(s, i) returns the character at index i of s, counting characters rather than bytes.", primUTF8Ref)
+	Register(env, "utf8Slice", 2, true,
+		"utf8Slice(s, start, end) returns the characters of s from start up to end, counting characters rather than bytes.", primUTF8Slice)
+	Register(env, "stringToVector", 1, false,
+		"stringToVector(s) returns a vector of the characters of s.", primStringToVector)
+	Register(env, "vectorToString", 1, false,
+		"vectorToString(v) concatenates a vector of characters and strings into a string.", primVectorToString)
+}
+
+// stringArgs checks that every argument of name is a string.
+func stringArgs(name string, args []lang.Value) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, err := requireStringArg(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
+
+func primStr(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(displayString(arg))
+	}
+	return lang.StringValue(b.String()), nil
+}
+
+func primFormat(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	format, err := requireStringArg("format", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	text, err := formatValues("format", format, args[1:])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(text), nil
+}
+
+func primStringSplit(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	strs, err := stringArgs("stringSplit", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return stringList(strings.Split(strs[0], strs[1])), nil
+}
+
+func primStringJoin(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	items, err := lang.ToSlice(args[0])
+	if err != nil {
+		return lang.Value{}, typeError("stringJoin", "list", args[0])
+	}
+	sep, err := requireStringArg("stringJoin", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	parts, err := stringArgs("stringJoin", items)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(strings.Join(parts, sep)), nil
+}
+
+func primStringTrim(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 2 {
+		return lang.Value{}, arityError("stringTrim", 1, 2, len(args))
+	}
+	strs, err := stringArgs("stringTrim", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if len(strs) == 1 {
+		return lang.StringValue(strings.TrimSpace(strs[0])), nil
+	}
+	return lang.StringValue(strings.Trim(strs[0], strs[1])), nil
+}
+
+func primStringIndex(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	strs, err := stringArgs("stringIndex", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	idx := strings.Index(strs[0], strs[1])
+	if idx < 0 {
+		return lang.IntValue(-1), nil
+	}
+	return lang.IntValue(int64(utf8.RuneCountInString(strs[0][:idx]))), nil
+}
+
+func primStringReplace(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 4 {
+		return lang.Value{}, arityError("stringReplace", 3, 4, len(args))
+	}
+	strs, err := stringArgs("stringReplace", args[:3])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	n := int64(-1)
+	if len(args) == 4 {
+		if n, err = requireIntArg("stringReplace", args[3]); err != nil {
+			return lang.Value{}, err
+		}
+	}
+	return lang.StringValue(strings.Replace(strs[0], strs[1], strs[2], int(n))), nil
+}
+
+func primStringUpper(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("stringUpper", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(strings.ToUpper(str)), nil
+}
+
+func primStringLower(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("stringLower", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.StringValue(strings.ToLower(str)), nil
+}
+
+func primStringContains(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	strs, err := stringArgs("stringContains", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(strings.Contains(strs[0], strs[1])), nil
+}
+
+func primStringStartsWith(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	strs, err := stringArgs("stringStartsWith", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(strings.HasPrefix(strs[0], strs[1])), nil
+}
+
+func primStringEndsWith(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	strs, err := stringArgs("stringEndsWith", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(strings.HasSuffix(strs[0], strs[1])), nil
+}
+
+func primIsChar(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeChar), nil
+}
+
+func primCharToInteger(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if args[0].Type != lang.TypeChar {
+		return lang.Value{}, typeError("charToInteger", "char", args[0])
+	}
+	return lang.IntValue(int64(args[0].Char())), nil
+}
+
+func primIntegerToChar(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	n, err := requireIntArg("integerToChar", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if n < 0 || n > utf8.MaxRune || !utf8.ValidRune(rune(n)) {
+		return lang.Value{}, fmt.Errorf("integerToChar: invalid code point %d", n)
+	}
+	return lang.CharValue(rune(n)), nil
+}
+
+func primCharToString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if args[0].Type != lang.TypeChar {
+		return lang.Value{}, typeError("charToString", "char", args[0])
+	}
+	return lang.StringValue(string(args[0].Char())), nil
+}
+
+func primUTF8Ref(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("utf8Ref", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	idx, err := requireIntArg("utf8Ref", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return charAt("utf8Ref", str, idx)
+}
+
+// charAt returns the character at index idx of str, counting characters
+// rather than bytes, for the primitive name.
+func charAt(name, str string, idx int64) (lang.Value, error) {
+	if idx >= 0 {
+		i := idx
+		for _, r := range str {
+			if i == 0 {
+				return lang.CharValue(r), nil
+			}
+			i--
+		}
+	}
+	return lang.Value{}, fmt.Errorf("%s index %d out of range for length %d", name, idx, utf8.RuneCountInString(str))
+}
+
+// primUTF8Slice does what stringSlice does; both count characters.
+func primUTF8Slice(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 3 {
+		return lang.Value{}, arityError("utf8Slice", 2, 3, len(args))
+	}
+	str, err := requireStringArg("utf8Slice", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	start, err := requireIntArg("utf8Slice", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	length := int64(utf8.RuneCountInString(str))
+	end := length
+	if len(args) == 3 {
+		if end, err = requireIntArg("utf8Slice", args[2]); err != nil {
+			return lang.Value{}, err
+		}
+	}
+	if start < 0 || start > length {
+		return lang.Value{}, fmt.Errorf("utf8Slice start index %d out of range 0..%d", start, length)
+	}
+	if end < 0 || end > length {
+		return lang.Value{}, fmt.Errorf("utf8Slice end index %d out of range 0..%d", end, length)
+	}
+	if end < start {
+		return lang.Value{}, fmt.Errorf("utf8Slice end index %d precedes start %d", end, start)
+	}
+	return lang.StringValue(charSlice(str, start, end)), nil
+}
+
+// charSlice returns the characters of str from start up to end, which the
+// caller has checked against its length in characters.
+func charSlice(str string, start, end int64) string {
+	from, to := len(str), len(str)
+	count := int64(0)
+	for i := range str {
+		if count == start {
+			from = i
+		}
+		if count == end {
+			to = i
+			break
+		}
+		count++
+	}
+	return str[from:to]
+}
+
+func primStringToVector(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("stringToVector", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	chars := make([]lang.Value, 0, utf8.RuneCountInString(str))
+	for _, r := range str {
+		chars = append(chars, lang.CharValue(r))
+	}
+	return lang.VectorValue(chars), nil
+}
+
+// primVectorToString accepts strings as well as characters, so a vector
+// built from one-character strings converts back just as well.
+func primVectorToString(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	vec, err := requireVectorArg("vectorToString", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	var b strings.Builder
+	for _, elem := range vec.Elements {
+		switch elem.Type {
+		case lang.TypeChar:
+			b.WriteRune(elem.Char())
+		case lang.TypeString:
+			b.WriteString(elem.Str())
+		default:
+			return lang.Value{}, typeError("vectorToString", "char or string", elem)
+		}
+	}
+	return lang.StringValue(b.String()), nil
+}
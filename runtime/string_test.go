@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
@@ -173,3 +174,261 @@ func TestPrimStringSliceErrors(t *testing.T) {
 		t.Fatalf("expected error for end out of range")
 	}
 }
+
+func TestStringFieldsAndLines(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`stringFields("  alpha beta\tgamma\n ")`, `("alpha" "beta" "gamma")`},
+		{`stringFields("   ")`, "()"},
+		{`stringLines("one\ntwo\nthree")`, `("one" "two" "three")`},
+		{`stringLines("one\n\ntwo\n")`, `("one" "" "two")`},
+		{`stringLines("")`, "()"},
+		{`stringLines("\n")`, `("")`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	val, err := primStringLines(ev, []lang.Value{lang.StringValue("dos\r\nlines\r\n")})
+	if err != nil || val.String() != `("dos" "lines")` {
+		t.Fatalf("expected CRLF terminators to be dropped, got %v (%v)", val, err)
+	}
+	if _, err := EvaluateGispString(ev, "stringLines(1)"); err == nil || !strings.Contains(err.Error(), "stringLines expects string") {
+		t.Fatalf("expected stringLines type error, got %v", err)
+	}
+}
+
+func TestCodePointPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`codePointToString(65)`, `"A"`},
+		{`codePointToString(9786)`, `"☺"`},
+		{`stringToCodePoints("Añ☺")`, "(65 241 9786)"},
+		{`stringToCodePoints("")`, "()"},
+		{`stringToCodePoints(stringAppend("a", codePointToString(128512)))`, "(97 128512)"},
+		{`utf8Length("héllo")`, "5"},
+		{`stringLength("héllo")`, "5"},
+		{`[utf8Length(""), utf8Length("日本語")]`, "(0 3)"},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+
+	// A Caesar shift written with the code point helpers.
+	src := `
+func shift(s, k) {
+    var out = ""
+    var points = stringToCodePoints(s)
+    while !nullp(points) {
+        var c = first(points)
+        if c >= 97 && c <= 122 {
+            c = (c - 97 + k) % 26 + 97
+        }
+        out = stringAppend(out, codePointToString(c))
+        points = rest(points)
+    }
+    return out
+}
+shift("hello, world", 3)
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil || val.Str() != "khoor, zruog" {
+		t.Fatalf("caesar shift => %v, %v", val, err)
+	}
+
+	for _, src := range []string{"codePointToString(-1)", "codePointToString(55296)", "codePointToString(1114112)"} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), "invalid code point") {
+			t.Fatalf("%s: expected invalid code point error, got %v", src, err)
+		}
+	}
+	if _, err := EvaluateGispString(ev, `codePointToString("A")`); err == nil {
+		t.Fatal("expected type error for string argument")
+	}
+}
+
+func TestStringLibrary(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`stringSplit("a,b,,c", ",")`, `("a" "b" "" "c")`},
+		{`stringSplit("héllo", "")`, `("h" "é" "l" "l" "o")`},
+		{`stringSplit("", ",")`, `("")`},
+		{`stringJoin(["x", "y", "z"], ", ")`, `"x, y, z"`},
+		{`stringJoin([], "-")`, `""`},
+		{`stringTrim(" \t hi there\n")`, `"hi there"`},
+		{`stringTrim("--hi-", "-")`, `"hi"`},
+		{`stringIndex("naïve café", "café")`, "6"},
+		{`stringSlice("naïve café", stringIndex("naïve café", "café"))`, `"café"`},
+		{`stringIndex("abc", "x")`, "-1"},
+		{`stringReplace("a-b-c", "-", "+")`, `"a+b+c"`},
+		{`stringReplace("a-b-c", "-", "", 1)`, `"ab-c"`},
+		{`stringUpper("gräfin ü")`, `"GRÄFIN Ü"`},
+		{`stringLower("ÀÉ Go")`, `"àé go"`},
+		{`[stringContains("seafood", "foo"), stringContains("seafood", "bar")]`, "(#t #f)"},
+		{`[stringStartsWith("golang", "go"), stringEndsWith("golang", "ng"), stringEndsWith("golang", "go")]`, "(#t #t #f)"},
+		{`str("n = ", 3, ", ", 2.5, 'c', " ", [1, "a"], true, nil)`, `"n = 3, 2.5c (1 \"a\")#t()"`},
+		{`str()`, `""`},
+		{`format("%-6s|%5.2f|%03d|%v", "ab", 3.14159, 7, [1, 2])`, `"ab    | 3.14|007|(1 2)"`},
+		{`format("%d %x %e", 1 << 70, 1 << 64, 1 << 64)`, `"1180591620717411303424 10000000000000000 1.844674e+19"`},
+		{`format("%q %s %U %t %%", "a\"b", integerToChar(233), 233, false)`, `"\"a\\\"b\" é U+00E9 false %"`},
+		{`format("no verbs")`, `"no verbs"`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	for src, want := range map[string]string{
+		`stringSplit("a", 1)`:               "stringSplit expects string",
+		`stringJoin(["a", 1], ",")`:         "stringJoin expects string",
+		`stringJoin("a", ",")`:              "stringJoin expects list",
+		`stringTrim("a", "b", "c")`:         "stringTrim",
+		`stringReplace("a", "a", "b", 1.5)`: "stringReplace expects integer",
+		`stringUpper(1)`:                    "stringUpper expects string",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestCharacters(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`'a'`, `#\a`},
+		{`[' ', '\n', '\'']`, `(#\space #\newline #\')`},
+		{`[charp('a'), charp("a"), charp(97)]`, "(#t #f #f)"},
+		{`charToInteger('λ')`, "955"},
+		{`integerToChar(97)`, `#\a`},
+		{`charToString('λ')`, `"λ"`},
+		{`['a' == 'a', 'a' == 'b', 'a' == "a", equal('a', 'a')]`, "(#t #f #f #t)"},
+		{`utf8Ref("aλb", 1)`, `#\λ`},
+		{`utf8Slice("héllo", 1, 3)`, `"él"`},
+		{`utf8Slice("héllo", 3)`, `"lo"`},
+		{`utf8Slice("héllo", 5)`, `""`},
+		{`stringSlice("héllo", 1, 3)`, `"él"`},
+		{`var s = "héllo, 世界"
+var i = 0
+var ok = true
+while i < stringLength(s) {
+	ok = ok && s[i] == utf8Ref(s, i) && charToString(s[i]) == stringSlice(s, i, i + 1)
+	i++
+}
+[ok, i]`, "(#t 9)"},
+		{`stringLength(hexDecode("ff"))`, "1"},
+		{`mapGet(makeMap('x', 1), 'x')`, "1"},
+		{"`'(#\\a #\\x41)", `(#\a #\A)`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	for src, want := range map[string]string{
+		`charToInteger("a")`:       "charToInteger expects char",
+		`charToString(97)`:         "charToString expects char",
+		`integerToChar(-1)`:        "invalid code point -1",
+		`integerToChar(55296)`:     "invalid code point 55296",
+		`integerToChar(1114112)`:   "invalid code point 1114112",
+		`utf8Ref("aλb", 3)`:        "utf8Ref index 3 out of range for length 3",
+		`utf8Ref("aλb", -1)`:       "utf8Ref index -1 out of range",
+		`utf8Slice("héllo", 6)`:    "utf8Slice start index 6 out of range 0..5",
+		`utf8Slice("héllo", 3, 2)`: "utf8Slice end index 2 precedes start 3",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+
+	var out bytes.Buffer
+	ev.SetOutput(&out)
+	if _, err := EvaluateGispString(ev, `display('λ'); display(['λ'])`); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != `λ(#\λ)` {
+		t.Fatalf("display printed %q", got)
+	}
+}
+
+func TestStringVectorConversion(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`stringToVector("aλ ")`, `#(#\a #\λ #\space)`},
+		{`stringToVector("")`, "#()"},
+		{`vectorToString(stringToVector("héllo"))`, `"héllo"`},
+		{`vectorToString(#['a', "bc", 'λ'])`, `"abcλ"`},
+		{`vectorToString(#[])`, `""`},
+		{`var v = stringToVector("abc"); v[0] = 'x'; vectorToString(v)`, `"xbc"`},
+	}
+	for _, tc := range cases {
+		val, err := EvaluateGispString(ev, tc.src)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tc.src, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+		}
+	}
+	for src, want := range map[string]string{
+		`stringToVector(1)`:         "stringToVector expects string",
+		`vectorToString("abc")`:     "vectorToString expects vector",
+		`vectorToString(#['a', 1])`: "vectorToString expects char or string",
+	} {
+		if _, err := EvaluateGispString(ev, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestPrintf(t *testing.T) {
+	ev := NewEvaluator()
+	var out bytes.Buffer
+	ev.SetOutput(&out)
+	if _, err := EvaluateGispString(ev, `printf("%s=%.1f\n", "pi", 3.14159)
+printf("%d items", 3)`); err != nil {
+		t.Fatalf("printf failed: %v", err)
+	}
+	if got, want := out.String(), "pi=3.1\n3 items"; got != want {
+		t.Fatalf("printed %q, want %q", got, want)
+	}
+	out.Reset()
+	if _, err := EvaluateGispString(ev, `printf("%d %d", 1)`); err == nil || !strings.Contains(err.Error(), "printf: missing argument for %d") {
+		t.Fatalf("expected missing argument error, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("printf printed %q despite failing", out.String())
+	}
+}
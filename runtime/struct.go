@@ -0,0 +1,162 @@
+package runtime
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Gisp's struct declaration compiles to defineStruct, and the field syntax
+// obj.field to getField and setField. Modules are records too: import binds
+// the module name to a record holding the module's definitions. Both also
+// accept objects, which are maps; see object.go.
+
+func installStructPrimitives(env *lang.Env) {
+	Register(env, "defineStruct", 2, false,
+		"defineStruct(name, fields) defines the constructor makeName and the predicate namep for a struct type.", primDefineStruct)
+	Register(env, "getField", 2, false, "getField(obj, field) returns the named field of a struct, module or object.", primGetField)
+	Register(env, "setField", 3, false, "setField(obj, field, value) stores value in the named field of a struct or object and returns value.", primSetField)
+	Register(env, "recordp", 1, false, "recordp(x) reports whether x is a struct or module.", primIsRecord)
+}
+
+// constructorName returns the name of the constructor of struct name:
+// makePoint for point.
+func constructorName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return "make" + string(unicode.ToUpper(r)) + name[size:]
+}
+
+func primDefineStruct(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if args[0].Type != lang.TypeSymbol {
+		return lang.Value{}, typeError("defineStruct", "symbol", args[0])
+	}
+	name := args[0].Sym()
+	fieldValues, err := lang.ToSlice(args[1])
+	if err != nil {
+		return lang.Value{}, typeError("defineStruct", "list of symbols", args[1])
+	}
+	fields := make([]string, len(fieldValues))
+	for i, field := range fieldValues {
+		if field.Type != lang.TypeSymbol {
+			return lang.Value{}, typeError("defineStruct", "symbol", field)
+		}
+		fields[i] = field.Sym()
+	}
+	rt, err := lang.NewRecordType(name, fields)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	makeName := constructorName(name)
+	env := ev.CurrentEnv()
+	env.Define(makeName, lang.PrimitiveValue(func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		if len(args) != len(fields) {
+			return lang.Value{}, arityError(makeName, len(fields), len(fields), len(args))
+		}
+		return lang.RecordValue(&lang.Record{Type: rt, Values: append([]lang.Value(nil), args...)}), nil
+	}))
+	env.Define(name+"p", lang.PrimitiveValue(func(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+		if len(args) != 1 {
+			return lang.Value{}, arityError(name+"p", 1, 1, len(args))
+		}
+		r := args[0].Record()
+		return lang.BoolValue(args[0].Type == lang.TypeRecord && r != nil && r.Type == rt), nil
+	}))
+	return args[0], nil
+}
+
+// fieldArgs checks the record and field name arguments of getField and
+// setField.
+func fieldArgs(name string, args []lang.Value) (*lang.Record, string, error) {
+	r := args[0].Record()
+	if args[0].Type != lang.TypeRecord || r == nil {
+		return nil, "", typeError(name, "struct, module or object", args[0])
+	}
+	if args[1].Type != lang.TypeSymbol {
+		return nil, "", typeError(name, "symbol", args[1])
+	}
+	return r, args[1].Sym(), nil
+}
+
+func primGetField(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if args[0].Type == lang.TypeMap {
+		name, err := requireSlotName("getField", args[1])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		val, ok, err := lookupSlot(args[0].Map(), name)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if !ok {
+			return lang.Value{}, fmt.Errorf("object has no field %s", name)
+		}
+		return val, nil
+	}
+	r, field, err := fieldArgs("getField", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	val, ok := r.Get(field)
+	if !ok {
+		return lang.Value{}, fmt.Errorf("%s has no field %s", r.Type.Name, field)
+	}
+	return val, nil
+}
+
+func primSetField(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if args[0].Type == lang.TypeMap {
+		if _, err := requireSlotName("setField", args[1]); err != nil {
+			return lang.Value{}, err
+		}
+		args[0].Map().Set(args[1], args[2])
+		return args[2], nil
+	}
+	r, field, err := fieldArgs("setField", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if !r.Set(field, args[2]) {
+		return lang.Value{}, fmt.Errorf("%s has no field %s", r.Type.Name, field)
+	}
+	return args[2], nil
+}
+
+func primIsRecord(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.BoolValue(args[0].Type == lang.TypeRecord), nil
+}
+
+func equalRecords(a, b *lang.Record) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	for i := range a.Values {
+		if !equalValues(a.Values[i], b.Values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// moduleRecord returns a record whose fields are the definitions in a
+// module's environment.
+func moduleRecord(name string, module *lang.Env) (lang.Value, error) {
+	fields := module.Names()
+	values := make([]lang.Value, len(fields))
+	for i, field := range fields {
+		val, err := module.Get(field)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		values[i] = val
+	}
+	rt, err := lang.NewRecordType("module "+name, fields)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.RecordValue(&lang.Record{Type: rt, Values: values}), nil
+}
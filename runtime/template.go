@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func primRenderTemplate(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return lang.Value{}, arityError("renderTemplate", 1, 2, len(args))
+	}
+	text, err := requireStringArg("renderTemplate", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	var data interface{}
+	if len(args) == 2 {
+		data, err = templateData(args[1])
+		if err != nil {
+			return lang.Value{}, fmt.Errorf("renderTemplate: %w", err)
+		}
+	}
+	tmpl, err := template.New("renderTemplate").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("renderTemplate: %w", err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return lang.Value{}, fmt.Errorf("renderTemplate: %w", err)
+	}
+	return lang.StringValue(out.String()), nil
+}
+
+// templateData converts a runtime value into plain Go data for text/template.
+// Maps with string or symbol keys and association lists (lists of pairs
+// keyed by symbols) become Go maps, other lists and vectors become slices,
+// and characters become one-character strings.
+func templateData(v lang.Value) (interface{}, error) {
+	switch v.Type {
+	case lang.TypeEmpty:
+		return nil, nil
+	case lang.TypeBool:
+		return v.Bool(), nil
+	case lang.TypeInt:
+		return v.Int(), nil
+	case lang.TypeBigInt:
+		return v.BigInt(), nil
+	case lang.TypeReal:
+		return v.Real(), nil
+	case lang.TypeString:
+		return v.Str(), nil
+	case lang.TypeSymbol:
+		return v.Sym(), nil
+	case lang.TypeChar:
+		return string(v.Char()), nil
+	case lang.TypeMap:
+		m := make(map[string]interface{}, v.Map().Len())
+		for _, key := range v.Map().Keys() {
+			var name string
+			switch key.Type {
+			case lang.TypeString:
+				name = key.Str()
+			case lang.TypeSymbol:
+				name = key.Sym()
+			default:
+				return nil, fmt.Errorf("cannot use %s as a template key", typeName(key))
+			}
+			item, _ := v.Map().Get(key)
+			val, err := templateData(item)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = val
+		}
+		return m, nil
+	case lang.TypePair:
+		items, err := lang.ToSlice(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert improper list %s", v.String())
+		}
+		if isAssocList(items) {
+			m := make(map[string]interface{}, len(items))
+			for _, item := range items {
+				entry := item.Pair()
+				val, err := templateData(entry.Rest)
+				if err != nil {
+					return nil, err
+				}
+				m[entry.First.Sym()] = val
+			}
+			return m, nil
+		}
+		return templateSlice(items)
+	case lang.TypeVector:
+		return templateSlice(v.Vector().Elements)
+	default:
+		return nil, fmt.Errorf("cannot convert %s", typeName(v))
+	}
+}
+
+func templateSlice(items []lang.Value) ([]interface{}, error) {
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		val, err := templateData(item)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = val
+	}
+	return out, nil
+}
+
+func isAssocList(items []lang.Value) bool {
+	for _, item := range items {
+		if item.Type != lang.TypePair {
+			return false
+		}
+		if item.Pair().First.Type != lang.TypeSymbol {
+			return false
+		}
+	}
+	return len(items) > 0
+}
@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	ev := NewEvaluator()
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "no data",
+			src:  `renderTemplate("plain text")`,
+			want: "plain text",
+		},
+		{
+			name: "association list",
+			src:  "renderTemplate(\"{{.name}} is {{.age}}\", `'((name . \"Ann\") (age . 42)))",
+			want: "Ann is 42",
+		},
+		{
+			name: "range over list",
+			src:  `renderTemplate("{{range .}}[{{.}}]{{end}}", [1, 2.5, "x"])`,
+			want: "[1][2.5][x]",
+		},
+		{
+			name: "nested values",
+			src:  "renderTemplate(\"{{.title}}:{{range .rows}} {{index . 0}}{{end}}\", `'((title . \"T\") (rows . (#(\"a\") #(\"b\")))))",
+			want: "T: a b",
+		},
+		{
+			name: "map",
+			src:  `renderTemplate("{{.name}} has {{range .tags}}{{.}}{{end}}", makeMap("name", "x", "tags", #[integerToChar(97), integerToChar(98)]))`,
+			want: "x has ab",
+		},
+		{
+			name: "symbol keys",
+			src:  "renderTemplate(\"{{.id}}\", makeMap(`'id, 7))",
+			want: "7",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			val, err := EvaluateGispString(ev, tc.src)
+			if err != nil {
+				t.Fatalf("renderTemplate failed: %v", err)
+			}
+			if val.Str() != tc.want {
+				t.Fatalf("got %q, want %q", val.Str(), tc.want)
+			}
+		})
+	}
+
+	errCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{`renderTemplate("{{.missing}}", ` + "`'((name . 1))" + `)`, "missing"},
+		{`renderTemplate("{{", nil)`, "renderTemplate"},
+		{`renderTemplate("{{.}}", func() { 1 })`, "cannot convert closure"},
+		{`renderTemplate(1)`, "renderTemplate expects string"},
+		{`renderTemplate("{{.}}", makeMap(1, 2))`, "cannot use integer as a template key"},
+	}
+	for _, tc := range errCases {
+		if _, err := EvaluateGispString(ev, tc.src); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.src, tc.wantErr, err)
+		}
+	}
+}
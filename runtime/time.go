@@ -0,0 +1,169 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Timestamps are integer Unix seconds and durations are seconds, integer or
+// real; there is no separate duration type. Integer arithmetic on them is
+// exact, becoming big integers as the arithmetic operators do. Calendar
+// helpers interpret timestamps in UTC.
+
+// calendarYears bounds the years, and the timestamps, that the calendar
+// helpers accept, keeping time.Date and AddDate well inside their range.
+const calendarYears = 1_000_000_000
+
+func installTimePrimitives(env *lang.Env) {
+
+	Register(env, "currentTime", 0, false,
+		"currentTime() returns the current time as Unix seconds.", primCurrentTime)
+	Register(env, "addDuration", 2, true,
+		"addDuration(ts, amount [, unit]) adds amount to ts; unit is seconds (default), minutes, hours, days, months or years.", primAddDuration)
+	Register(env, "durationBetween", 2, false,
+		"durationBetween(start, end) returns end - start in seconds.", primDurationBetween)
+	Register(env, "parseDuration", 1, false,
+		"parseDuration(text) parses a Go duration string such as \"1h30m\" into seconds.", primParseDuration)
+	Register(env, "formatDuration", 1, false,
+		"formatDuration(seconds) renders a duration as a Go duration string.", primFormatDuration)
+	Register(env, "dayOfWeek", 1, false,
+		"dayOfWeek(ts) returns the UTC weekday of ts, 0 for Sunday.", primDayOfWeek)
+	Register(env, "daysInMonth", 2, false,
+		"daysInMonth(year, month) returns the number of days in the month.", primDaysInMonth)
+}
+
+func primCurrentTime(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.IntValue(time.Now().Unix()), nil
+}
+
+func primAddDuration(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 3 {
+		return lang.Value{}, arityError("addDuration", 2, 3, len(args))
+	}
+	unit := "seconds"
+	if len(args) == 3 {
+		u, err := requireStringArg("addDuration", args[2])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		unit = u
+	}
+	switch unit {
+	case "days", "months", "years":
+		ts, err := requireIntArg("addDuration", args[0])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		amount, err := requireIntArg("addDuration", args[1])
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if ts < -calendarYears*366*86400 || ts > calendarYears*366*86400 {
+			return lang.Value{}, fmt.Errorf("addDuration timestamp out of range: %d", ts)
+		}
+		limit := int64(calendarYears)
+		switch unit {
+		case "days":
+			limit *= 366
+		case "months":
+			limit *= 12
+		}
+		if amount < -limit || amount > limit {
+			return lang.Value{}, fmt.Errorf("addDuration %d %s out of range", amount, unit)
+		}
+		t := time.Unix(ts, 0).UTC()
+		switch unit {
+		case "days":
+			t = t.AddDate(0, 0, int(amount))
+		case "months":
+			t = t.AddDate(0, int(amount), 0)
+		default:
+			t = t.AddDate(int(amount), 0, 0)
+		}
+		return lang.IntValue(t.Unix()), nil
+	}
+	scale, ok := durationUnits[unit]
+	if !ok {
+		return lang.Value{}, fmt.Errorf("addDuration unknown unit %q", unit)
+	}
+	for _, arg := range args[:2] {
+		if !isNumber(arg) {
+			return lang.Value{}, typeError("addDuration", "number", arg)
+		}
+	}
+	return addNumbers(args[0], mulNumbers(args[1], lang.IntValue(scale))), nil
+}
+
+// durationUnits maps fixed-length units to their size in seconds.
+var durationUnits = map[string]int64{
+	"seconds": 1,
+	"minutes": 60,
+	"hours":   3600,
+}
+
+func primDurationBetween(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return lang.Value{}, typeError("durationBetween", "number", arg)
+		}
+	}
+	return subNumbers(args[1], args[0]), nil
+}
+
+func primParseDuration(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	str, err := requireStringArg("parseDuration", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(str))
+	if err != nil {
+		return lang.Value{}, fmt.Errorf("parseDuration: %w", err)
+	}
+	if d%time.Second == 0 {
+		return lang.IntValue(int64(d / time.Second)), nil
+	}
+	return lang.RealValue(d.Seconds()), nil
+}
+
+func primFormatDuration(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	secs, err := toFloat(args[0])
+	if err != nil {
+		return lang.Value{}, typeError("formatDuration", "number", args[0])
+	}
+	if math.Abs(secs) > float64(math.MaxInt64)/float64(time.Second) {
+		return lang.Value{}, fmt.Errorf("formatDuration duration out of range: %v", secs)
+	}
+	return lang.StringValue(time.Duration(secs * float64(time.Second)).String()), nil
+}
+
+func primDayOfWeek(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	ts, err := requireIntArg("dayOfWeek", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.IntValue(int64(time.Unix(ts, 0).UTC().Weekday())), nil
+}
+
+func primDaysInMonth(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	year, err := requireIntArg("daysInMonth", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	month, err := requireIntArg("daysInMonth", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if year < -calendarYears || year > calendarYears {
+		return lang.Value{}, fmt.Errorf("daysInMonth year out of range: %d", year)
+	}
+	if month < 1 || month > 12 {
+		return lang.Value{}, fmt.Errorf("daysInMonth month must be between 1 and 12, got %d", month)
+	}
+	// Day zero of the following month is the last day of this one.
+	last := time.Date(int(year), time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC)
+	return lang.IntValue(int64(last.Day())), nil
+}
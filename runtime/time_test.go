@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func TestDateAndDurationPrimitives(t *testing.T) {
+	ev := NewEvaluator()
+	// 2024-01-31T00:00:00Z, a Wednesday.
+	const jan31 = 1706659200
+
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"add seconds", "addDuration(100, 20)", "120"},
+		{"add hours", `addDuration(0, 2, "hours")`, "7200"},
+		{"add fractional", "addDuration(1, 0.5)", "1.5"},
+		{"add days", `addDuration(1706659200, 1, "days")`, "1706745600"},
+		{"add months normalises", `addDuration(1706659200, 1, "months")`, "1709337600"},
+		{"between", "durationBetween(1706659200, 1706745600)", "86400"},
+		{"add overflows into big integer", `addDuration(0, 9223372036854775807, "hours")`, "33204139332677192905200"},
+		{"between overflows into big integer", "durationBetween(-9223372036854775807, 9223372036854775807)", "18446744073709551614"},
+		{"between reals", "durationBetween(1, 2.5)", "1.5"},
+		{"parse whole", `parseDuration("1h30m")`, "5400"},
+		{"parse fraction", `parseDuration("1500ms")`, "1.5"},
+		{"format", "formatDuration(5400)", `"1h30m0s"`},
+		{"format fraction", "formatDuration(0.25)", `"250ms"`},
+		{"weekday", "dayOfWeek(1706659200)", "3"},
+		{"leap february", "daysInMonth(2024, 2)", "29"},
+		{"plain february", "daysInMonth(2023, 2)", "28"},
+		{"december", "daysInMonth(2023, 12)", "31"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			val, err := EvaluateGispString(ev, tc.src)
+			if err != nil {
+				t.Fatalf("%s failed: %v", tc.src, err)
+			}
+			if got := val.String(); got != tc.want {
+				t.Fatalf("%s => %s, want %s", tc.src, got, tc.want)
+			}
+		})
+	}
+
+	now, err := primCurrentTime(ev, nil)
+	if err != nil || now.Type != lang.TypeInt || now.Int() <= jan31 {
+		t.Fatalf("currentTime returned %v (%v)", now, err)
+	}
+
+	errorsCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{`addDuration(0, 1, "weeks")`, "unknown unit"},
+		{`addDuration(0, 1.5, "days")`, "addDuration expects integer"},
+		{`parseDuration("soon")`, "parseDuration"},
+		{"daysInMonth(2024, 13)", "between 1 and 12"},
+		{"daysInMonth(1 << 40, 2)", "daysInMonth year out of range"},
+		{`addDuration(0, 1 << 40, "years")`, "out of range"},
+		{`addDuration(9223372036854775807, 1, "days")`, "addDuration timestamp out of range"},
+		{`addDuration(0, "soon")`, "addDuration expects number"},
+		{`durationBetween(0, "soon")`, "durationBetween expects number"},
+		{`dayOfWeek("monday")`, "dayOfWeek expects integer"},
+	}
+	for _, tc := range errorsCases {
+		if _, err := EvaluateGispString(ev, tc.src); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.src, tc.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func primTrace(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	name, proc, err := tracedProcedure(ev, "trace", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if proc.Type != lang.TypeClosure {
+		return lang.Value{}, fmt.Errorf("trace expects %s to name a closure, got %s", name, typeName(proc))
+	}
+	if err := ev.Trace(proc, name); err != nil {
+		return lang.Value{}, err
+	}
+	return lang.SymbolValue(name), nil
+}
+
+func primUntrace(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	_, proc, err := tracedProcedure(ev, "untrace", args)
+	if err != nil {
+		return lang.Value{}, err
+	}
+	return lang.BoolValue(ev.Untrace(proc)), nil
+}
+
+// primTraceContinuations switches the logging of call/cc captures and jumps
+// and returns the previous setting.
+func primTraceContinuations(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) != 1 {
+		return lang.Value{}, arityError("traceContinuations", 1, 1, len(args))
+	}
+	prev := ev.TraceContinuations
+	ev.TraceContinuations = lang.IsTruthy(args[0])
+	return lang.BoolValue(prev), nil
+}
+
+// tracedProcedure resolves the global binding named by a symbol or string.
+func tracedProcedure(ev *lang.Evaluator, name string, args []lang.Value) (string, lang.Value, error) {
+	if len(args) != 1 {
+		return "", lang.Value{}, arityError(name, 1, 1, len(args))
+	}
+	var target string
+	switch args[0].Type {
+	case lang.TypeSymbol:
+		target = args[0].Sym()
+	case lang.TypeString:
+		target = args[0].Str()
+	default:
+		return "", lang.Value{}, typeError(name, "symbol or string", args[0])
+	}
+	proc, err := ev.Global.Get(target)
+	if err != nil {
+		return "", lang.Value{}, err
+	}
+	return target, proc, nil
+}
@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTraceAndUntrace(t *testing.T) {
+	ev := NewEvaluator()
+	var out bytes.Buffer
+	ev.SetTraceOutput(&out)
+
+	src := `
+func fact(n) {
+	if n == 0 {
+		return 1
+	}
+	return n * fact(n - 1)
+}
+trace("fact")
+fact(2)
+`
+	val, err := EvaluateGispString(ev, src)
+	if err != nil {
+		t.Fatalf("traced evaluation failed: %v", err)
+	}
+	if val.Int() != 2 {
+		t.Fatalf("expected 2, got %v", val)
+	}
+	want := "(fact 2)\n  (fact 1)\n    (fact 0)\n    => 1\n  => 1\n=> 2\n"
+	if out.String() != want {
+		t.Fatalf("unexpected trace output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	val, err = EvaluateGispString(ev, `[untrace("fact"), untrace("fact"), fact(3)]`)
+	if err != nil {
+		t.Fatalf("untrace failed: %v", err)
+	}
+	if val.String() != "(#t #f 6)" {
+		t.Fatalf("unexpected untrace result %s", val.String())
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected no trace output after untrace, got %q", out.String())
+	}
+
+	errCases := []struct {
+		src     string
+		wantErr string
+	}{
+		{`trace("missing")`, "unbound variable: missing"},
+		{`trace("display")`, "trace expects display to name a closure, got primitive"},
+		{`trace(1)`, "trace expects symbol or string"},
+	}
+	for _, tc := range errCases {
+		if _, err := EvaluateGispString(ev, tc.src); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.src, tc.wantErr, err)
+		}
+	}
+}
+
+func TestTraceSurvivesEscapingContinuation(t *testing.T) {
+	ev := NewEvaluator()
+	var out bytes.Buffer
+	ev.SetTraceOutput(&out)
+
+	src := `
+(define (find-first pred lst)
+  (call/cc (lambda (k)
+    (define (walk l)
+      (if (pred (first l)) (k (first l)) (walk (rest l))))
+    (walk lst))))
+(define (even x) (= (% x 2) 0))
+(trace 'even)
+(list (find-first even '(1 4 5)) (even 3))
+`
+	if _, err := EvaluateReader(ev, strings.NewReader(src)); err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	want := "(even 1)\n=> #f\n(even 4)\n=> #t\n(even 3)\n=> #f\n"
+	if out.String() != want {
+		t.Fatalf("unexpected trace output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestTraceContinuations(t *testing.T) {
+	ev := NewEvaluator()
+	var out bytes.Buffer
+	ev.SetTraceOutput(&out)
+
+	src := `
+(define saved #f)
+(define (run)
+  (let ((r (call/cc (lambda (k) (set! saved k) 1))))
+    (if (< r 3) (saved (+ r 1)) r)))
+(list (traceContinuations #t) (+ 10 (run)) (traceContinuations #f) (call/cc (lambda (k) (k 5))))
+`
+	val, err := EvaluateReader(ev, strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if val.String() != "(#f 13 #t 5)" {
+		t.Fatalf("unexpected result %s", val.String())
+	}
+	want := "call/cc: capture #1 at depth 3\n" +
+		"call/cc: invoke #1 with 2, discarding 2 frames and resuming at depth 3\n" +
+		"call/cc: invoke #1 with 3, discarding 2 frames and resuming at depth 3\n"
+	if out.String() != want {
+		t.Fatalf("unexpected trace output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
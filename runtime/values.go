@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// Primitives with more than one result return them with
+// lang.MultipleValues, and callWithValues, the receive macro and Gisp's
+// `var q, r = divmod(a, b)` take them apart without building a list.
+
+func installValuesPrimitives(env *lang.Env) {
+	Register(env, "values", 0, true,
+		"values(x...) returns its arguments as multiple values.", primValues)
+	Register(env, "callWithValues", 2, false,
+		"callWithValues(producer, consumer) calls producer with no arguments and then consumer with the values it returned.", primCallWithValues)
+	Register(env, "divmod", 2, false,
+		"divmod(a, b) returns the quotient and remainder of integer division, truncated toward zero like %.", primDivmod)
+	Register(env, "partition", 2, false,
+		"partition(pred, list) returns the elements that satisfy pred and those that do not, as two lists.", primPartition)
+	Register(env, "parseInt", 1, true,
+		"parseInt(s, base) parses s as an integer in base (10 when omitted) and returns it with true, or 0 and false when s is not one.", primParseInt)
+}
+
+func primValues(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	return lang.MultipleValues(append([]lang.Value(nil), args...)...), nil
+}
+
+func primCallWithValues(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	consumer := args[1]
+	return lang.Callback(args[0], nil, func(res lang.Value) (lang.Value, error) {
+		return lang.TailCall(consumer, res.Values()), nil
+	}), nil
+}
+
+func primDivmod(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	a, err := requireIntegerArg("divmod", args[0])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	b, err := requireIntegerArg("divmod", args[1])
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if b.Type == lang.TypeInt && b.Int() == 0 {
+		return lang.Value{}, errors.New("divmod: division by zero")
+	}
+	if a.Type == lang.TypeInt && b.Type == lang.TypeInt && b.Int() != -1 {
+		return lang.MultipleValues(lang.IntValue(a.Int()/b.Int()), lang.IntValue(a.Int()%b.Int())), nil
+	}
+	q, r := new(big.Int).QuoRem(a.BigInt(), b.BigInt(), new(big.Int))
+	return lang.MultipleValues(lang.BigIntValue(q), lang.BigIntValue(r)), nil
+}
+
+func primPartition(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	var in, out []lang.Value
+	return scanList("partition", args[0], args[1], func(item lang.Value, match bool) bool {
+		if match {
+			in = append(in, item)
+		} else {
+			out = append(out, item)
+		}
+		return true
+	}, func() lang.Value {
+		return lang.MultipleValues(lang.List(in...), lang.List(out...))
+	})
+}
+
+func primParseInt(ev *lang.Evaluator, args []lang.Value) (lang.Value, error) {
+	if len(args) > 2 {
+		return lang.Value{}, arityError("parseInt", 1, 2, len(args))
+	}
+	if args[0].Type != lang.TypeString {
+		return lang.Value{}, typeError("parseInt", "string", args[0])
+	}
+	base := int64(10)
+	if len(args) == 2 {
+		if args[1].Type != lang.TypeInt {
+			return lang.Value{}, typeError("parseInt", "integer", args[1])
+		}
+		base = args[1].Int()
+		if base < 2 || base > 36 {
+			return lang.Value{}, errors.New("parseInt: base must be between 2 and 36")
+		}
+	}
+	s := args[0].Str()
+	if n, err := strconv.ParseInt(s, int(base), 64); err == nil {
+		return lang.MultipleValues(lang.IntValue(n), lang.BoolValue(true)), nil
+	}
+	if n, ok := new(big.Int).SetString(s, int(base)); ok {
+		return lang.MultipleValues(lang.BigIntValue(n), lang.BoolValue(true)), nil
+	}
+	return lang.MultipleValues(lang.IntValue(0), lang.BoolValue(false)), nil
+}
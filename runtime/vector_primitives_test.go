@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -145,3 +146,24 @@ func TestVectorPrimitives(t *testing.T) {
 		}
 	})
 }
+
+func TestAllocationLimit(t *testing.T) {
+	ev := NewEvaluator()
+	ev.MaxAlloc = 10
+
+	if _, err := EvaluateGispString(ev, `makeVector(10)`); err != nil {
+		t.Fatalf("makeVector at the limit failed: %v", err)
+	}
+	for _, src := range []string{`makeVector(11)`, `makeString(11, "x")`} {
+		_, err := EvaluateGispString(ev, src)
+		if !errors.Is(err, lang.ErrAllocLimit) || !strings.Contains(err.Error(), "exceeds limit 10") {
+			t.Fatalf("%s => %v, want allocation limit error", src, err)
+		}
+	}
+
+	// The default limit stops a runaway size before any memory is reserved.
+	ev.MaxAlloc = 0
+	if _, err := EvaluateGispString(ev, `makeVector(9223372036854775807)`); !errors.Is(err, lang.ErrAllocLimit) {
+		t.Fatalf("expected default allocation limit error, got %v", err)
+	}
+}
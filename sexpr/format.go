@@ -0,0 +1,168 @@
+package sexpr
+
+import (
+	"strings"
+
+	"github.com/sergev/gisp/lang"
+)
+
+// DefaultWidth is the line width used by Format when none is given.
+const DefaultWidth = 80
+
+// formatDepthLimit stops the pretty printer from recursing further; deeper
+// structure is printed flat, where Value.String elides it.
+const formatDepthLimit = 1000
+
+// bodyForms lists special forms whose trailing arguments form a body. The
+// value is the number of leading arguments kept on the line of the head;
+// the body is indented two columns past the opening parenthesis.
+var bodyForms = map[string]int{
+	"begin":          0,
+	"catch":          1,
+	"cond":           0,
+	"define":         1,
+	"define-macro":   1,
+	"lambda":         1,
+	"let":            1,
+	"unwind-protect": 1,
+}
+
+// Format renders v as indented text that fits within width columns where
+// possible. Lists that fit stay on one line; longer calls keep the first
+// argument next to the operator and align the rest beneath it, while
+// special forms such as define and lambda indent their bodies by two.
+func Format(v lang.Value, width int) string {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	f := &formatter{width: width}
+	f.format(v, 0, 0)
+	return f.out.String()
+}
+
+type formatter struct {
+	out   strings.Builder
+	width int
+}
+
+// format writes v assuming the cursor is at column col.
+func (f *formatter) format(v lang.Value, col, depth int) {
+	flat := v.String()
+	if col+len(flat) <= f.width || depth >= formatDepthLimit {
+		f.out.WriteString(flat)
+		return
+	}
+	switch v.Type {
+	case lang.TypePair:
+		items, err := lang.ToSlice(v)
+		if err != nil || len(items) < 2 {
+			f.out.WriteString(flat)
+			return
+		}
+		f.formatList(items, col, depth)
+	case lang.TypeVector:
+		f.out.WriteString("#(")
+		f.formatLines(v.Vector().Elements, col+2, depth)
+		f.out.WriteByte(')')
+	default:
+		f.out.WriteString(flat)
+	}
+}
+
+func (f *formatter) formatList(items []lang.Value, col, depth int) {
+	head := items[0]
+	f.out.WriteByte('(')
+	if head.Type != lang.TypeSymbol {
+		f.formatLines(items, col+1, depth)
+		f.out.WriteByte(')')
+		return
+	}
+	name := head.Sym()
+	f.out.WriteString(name)
+	args := items[1:]
+	if keep, ok := bodyForms[name]; ok {
+		if keep > len(args) {
+			keep = len(args)
+		}
+		pos := col + 1 + len(name)
+		for _, arg := range args[:keep] {
+			f.out.WriteByte(' ')
+			f.format(arg, pos+1, depth+1)
+			pos = f.column()
+		}
+		for _, arg := range args[keep:] {
+			f.newline(col + 2)
+			f.format(arg, col+2, depth+1)
+		}
+		f.out.WriteByte(')')
+		return
+	}
+	// Align arguments under the first one unless the operator is so long
+	// that there is little room left; then indent by two instead.
+	argCol := col + len(name) + 2
+	if argCol > f.width/2 {
+		for _, arg := range args {
+			f.newline(col + 2)
+			f.format(arg, col+2, depth+1)
+		}
+		f.out.WriteByte(')')
+		return
+	}
+	f.out.WriteByte(' ')
+	f.formatLines(args, argCol, depth)
+	f.out.WriteByte(')')
+}
+
+// formatLines writes items one per line, each starting at column col; the
+// first item continues the current line. Items that are all atoms are
+// instead packed onto as few lines as fit.
+func (f *formatter) formatLines(items []lang.Value, col, depth int) {
+	if allAtoms(items) {
+		f.fillAtoms(items, col)
+		return
+	}
+	for i, item := range items {
+		if i > 0 {
+			f.newline(col)
+		}
+		f.format(item, col, depth+1)
+	}
+}
+
+func (f *formatter) fillAtoms(items []lang.Value, col int) {
+	cur := f.column()
+	for i, item := range items {
+		text := item.String()
+		if i > 0 {
+			if cur+1+len(text) > f.width {
+				f.newline(col)
+				cur = col
+			} else {
+				f.out.WriteByte(' ')
+				cur++
+			}
+		}
+		f.out.WriteString(text)
+		cur += len(text)
+	}
+}
+
+func allAtoms(items []lang.Value) bool {
+	for _, item := range items {
+		if item.Type == lang.TypePair || item.Type == lang.TypeVector {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *formatter) newline(col int) {
+	f.out.WriteByte('\n')
+	f.out.WriteString(strings.Repeat(" ", col))
+}
+
+// column reports the cursor column after the text written so far.
+func (f *formatter) column() int {
+	s := f.out.String()
+	return len(s) - (strings.LastIndexByte(s, '\n') + 1)
+}
@@ -0,0 +1,106 @@
+package sexpr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sergev/gisp/lang"
+)
+
+func mustReadOne(t *testing.T, src string) lang.Value {
+	t.Helper()
+	forms, err := ReadString(src)
+	if err != nil {
+		t.Fatalf("ReadString(%q) returned error: %v", src, err)
+	}
+	if len(forms) != 1 {
+		t.Fatalf("ReadString(%q) returned %d forms, want 1", src, len(forms))
+	}
+	return forms[0]
+}
+
+func TestFormatLayout(t *testing.T) {
+	cases := []struct {
+		name  string
+		src   string
+		width int
+		want  string
+	}{
+		{
+			name:  "fits on one line",
+			src:   "(+ 1 (* 2 3))",
+			width: 80,
+			want:  "(+ 1 (* 2 3))",
+		},
+		{
+			name:  "body forms indent by two",
+			src:   "(define f (lambda (n) (begin (display n) (newline))))",
+			width: 30,
+			want: "(define f\n" +
+				"  (lambda (n)\n" +
+				"    (begin\n" +
+				"      (display n)\n" +
+				"      (newline))))",
+		},
+		{
+			name:  "arguments align under the first",
+			src:   "(if (< n 1) (display n) (newline))",
+			width: 20,
+			want: "(if (< n 1)\n" +
+				"    (display n)\n" +
+				"    (newline))",
+		},
+		{
+			name:  "atoms are packed",
+			src:   "(list 1 2 3 4 5 6 7 8 9 10)",
+			width: 16,
+			want: "(list 1 2 3 4 5\n" +
+				"      6 7 8 9 10)",
+		},
+		{
+			name:  "vector elements",
+			src:   "#((a b) (c d))",
+			width: 10,
+			want: "#((a b)\n" +
+				"  (c d))",
+		},
+		{
+			name:  "non-symbol head",
+			src:   "((lambda (x) x) 42)",
+			width: 12,
+			want: "((lambda (x)\n" +
+				"   x)\n" +
+				" 42)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Format(mustReadOne(t, tc.src), tc.width)
+			if got != tc.want {
+				t.Fatalf("Format(%s, %d) =\n%s\nwant\n%s", tc.src, tc.width, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatDefaultWidth(t *testing.T) {
+	v := mustReadOne(t, "(a b c)")
+	if got := Format(v, 0); got != "(a b c)" {
+		t.Fatalf("Format with zero width => %q", got)
+	}
+}
+
+func TestFormatDeepNesting(t *testing.T) {
+	v := lang.IntValue(0)
+	for i := 0; i < formatDepthLimit+50; i++ {
+		v = lang.List(lang.SymbolValue("f"), v)
+	}
+	got := Format(v, 40)
+	if !strings.HasPrefix(got, "(f (f") {
+		t.Fatalf("unexpected formatted prefix: %.20q", got)
+	}
+	if lines := strings.Count(got, "\n") + 1; lines > formatDepthLimit+1 {
+		t.Fatalf("expected nesting past the depth limit to stay flat, got %d lines", lines)
+	}
+}
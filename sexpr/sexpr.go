@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
 	"unicode"
@@ -150,6 +151,8 @@ func readExpr(sc *scanner) (lang.Value, error) {
 		return readString(sc)
 	case '#':
 		return readDispatch(sc)
+	case '{':
+		return readMap(sc)
 	default:
 		if unicode.IsSpace(r) {
 			return readExpr(sc)
@@ -173,13 +176,55 @@ func readDispatch(sc *scanner) (lang.Value, error) {
 	case 'f':
 		return lang.BoolValue(false), nil
 	case '(':
-		return readVector(sc)
+		return readVector(sc, ')')
+	case '[':
+		return readVector(sc, ']')
+	case '\\':
+		return readChar(sc)
 	default:
 		return lang.Value{}, fmt.Errorf("unknown dispatch sequence: #%c", r)
 	}
 }
 
-func readVector(sc *scanner) (lang.Value, error) {
+// readChar reads the character after #\: a single character such as #\a
+// or #\(, a name such as #\space, or a code point such as #\x3bb.
+func readChar(sc *scanner) (lang.Value, error) {
+	first, _, err := sc.read()
+	if err != nil {
+		if sc.isEOF(err) {
+			return lang.Value{}, errors.New("unterminated character literal")
+		}
+		return lang.Value{}, err
+	}
+	var builder strings.Builder
+	builder.WriteRune(first)
+	for {
+		r, w, err := sc.read()
+		if err != nil {
+			if sc.isEOF(err) {
+				break
+			}
+			return lang.Value{}, err
+		}
+		if unicode.IsSpace(r) || strings.ContainsRune("()[]{}\";,'`", r) {
+			sc.unread(r, w)
+			break
+		}
+		builder.WriteRune(r)
+	}
+	name := builder.String()
+	if name == string(first) {
+		return lang.CharValue(first), nil
+	}
+	if r, ok := lang.CharName(name); ok {
+		return lang.CharValue(r), nil
+	}
+	return lang.Value{}, fmt.Errorf("unknown character name #\\%s", name)
+}
+
+// readVector reads the elements of #(...) or #[...] up to the closing
+// delimiter.
+func readVector(sc *scanner, closer rune) (lang.Value, error) {
 	if err := sc.skipWhitespace(); err != nil {
 		if sc.isEOF(err) {
 			return lang.Value{}, errors.New("unterminated vector")
@@ -190,7 +235,7 @@ func readVector(sc *scanner) (lang.Value, error) {
 	if err != nil {
 		return lang.Value{}, err
 	}
-	if r == ')' {
+	if r == closer {
 		if _, _, err := sc.read(); err != nil {
 			return lang.Value{}, err
 		}
@@ -208,7 +253,7 @@ func readVector(sc *scanner) (lang.Value, error) {
 		if err != nil {
 			return lang.Value{}, err
 		}
-		if next == ')' {
+		if next == closer {
 			if _, _, err := sc.read(); err != nil {
 				return lang.Value{}, err
 			}
@@ -223,6 +268,109 @@ func readVector(sc *scanner) (lang.Value, error) {
 	return lang.VectorValue(elems), nil
 }
 
+// readMap reads a map literal {key: value, ...}. A bare word before the
+// colon is a symbol key unless it is a number; other keys, such as strings,
+// are read as data. Entries may be separated by commas.
+func readMap(sc *scanner) (lang.Value, error) {
+	m := lang.NewMap()
+	for {
+		if err := sc.skipWhitespace(); err != nil {
+			if sc.isEOF(err) {
+				return lang.Value{}, errors.New("unterminated map")
+			}
+			return lang.Value{}, err
+		}
+		r, _, err := sc.peek()
+		if err != nil {
+			return lang.Value{}, err
+		}
+		if r == '}' {
+			if _, _, err := sc.read(); err != nil {
+				return lang.Value{}, err
+			}
+			return lang.MapValue(m), nil
+		}
+		key, err := readMapKey(sc)
+		if err != nil {
+			return lang.Value{}, err
+		}
+		val, err := readExpr(sc)
+		if err != nil {
+			if sc.isEOF(err) {
+				return lang.Value{}, errors.New("unterminated map")
+			}
+			return lang.Value{}, err
+		}
+		if err := m.Set(key, val); err != nil {
+			return lang.Value{}, err
+		}
+		if err := sc.skipWhitespace(); err != nil {
+			if sc.isEOF(err) {
+				return lang.Value{}, errors.New("unterminated map")
+			}
+			return lang.Value{}, err
+		}
+		if next, _, err := sc.peek(); err == nil && next == ',' {
+			if _, _, err := sc.read(); err != nil {
+				return lang.Value{}, err
+			}
+		}
+	}
+}
+
+// readMapKey reads a map key and the colon that follows it.
+func readMapKey(sc *scanner) (lang.Value, error) {
+	r, _, err := sc.peek()
+	if err != nil {
+		return lang.Value{}, err
+	}
+	var key lang.Value
+	if r == '"' || r == '#' || r == '(' {
+		if key, err = readExpr(sc); err != nil {
+			return lang.Value{}, err
+		}
+	} else {
+		var builder strings.Builder
+		for {
+			r, w, err := sc.read()
+			if err != nil {
+				if sc.isEOF(err) {
+					return lang.Value{}, errors.New("unterminated map")
+				}
+				return lang.Value{}, err
+			}
+			if r == ':' || unicode.IsSpace(r) || strings.ContainsRune("()\"';,]}", r) {
+				sc.unread(r, w)
+				break
+			}
+			builder.WriteRune(r)
+		}
+		token := builder.String()
+		if token == "" {
+			return lang.Value{}, fmt.Errorf("expected map key, got %q", r)
+		}
+		if num, ok := tryNumber(token); ok {
+			key = num
+		} else {
+			key = lang.SymbolValue(token)
+		}
+	}
+	if err := sc.skipWhitespace(); err != nil {
+		if sc.isEOF(err) {
+			return lang.Value{}, errors.New("unterminated map")
+		}
+		return lang.Value{}, err
+	}
+	colon, _, err := sc.read()
+	if err != nil {
+		return lang.Value{}, err
+	}
+	if colon != ':' {
+		return lang.Value{}, fmt.Errorf("expected : after map key %s, got %q", key.String(), colon)
+	}
+	return key, nil
+}
+
 func readList(sc *scanner) (lang.Value, error) {
 	if err := sc.skipWhitespace(); err != nil {
 		if sc.isEOF(err) {
@@ -365,6 +513,10 @@ func readString(sc *scanner) (lang.Value, error) {
 func tryNumber(token string) (lang.Value, bool) {
 	if i, err := strconv.ParseInt(token, 10, 64); err == nil {
 		return lang.IntValue(i), true
+	} else if errors.Is(err, strconv.ErrRange) {
+		if b, ok := new(big.Int).SetString(token, 10); ok {
+			return lang.BigIntValue(b), true
+		}
 	}
 	if f, err := strconv.ParseFloat(token, 64); err == nil {
 		return lang.RealValue(f), true
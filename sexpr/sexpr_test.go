@@ -2,6 +2,8 @@ package sexpr
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"strings"
 	"testing"
 
@@ -40,6 +42,17 @@ func TestReadStringSuccessCases(t *testing.T) {
 				lang.BoolValue(false),
 			},
 		},
+		{
+			name:  "Characters",
+			input: `#\a #\space #\x3bb #\( (#\))`,
+			want: []lang.Value{
+				lang.CharValue('a'),
+				lang.CharValue(' '),
+				lang.CharValue('λ'),
+				lang.CharValue('('),
+				lang.PairValue(lang.CharValue(')'), lang.EmptyList),
+			},
+		},
 		{
 			name:  "StringsWithEscapes",
 			input: `"hello\nworld" "tab\tquote\" backslash\\"`,
@@ -107,6 +120,26 @@ func TestReadStringSuccessCases(t *testing.T) {
 				}),
 			},
 		},
+		{
+			name:  "BracketVectorLiteral",
+			input: "#[1 (2 3)]",
+			want: []lang.Value{
+				lang.VectorValue([]lang.Value{
+					lang.IntValue(1),
+					lang.List(lang.IntValue(2), lang.IntValue(3)),
+				}),
+			},
+		},
+		{
+			name:  "MapLiteral",
+			input: `{b: 1, "a": (x), 2:#t 1.5 : {}}`,
+			want:  []lang.Value{mapOf(lang.SymbolValue("b"), lang.IntValue(1), lang.StringValue("a"), lang.List(lang.SymbolValue("x")), lang.IntValue(2), lang.BoolValue(true), lang.RealValue(1.5), mapOf())},
+		},
+		{
+			name:  "IntegersBeyondInt64",
+			input: "9223372036854775807 9223372036854775808 -9223372036854775809",
+			want:  []lang.Value{lang.IntValue(math.MaxInt64), bigInt("9223372036854775808"), bigInt("-9223372036854775809")},
+		},
 		{
 			name:  "CommentWithoutNewlineAtEOF",
 			input: "; trailing comment without newline",
@@ -229,6 +262,12 @@ func TestReadStringErrorCases(t *testing.T) {
 		{name: "DottedListMisuse", input: "(a . b c)", sub: "expected )"},
 		{name: "UnterminatedString", input: `"unterminated`, sub: "unterminated string"},
 		{name: "UnterminatedVector", input: "#(1 2", sub: "unterminated vector"},
+		{name: "UnterminatedBracketVector", input: "#[1 2", sub: "unterminated vector"},
+		{name: "UnterminatedMap", input: "{a: 1", sub: "unterminated map"},
+		{name: "MapKeyWithoutColon", input: "{a 1}", sub: "expected : after map key a"},
+		{name: "UnhashableMapKey", input: "{(1): 2}", sub: "pair cannot be used as a map key"},
+		{name: "UnknownCharName", input: `#\bell`, sub: `unknown character name #\bell`},
+		{name: "MissingChar", input: `#\`, sub: "unterminated character literal"},
 	}
 
 	for _, tc := range cases {
@@ -272,6 +311,11 @@ func TestParseLiteralCommentWithoutNewlineErrors(t *testing.T) {
 	}
 }
 
+func bigInt(digits string) lang.Value {
+	b, _ := new(big.Int).SetString(digits, 10)
+	return lang.BigIntValue(b)
+}
+
 func valuesEqual(a, b lang.Value) bool {
 	if a.Type != b.Type {
 		return false
@@ -283,12 +327,16 @@ func valuesEqual(a, b lang.Value) bool {
 		return a.Bool() == b.Bool()
 	case lang.TypeInt:
 		return a.Int() == b.Int()
+	case lang.TypeBigInt:
+		return a.BigInt().Cmp(b.BigInt()) == 0
 	case lang.TypeReal:
 		return a.Real() == b.Real()
 	case lang.TypeString:
 		return a.Str() == b.Str()
 	case lang.TypeSymbol:
 		return a.Sym() == b.Sym()
+	case lang.TypeChar:
+		return a.Char() == b.Char()
 	case lang.TypePair:
 		ap := a.Pair()
 		bp := b.Pair()
@@ -311,6 +359,9 @@ func valuesEqual(a, b lang.Value) bool {
 			}
 		}
 		return true
+	case lang.TypeMap:
+		// Printing lists the entries in order, so it checks that too.
+		return a.String() == b.String()
 	default:
 		return false
 	}
@@ -324,3 +375,13 @@ func valueString(v lang.Value) string {
 		return v.String()
 	}
 }
+
+func mapOf(kvs ...lang.Value) lang.Value {
+	m := lang.NewMap()
+	for i := 0; i < len(kvs); i += 2 {
+		if err := m.Set(kvs[i], kvs[i+1]); err != nil {
+			panic(err)
+		}
+	}
+	return lang.MapValue(m)
+}